@@ -26,6 +26,7 @@ pre_target_build()
 	local ROSINC=$($CC_FOR_TARGET --print-sysroot)/usr/include
 	cd runtime
 	cp $ROSINC/ros/bits/syscall.h zsyscall_${GOOS}.h
+	../syscall/mksysnum_${GOOS}.pl -runtime $ROSINC/ros/bits/syscall.h > zsysnames_${GOOS}.go
 	$GOTOOLDIR/go_bootstrap tool cgo -cdefs defs_${GOOS}.go defsbogus_${GOOS}.go > defs_${GOOS}_${GOARCH}.h
 	$GOTOOLDIR/go_bootstrap tool cgo -godefs defs_${GOOS}.go > parlib/zdefs_${GOOS}_${GOARCH}.go
 	rm -rf _obj
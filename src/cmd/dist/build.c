@@ -1319,6 +1319,7 @@ static char *buildorder[] = {
 	// often.
 	"runtime",
 	"errors",
+	"internal/oserror",
 	"sync/atomic",
 	"sync",
 	"io",
@@ -1401,6 +1402,7 @@ static char *cleantab[] = {
 	"go/parser",
 	"go/scanner",
 	"go/token",
+	"internal/oserror",
 	"io",
 	"io/ioutil",
 	"log",
@@ -0,0 +1,16 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rand
+
+import "internal/syscall"
+
+func init() {
+	altGetRandom = getRandomAkaros
+}
+
+func getRandomAkaros(p []byte) (ok bool) {
+	n, err := syscall.GetRandom(p, 0)
+	return n == len(p) && err == nil
+}
@@ -22,14 +22,17 @@ import (
 
 const urandomDevice = "/dev/urandom"
 
+// The Akaros kernel generator, also read directly by altGetRandom.
+const akarosRandomDevice = "#random/urandom"
+
 // Easy implementation: read from /dev/urandom.
-// This is sufficient on Linux, OS X, and FreeBSD.
+// This is sufficient on Linux, OS X, FreeBSD and Akaros.
 
 func init() {
 	if runtime.GOOS == "plan9" {
 		Reader = newReader(nil)
 	} else if runtime.GOOS == "akaros" {
-		Reader = newReader(&devReader{name: "#random/urandom"})
+		Reader = &devReader{name: akarosRandomDevice}
 	} else {
 		Reader = &devReader{name: urandomDevice}
 	}
@@ -47,7 +50,7 @@ type devReader struct {
 var altGetRandom func([]byte) (ok bool)
 
 func (r *devReader) Read(b []byte) (n int, err error) {
-	if altGetRandom != nil && r.name == urandomDevice && altGetRandom(b) {
+	if altGetRandom != nil && (r.name == urandomDevice || r.name == akarosRandomDevice) && altGetRandom(b) {
 		return len(b), nil
 	}
 	r.mu.Lock()
@@ -120,10 +120,13 @@ var pkgDeps = map[string][]string{
 
 	// End of linear dependency definitions.
 
+	// The errors shared by os and syscall.
+	"internal/oserror": {"errors"},
+
 	// Operating system access.
-	"syscall":       {"L0", "unicode/utf16"},
+	"syscall":       {"L0", "internal/oserror", "unicode/utf16"},
 	"time":          {"L0", "syscall"},
-	"os":            {"L1", "os", "syscall", "time"},
+	"os":            {"L1", "internal/oserror", "os", "syscall", "time"},
 	"path/filepath": {"L2", "os", "syscall"},
 	"io/ioutil":     {"L2", "os", "path/filepath", "time"},
 	"os/exec":       {"L2", "os", "path/filepath", "syscall"},
@@ -148,12 +151,15 @@ var pkgDeps = map[string][]string{
 	"regexp/syntax":  {"L2"},
 	"runtime/debug":  {"L2", "fmt", "io/ioutil", "os", "time"},
 	"runtime/pprof":  {"L2", "fmt", "text/tabwriter"},
+	"runtime/trace":  {"L0"},
 	"text/tabwriter": {"L2"},
 
-	"testing":        {"L2", "flag", "fmt", "os", "runtime/pprof", "time"},
+	"testing":        {"L2", "flag", "fmt", "os", "runtime/pprof", "syscall", "time"},
 	"testing/iotest": {"L2", "log"},
 	"testing/quick":  {"L2", "flag", "fmt", "reflect"},
 
+	"runtime/pprof/multiproc": {"L2", "OS", "encoding/binary", "fmt", "runtime/pprof", "syscall", "time"},
+
 	// L4 is defined as L3+fmt+log+time, because in general once
 	// you're using L3 packages, use of fmt, log, or time is not a big deal.
 	"L4": {
@@ -0,0 +1,65 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+import (
+	"sync"
+	stdsyscall "syscall"
+)
+
+// GetRandomFlag is a flag supported by GetRandom.
+type GetRandomFlag uintptr
+
+const (
+	// GRND_NONBLOCK means return EAGAIN rather than blocking.
+	// The Akaros random device never blocks, so it has no effect.
+	GRND_NONBLOCK GetRandomFlag = 0x0001
+
+	// GRND_RANDOM means use #random/random instead of #random/urandom.
+	GRND_RANDOM GetRandomFlag = 0x0002
+)
+
+// Akaros has no getrandom system call; its kernel generator is read
+// through the #random device.  The descriptors are opened on first use
+// and kept, so that GetRandom keeps working when the process is out of
+// descriptors or has changed its namespace.
+var random [2]struct {
+	once sync.Once
+	fd   int
+	err  error
+}
+
+// GetRandom fills p from the kernel random number generator, behaving
+// like the Linux getrandom system call.
+func GetRandom(p []byte, flags GetRandomFlag) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	i, name := 0, "#random/urandom"
+	if flags&GRND_RANDOM != 0 {
+		i, name = 1, "#random/random"
+	}
+	r := &random[i]
+	r.once.Do(func() {
+		r.fd, r.err = stdsyscall.Open(name, stdsyscall.O_RDONLY|stdsyscall.O_CLOEXEC, 0)
+	})
+	if r.err != nil {
+		return 0, r.err
+	}
+	for n < len(p) {
+		m, err := stdsyscall.Read(r.fd, p[n:])
+		if err == stdsyscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if m <= 0 {
+			return n, stdsyscall.EIO
+		}
+		n += m
+	}
+	return n, nil
+}
@@ -23,7 +23,11 @@ type netFD struct {
 	ctl, data    *os.File
 	laddr, raddr Addr
 
-	// Deadline stuff
+	// data's descriptor, when the poller has it
+	sysfd int
+	pd    pollDesc
+
+	// Deadline stuff, for a data file the poller could not take
 	readDeadline  int64
 	writeDeadline int64
 }
@@ -43,12 +47,28 @@ func dial(net string, ra Addr, dialer func(time.Time) (Conn, error), deadline ti
 }
 
 func newFD(proto, name string, ctl, data *os.File, laddr, raddr Addr) (*netFD, error) {
-	return &netFD{proto: proto, n: name, dir: netdir + "/" + proto + "/" + name, ctl: ctl, data: data, laddr: laddr, raddr: raddr}, nil
+	fd := &netFD{proto: proto, n: name, dir: netdir + "/" + proto + "/" + name, ctl: ctl, data: data, laddr: laddr, raddr: raddr, sysfd: -1}
+	fd.init()
+	return fd, nil
 }
 
-func (fd *netFD) init() error {
-	// stub for future fd.pd.Init(fd)
-	return nil
+// init hands the data file to the poller, which polls descriptors with
+// FD taps (see runtime/netpoll_akaros.c).  If the kernel has no FD taps,
+// or the poller cannot take the file, it stays in blocking mode and I/O
+// on it blocks an M, bounded by syscall.RunWithDeadline.
+func (fd *netFD) init() {
+	if fd.data == nil || !syscall.HasFeature(syscall.FeatureFdTaps) {
+		return
+	}
+	sysfd := int(fd.data.Fd())
+	if syscall.SetNonblock(sysfd, true) != nil {
+		return
+	}
+	fd.sysfd = sysfd
+	if err := fd.pd.Init(fd); err != nil || !fd.pd.Polled() {
+		syscall.SetNonblock(sysfd, false)
+		fd.sysfd = -1
+	}
 }
 
 func (fd *netFD) name() string {
@@ -68,6 +88,7 @@ func (fd *netFD) destroy() {
 	if !fd.ok() {
 		return
 	}
+	fd.pd.Close()
 	err := fd.ctl.Close()
 	if fd.data != nil {
 		if err1 := fd.data.Close(); err1 != nil && err == nil {
@@ -127,15 +148,28 @@ func (fd *netFD) writeUnlock() {
 	}
 }
 
-func convertErr(e error) error {
-	switch e := e.(type) {
-	case *os.PathError:
-		switch e := e.Err.(type) {
-		case *syscall.AkaError:
-			if e.Timeout() {
-				return errTimeout
-			}
-		}
+// Polled reports whether the poller has the data file.
+func (pd *pollDesc) Polled() bool {
+	return pd.runtimeCtx != 0
+}
+
+// isEAGAIN reports whether a non-blocking call failed for want of data or
+// buffer space.
+func isEAGAIN(err error) bool {
+	if e, ok := err.(*syscall.AkaError); ok {
+		return e.Errno() == syscall.EAGAIN
+	}
+	return err == syscall.EAGAIN
+}
+
+// abortErr turns a call aborted by a deadline into errTimeout.
+func abortErr(e error) error {
+	err := e
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	if ae, ok := err.(*syscall.AkaError); ok && ae.Timeout() {
+		return errTimeout
 	}
 	return e
 }
@@ -144,6 +178,9 @@ func (fd *netFD) Read(b []byte) (n int, err error) {
 	if !fd.ok() || fd.data == nil {
 		return 0, syscall.EINVAL
 	}
+	if fd.pd.Polled() {
+		return fd.pollRead(b)
+	}
 	if fd.readDeadline > 0 && time.Now().UnixNano()/1000 > fd.readDeadline {
 		n = 0
 		err = errTimeout
@@ -156,7 +193,7 @@ func (fd *netFD) Read(b []byte) (n int, err error) {
 	syscall.RunWithDeadline(func() {
 		n, err = fd.data.Read(b)
 	}, fd.readDeadline)
-	err = convertErr(err)
+	err = abortErr(err)
 	if fd.proto == "udp" && err == io.EOF {
 		n = 0
 		err = nil
@@ -168,6 +205,9 @@ func (fd *netFD) Write(b []byte) (n int, err error) {
 	if !fd.ok() || fd.data == nil {
 		return 0, syscall.EINVAL
 	}
+	if fd.pd.Polled() {
+		return fd.pollWrite(b)
+	}
 	if fd.writeDeadline > 0 && time.Now().UnixNano()/1000 > fd.writeDeadline {
 		n = 0
 		err = errTimeout
@@ -180,10 +220,72 @@ func (fd *netFD) Write(b []byte) (n int, err error) {
 	syscall.RunWithDeadline(func() {
 		n, err = fd.data.Write(b)
 	}, fd.writeDeadline)
-	err = convertErr(err)
+	err = abortErr(err)
+	return
+}
+
+func (fd *netFD) pollRead(b []byte) (n int, err error) {
+	if err := fd.readLock(); err != nil {
+		return 0, err
+	}
+	defer fd.readUnlock()
+	if err := fd.pd.PrepareRead(); err != nil {
+		return 0, &OpError{"read", fd.dir, fd.raddr, err}
+	}
+	for {
+		n, err = syscall.Read(fd.sysfd, b)
+		if err != nil {
+			n = 0
+			if isEAGAIN(err) {
+				if err = fd.pd.WaitRead(); err == nil {
+					continue
+				}
+			}
+		}
+		break
+	}
+	if n == 0 && err == nil && len(b) > 0 && fd.proto != "udp" {
+		err = io.EOF
+	}
+	if err != nil && err != io.EOF {
+		err = &OpError{"read", fd.dir, fd.raddr, err}
+	}
 	return
 }
 
+func (fd *netFD) pollWrite(b []byte) (nn int, err error) {
+	if err := fd.writeLock(); err != nil {
+		return 0, err
+	}
+	defer fd.writeUnlock()
+	if err := fd.pd.PrepareWrite(); err != nil {
+		return 0, &OpError{"write", fd.dir, fd.raddr, err}
+	}
+	for nn < len(b) {
+		var n int
+		n, err = syscall.Write(fd.sysfd, b[nn:])
+		if n > 0 {
+			nn += n
+		}
+		if err != nil {
+			if isEAGAIN(err) {
+				if err = fd.pd.WaitWrite(); err == nil {
+					continue
+				}
+			}
+			break
+		}
+		if n == 0 {
+			err = io.ErrUnexpectedEOF
+			break
+		}
+	}
+	if err != nil {
+		err = &OpError{"write", fd.dir, fd.raddr, err}
+	}
+	return nn, err
+}
+
 func (fd *netFD) closeRead() error {
 	if !fd.ok() {
 		return syscall.EINVAL
@@ -205,6 +307,13 @@ func (fd *netFD) Close() error {
 	if !fd.ok() {
 		return syscall.EINVAL
 	}
+	// Unblock any I/O parked in the poller.  Once it is gone, and with
+	// it the last reference, destroy closes the files.
+	if fd.pd.Polled() {
+		fd.pd.Evict()
+		fd.decref()
+		return nil
+	}
 	fd.ctl.AbortOutstandingSyscalls()
 	err := fd.ctl.Close()
 	if fd.data != nil {
@@ -234,26 +343,48 @@ func (l *TCPListener) dup() (*os.File, error) {
 }
 
 func (fd *netFD) file(f *os.File, s string) (*os.File, error) {
-	dfd, err := syscall.Dup(int(f.Fd()))
+	dfd, err := syscall.DupCloseOnExec(int(f.Fd()))
 	if err != nil {
 		return nil, &OpError{"dup", s, fd.laddr, err}
 	}
+	// The copy is handed out for blocking I/O.
+	if f == fd.data && fd.pd.Polled() {
+		if err := syscall.SetNonblock(dfd, false); err != nil {
+			syscall.Close(dfd)
+			return nil, &OpError{"setnonblock", s, fd.laddr, err}
+		}
+	}
 	return os.NewFile(uintptr(dfd), s), nil
 }
 
 func (fd *netFD) setDeadline(t time.Time) error {
 	fd.readDeadline = t.UnixNano() / 1000
 	fd.writeDeadline = fd.readDeadline
-	return nil
+	return fd.setPollDeadline(t, 'r'+'w')
 }
 
 func (fd *netFD) setReadDeadline(t time.Time) error {
 	fd.readDeadline = t.UnixNano() / 1000
-	return nil
+	return fd.setPollDeadline(t, 'r')
 }
 
 func (fd *netFD) setWriteDeadline(t time.Time) error {
 	fd.writeDeadline = t.UnixNano() / 1000
+	return fd.setPollDeadline(t, 'w')
+}
+
+func (fd *netFD) setPollDeadline(t time.Time, mode int) error {
+	d := runtimeNano() + int64(t.Sub(time.Now()))
+	if t.IsZero() {
+		d = 0
+	}
+	if err := fd.incref(); err != nil {
+		return err
+	}
+	if fd.pd.Polled() {
+		runtime_pollSetDeadline(fd.pd.runtimeCtx, d, mode)
+	}
+	fd.decref()
 	return nil
 }
 
@@ -0,0 +1,89 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+// pollerConns returns both ends of a TCP connection, skipping the test
+// unless the poller has them.
+func pollerConns(t *testing.T) (c, s *TCPConn) {
+	if !syscall.HasFeature(syscall.FeatureFdTaps) {
+		t.Skip("kernel has no FD taps")
+	}
+	ln, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	cc, err := Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := ln.Accept()
+	if err != nil {
+		cc.Close()
+		t.Fatal(err)
+	}
+	c, s = cc.(*TCPConn), sc.(*TCPConn)
+	if !c.fd.pd.Polled() || !s.fd.pd.Polled() {
+		c.Close()
+		s.Close()
+		t.Fatal("poller did not take the connection")
+	}
+	return c, s
+}
+
+func TestPollerReadWrite(t *testing.T) {
+	c, s := pollerConns(t)
+	defer c.Close()
+	defer s.Close()
+	// The read parks in the poller until the write arrives.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c.Write([]byte("hello"))
+	}()
+	var buf [16]byte
+	n, err := s.Read(buf[:])
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("Read = %q, %v; want %q, nil", buf[:n], err, "hello")
+	}
+}
+
+func TestPollerDeadline(t *testing.T) {
+	c, s := pollerConns(t)
+	defer c.Close()
+	defer s.Close()
+	s.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	var buf [16]byte
+	_, err := s.Read(buf[:])
+	if ne, ok := err.(Error); !ok || !ne.Timeout() {
+		t.Fatalf("Read past deadline = %v, want timeout", err)
+	}
+}
+
+func TestPollerCloseUnblocks(t *testing.T) {
+	c, s := pollerConns(t)
+	defer c.Close()
+	errc := make(chan error, 1)
+	go func() {
+		var buf [16]byte
+		_, err := s.Read(buf[:])
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Fatal("Read after Close succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not unblock a parked Read")
+	}
+}
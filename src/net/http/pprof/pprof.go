@@ -34,6 +34,14 @@
 //
 //	go tool pprof http://localhost:6060/debug/pprof/block
 //
+// Any of the profiles, the CPU profile included, is served in the
+// profile.proto format instead when the request adds proto=1.
+//
+// On Akaros, the syscall profile lists the system calls the kernel has
+// yet to complete.  A heap census (see runtime/pprof.HeapCensus), small
+// enough for machines that cannot hold a heap dump, is served at
+// /debug/pprof/census.
+//
 // To view all available profiles, open http://localhost:6060/debug/pprof/
 // in your browser.
 //
@@ -64,6 +72,7 @@ func init() {
 	http.Handle("/debug/pprof/cmdline", http.HandlerFunc(Cmdline))
 	http.Handle("/debug/pprof/profile", http.HandlerFunc(Profile))
 	http.Handle("/debug/pprof/symbol", http.HandlerFunc(Symbol))
+	http.Handle("/debug/pprof/census", http.HandlerFunc(Census))
 }
 
 // Cmdline responds with the running program's
@@ -82,10 +91,15 @@ func Profile(w http.ResponseWriter, r *http.Request) {
 		sec = 30
 	}
 
+	start := pprof.StartCPUProfile
+	if proto, _ := strconv.Atoi(r.FormValue("proto")); proto > 0 {
+		start = pprof.StartCPUProfileProto
+	}
+
 	// Set Content Type assuming StartCPUProfile will work,
 	// because if it does it starts writing.
 	w.Header().Set("Content-Type", "application/octet-stream")
-	if err := pprof.StartCPUProfile(w); err != nil {
+	if err := start(w); err != nil {
 		// StartCPUProfile failed, so no writes yet.
 		// Can change header back to text content
 		// and send error code.
@@ -166,10 +180,30 @@ func (name handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if name == "heap" && gc > 0 {
 		runtime.GC()
 	}
+	if proto, _ := strconv.Atoi(r.FormValue("proto")); proto > 0 {
+		var buf bytes.Buffer
+		if err := p.WriteProtoTo(&buf); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "%s\n", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(buf.Bytes())
+		return
+	}
 	p.WriteTo(w, debug)
 	return
 }
 
+// Census responds with a census of the live heap, taken after a garbage
+// collection.  The package initialization registers it as
+// /debug/pprof/census.
+func Census(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	pprof.TakeHeapCensus().WriteTo(w, debug)
+}
+
 // Index responds with the pprof-formatted profile named by the request.
 // For example, "/debug/pprof/heap" serves the "heap" profile.
 // Index responds to a request for "/debug/pprof/" with an HTML page
@@ -183,12 +217,30 @@ func Index(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	profiles := pprof.Profiles()
+	var profiles []profileEntry
+	for _, p := range pprof.Profiles() {
+		profiles = append(profiles, profileEntry{p.Name(), p.Count(), profileDescriptions[p.Name()]})
+	}
 	if err := indexTmpl.Execute(w, profiles); err != nil {
 		log.Print(err)
 	}
 }
 
+type profileEntry struct {
+	Name  string
+	Count int
+	Desc  string
+}
+
+var profileDescriptions = map[string]string{
+	"block":        "Stack traces that led to blocking on synchronization primitives",
+	"goroutine":    "Stack traces of all current goroutines",
+	"heap":         "A sampling of memory allocations of live objects",
+	"mutex":        "Stack traces of holders of contended mutexes",
+	"syscall":      "System calls the kernel has not completed yet (Akaros only)",
+	"threadcreate": "Stack traces that led to the creation of new OS threads",
+}
+
 var indexTmpl = template.Must(template.New("index").Parse(`<html>
 <head>
 <title>/debug/pprof/</title>
@@ -199,11 +251,13 @@ var indexTmpl = template.Must(template.New("index").Parse(`<html>
 profiles:<br>
 <table>
 {{range .}}
-<tr><td align=right>{{.Count}}<td><a href="/debug/pprof/{{.Name}}?debug=1">{{.Name}}</a>
+<tr><td align=right>{{.Count}}<td><a href="/debug/pprof/{{.Name}}?debug=1">{{.Name}}</a><td>{{.Desc}}
 {{end}}
 </table>
 <br>
 <a href="/debug/pprof/goroutine?debug=2">full goroutine stack dump</a><br>
+<a href="/debug/pprof/census?debug=1">heap census</a><br>
+<a href="/debug/pprof/profile?seconds=30">30-second CPU profile</a><br>
 </body>
 </html>
 `))
@@ -173,12 +173,20 @@ func dialPlan9(net string, laddr, raddr Addr) (fd *netFD, err error) {
 	return newFD(proto, name, f, data, laddr, raddr)
 }
 
-func listenPlan9(net string, laddr Addr) (fd *netFD, err error) {
+// listenPlan9 announces on laddr, first writing the control messages ctl
+// to the new conversation.
+func listenPlan9(net string, laddr Addr, ctl ...string) (fd *netFD, err error) {
 	defer func() { netErr(err) }()
 	f, dest, proto, name, err := startPlan9(net, laddr)
 	if err != nil {
 		return nil, &OpError{"listen", net, laddr, err}
 	}
+	for _, msg := range ctl {
+		if _, err = f.WriteString(msg); err != nil {
+			f.Close()
+			return nil, &OpError{"listen", net, laddr, err}
+		}
+	}
 	_, err = f.WriteString("announce " + dest)
 	if err != nil {
 		f.Close()
@@ -0,0 +1,70 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+// A ListenConfig holds options for announcing on an Internet address.
+//
+// The Akaros IP stack refuses to announce on a port that another
+// conversation holds.  ReuseAddr and ReusePort relax that, by writing
+// the "reuseaddr" and "reuseport" control messages to the conversation
+// before it announces.  A stack that does not know them fails the
+// Listen; nothing is silently ignored.
+type ListenConfig struct {
+	// ReuseAddr lets the listener take a port still held by the
+	// connections of an earlier listener, as after a server restart.
+	ReuseAddr bool
+
+	// ReusePort lets several listeners, in this or other processes,
+	// announce on the same port if each sets ReusePort.  The stack
+	// spreads incoming connections or datagrams among them.
+	ReusePort bool
+}
+
+func (lc *ListenConfig) ctl() []string {
+	var msgs []string
+	if lc.ReuseAddr {
+		msgs = append(msgs, "reuseaddr")
+	}
+	if lc.ReusePort {
+		msgs = append(msgs, "reuseport")
+	}
+	return msgs
+}
+
+// Listen is like the package function Listen but applies lc.  The
+// network must be "tcp", "tcp4" or "tcp6".
+func (lc *ListenConfig) Listen(net, laddr string) (Listener, error) {
+	la, err := resolveAddr("listen", net, laddr, noDeadline)
+	if err != nil {
+		return nil, &OpError{Op: "listen", Net: net, Addr: nil, Err: err}
+	}
+	a, ok := la.toAddr().(*TCPAddr)
+	if !ok {
+		return nil, &OpError{Op: "listen", Net: net, Addr: la.toAddr(), Err: UnknownNetworkError(net)}
+	}
+	l, err := listenTCP(net, a, lc.ctl()...)
+	if err != nil {
+		return nil, err // l is non-nil interface containing nil pointer
+	}
+	return l, nil
+}
+
+// ListenPacket is like the package function ListenPacket but applies
+// lc.  The network must be "udp", "udp4" or "udp6".
+func (lc *ListenConfig) ListenPacket(net, laddr string) (PacketConn, error) {
+	la, err := resolveAddr("listen", net, laddr, noDeadline)
+	if err != nil {
+		return nil, &OpError{Op: "listen", Net: net, Addr: nil, Err: err}
+	}
+	a, ok := la.toAddr().(*UDPAddr)
+	if !ok {
+		return nil, &OpError{Op: "listen", Net: net, Addr: la.toAddr(), Err: UnknownNetworkError(net)}
+	}
+	c, err := listenUDP(net, a, lc.ctl()...)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -182,6 +182,10 @@ func (l *TCPListener) File() (f *os.File, err error) { return l.dup() }
 // port of 0, ListenTCP will choose an available port.  The caller can
 // use the Addr method of TCPListener to retrieve the chosen address.
 func ListenTCP(net string, laddr *TCPAddr) (*TCPListener, error) {
+	return listenTCP(net, laddr)
+}
+
+func listenTCP(net string, laddr *TCPAddr, ctl ...string) (*TCPListener, error) {
 	switch net {
 	case "tcp", "tcp4", "tcp6":
 	default:
@@ -190,7 +194,7 @@ func ListenTCP(net string, laddr *TCPAddr) (*TCPListener, error) {
 	if laddr == nil {
 		laddr = &TCPAddr{}
 	}
-	fd, err := listenPlan9(net, laddr)
+	fd, err := listenPlan9(net, laddr, ctl...)
 	if err != nil {
 		return nil, err
 	}
@@ -172,6 +172,10 @@ func unmarshalUDPHeader(b []byte) (*udpHeader, []byte) {
 // methods can be used to receive and send UDP packets with per-packet
 // addressing.
 func ListenUDP(net string, laddr *UDPAddr) (*UDPConn, error) {
+	return listenUDP(net, laddr)
+}
+
+func listenUDP(net string, laddr *UDPAddr, ctl ...string) (*UDPConn, error) {
 	switch net {
 	case "udp", "udp4", "udp6":
 	default:
@@ -180,7 +184,7 @@ func ListenUDP(net string, laddr *UDPAddr) (*UDPConn, error) {
 	if laddr == nil {
 		laddr = &UDPAddr{}
 	}
-	l, err := listenPlan9(net, laddr)
+	l, err := listenPlan9(net, laddr, ctl...)
 	if err != nil {
 		return nil, err
 	}
@@ -4,43 +4,22 @@
 
 package os
 
-import "syscall"
-
 func isExist(err error) bool {
-	switch pe := err.(type) {
-	case nil:
-		return false
-	case *PathError:
-		err = pe.Err
-	case *LinkError:
-		err = pe.Err
-	}
-	switch pe := err.(type) {
-	case *syscall.AkaError:
-		return pe.Errno() == syscall.EEXIST
-	default:
-		return pe == ErrExist
-	}
+	return underlyingErrorIs(err, ErrExist)
 }
 
 func isNotExist(err error) bool {
-	switch pe := err.(type) {
-	case nil:
-		return false
-	case *PathError:
-		err = pe.Err
-	case *LinkError:
-		err = pe.Err
-	}
-	switch pe := err.(type) {
-	case *syscall.AkaError:
-		return pe.Errno() == syscall.ENOENT
-	default:
-		return pe == ErrNotExist
-	}
+	return underlyingErrorIs(err, ErrNotExist)
 }
 
 func isPermission(err error) bool {
+	return underlyingErrorIs(err, ErrPermission)
+}
+
+// underlyingErrorIs reports whether err, with any *PathError, *LinkError
+// or *SyscallError wrapper removed, is target.  The syscall package's
+// Errno and *AkaError decide for themselves with their Is methods.
+func underlyingErrorIs(err, target error) bool {
 	switch pe := err.(type) {
 	case nil:
 		return false
@@ -48,11 +27,14 @@ func isPermission(err error) bool {
 		err = pe.Err
 	case *LinkError:
 		err = pe.Err
+	case *SyscallError:
+		err = pe.Err
 	}
-	switch pe := err.(type) {
-	case *syscall.AkaError:
-		return pe.Errno() == syscall.EACCES || pe.Errno() == syscall.EPERM
-	default:
-		return pe == ErrPermission
+	if err == target {
+		return true
 	}
+	e, ok := err.(interface {
+		Is(error) bool
+	})
+	return ok && e.Is(target)
 }
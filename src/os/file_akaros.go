@@ -37,11 +37,16 @@ func (f *File) Fd() uintptr {
 }
 
 // NewFile returns a new File with the given file descriptor and name.
+// If name is empty, the File is named by the path the kernel has recorded
+// for the descriptor, if any.
 func NewFile(fd uintptr, name string) *File {
 	fdi := int(fd)
 	if fdi < 0 {
 		return nil
 	}
+	if name == "" {
+		name, _ = syscall.Fd2path(fdi)
+	}
 	f := &File{&file{fd: fdi, name: name}}
 	runtime.SetFinalizer(f.file, (*file).close)
 	return f
@@ -282,18 +287,8 @@ func (f *File) seek(offset int64, whence int) (ret int64, err error) {
 // If the file is a symbolic link, it changes the size of the link's target.
 // If there is an error, it will be of type *PathError.
 func Truncate(name string, size int64) error {
-	var d syscall.Dir
-
-	d.Null()
-	d.Length = size
-
-	var buf [syscall.STATFIXLEN]byte
-	n, err := d.Marshal(buf[:])
-	if err != nil {
-		return &PathError{"truncate", name, err}
-	}
-	if err = syscall.Wstat(name, buf[:n], syscall.WSTAT_LENGTH); err != nil {
-		return &PathError{"truncate", name, err}
+	if e := syscall.Truncate(name, size); e != nil {
+		return &PathError{"truncate", name, e}
 	}
 	return nil
 }
@@ -305,18 +300,8 @@ func (f *File) Truncate(size int64) error {
 	if f == nil {
 		return ErrInvalid
 	}
-
-	var d syscall.Dir
-	d.Null()
-	d.Length = size
-
-	var buf [syscall.STATFIXLEN]byte
-	n, err := d.Marshal(buf[:])
-	if err != nil {
-		return &PathError{"truncate", f.name, err}
-	}
-	if err = syscall.Fwstat(f.fd, buf[:n], syscall.WSTAT_LENGTH); err != nil {
-		return &PathError{"truncate", f.name, err}
+	if e := syscall.Ftruncate(f.fd, size); e != nil {
+		return &PathError{"truncate", f.name, e}
 	}
 	return nil
 }
@@ -410,24 +395,12 @@ func rename(oldname, newname string) error {
 	return nil
 }
 
-const chmodMask = uint32(syscall.S_ISUID | syscall.S_ISGID | syscall.S_ISVTX | ModePerm)
-
 // Chmod changes the mode of the named file to mode.
 // If the file is a symbolic link, it changes the mode of the link's target.
 // If there is an error, it will be of type *PathError.
 func Chmod(name string, mode FileMode) error {
-	var d syscall.Dir
-
-	d.Null()
-	d.Mode = syscallMode(mode) & chmodMask
-
-	var buf [syscall.STATFIXLEN]byte
-	n, err := d.Marshal(buf[:])
-	if err != nil {
-		return &PathError{"chmod", name, err}
-	}
-	if err = syscall.Wstat(name, buf[:n], syscall.WSTAT_MODE); err != nil {
-		return &PathError{"chmod", name, err}
+	if e := syscall.Chmod(name, syscallMode(mode)); e != nil {
+		return &PathError{"chmod", name, e}
 	}
 	return nil
 }
@@ -438,18 +411,8 @@ func (f *File) Chmod(mode FileMode) error {
 	if f == nil {
 		return ErrInvalid
 	}
-	var d syscall.Dir
-
-	d.Null()
-	d.Mode = syscallMode(mode) & chmodMask
-
-	var buf [syscall.STATFIXLEN]byte
-	n, err := d.Marshal(buf[:])
-	if err != nil {
-		return &PathError{"chmod", f.name, err}
-	}
-	if err = syscall.Fwstat(f.fd, buf[:n], syscall.WSTAT_MODE); err != nil {
-		return &PathError{"chmod", f.name, err}
+	if e := syscall.Fchmod(f.fd, syscallMode(mode)); e != nil {
+		return &PathError{"chmod", f.name, e}
 	}
 	return nil
 }
@@ -24,8 +24,15 @@ var useSyscallwd = func(error) bool { return true }
 // reached via multiple paths (due to symbolic links),
 // Getwd may return any one of them.
 func Getwd() (dir string, err error) {
-	if runtime.GOOS == "windows" {
+	switch runtime.GOOS {
+	case "windows":
 		return syscall.Getwd()
+	case "akaros":
+		// The kernel tracks the working directory by name, and
+		// stat identity is not reliable across devices, so ask it
+		// directly rather than trusting $PWD or the cache below.
+		dir, err := syscall.Getwd()
+		return dir, NewSyscallError("getwd", err)
 	}
 
 	// Clumsy but widespread kludge:
@@ -0,0 +1,54 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"sync"
+	"syscall"
+)
+
+// An InheritedFile is a file handed down by the parent process and
+// described in the warm-start manifest (see syscall.FdManifestEnv).
+type InheritedFile struct {
+	*File
+	Kind string // syscall.FdListener, syscall.FdLog, syscall.FdControl, ...
+	Name string
+}
+
+var inherited struct {
+	once  sync.Once
+	files []InheritedFile
+	err   error
+}
+
+// InheritedFiles returns the files described by the parent's warm-start
+// manifest, in manifest order.  It returns no files and no error if the
+// process was started without one.
+//
+// The Files are made on the first call, and every call returns the same
+// ones, so a File one caller closes is closed for all of them.  See
+// syscall.InheritedFds for the descriptors alone.
+func InheritedFiles() ([]InheritedFile, error) {
+	inherited.once.Do(func() {
+		inherited.files, inherited.err = newInheritedFiles()
+	})
+	return inherited.files, inherited.err
+}
+
+func newInheritedFiles() ([]InheritedFile, error) {
+	fds, err := syscall.InheritedFds()
+	if err != nil {
+		return nil, NewSyscallError("fd manifest", err)
+	}
+	files := make([]InheritedFile, len(fds))
+	for i, fd := range fds {
+		name := fd.Name
+		if name == "" {
+			name = fd.Kind
+		}
+		files[i] = InheritedFile{NewFile(uintptr(fd.Fd), name), fd.Kind, fd.Name}
+	}
+	return files, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package os
+
+import (
+	"sync"
+	"syscall"
+)
+
+// A ProcTemplate keeps a supply of identical child processes that have
+// already been created and set up, but not yet started, so that starting
+// one only costs letting it run.  It suits programs that launch many
+// copies of the same worker.
+//
+// The files in the template's ProcAttr are duplicated into each child as
+// it is prepared, so they must stay open until the template is closed.
+type ProcTemplate struct {
+	name string
+	argv []string
+	attr *syscall.ProcAttr
+	size int
+
+	mu      sync.Mutex
+	ready   []int // prepared pids, oldest first
+	filling bool
+	closed  bool
+}
+
+// NewProcTemplate returns a template that keeps n children of the
+// program name, started as StartProcess(name, argv, attr) would, ready to
+// run.  The first child is prepared before NewProcTemplate returns, so
+// that a bad name or attr is reported at once; the rest are prepared in
+// the background.
+func NewProcTemplate(name string, argv []string, attr *ProcAttr, n int) (*ProcTemplate, error) {
+	if n < 1 {
+		n = 1
+	}
+	if attr == nil {
+		attr = &ProcAttr{}
+	}
+	sysattr := &syscall.ProcAttr{
+		Dir: attr.Dir,
+		Env: attr.Env,
+		Sys: attr.Sys,
+	}
+	if sysattr.Env == nil {
+		sysattr.Env = Environ()
+	}
+	for _, f := range attr.Files {
+		sysattr.Files = append(sysattr.Files, f.Fd())
+	}
+	t := &ProcTemplate{name: name, argv: argv, attr: sysattr, size: n}
+	pid, err := t.prepare()
+	if err != nil {
+		return nil, err
+	}
+	t.ready = append(t.ready, pid)
+	t.fill()
+	return t, nil
+}
+
+func (t *ProcTemplate) prepare() (int, error) {
+	pid, err := syscall.PrepareProcess(t.name, t.argv, t.attr)
+	if err != nil {
+		return 0, &PathError{"fork/exec", t.name, err}
+	}
+	return pid, nil
+}
+
+// fill starts a goroutine to top the supply back up, unless one is
+// already running.
+func (t *ProcTemplate) fill() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.filling || t.closed || len(t.ready) >= t.size {
+		return
+	}
+	t.filling = true
+	go func() {
+		for {
+			pid, err := t.prepare()
+			t.mu.Lock()
+			if err != nil || t.closed || len(t.ready) >= t.size {
+				t.filling = false
+				t.mu.Unlock()
+				if err == nil {
+					discard(pid)
+				}
+				return
+			}
+			t.ready = append(t.ready, pid)
+			full := len(t.ready) >= t.size
+			if full {
+				t.filling = false
+			}
+			t.mu.Unlock()
+			if full {
+				return
+			}
+		}
+	}()
+}
+
+// Start runs one of the prepared children and returns it.  If none is
+// ready, it prepares one itself.
+func (t *ProcTemplate) Start() (*Process, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, ErrInvalid
+	}
+	var pid int
+	if len(t.ready) > 0 {
+		pid = t.ready[0]
+		t.ready = t.ready[1:]
+	}
+	t.mu.Unlock()
+
+	var err error
+	if pid == 0 {
+		if pid, err = t.prepare(); err != nil {
+			return nil, err
+		}
+	}
+	t.fill()
+	if err := syscall.ProcRun(pid); err != nil {
+		discard(pid)
+		return nil, &PathError{"fork/exec", t.name, err}
+	}
+	return newProcess(pid, 0), nil
+}
+
+// Close discards the children that have not been started.  Processes
+// already returned by Start are unaffected.
+func (t *ProcTemplate) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrInvalid
+	}
+	t.closed = true
+	ready := t.ready
+	t.ready = nil
+	t.mu.Unlock()
+
+	var err error
+	for _, pid := range ready {
+		if e := discard(pid); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// discard kills pid, a prepared child that will not be started, and
+// waits for it, so that it does not linger as a zombie.
+func discard(pid int) error {
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		return NewSyscallError("kill", err)
+	}
+	if _, err := syscall.Waitpid(pid, nil, 0); err != nil {
+		return NewSyscallError("wait", err)
+	}
+	return nil
+}
@@ -7,16 +7,30 @@
 #include <signal.h>
 #include "libcgo.h"
 
+// Every M is a parlib pthread, which is a uthread with its own stack and
+// its own TLS, so the g that threadentry stores stays with the thread
+// whichever vcore parlib runs it on.  Threads that C code creates are
+// uthreads too: a callback from one finds no g in its TLS and borrows an
+// extra M through runtime·needm.  Callbacks must not come from vcore
+// context, which runs on the vcore's own stack and TLS.
+
 static void* threadentry(void*);
 static void (*setg_gcc)(void*);
 
+// The main thread runs on the stack the kernel gave the process, which
+// is USTACK_NUM_PAGES (256) pages long, rather than on one parlib
+// allocated.
+enum {
+	MainStackSize = 256*4096,
+};
+
 void
 x_cgo_init(G* g, void (*setg)(void*))
 {
 	int dummy;
-	// The system stack is set to a fixed size of 256 pages
-	g->stacklo = (uintptr)&dummy - 256*4096 + 4096;
+
 	setg_gcc = setg;
+	g->stacklo = (uintptr)&dummy - MainStackSize + 4096;
 }
 
 
@@ -34,15 +48,14 @@ _cgo_sys_thread_start(ThreadStart *ts)
 
 	pthread_attr_init(&attr);
 	pthread_attr_getstacksize(&attr, &size);
-        // Leave stacklo=0 and set stackhi=size; mstack will do the rest.
+	// Leave stacklo=0 and set stackhi=size; mstack will do the rest.
 	ts->g->stackhi = size;
 	err = pthread_create(&p, &attr, threadentry, ts);
 
 	pthread_sigmask(SIG_SETMASK, &oset, nil);
 
 	if (err != 0) {
-		fprintf(stderr, "runtime/cgo: pthread_create failed: %s\n", strerror(err));
-		abort();
+		fatalf("pthread_create failed: %s", strerror(err));
 	}
 }
 
@@ -62,11 +62,13 @@ const (
 type cpuprofEntry struct {
 	count uintptr
 	depth uintptr
+	tag   uintptr
 	stack [maxCPUProfStack]uintptr
 }
 
 type cpuProfile struct {
 	on     bool    // profiling is on
+	tagged bool    // log records carry the goroutine's profiler labels
 	wait   note    // goroutine waits here
 	count  uintptr // tick count
 	evicts uintptr // eviction count
@@ -147,6 +149,10 @@ func SetCPUProfileRate(hz int) {
 		}
 
 		cpuprof.on = true
+		cpuprof.tagged = proflabels.tagcpu
+		if cpuprof.tagged {
+			keepproflabels()
+		}
 		// pprof binary header format.
 		// http://code.google.com/p/google-perftools/source/browse/trunk/src/profiledata.cc#117
 		p := &cpuprof.log[0]
@@ -187,22 +193,27 @@ func SetCPUProfileRate(hz int) {
 	unlock(&cpuprofLock)
 }
 
-func cpuproftick(pc *uintptr, n int32) {
+func cpuproftick(pc *uintptr, n int32, tag uintptr) {
 	if n > maxCPUProfStack {
 		n = maxCPUProfStack
 	}
 	s := (*[maxCPUProfStack]uintptr)(unsafe.Pointer(pc))[:n]
-	cpuprof.add(s)
+	cpuprof.add(s, tag)
 }
 
-// add adds the stack trace to the profile.
+// add adds the stack trace to the profile, with tag, the address of the
+// interrupted goroutine's profiler labels, if the profile is tagged.
 // It is called from signal handlers and other limited environments
 // and cannot allocate memory or acquire locks that might be
 // held at the time of the signal, nor can it use substantial amounts
 // of stack.  It is allowed to call evict.
-func (p *cpuProfile) add(pc []uintptr) {
+func (p *cpuProfile) add(pc []uintptr, tag uintptr) {
+	if !p.tagged {
+		tag = 0
+	}
+
 	// Compute hash.
-	h := uintptr(0)
+	h := tag
 	for _, x := range pc {
 		h = h<<8 | (h >> (8 * (unsafe.Sizeof(h) - 1)))
 		h += x*31 + x*7 + x*3
@@ -214,7 +225,7 @@ func (p *cpuProfile) add(pc []uintptr) {
 Assoc:
 	for i := range b.entry {
 		e := &b.entry[i]
-		if e.depth != uintptr(len(pc)) {
+		if e.depth != uintptr(len(pc)) || e.tag != tag {
 			continue
 		}
 		for j := range pc {
@@ -244,6 +255,7 @@ Assoc:
 
 	// Reuse the newly evicted entry.
 	e.depth = uintptr(len(pc))
+	e.tag = tag
 	e.count = 1
 	copy(e.stack[:], pc)
 }
@@ -254,8 +266,14 @@ Assoc:
 // allocate memory or block.  It is safe to call flushlog.
 // evict returns true if the entry was copied to the log,
 // false if there was no room available.
+//
+// In a tagged profile, the tag goes in front of the stack, as though
+// it were one more PC.
 func (p *cpuProfile) evict(e *cpuprofEntry) bool {
 	d := e.depth
+	if p.tagged {
+		d++
+	}
 	nslot := d + 2
 	log := &p.log[p.toggle]
 	if p.nlog+nslot > uintptr(len(p.log[0])) {
@@ -270,6 +288,11 @@ func (p *cpuProfile) evict(e *cpuprofEntry) bool {
 	q++
 	log[q] = d
 	q++
+	if p.tagged {
+		log[q] = e.tag
+		q++
+		d--
+	}
 	copy(log[q:], e.stack[:d])
 	q += d
 	p.nlog = q
@@ -294,8 +317,14 @@ func (p *cpuProfile) flushlog() bool {
 		lostPC := funcPC(lostProfileData)
 		log[0] = p.lost
 		log[1] = 1
-		log[2] = lostPC
-		q = 3
+		q = 2
+		if p.tagged {
+			log[1] = 2
+			log[q] = 0
+			q++
+		}
+		log[q] = lostPC
+		q++
 		p.lost = 0
 	}
 	p.nlog = q
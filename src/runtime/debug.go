@@ -12,6 +12,9 @@ func Breakpoint()
 // LockOSThread wires the calling goroutine to its current operating system thread.
 // Until the calling goroutine exits or calls UnlockOSThread, it will always
 // execute in that thread, and no other goroutine can.
+// On Akaros, the thread is also kept to the vcore it was running on, for
+// code whose state belongs to a core rather than a thread; GODEBUG=pinpcore
+// keeps the physical core under that vcore as well.
 func LockOSThread()
 
 // UnlockOSThread unwires the calling goroutine from its fixed operating system thread.
@@ -49,8 +52,11 @@ func GOMAXPROCS(n int) int {
 }
 
 // NumCPU returns the number of logical CPUs on the local machine.
+// On Akaros it returns the number of vcores the kernel has granted the
+// process at the moment, which changes as the runtime asks for more and
+// as the kernel grants or revokes them.
 func NumCPU() int {
-	return int(ncpu)
+	return int(numcpu())
 }
 
 // NumCgoCall returns the number of cgo calls made by the current process.
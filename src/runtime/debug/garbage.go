@@ -100,6 +100,21 @@ func SetGCPercent(percent int) int {
 	return int(old)
 }
 
+// SetMemoryLimit sets a soft limit, in bytes, on the memory the runtime
+// maps for the program: the heap, goroutine stacks and the runtime's own
+// structures.  The garbage collector then starts a collection early
+// enough to keep the total under the limit and returns idle memory to
+// the operating system when it is over.  The limit is soft: if the live
+// heap alone does not fit, the program keeps running, collecting more
+// often.  A negative limit leaves the setting unchanged.  SetMemoryLimit
+// returns the previous setting.  The initial setting is math.MaxInt64,
+// no limit; on Akaros, a soft RLIMIT_AS inherited from the parent process
+// (see syscall.RlimitEnv) is the initial setting instead.  The limit does
+// not apply while garbage collection is disabled by SetGCPercent(-1).
+func SetMemoryLimit(limit int64) int64 {
+	return setMemoryLimit(limit)
+}
+
 // FreeOSMemory forces a garbage collection followed by an
 // attempt to return as much memory to the operating system
 // as possible. (Even if this is not called, the runtime gradually
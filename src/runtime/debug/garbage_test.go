@@ -113,3 +113,14 @@ func TestSetGCPercent(t *testing.T) {
 		t.Errorf("SetGCPercent(123); SetGCPercent(x) = %d, want 123", new)
 	}
 }
+
+func TestSetMemoryLimit(t *testing.T) {
+	// As for SetGCPercent, only test that the setting round-trips.
+	old := SetMemoryLimit(1 << 40)
+	if got := SetMemoryLimit(-1); got != 1<<40 {
+		t.Errorf("SetMemoryLimit(1<<40); SetMemoryLimit(-1) = %d, want %d", got, int64(1<<40))
+	}
+	if got := SetMemoryLimit(old); got != 1<<40 {
+		t.Errorf("SetMemoryLimit(1<<40); SetMemoryLimit(x) = %d, want %d", got, int64(1<<40))
+	}
+}
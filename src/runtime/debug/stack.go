@@ -26,6 +26,26 @@ func PrintStack() {
 	os.Stderr.Write(stack())
 }
 
+// PrintStackOf prints to standard error the stack trace of the goroutine
+// with the given ID, as formatted by runtime.StackOf, without disturbing
+// any other goroutine.  It reports whether the goroutine exists.  A
+// watchdog that finds a goroutine stuck can use it to log only that
+// goroutine's trace.
+func PrintStackOf(id int64) bool {
+	buf := make([]byte, 4096)
+	for {
+		n, ok := runtime.StackOf(id, buf)
+		if !ok {
+			return false
+		}
+		if n < len(buf) {
+			os.Stderr.Write(buf[:n])
+			return true
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
 // Stack returns a formatted stack trace of the goroutine that calls it.
 // For each routine, it includes the source line information and PC value,
 // then attempts to discover, for Go functions, the calling function or
@@ -24,6 +24,8 @@ package parlib
 #include <parlib/vcore.h>
 #include <parlib/serialize.h>
 #include <ros/errno.h>
+#include <ros/event.h>
+#include <ros/fdtap.h>
 #include <ros/fs.h>
 #include <ros/memlayout.h>
 #include <ros/mman.h>
@@ -39,6 +41,7 @@ const (
 	FUTEX_WAIT = C.FUTEX_WAIT
 	FUTEX_WAKE = C.FUTEX_WAKE
 
+	EBADF  = C.EBADF
 	EINTR  = C.EINTR
 	EAGAIN = C.EAGAIN
 	ENOMEM = C.ENOMEM
@@ -52,6 +55,7 @@ const (
 	MAP_PRIVATE  = C.MAP_PRIVATE
 	MAP_FIXED    = C.MAP_FIXED
 	MAP_POPULATE = C.MAP_POPULATE
+	MAP_HUGETLB  = C.MAP_HUGETLB
 
 	SA_RESTART = C.SA_RESTART
 	SA_ONSTACK = C.SA_ONSTACK
@@ -109,6 +113,20 @@ const (
 	SEGV_ACCERR = C.SEGV_ACCERR
 
 	AT_FDCWD = C.AT_FDCWD
+
+	SC_DONE = C.SC_DONE
+
+	EV_SYSCALL      = C.EV_SYSCALL
+	EV_POSIX_SIGNAL = C.EV_POSIX_SIGNAL
+	NR_EVENT_TYPES  = C.NR_EVENT_TYPES
+
+	FDTAP_CMD_ADD = C.FDTAP_CMD_ADD
+	FDTAP_CMD_REM = C.FDTAP_CMD_REM
+
+	FDTAP_FILT_READABLE = C.FDTAP_FILT_READABLE
+	FDTAP_FILT_WRITABLE = C.FDTAP_FILT_WRITABLE
+	FDTAP_FILT_ERROR    = C.FDTAP_FILT_ERROR
+	FDTAP_FILT_HANGUP   = C.FDTAP_FILT_HANGUP
 )
 
 type Sigset C.sigset_t
@@ -119,6 +137,8 @@ type GlobalProcinfoType C.struct_proc_global_info
 type Ucq C.struct_ucq
 type EventQueue C.struct_event_queue
 type EventMbox C.struct_event_mbox
+type EventMsg C.struct_event_msg
+type FdTapReq C.struct_fd_tap_req
 type Timespec C.struct_timespec
 type Timeval C.struct_timeval
 type Itimerval C.struct_itimerval
@@ -135,3 +155,7 @@ type SyscallArg C.gcc_syscall_arg_t
 type FutexArg C.gcc_futex_arg_t
 type SigactionArg C.gcc_sigaction_arg_t
 type SigprocmaskArg C.gcc_sigprocmask_arg_t
+type WatchdogArg C.gcc_watchdog_arg_t
+type EvqPollArg C.gcc_evq_poll_arg_t
+type VcorePinArg C.gcc_vcore_pin_arg_t
+type UthreadStateArg C.gcc_uthread_state_arg_t
@@ -8,6 +8,7 @@ enum {
 	FUTEX_WAIT	= 0x0,
 	FUTEX_WAKE	= 0x1,
 
+	EBADF	= 0x9,
 	EINTR	= 0x4,
 	EAGAIN	= 0xb,
 	ENOMEM	= 0xc,
@@ -21,6 +22,7 @@ enum {
 	MAP_PRIVATE	= 0x2,
 	MAP_FIXED	= 0x10,
 	MAP_POPULATE	= 0x8000,
+	MAP_HUGETLB	= 0x40000,
 
 	SA_RESTART	= 0x10000000,
 	SA_ONSTACK	= 0x8000000,
@@ -78,6 +80,20 @@ enum {
 	SEGV_ACCERR	= 0x2,
 
 	AT_FDCWD	= -0x64,
+
+	SC_DONE		= 0x1,
+
+	EV_SYSCALL	= 0xa,
+	EV_POSIX_SIGNAL	= 0xc,
+	NR_EVENT_TYPES	= 0x19,
+
+	FDTAP_CMD_ADD	= 0x1,
+	FDTAP_CMD_REM	= 0x2,
+
+	FDTAP_FILT_READABLE	= 0x1,
+	FDTAP_FILT_WRITABLE	= 0x2,
+	FDTAP_FILT_ERROR	= 0x10,
+	FDTAP_FILT_HANGUP	= 0x40,
 };
 
 typedef struct Vcore Vcore;
@@ -87,6 +103,8 @@ typedef struct GlobalProcinfoType GlobalProcinfoType;
 typedef struct Ucq Ucq;
 typedef struct EventQueue EventQueue;
 typedef struct EventMbox EventMbox;
+typedef struct EventMsg EventMsg;
+typedef struct FdTapReq FdTapReq;
 typedef struct Timespec Timespec;
 typedef struct Timeval Timeval;
 typedef struct Itimerval Itimerval;
@@ -102,6 +120,10 @@ typedef struct SyscallArg SyscallArg;
 typedef struct FutexArg FutexArg;
 typedef struct SigactionArg SigactionArg;
 typedef struct SigprocmaskArg SigprocmaskArg;
+typedef struct WatchdogArg WatchdogArg;
+typedef struct EvqPollArg EvqPollArg;
+typedef struct VcorePinArg VcorePinArg;
+typedef struct UthreadStateArg UthreadStateArg;
 
 #pragma pack on
 
@@ -175,6 +197,21 @@ struct EventMbox {
 	Ucq	ucq;
 	byte	Pad_cgo_1[24];
 };
+struct EventMsg {
+	uint16	ev_type;
+	uint16	ev_arg1;
+	uint32	ev_arg2;
+	byte	*ev_arg3;
+	uint64	ev_arg4;
+};
+struct FdTapReq {
+	int32	fd;
+	int32	cmd;
+	int32	filter;
+	int32	ev_id;
+	EventQueue	*ev_q;
+	byte	*data;
+};
 struct Timespec {
 	int64	tv_sec;
 	int64	tv_nsec;
@@ -318,6 +355,38 @@ struct SigprocmaskArg {
 	int32	retval;
 	byte	Pad_cgo_1[4];
 };
+struct WatchdogArg {
+	uint64	period_usec;
+	uint32	*ticks;
+	uint32	*npidle;
+	int32	*runqsize;
+	int32	*nprocs;
+	uint32	last;
+	int32	stale;
+	int32	fired;
+	byte	Pad_cgo_0[4];
+};
+struct EvqPollArg {
+	EventQueue	*evq;
+	EventMsg	msg;
+	int32	ok;
+	byte	Pad_cgo_0[4];
+};
+struct VcorePinArg {
+	int32	pin;
+	int32	provision;
+	int32	vcoreid;
+	int32	pcoreid;
+	int32	ok;
+};
+struct UthreadStateArg {
+	byte	*uth;
+	SyscallArg	*sysc;
+	int32	state;
+	int32	flags;
+	int32	notif_disabled;
+	int32	vcoreid;
+};
 
 
 #pragma pack off
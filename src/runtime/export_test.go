@@ -163,3 +163,16 @@ func GostringW(w []uint16) (s string) {
 
 var Gostringnocopy = gostringnocopy
 var Maxstring = &maxstring
+
+// PCCached returns the file and line the PC cache holds for pc, if any.
+func PCCached(pc uintptr) (file string, line int, ok bool) {
+	f := findfunc(pc)
+	if f == nil {
+		return "", 0, false
+	}
+	fileno, l, ok := pcCacheGet(f, pc)
+	if !ok {
+		return "", 0, false
+	}
+	return gostringnocopy(&pclntable[filetab[fileno]]), int(l), true
+}
@@ -54,6 +54,41 @@ a comma-separated list of name=val pairs. Supported names are:
 
 	scavenge: scavenge=1 enables debugging mode of heap scavenger.
 
+	starttrace: on Akaros, setting starttrace=1 causes the runtime to emit a single
+	line to standard error when main.main starts, giving the time at which each
+	start-up phase finished, and another when the network poller starts.
+
+	tracekernel: on Akaros, setting tracekernel=1 causes tracebacks to follow each frame
+	that entered the kernel with the system call it made: its number, its arguments
+	and, while it is in flight, how long it has been waiting.
+
+	akarostrace: on Akaros, setting akarostrace=1 causes every system call made by
+	package syscall to be logged to standard error as it completes, strace-style:
+	the goroutine, the call's name and arguments, its return value, errno and error
+	string, and how long it took.  Setting akarostrace=N for N > 2 logs to file
+	descriptor N instead, which must have been opened by the parent process.
+
+	akarosleaks: on Akaros, setting akarosleaks=1 causes syscall.Exec to report on
+	standard error the FD tap sets, event queues and asynchronous system calls that
+	were still open and had to be torn down.
+
+	akarossync: on Akaros, setting akarossync=1 makes each blocking system call made
+	through package syscall hold its thread until the call completes, instead of
+	parking the goroutine and leaving the thread free to run others.
+
+	asyncpreemptoff: on Akaros, setting asyncpreemptoff=1 stops the runtime from
+	interrupting long-running goroutines with a notification to their vcore, so
+	that, as on other systems, they are only preempted at function calls.
+
+	hugepages: on Akaros, setting hugepages=1 causes the heap arena to be mapped
+	with 2MB pages where the kernel provides them, cutting TLB misses for programs
+	with large heaps at the cost of growing the heap 2MB at a time.  If the kernel
+	refuses the first such mapping, the runtime goes back to ordinary pages.
+
+	pinpcore: on Akaros, setting pinpcore=1 makes LockOSThread also provision the
+	physical core under the locked goroutine's vcore to the process, so that the
+	kernel returns the vcore on the same core if it ever preempts it.
+
 The GOMAXPROCS variable limits the number of operating system threads that
 can execute user-level Go code simultaneously. There is no limit to the number of threads
 that can be blocked in system calls on behalf of Go code; those do not count against
@@ -66,11 +101,16 @@ By default, a failure prints a stack trace for every extant goroutine, eliding f
 internal to the run-time system, and then exits with exit code 2.
 If GOTRACEBACK=0, the per-goroutine stack traces are omitted entirely.
 If GOTRACEBACK=1, the default behavior is used.
-If GOTRACEBACK=2, the per-goroutine stack traces include run-time functions.
+If GOTRACEBACK=2 or GOTRACEBACK=system, the per-goroutine stack traces include
+run-time functions. On Akaros, each goroutine's header is then followed by the
+state of the thread under it: its M, the vcore running its uthread, whether the
+uthread has notifications disabled, and any system call it is waiting on.
 If GOTRACEBACK=crash, the per-goroutine stack traces include run-time functions,
 and if possible the program crashes in an operating-specific manner instead of
 exiting. For example, on Unix systems, the program raises SIGABRT to trigger a
-core dump.
+core dump. On Akaros, which has no core dumps, the program writes a text core of
+its own, with registers, every goroutine's stack and a table of heap spans, to the
+file named by $GOCORE, to core.PID in the current directory, or to #cons/cons.
 
 The GOARCH, GOOS, GOPATH, and GOROOT environment variables complete
 the set of Go environment variables. They influence the building of Go programs
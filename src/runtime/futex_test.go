@@ -2,11 +2,11 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Futex is only available on Akaros, DragonFly BSD, FreeBSD and Linux.
+// Futex is only available on DragonFly BSD, FreeBSD and Linux.
 // The race detector emits calls to split stack functions so it breaks
 // the test.
 
-// +build akaros dragonfly freebsd linux
+// +build dragonfly freebsd linux
 // +build !race
 
 package runtime_test
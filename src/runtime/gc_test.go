@@ -290,3 +290,34 @@ func TestPrintGC(t *testing.T) {
 	}
 	close(done)
 }
+
+var pacingSink []byte
+
+func TestReadPacingStats(t *testing.T) {
+	if os.Getenv("GOGC") == "off" {
+		t.Skip("skipping test; GOGC=off in environment")
+	}
+	var before, after runtime.PacingStats
+	runtime.ReadPacingStats(&before)
+	for i := 0; i < 100; i++ {
+		pacingSink = make([]byte, 64<<10)
+	}
+	runtime.ReadPacingStats(&after)
+	if got := after.TotalAlloc - before.TotalAlloc; got < 100*64<<10 {
+		t.Errorf("TotalAlloc grew by %d bytes, want at least %d", got, 100*64<<10)
+	}
+	if after.NextGC == 0 || after.AllocRate <= 0 {
+		t.Errorf("NextGC=%d AllocRate=%v, want both positive", after.NextGC, after.AllocRate)
+	}
+	// Allocation collects as soon as HeapAlloc reaches NextGC, so the
+	// debt can never be more than the last allocation ran it up by.
+	if after.GCDebt >= 64<<10 {
+		t.Errorf("GCDebt=%d after allocating, want less than one allocation (%d)", after.GCDebt, 64<<10)
+	}
+	// A collection leaves headroom before the next.
+	runtime.GC()
+	runtime.ReadPacingStats(&after)
+	if after.GCDebt >= 0 {
+		t.Errorf("GCDebt=%d just after a collection, want it negative", after.GCDebt)
+	}
+}
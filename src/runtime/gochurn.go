@@ -0,0 +1,41 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// A GoroutineStats records how many goroutines the program has started
+// and finished.  It is read without stopping the world, so the fields are
+// not one consistent snapshot.
+type GoroutineStats struct {
+	Created  uint64 // goroutines started since the program started
+	Finished uint64 // goroutines that have exited
+	Peak     uint64 // most goroutines alive at once
+
+	// When is the time s was read, in nanoseconds on a monotonic clock
+	// with an arbitrary origin; only differences between readings mean
+	// anything.
+	When int64
+}
+
+// ReadGoroutineStats populates s with goroutine creation statistics.
+// The counters cost a few atomic operations per goroutine, so they are
+// always on.
+func ReadGoroutineStats(s *GoroutineStats) {
+	s.Finished = atomicload64(&gofinished)
+	s.Created = atomicload64(&gocreated)
+	s.Peak = atomicload64(&gopeak)
+	s.When = nanotime()
+}
+
+// ChurnRate returns the number of goroutines started per second between
+// prev and s, two readings by ReadGoroutineStats with prev the earlier.
+// Each caller keeps its own baseline, so callers sampling at different
+// intervals do not disturb one another.
+func (s *GoroutineStats) ChurnRate(prev *GoroutineStats) float64 {
+	d := s.When - prev.When
+	if d <= 0 || s.Created < prev.Created {
+		return 0
+	}
+	return float64(s.Created-prev.Created) * 1e9 / float64(d)
+}
@@ -70,6 +70,28 @@ enum {
 static byte buf[BufSize];
 static uintptr nbuf;
 
+static bool	dumpfailed;
+
+// Write all of data to the dump file.  A write may take less than it is
+// given, as when the file is a pipe or a socket, and an object may be
+// larger than one write can take.  Once a write fails, the rest of the
+// dump is dropped.
+static void
+writeall(byte *data, uintptr len)
+{
+	int32 n;
+
+	while(len > 0 && !dumpfailed) {
+		n = runtime·write(dumpfd, data, len < (1<<30) ? len : (1<<30));
+		if(n <= 0) {
+			dumpfailed = true;
+			break;
+		}
+		data += n;
+		len -= n;
+	}
+}
+
 static void
 write(byte *data, uintptr len)
 {
@@ -78,9 +100,9 @@ write(byte *data, uintptr len)
 		nbuf += len;
 		return;
 	}
-	runtime·write(dumpfd, buf, nbuf);
+	writeall(buf, nbuf);
 	if(len >= BufSize) {
-		runtime·write(dumpfd, data, len);
+		writeall(data, len);
 		nbuf = 0;
 	} else {
 		runtime·memmove(buf, data, len);
@@ -91,7 +113,7 @@ write(byte *data, uintptr len)
 static void
 flush(void)
 {
-	runtime·write(dumpfd, buf, nbuf);
+	writeall(buf, nbuf);
 	nbuf = 0;
 }
 
@@ -778,6 +800,7 @@ runtime·writeheapdump_m(void)
 
 	// Set dump file.
 	dumpfd = fd;
+	dumpfailed = false;
 
 	// Call dump routine.
 	mdump();
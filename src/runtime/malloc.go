@@ -151,6 +151,7 @@ func mallocgc(size uintptr, typ *_type, flags uint32) unsafe.Pointer {
 			}
 			s.freelist = v.next
 			s.ref++
+			c.local_nsmallalloc[tinySizeClass]++
 			//TODO: prefetch v.next
 			x = unsafe.Pointer(v)
 			(*[2]uint64)(x)[0] = 0
@@ -182,6 +183,7 @@ func mallocgc(size uintptr, typ *_type, flags uint32) unsafe.Pointer {
 			}
 			s.freelist = v.next
 			s.ref++
+			c.local_nsmallalloc[sizeclass]++
 			//TODO: prefetch
 			x = unsafe.Pointer(v)
 			if flags&flagNoZero == 0 {
@@ -202,7 +204,9 @@ func mallocgc(size uintptr, typ *_type, flags uint32) unsafe.Pointer {
 		releasem(mp)
 		x = unsafe.Pointer(uintptr(s.start << pageShift))
 		size = uintptr(s.elemsize)
+		c.local_nlargealloc++
 	}
+	c.local_allocbytes += size
 
 	if flags&flagNoScan != 0 {
 		// All objects are pre-marked as noscan.
@@ -327,17 +331,21 @@ marked:
 		tracealloc(x, size, typ)
 	}
 
+	if provenanceEnabled {
+		recordProvenance(x)
+	}
+
 	if rate := MemProfileRate; rate > 0 {
 		if size < uintptr(rate) && int32(size) < c.next_sample {
 			c.next_sample -= int32(size)
 		} else {
 			mp := acquirem()
-			profilealloc(mp, x, size)
+			profilealloc(mp, x, size, typ)
 			releasem(mp)
 		}
 	}
 
-	if memstats.heap_alloc >= memstats.next_gc {
+	if memstats.heap_alloc >= memstats.next_gc || memstats.heap_alloc >= limitgc {
 		gogc(0)
 	}
 
@@ -385,7 +393,7 @@ func goroundupsize(size uintptr) uintptr {
 	return (size + pageSize - 1) &^ pageMask
 }
 
-func profilealloc(mp *m, x unsafe.Pointer, size uintptr) {
+func profilealloc(mp *m, x unsafe.Pointer, size uintptr, typ *_type) {
 	c := mp.mcache
 	rate := MemProfileRate
 	if size < uintptr(rate) {
@@ -405,7 +413,7 @@ func profilealloc(mp *m, x unsafe.Pointer, size uintptr) {
 		c.next_sample = next
 	}
 
-	mProf_Malloc(x, size)
+	mProf_Malloc(x, size, typ)
 }
 
 // force = 1 - do GC regardless of current heap usage
@@ -426,7 +434,7 @@ func gogc(force int32) {
 
 	semacquire(&worldsema, false)
 
-	if force == 0 && memstats.heap_alloc < memstats.next_gc {
+	if force == 0 && memstats.heap_alloc < memstats.next_gc && memstats.heap_alloc < limitgc {
 		// typically threads which lost the race to grab
 		// worldsema exit here when gc is done.
 		semrelease(&worldsema)
@@ -468,6 +476,7 @@ func gogc(force int32) {
 		}
 		onM(gc_m)
 	}
+	pacinggcdone()
 
 	// all done
 	mp.gcing = 0
@@ -114,6 +114,7 @@ enum
 	FixAllocChunk = 16<<10,		// Chunk size for FixAlloc
 	MaxMHeapList = 1<<(20 - PageShift),	// Maximum page length for fixed-size list in MHeap.
 	HeapAllocChunk = 1<<20,		// Chunk size for heap growth
+	HugePageSize = 2<<20,		// Akaros jumbo page, for GODEBUG=hugepages=1
 
 	// Per-P, per order stack segment cache size.
 	StackCacheSize = 32*1024,
@@ -332,6 +333,7 @@ struct MCache
 	// so they are grouped here for better caching.
 	int32 next_sample;		// trigger heap sample after allocating this many bytes
 	intptr local_cachealloc;	// bytes allocated (or freed) from cache since last lock of heap
+	uintptr local_allocbytes;	// bytes allocated from cache, never reset (see pacing.go)
 	// Allocator cache for tiny objects w/o pointers.
 	// See "Tiny allocator" comment in malloc.goc.
 	byte*	tiny;
@@ -351,6 +353,10 @@ struct MCache
 	uintptr local_largefree;	// bytes freed for large objects (>MaxSmallSize)
 	uintptr local_nlargefree;	// number of frees for large objects (>MaxSmallSize)
 	uintptr local_nsmallfree[NumSizeClasses];	// number of frees for small objects (<=MaxSmallSize)
+
+	// Allocation counts, never reset (see readmemstats_m in mgc0.c).
+	uintptr local_nlargealloc;	// number of large objects allocated
+	uintptr local_nsmallalloc[NumSizeClasses];	// number of small objects allocated, less tiny allocs
 };
 
 MSpan*	runtime·MCache_Refill(MCache *c, int32 sizeclass);
@@ -394,6 +400,7 @@ struct SpecialProfile
 {
 	Special	special;
 	Bucket*	b;
+	Bucket*	tb;	// bucket counting the object by type, or nil
 };
 
 // An MSpan is a run of pages.
@@ -507,6 +514,8 @@ struct MHeap
 	uint64 largefree;	// bytes freed for large objects (>MaxSmallSize)
 	uint64 nlargefree;	// number of frees for large objects (>MaxSmallSize)
 	uint64 nsmallfree[NumSizeClasses];	// number of frees for small objects (<=MaxSmallSize)
+	uint64 nlargealloc;	// allocation counts of freed mcaches
+	uint64 nsmallalloc[NumSizeClasses];
 };
 #define runtime·mheap runtime·mheap_
 extern MHeap runtime·mheap;
@@ -615,6 +624,7 @@ void	runtime·gc_g_ptr(Eface*);
 void	runtime·gc_itab_ptr(Eface*);
 
 void  runtime·setgcpercent_m(void);
+void  runtime·setmemorylimit_m(void);
 
 // Value we use to mark dead pointers when GODEBUG=gcdead=1.
 #define PoisonGC ((uintptr)0xf969696969696969ULL)
@@ -46,6 +46,45 @@ func TestMemStats(t *testing.T) {
 	}
 }
 
+func TestMemStatsConcurrent(t *testing.T) {
+	// ReadMemStats does not stop the world, so read it while other
+	// goroutines allocate and free, and check that the counts it reads
+	// are consistent with each other.
+	defer GOMAXPROCS(GOMAXPROCS(4))
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for j := 0; j < 100; j++ {
+					// Sized at run time, so on the heap.
+					_ = make([]byte, 8<<uint(j%16))
+				}
+			}
+		}()
+	}
+	defer close(done)
+	st := new(MemStats)
+	for i := 0; i < 1000; i++ {
+		ReadMemStats(st)
+		if st.Frees > st.Mallocs {
+			t.Fatalf("Frees(%d) > Mallocs(%d)", st.Frees, st.Mallocs)
+		}
+		if st.Alloc > st.TotalAlloc || st.HeapObjects > 1e10 {
+			t.Fatalf("Insanely high value (overflow?): %+v", *st)
+		}
+		for _, s := range st.BySize {
+			if s.Frees > s.Mallocs {
+				t.Fatalf("size %d: Frees(%d) > Mallocs(%d)", s.Size, s.Frees, s.Mallocs)
+			}
+		}
+	}
+}
+
 var mallocSink uintptr
 
 func BenchmarkMalloc8(b *testing.B) {
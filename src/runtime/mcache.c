@@ -12,6 +12,10 @@
 
 extern volatile intgo runtime·MemProfileRate;
 
+// The allocation counts of per-P caches that have been freed, for
+// ReadPacingStats (pacing.go).  Updated under the heap lock.
+extern uint64 runtime·allocfolded;
+
 // dummy MSpan that contains no free objects.
 MSpan runtime·emptymspan;
 
@@ -42,11 +46,17 @@ runtime·allocmcache(void)
 static void
 freemcache(MCache *c)
 {
+	int32 i;
+
 	runtime·MCache_ReleaseAll(c);
 	runtime·stackcache_clear(c);
 	runtime·gcworkbuffree(c->gcworkbuf);
 	runtime·lock(&runtime·mheap.lock);
 	runtime·purgecachedstats(c);
+	runtime·allocfolded += c->local_allocbytes;
+	runtime·mheap.nlargealloc += c->local_nlargealloc;
+	for(i=0; i<nelem(c->local_nsmallalloc); i++)
+		runtime·mheap.nsmallalloc[i] += c->local_nsmallalloc[i];
 	runtime·FixAlloc_Free(&runtime·mheap.cachealloc, c);
 	runtime·unlock(&runtime·mheap.lock);
 }
@@ -62,13 +62,51 @@ runtime·sysAlloc(uintptr n, uint64 *stat)
 	return p;
 }
 
+// Akaros has no madvise, so give pages back by mapping fresh anonymous
+// memory over them: the kernel frees the old pages at once, and the new
+// mapping has none until they are touched, which is all SysUsed needs.
+// With huge pages, only whole huge pages go back, each as a huge page
+// again, so that the scavenger does not split up the arena.
+static void
+unusedrange(void *v, uintptr n, byte **start, byte **end)
+{
+	*start = v;
+	*end = *start + n;
+	if(runtime·hugepagesok()) {
+		*start = (byte*)ROUND((uintptr)*start, HugePageSize);
+		*end = (byte*)((uintptr)*end & ~(uintptr)(HugePageSize-1));
+	}
+}
+
 void
 runtime·SysUnused(void *v, uintptr n)
 {
-	USED(v, n);
-	// Eventually we will want to use something like madvise if we ever support
-	// it on Akaros.
-	// runtime·madvise(v, n, MADV_DONTNEED);
+	byte *start, *end;
+	int32 flags;
+	void *p;
+
+	unusedrange(v, n, &start, &end);
+	if(start >= end)
+		return;
+	flags = MAP_ANON|MAP_FIXED|MAP_PRIVATE;
+	if(runtime·hugepagesok())
+		flags |= MAP_HUGETLB;
+	p = runtime·mmap(start, end - start, PROT_READ|PROT_WRITE, flags, -1, 0);
+	if(p != start)
+		runtime·throw("runtime: cannot release unused pages");
+}
+
+// SysReleasable returns how many of the n bytes at v SysUnused gives
+// back, for the scavenger's accounting.
+uintptr
+runtime·SysReleasable(void *v, uintptr n)
+{
+	byte *start, *end;
+
+	unusedrange(v, n, &start, &end);
+	if(start >= end)
+		return 0;
+	return end - start;
 }
 
 void
@@ -119,6 +157,38 @@ runtime·SysReserve(void *v, uintptr n, bool *reserved)
 	return p;
 }
 
+// Huge pages, with GODEBUG=hugepages=1.  MHeap_Grow grows the arena a
+// huge page at a time, and SysMap remaps the huge-page-aligned part of
+// each new piece of arena with them.  A kernel without them refuses the
+// first such mapping; then we put ordinary pages back and stop asking.
+static bool hugepagesfailed;
+
+bool
+runtime·hugepagesok(void)
+{
+	return runtime·debug.hugepages > 0 && !hugepagesfailed;
+}
+
+static void
+maphuge(byte *v, uintptr n)
+{
+	byte *start, *end;
+	void *p;
+
+	start = (byte*)ROUND((uintptr)v, HugePageSize);
+	end = (byte*)(((uintptr)v + n) & ~(uintptr)(HugePageSize-1));
+	if(start >= end)
+		return;
+	p = runtime·mmap(start, end - start, PROT_READ|PROT_WRITE,
+		MAP_ANON|MAP_FIXED|MAP_PRIVATE|MAP_HUGETLB, -1, 0);
+	if(p == start)
+		return;
+	hugepagesfailed = true;
+	p = runtime·mmap(start, end - start, PROT_READ|PROT_WRITE, MAP_ANON|MAP_FIXED|MAP_PRIVATE, -1, 0);
+	if(p != start)
+		runtime·throw("runtime: cannot map pages in arena address space");
+}
+
 void
 runtime·SysMap(void *v, uintptr n, bool reserved, uint64 *stat)
 {
@@ -135,6 +205,8 @@ runtime·SysMap(void *v, uintptr n, bool reserved, uint64 *stat)
 			runtime·printf("runtime: address space conflict: map(%p) = %p\n", v, p);
 			runtime·throw("runtime: address space conflict");
 		}
+		if(runtime·hugepagesok())
+			maphuge(v, n);
 		return;
 	}
 
@@ -143,4 +215,6 @@ runtime·SysMap(void *v, uintptr n, bool reserved, uint64 *stat)
 		runtime·throw("runtime: out of memory");
 	if(p != v)
 		runtime·throw("runtime: cannot map pages in arena address space");
+	if(runtime·hugepagesok())
+		maphuge(v, n);
 }
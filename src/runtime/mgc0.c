@@ -83,6 +83,12 @@ static byte oneptr[] = {BitsPointer};
 // Initialized from $GOGC.  GOGC=off means no gc.
 extern int32 runtime·gcpercent;
 
+// Soft memory limit.  memorylimit is the limit in bytes, maxint64 for
+// none; a collection starts once heap_alloc reaches limitgc, whatever
+// next_gc says.  Both are set up in gcinit.
+extern int64 runtime·memorylimit;
+extern uint64 runtime·limitgc;
+
 // Holding worldsema grants an M the right to try to stop the world.
 // The procedure is:
 //
@@ -137,6 +143,7 @@ static void	putempty(Workbuf*);
 static Workbuf* handoff(Workbuf*);
 static void	gchelperstart(void);
 static void	flushallmcaches(void);
+static void	setlimitgc(void);
 static bool	scanframe(Stkframe *frame, void *unused);
 static void	scanstack(G *gp);
 static BitVector	unrollglobgcprog(byte *prog, uintptr size);
@@ -672,9 +679,40 @@ runtime·stackmapdata(StackMap *stackmap, int32 n)
 	return (BitVector){stackmap->nbit, stackmap->bytedata + n*((stackmap->nbit+31)/32*4)};
 }
 
+#ifdef GOOS_akaros
+extern void runtime·asyncpreempt(void);
+
+// Scan n bytes at b conservatively: every word that points into an
+// in-use span keeps the object it points into alive, whatever it really
+// is.  At worst that keeps garbage, or a free object, marked for a cycle.
+static void
+scanconservative(byte *b, uintptr n)
+{
+	byte *obj, *arena_start, *arena_used;
+	uintptr i;
+	MSpan *s;
+
+	arena_start = runtime·mheap.arena_start;
+	arena_used = runtime·mheap.arena_used;
+	for(i = 0; i+PtrSize <= n; i += PtrSize) {
+		obj = *(byte**)(b+i);
+		if(obj < arena_start || obj >= arena_used)
+			continue;
+		s = runtime·mheap.spans[(obj-arena_start)>>PageShift];
+		if(s == nil || s->state != MSpanInUse ||
+		   obj < (byte*)(s->start<<PageShift) || obj >= s->limit)
+			continue;
+		scanblock(b+i, PtrSize, oneptr);
+	}
+}
+#endif
+
 // Scan a stack frame: local variables and function arguments/results.
+// On Akaros, ctxt points to a bool saying whether the frame was
+// interrupted by an asynchronous preemption, which scanframe sets for
+// the next frame when it sees runtime·asyncpreempt.
 static bool
-scanframe(Stkframe *frame, void *unused)
+scanframe(Stkframe *frame, void *ctxt)
 {
 	Func *f;
 	StackMap *stackmap;
@@ -683,8 +721,19 @@ scanframe(Stkframe *frame, void *unused)
 	uintptr targetpc;
 	int32 pcdata;
 
-	USED(unused);
+	USED(ctxt);
 	f = frame->fn;
+#ifdef GOOS_akaros
+	if(ctxt != nil && *(bool*)ctxt) {
+		// Stopped at an arbitrary instruction, not a call: the stack
+		// maps may not cover what is live here.
+		*(bool*)ctxt = false;
+		scanconservative((byte*)frame->sp, frame->argp + frame->arglen - frame->sp);
+		return true;
+	}
+	if(ctxt != nil && f->entry == (uintptr)runtime·asyncpreempt)
+		*(bool*)ctxt = true;
+#endif
 	targetpc = frame->continpc;
 	if(targetpc == 0) {
 		// Frame is dead.
@@ -755,6 +804,9 @@ scanstack(G *gp)
 {
 	M *mp;
 	bool (*fn)(Stkframe*, void*);
+#ifdef GOOS_akaros
+	bool async;
+#endif
 
 	if(runtime·readgstatus(gp)&Gscan == 0) {
 		runtime·printf("runtime: gp=%p, goid=%D, gp->atomicstatus=%d\n", gp, gp->goid, runtime·readgstatus(gp));
@@ -782,7 +834,14 @@ scanstack(G *gp)
 		runtime·throw("can't scan gchelper stack");
 
 	fn = scanframe;
+#ifdef GOOS_akaros
+	async = false;
+	if(gp->asyncbusy)
+		scanconservative((byte*)gp->asyncregs, sizeof gp->asyncregs);
+	runtime·gentraceback(~(uintptr)0, ~(uintptr)0, 0, gp, 0, nil, 0x7fffffff, &fn, &async, 0);
+#else
 	runtime·gentraceback(~(uintptr)0, ~(uintptr)0, 0, gp, 0, nil, 0x7fffffff, &fn, nil, 0);
+#endif
 	runtime·tracebackdefers(gp, &fn, nil);
 }
 
@@ -1357,6 +1416,8 @@ runtime·gcinit(void)
 
 	runtime·work.markfor = runtime·parforalloc(MaxGcproc);
 	runtime·gcpercent = runtime·readgogc();
+	runtime·memorylimit = 0x7fffffffffffffffLL;
+	runtime·limitgc = ~(uint64)0;
 	runtime·gcdatamask = unrollglobgcprog(runtime·gcdata, runtime·edata - runtime·data);
 	runtime·gcbssmask = unrollglobgcprog(runtime·gcbss, runtime·ebss - runtime·bss);
 }
@@ -1373,6 +1434,8 @@ runtime·gc_m(void)
 
 	a.start_time = (uint64)(g->m->scalararg[0]) | ((uint64)(g->m->scalararg[1]) << 32);
 	a.eagersweep = g->m->scalararg[2];
+	if(runtime·traceEnabled)
+		runtime·traceGCStart();
 	gc(&a);
 
 	if(nbadblock > 0) {
@@ -1383,6 +1446,8 @@ runtime·gc_m(void)
 				runtime·throw("cannot find path to bad pointer");
 		}
 	}
+	if(runtime·traceEnabled)
+		runtime·traceGCDone();
 
 	runtime·casgstatus(gp, Gwaiting, Grunning);
 }
@@ -1463,6 +1528,7 @@ gc(struct gc_args *args)
 	// conservatively set next_gc to high value assuming that everything is live
 	// concurrent/lazy sweep will reduce this number while discovering new garbage
 	mstats.next_gc = mstats.heap_alloc+mstats.heap_alloc*runtime·gcpercent/100;
+	setlimitgc();
 
 	t4 = runtime·nanotime();
 	runtime·atomicstore64(&mstats.last_gc, runtime·unixnanotime());  // must be Unix time to make sense to user
@@ -1541,8 +1607,74 @@ gc(struct gc_args *args)
 }
 
 extern uintptr runtime·sizeof_C_MStats;
+extern uint64 runtime·allocfolded;
+
+// ReadMemStats does not stop the world, so it cannot flush the mcaches
+// and scan the spans as runtime·updatememstats does.  Instead every
+// mcache counts the objects it hands out in counters it never resets,
+// which freemcache folds into the heap's, and the frees it sweeps in
+// counters that runtime·purgecachedstats moves to the heap's under the
+// heap lock.  Holding the heap lock, we add up the heap's counts and
+// every P's; one P's counts may miss its last few allocations, as reading
+// them races with its mallocs, but that is all a pause would buy.
+// Frees are read before allocations: an object is allocated before it
+// is freed, so every free we count has its allocation counted too and
+// nfree cannot pass nmalloc.  The byte counts are clamped all the same,
+// as a P's allocbytes is read without ordering against its mallocs.
+static void
+readallocstats(MStats *stats)
+{
+	P *p, **pp;
+	MCache *c;
+	int32 i;
+	uint64 nsmall, freed, total;
+	uint64 nsmallfree[nelem(mstats.by_size)];
 
-static void readmemstats_m(void);
+	stats->nfree = runtime·mheap.nlargefree + mstats.tinyallocs;
+	freed = runtime·mheap.largefree;
+	for(i = 0; i < nelem(mstats.by_size); i++)
+		nsmallfree[i] = runtime·mheap.nsmallfree[i];
+	for(pp=runtime·allp; p=*pp; pp++) {
+		if((c = p->mcache) == nil)
+			continue;
+		stats->nfree += c->local_nlargefree + c->local_tinyallocs;
+		freed += c->local_largefree;
+		for(i = 0; i < nelem(c->local_nsmallfree); i++)
+			nsmallfree[i] += c->local_nsmallfree[i];
+	}
+	for(i = 0; i < nelem(mstats.by_size); i++) {
+		stats->nfree += nsmallfree[i];
+		freed += nsmallfree[i] * runtime·class_to_size[i];
+	}
+
+	total = runtime·allocfolded;
+	stats->nmalloc = runtime·mheap.nlargealloc + mstats.tinyallocs;
+	for(i = 0; i < nelem(mstats.by_size); i++) {
+		nsmall = runtime·mheap.nsmallalloc[i];
+		for(pp=runtime·allp; p=*pp; pp++) {
+			if((c = p->mcache) != nil)
+				nsmall += c->local_nsmallalloc[i];
+		}
+		stats->nmalloc += nsmall;
+		// Go's MemStats has room for only 61 size classes.
+		if(i < 61) {
+			stats->by_size[i].nmalloc = nsmall;
+			stats->by_size[i].nfree = nsmallfree[i];
+		}
+	}
+	for(pp=runtime·allp; p=*pp; pp++) {
+		if((c = p->mcache) == nil)
+			continue;
+		total += c->local_allocbytes;
+		stats->nmalloc += c->local_nlargealloc + c->local_tinyallocs;
+	}
+	if(total < freed)
+		total = freed;
+	stats->total_alloc = total;
+	stats->alloc = total - freed;
+	stats->heap_alloc = stats->alloc;
+	stats->heap_objects = stats->nmalloc - stats->nfree;
+}
 
 void
 runtime·readmemstats_m(void)
@@ -1552,10 +1684,16 @@ runtime·readmemstats_m(void)
 	stats = g->m->ptrarg[0];
 	g->m->ptrarg[0] = nil;
 
-	runtime·updatememstats(nil);
+	runtime·lock(&runtime·mheap.lock);
 	// Size of the trailing by_size array differs between Go and C,
 	// NumSizeClasses was changed, but we can not change Go struct because of backward compatibility.
 	runtime·memmove(stats, &mstats, runtime·sizeof_C_MStats);
+	stats->mcache_inuse = runtime·mheap.cachealloc.inuse;
+	stats->mspan_inuse = runtime·mheap.spanalloc.inuse;
+	stats->sys = stats->heap_sys + stats->stacks_sys + stats->mspan_sys +
+		stats->mcache_sys + stats->buckhash_sys + stats->gc_sys + stats->other_sys;
+	readallocstats(stats);
+	runtime·unlock(&runtime·mheap.lock);
 
 	// Stack numbers are part of the heap numbers, separate those out for user consumption
 	stats->stacks_sys = stats->stacks_inuse;
@@ -1615,6 +1753,62 @@ readgcstats_m(void)
 	pauses->len = n+n+3;
 }
 
+// Memory the process has mapped and not handed back, all of it anonymous
+// mappings the kernel charges to the process.  This is the runtime's own
+// count, from mstats: the limit it is held to is the soft RLIMIT_AS that
+// package syscall emulates, and the kernel keeps no per-process count of
+// its own to ask.
+static uint64
+memmapped(void)
+{
+	return mstats.heap_sys - mstats.heap_released + mstats.stacks_sys + mstats.mspan_sys +
+		mstats.mcache_sys + mstats.buckhash_sys + mstats.gc_sys + mstats.other_sys;
+}
+
+// Set limitgc so that the heap, grown to it, fits under the memory limit
+// along with everything else the runtime has mapped.  Called with the
+// world stopped: at the end of a collection, when the heap is as small as
+// it will get, and from runtime·setmemorylimit_m when the limit changes.  Idle heap pages count against
+// the limit until they are released, so when over it we release them all
+// at once rather than wait for the scavenger.  The heap always gets at
+// least 1/16 of its size to grow into: a limit that the live heap alone
+// exceeds makes collections frequent, but never back to back.
+static void
+setlimitgc(void)
+{
+	uint64 other, goal;
+
+	if(runtime·memorylimit == 0x7fffffffffffffffLL) {
+		runtime·limitgc = ~(uint64)0;
+		return;
+	}
+	if(memmapped() > runtime·memorylimit)
+		runtime·MHeap_Scavenge(-1, ~(uint64)0, 0);
+	other = memmapped() - mstats.heap_alloc;
+	goal = 0;
+	if(runtime·memorylimit > other)
+		goal = runtime·memorylimit - other;
+	if(goal < mstats.heap_alloc + mstats.heap_alloc/16)
+		goal = mstats.heap_alloc + mstats.heap_alloc/16;
+	runtime·limitgc = goal;
+}
+
+// Called with the world stopped (see setMemoryLimit in rdebug.go).
+void
+runtime·setmemorylimit_m(void)
+{
+	int64 in, out;
+
+	in = (int64)g->m->scalararg[0];
+	out = runtime·memorylimit;
+	if(in >= 0) {
+		runtime·memorylimit = in;
+		cachestats();
+		setlimitgc();
+	}
+	g->m->scalararg[0] = (uintptr)out;
+}
+
 void
 runtime·setgcpercent_m(void)
 {
@@ -394,6 +394,12 @@ MHeap_Grow(MHeap *h, uintptr npage)
 	ask = npage<<PageShift;
 	if(ask < HeapAllocChunk)
 		ask = HeapAllocChunk;
+#ifdef GOOS_akaros
+	// Grow in whole huge pages, so that the arena stays aligned to
+	// them and SysMap can back all of it with them.
+	if(runtime·hugepagesok())
+		ask = ROUND(ask, HugePageSize);
+#endif
 
 	v = runtime·MHeap_SysAlloc(h, ask);
 	if(v == nil) {
@@ -586,7 +592,7 @@ MHeap_FreeSpanLocked(MHeap *h, MSpan *s, bool acctinuse, bool acctidle)
 static uintptr
 scavengelist(MSpan *list, uint64 now, uint64 limit)
 {
-	uintptr released, sumreleased;
+	uintptr released, sumreleased, npages;
 	MSpan *s;
 
 	if(runtime·MSpanList_IsEmpty(list))
@@ -595,10 +601,18 @@ scavengelist(MSpan *list, uint64 now, uint64 limit)
 	sumreleased = 0;
 	for(s=list->next; s != list; s=s->next) {
 		if((now - s->unusedsince) > limit && s->npreleased != s->npages) {
-			released = (s->npages - s->npreleased) << PageShift;
+			npages = s->npages;
+#ifdef GOOS_akaros
+			// With huge pages, SysUnused gives back only the whole
+			// huge pages in the span, so count only those.
+			npages = runtime·SysReleasable((void*)(s->start << PageShift), s->npages << PageShift) >> PageShift;
+			if(npages <= s->npreleased)
+				continue;
+#endif
+			released = (npages - s->npreleased) << PageShift;
 			mstats.heap_released += released;
 			sumreleased += released;
-			s->npreleased = s->npages;
+			s->npreleased = npages;
 			runtime·SysUnused((void*)(s->start << PageShift), s->npages << PageShift);
 		}
 	}
@@ -836,24 +850,27 @@ runtime·removefinalizer(void *p)
 	runtime·unlock(&runtime·mheap.speciallock);
 }
 
-// Set the heap profile bucket associated with addr to b.
+// Set the heap profile buckets associated with addr to b and tb.
 void
 runtime·setprofilebucket_m(void)
 {	
 	void *p;
-	Bucket *b;
+	Bucket *b, *tb;
 	SpecialProfile *s;
 	
 	p = g->m->ptrarg[0];
 	b = g->m->ptrarg[1];
+	tb = g->m->ptrarg[2];
 	g->m->ptrarg[0] = nil;
 	g->m->ptrarg[1] = nil;
+	g->m->ptrarg[2] = nil;
 
 	runtime·lock(&runtime·mheap.speciallock);
 	s = runtime·FixAlloc_Alloc(&runtime·mheap.specialprofilealloc);
 	runtime·unlock(&runtime·mheap.speciallock);
 	s->special.kind = KindSpecialProfile;
 	s->b = b;
+	s->tb = tb;
 	if(!addspecial(p, &s->special))
 		runtime·throw("setprofilebucket: profile already set");
 }
@@ -878,6 +895,8 @@ runtime·freespecial(Special *s, void *p, uintptr size, bool freed)
 	case KindSpecialProfile:
 		sp = (SpecialProfile*)s;
 		runtime·mProf_Free(sp->b, size, freed);
+		if(sp->tb != nil)
+			runtime·mProf_Free(sp->tb, size, freed);
 		runtime·lock(&runtime·mheap.speciallock);
 		runtime·FixAlloc_Free(&runtime·mheap.specialprofilealloc, sp);
 		runtime·unlock(&runtime·mheap.speciallock);
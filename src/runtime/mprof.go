@@ -11,7 +11,11 @@ import (
 	"unsafe"
 )
 
-// NOTE(rsc): Everything here could use cas if contention became an issue.
+// proflock guards the bucket lists and the records in the buckets.
+// Events are not added to buckets as they happen: each P collects them
+// in its own profBuf and adds them in batches, so that recording an
+// allocation or blocking event rarely takes proflock.  Bucket lookup
+// takes no lock at all unless the bucket is new.
 var proflock mutex
 
 // All memory allocations are local and do not escape outside of the profiler.
@@ -21,12 +25,17 @@ const (
 	// profile types
 	memProfile bucketType = 1 + iota
 	blockProfile
+	mutexProfile
+	typeProfile
 
 	// size of bucket hash table
 	buckHashSize = 179999
 
 	// max depth of stack to record in bucket
 	maxStack = 32
+
+	// number of events a P holds before adding them to their buckets
+	profBufSize = 64
 )
 
 type bucketType int
@@ -42,14 +51,16 @@ type bucketType int
 type bucket struct {
 	next    *bucket
 	allnext *bucket
-	typ     bucketType // memBucket or blockBucket
+	typ     bucketType // memProfile, blockProfile, mutexProfile or typeProfile
 	hash    uintptr
 	size    uintptr
 	nstk    uintptr
+	t       *_type // typeProfile: the type counted; nil otherwise
 }
 
 // A memRecord is the bucket data for a bucket of type memProfile,
-// part of the memory profile.
+// part of the memory profile, or of type typeProfile, which counts the
+// same sampled allocations by type instead of by stack.
 type memRecord struct {
 	// The following complex 3-stage scheme of stats accumulation
 	// is required to obtain a consistent picture of mallocs and frees
@@ -82,7 +93,8 @@ type memRecord struct {
 }
 
 // A blockRecord is the bucket data for a bucket of type blockProfile,
-// part of the blocking profile.
+// part of the blocking profile, or of type mutexProfile, part of the
+// mutex contention profile.
 type blockRecord struct {
 	count  int64
 	cycles int64
@@ -91,6 +103,8 @@ type blockRecord struct {
 var (
 	mbuckets  *bucket // memory profile buckets
 	bbuckets  *bucket // blocking profile buckets
+	xbuckets  *bucket // mutex profile buckets
+	tbuckets  *bucket // heap type buckets
 	buckhash  *[179999]*bucket
 	bucketmem uintptr
 )
@@ -101,9 +115,9 @@ func newBucket(typ bucketType, nstk int) *bucket {
 	switch typ {
 	default:
 		gothrow("invalid profile bucket type")
-	case memProfile:
+	case memProfile, typeProfile:
 		size += unsafe.Sizeof(memRecord{})
-	case blockProfile:
+	case blockProfile, mutexProfile:
 		size += unsafe.Sizeof(blockRecord{})
 	}
 
@@ -120,31 +134,47 @@ func (b *bucket) stk() []uintptr {
 	return stk[:b.nstk:b.nstk]
 }
 
-// mp returns the memRecord associated with the memProfile bucket b.
+// mp returns the memRecord associated with the memProfile or
+// typeProfile bucket b.
 func (b *bucket) mp() *memRecord {
-	if b.typ != memProfile {
+	if b.typ != memProfile && b.typ != typeProfile {
 		gothrow("bad use of bucket.mp")
 	}
 	data := add(unsafe.Pointer(b), unsafe.Sizeof(*b)+b.nstk*unsafe.Sizeof(uintptr(0)))
 	return (*memRecord)(data)
 }
 
-// bp returns the blockRecord associated with the blockProfile bucket b.
+// bp returns the blockRecord associated with the blockProfile or
+// mutexProfile bucket b.
 func (b *bucket) bp() *blockRecord {
-	if b.typ != blockProfile {
+	if b.typ != blockProfile && b.typ != mutexProfile {
 		gothrow("bad use of bucket.bp")
 	}
 	data := add(unsafe.Pointer(b), unsafe.Sizeof(*b)+b.nstk*unsafe.Sizeof(uintptr(0)))
 	return (*blockRecord)(data)
 }
 
-// Return the bucket for stk[0:nstk], allocating new bucket if needed.
-func stkbucket(typ bucketType, size uintptr, stk []uintptr, alloc bool) *bucket {
-	if buckhash == nil {
-		buckhash = (*[buckHashSize]*bucket)(sysAlloc(unsafe.Sizeof(*buckhash), &memstats.buckhash_sys))
+// Return the bucket for stk[0:nstk], or for type t if typ is
+// typeProfile, allocating new bucket if needed.
+// Buckets are only ever pushed onto the front of a hash chain, after
+// they are filled in, so finding an existing bucket needs no lock.
+// Adding one takes proflock.
+func stkbucket(typ bucketType, t *_type, size uintptr, stk []uintptr, alloc bool) *bucket {
+	bh := (*[buckHashSize]*bucket)(atomicloadp(unsafe.Pointer(&buckhash)))
+	if bh == nil {
+		if !alloc {
+			return nil
+		}
+		lock(&proflock)
 		if buckhash == nil {
-			gothrow("runtime: cannot allocate memory")
+			bh = (*[buckHashSize]*bucket)(sysAlloc(unsafe.Sizeof(*buckhash), &memstats.buckhash_sys))
+			if bh == nil {
+				gothrow("runtime: cannot allocate memory")
+			}
+			atomicstorep(unsafe.Pointer(&buckhash), unsafe.Pointer(bh))
 		}
+		bh = buckhash
+		unlock(&proflock)
 	}
 
 	// Hash stack.
@@ -154,42 +184,66 @@ func stkbucket(typ bucketType, size uintptr, stk []uintptr, alloc bool) *bucket
 		h += h << 10
 		h ^= h >> 6
 	}
-	// hash in size
+	// hash in size and type
 	h += size
 	h += h << 10
 	h ^= h >> 6
+	h += uintptr(unsafe.Pointer(t))
+	h += h << 10
+	h ^= h >> 6
 	// finalize
 	h += h << 3
 	h ^= h >> 11
 
 	i := int(h % buckHashSize)
-	for b := buckhash[i]; b != nil; b = b.next {
-		if b.typ == typ && b.hash == h && b.size == size && eqslice(b.stk(), stk) {
-			return b
-		}
+	b := findbucket(bh, i, typ, t, h, size, stk)
+	if b != nil || !alloc {
+		return b
 	}
 
-	if !alloc {
-		return nil
+	lock(&proflock)
+	// Another P may have added the bucket since we looked.
+	if b = findbucket(bh, i, typ, t, h, size, stk); b != nil {
+		unlock(&proflock)
+		return b
 	}
 
 	// Create new bucket.
-	b := newBucket(typ, len(stk))
+	b = newBucket(typ, len(stk))
 	copy(b.stk(), stk)
 	b.hash = h
 	b.size = size
-	b.next = buckhash[i]
-	buckhash[i] = b
-	if typ == memProfile {
+	b.t = t
+	b.next = bh[i]
+	atomicstorep(unsafe.Pointer(&bh[i]), unsafe.Pointer(b))
+	switch typ {
+	case memProfile:
 		b.allnext = mbuckets
 		mbuckets = b
-	} else {
+	case typeProfile:
+		b.allnext = tbuckets
+		tbuckets = b
+	case mutexProfile:
+		b.allnext = xbuckets
+		xbuckets = b
+	default:
 		b.allnext = bbuckets
 		bbuckets = b
 	}
+	unlock(&proflock)
 	return b
 }
 
+// findbucket returns the bucket in chain i of bh that matches, or nil.
+func findbucket(bh *[buckHashSize]*bucket, i int, typ bucketType, t *_type, h, size uintptr, stk []uintptr) *bucket {
+	for b := (*bucket)(atomicloadp(unsafe.Pointer(&bh[i]))); b != nil; b = b.next {
+		if b.typ == typ && b.hash == h && b.size == size && b.t == t && eqslice(b.stk(), stk) {
+			return b
+		}
+	}
+	return nil
+}
+
 func sysAlloc(n uintptr, stat *uint64) unsafe.Pointer
 
 func eqslice(x, y []uintptr) bool {
@@ -205,7 +259,12 @@ func eqslice(x, y []uintptr) bool {
 }
 
 func mprof_GC() {
-	for b := mbuckets; b != nil; b = b.allnext {
+	mprof_GCbuckets(mbuckets)
+	mprof_GCbuckets(tbuckets)
+}
+
+func mprof_GCbuckets(list *bucket) {
+	for b := list; b != nil; b = b.allnext {
 		mp := b.mp()
 		mp.allocs += mp.prev_allocs
 		mp.frees += mp.prev_frees
@@ -225,51 +284,160 @@ func mprof_GC() {
 }
 
 // Record that a gc just happened: all the 'recent' statistics are now real.
+// Events still waiting in the Ps' buffers happened before the GC, so they
+// go into their buckets first.
 func mProf_GC() {
+	profflushall()
 	lock(&proflock)
 	mprof_GC()
 	unlock(&proflock)
 }
 
-// Called by malloc to record a profiled block.
-func mProf_Malloc(p unsafe.Pointer, size uintptr) {
+// Called by malloc to record a profiled block of type t (the element
+// type, for an array), or nil if malloc was not told.  The block is
+// counted once by stack and, if t is known, once more by type.
+func mProf_Malloc(p unsafe.Pointer, size uintptr, t *_type) {
 	var stk [maxStack]uintptr
 	nstk := callers(4, &stk[0], len(stk))
-	lock(&proflock)
-	b := stkbucket(memProfile, size, stk[:nstk], true)
-	mp := b.mp()
-	mp.recent_allocs++
-	mp.recent_alloc_bytes += size
-	unlock(&proflock)
+	b := stkbucket(memProfile, nil, size, stk[:nstk], true)
+	profevent(b, profMalloc, int64(size))
+	var tb *bucket
+	if t != nil {
+		tb = stkbucket(typeProfile, t, 0, nil, true)
+		profevent(tb, profMalloc, int64(size))
+	}
 
 	// Setprofilebucket locks a bunch of other mutexes, so we call it outside of proflock.
 	// This reduces potential contention and chances of deadlocks.
 	// Since the object must be alive during call to mProf_Malloc,
 	// it's fine to do this non-atomically.
-	setprofilebucket(p, b)
+	setprofilebucket(p, b, tb)
 }
 
 func setprofilebucket_m() // mheap.c
 
-func setprofilebucket(p unsafe.Pointer, b *bucket) {
+func setprofilebucket(p unsafe.Pointer, b, tb *bucket) {
 	g := getg()
 	g.m.ptrarg[0] = p
 	g.m.ptrarg[1] = unsafe.Pointer(b)
+	g.m.ptrarg[2] = unsafe.Pointer(tb)
 	onM(setprofilebucket_m)
 }
 
 // Called when freeing a profiled block.
 func mProf_Free(b *bucket, size uintptr, freed bool) {
-	lock(&proflock)
-	mp := b.mp()
 	if freed {
-		mp.recent_frees++
-		mp.recent_free_bytes += size
+		profevent(b, profFree, int64(size))
 	} else {
+		profevent(b, profSweepFree, int64(size))
+	}
+}
+
+// Kinds of profEvent.
+const (
+	profMalloc    = 1 + iota // allocation of value bytes
+	profFree                 // explicit free of value bytes
+	profSweepFree            // free of value bytes found by the sweeper
+	profBlock                // wait of value cycles
+)
+
+// A profEvent is a profile event that has yet to be added to bucket b.
+type profEvent struct {
+	b     *bucket
+	value int64
+	kind  uintptr
+}
+
+// A profBuf holds the profile events recorded on one P.  It hangs off
+// the P's profbuf field and is never freed.
+type profBuf struct {
+	lock mutex // taken before proflock
+	n    int
+	ev   [profBufSize]profEvent
+}
+
+// profevent records an event of the given kind against bucket b.  The
+// event goes into the current P's buffer, which is added to the buckets
+// under proflock when it fills up, when a profile is read and at each
+// GC.  Without a P, the event goes straight into b.
+func profevent(b *bucket, kind uintptr, value int64) {
+	mp := acquirem()
+	pp := mp.p
+	if pp == nil {
+		lock(&proflock)
+		profapply(&profEvent{b, value, kind})
+		unlock(&proflock)
+		releasem(mp)
+		return
+	}
+	pb := (*profBuf)(atomicloadp(unsafe.Pointer(&pp.profbuf)))
+	if pb == nil {
+		// Only this P's owner allocates its buffer.
+		pb = (*profBuf)(persistentalloc(unsafe.Sizeof(profBuf{}), 0, &memstats.buckhash_sys))
+		atomicstorep(unsafe.Pointer(&pp.profbuf), unsafe.Pointer(pb))
+	}
+	lock(&pb.lock)
+	if pb.n == len(pb.ev) {
+		lock(&proflock)
+		profflush(pb)
+		unlock(&proflock)
+	}
+	pb.ev[pb.n] = profEvent{b, value, kind}
+	pb.n++
+	unlock(&pb.lock)
+	releasem(mp)
+}
+
+// profflush adds the events in pb to their buckets.  The caller holds
+// pb.lock and proflock.
+func profflush(pb *profBuf) {
+	for i := 0; i < pb.n; i++ {
+		profapply(&pb.ev[i])
+	}
+	pb.n = 0
+}
+
+// profflushall adds the events in every P's buffer to their buckets.
+// Events recorded meanwhile on other Ps may or may not be included.
+func profflushall() {
+	for _, pp := range &allp {
+		if pp == nil {
+			break
+		}
+		pb := (*profBuf)(atomicloadp(unsafe.Pointer(&pp.profbuf)))
+		if pb == nil {
+			continue
+		}
+		lock(&pb.lock)
+		lock(&proflock)
+		profflush(pb)
+		unlock(&proflock)
+		unlock(&pb.lock)
+	}
+}
+
+// profapply adds e to its bucket.  The caller holds proflock.
+func profapply(e *profEvent) {
+	switch e.kind {
+	case profMalloc:
+		mp := e.b.mp()
+		mp.recent_allocs++
+		mp.recent_alloc_bytes += uintptr(e.value)
+	case profFree:
+		mp := e.b.mp()
+		mp.recent_frees++
+		mp.recent_free_bytes += uintptr(e.value)
+	case profSweepFree:
+		mp := e.b.mp()
 		mp.prev_frees++
-		mp.prev_free_bytes += size
+		mp.prev_free_bytes += uintptr(e.value)
+	case profBlock:
+		bp := e.b.bp()
+		bp.count++
+		bp.cycles += e.value
+	default:
+		gothrow("bad profile event")
 	}
-	unlock(&proflock)
 }
 
 var blockprofilerate uint64 // in CPU ticks
@@ -305,6 +473,12 @@ func blockevent(cycles int64, skip int) {
 	if rate <= 0 || (rate > cycles && int64(fastrand1())%rate > cycles) {
 		return
 	}
+	saveblockevent(cycles, skip+1, blockProfile)
+}
+
+// saveblockevent records an event of cycles in the profile of type typ,
+// blaming the caller skip frames up.
+func saveblockevent(cycles int64, skip int, typ bucketType) {
 	gp := getg()
 	var nstk int
 	var stk [maxStack]uintptr
@@ -313,11 +487,37 @@ func blockevent(cycles int64, skip int) {
 	} else {
 		nstk = gcallers(gp.m.curg, skip, &stk[0], len(stk))
 	}
-	lock(&proflock)
-	b := stkbucket(blockProfile, 0, stk[:nstk], true)
-	b.bp().count++
-	b.bp().cycles += cycles
-	unlock(&proflock)
+	b := stkbucket(typ, nil, 0, stk[:nstk], true)
+	profevent(b, profBlock, cycles)
+}
+
+var mutexprofilerate uint64 // fraction sampled
+
+// SetMutexProfileFraction controls the fraction of mutex contention events
+// that are reported in the mutex profile.  On average 1/rate events are
+// reported.  The previous rate is returned.
+//
+// To turn off profiling entirely, pass rate 0.
+// To just read the current rate, pass rate < 0.
+func SetMutexProfileFraction(rate int) int {
+	if rate < 0 {
+		return int(atomicload64(&mutexprofilerate))
+	}
+	old := xchg64(&mutexprofilerate, uint64(rate))
+	return int(old)
+}
+
+// mutexevent records that a goroutine waited cycles for a sync.Mutex or
+// sync.RWMutex, blaming the code that released it: that is where the
+// lock was held too long.
+func mutexevent(cycles int64, skip int) {
+	if cycles < 0 {
+		cycles = 0
+	}
+	rate := int64(atomicload64(&mutexprofilerate))
+	if rate > 0 && int64(fastrand1())%rate == 0 {
+		saveblockevent(cycles, skip+1, mutexProfile)
+	}
 }
 
 // Go interface to profile data.
@@ -394,31 +594,14 @@ func (r *MemProfileRecord) Stack() []uintptr {
 // the testing package's -test.memprofile flag instead
 // of calling MemProfile directly.
 func MemProfile(p []MemProfileRecord, inuseZero bool) (n int, ok bool) {
+	profflushall()
 	lock(&proflock)
-	clear := true
+	mprof_fill()
 	for b := mbuckets; b != nil; b = b.allnext {
 		mp := b.mp()
 		if inuseZero || mp.alloc_bytes != mp.free_bytes {
 			n++
 		}
-		if mp.allocs != 0 || mp.frees != 0 {
-			clear = false
-		}
-	}
-	if clear {
-		// Absolutely no data, suggesting that a garbage collection
-		// has not yet happened. In order to allow profiling when
-		// garbage collection is disabled from the beginning of execution,
-		// accumulate stats as if a GC just happened, and recount buckets.
-		mprof_GC()
-		mprof_GC()
-		n = 0
-		for b := mbuckets; b != nil; b = b.allnext {
-			mp := b.mp()
-			if inuseZero || mp.alloc_bytes != mp.free_bytes {
-				n++
-			}
-		}
 	}
 	if n <= len(p) {
 		ok = true
@@ -435,6 +618,55 @@ func MemProfile(p []MemProfileRecord, inuseZero bool) (n int, ok bool) {
 	return
 }
 
+// MemProfileFunc calls fn with each record of the current memory profile,
+// the ones MemProfile would return, until fn returns false.  Unlike
+// MemProfile, it needs no slice as large as the whole profile.  The
+// record passed to fn is reused for the next call, so fn must copy
+// anything it keeps.
+//
+// fn runs with no runtime locks held, so it may allocate.  Records for
+// call sequences first seen while MemProfileFunc runs are not reported.
+func MemProfileFunc(inuseZero bool, fn func(r *MemProfileRecord) bool) {
+	profflushall()
+	lock(&proflock)
+	mprof_fill()
+	first := mbuckets
+	unlock(&proflock)
+
+	// Buckets are only added at the head of the list, so the rest of
+	// the list stays as it was when we took first.
+	r := new(MemProfileRecord)
+	for b := first; b != nil; b = b.allnext {
+		lock(&proflock)
+		mp := b.mp()
+		ok := inuseZero || mp.alloc_bytes != mp.free_bytes
+		if ok {
+			record(r, b)
+		}
+		unlock(&proflock)
+		if ok && !fn(r) {
+			return
+		}
+	}
+}
+
+// mprof_fill makes sure the memory profile has something to report.
+// The caller holds proflock.
+func mprof_fill() {
+	for b := mbuckets; b != nil; b = b.allnext {
+		mp := b.mp()
+		if mp.allocs != 0 || mp.frees != 0 {
+			return
+		}
+	}
+	// Absolutely no data, suggesting that a garbage collection
+	// has not yet happened. In order to allow profiling when
+	// garbage collection is disabled from the beginning of execution,
+	// accumulate stats as if a GC just happened.
+	mprof_GC()
+	mprof_GC()
+}
+
 // Write b's data to r.
 func record(r *MemProfileRecord, b *bucket) {
 	mp := b.mp()
@@ -448,7 +680,31 @@ func record(r *MemProfileRecord, b *bucket) {
 	}
 }
 
+// heaptypes calls fn with the name of each type seen by the memory
+// profiler and the number of sampled objects and bytes of it still in
+// use.  Like MemProfileFunc, it runs fn with no runtime locks held.
+// It is runtime/pprof's way in; the records are not part of MemProfile.
+func heaptypes(fn func(typ string, objects, bytes int64)) {
+	profflushall()
+	lock(&proflock)
+	mprof_fill()
+	first := tbuckets
+	unlock(&proflock)
+
+	for b := first; b != nil; b = b.allnext {
+		lock(&proflock)
+		mp := b.mp()
+		objects := int64(mp.allocs) - int64(mp.frees)
+		bytes := int64(mp.alloc_bytes) - int64(mp.free_bytes)
+		unlock(&proflock)
+		if objects != 0 || bytes != 0 {
+			fn(*b.t._string, objects, bytes)
+		}
+	}
+}
+
 func iterate_memprof(fn func(*bucket, uintptr, *uintptr, uintptr, uintptr, uintptr)) {
+	profflushall()
 	lock(&proflock)
 	for b := mbuckets; b != nil; b = b.allnext {
 		mp := b.mp()
@@ -473,6 +729,7 @@ type BlockProfileRecord struct {
 // the testing package's -test.blockprofile flag instead
 // of calling BlockProfile directly.
 func BlockProfile(p []BlockProfileRecord) (n int, ok bool) {
+	profflushall()
 	lock(&proflock)
 	for b := bbuckets; b != nil; b = b.allnext {
 		n++
@@ -480,14 +737,7 @@ func BlockProfile(p []BlockProfileRecord) (n int, ok bool) {
 	if n <= len(p) {
 		ok = true
 		for b := bbuckets; b != nil; b = b.allnext {
-			bp := b.bp()
-			r := &p[0]
-			r.Count = int64(bp.count)
-			r.Cycles = int64(bp.cycles)
-			i := copy(r.Stack0[:], b.stk())
-			for ; i < len(r.Stack0); i++ {
-				r.Stack0[i] = 0
-			}
+			blockrecord(&p[0], b)
 			p = p[1:]
 		}
 	}
@@ -495,6 +745,76 @@ func BlockProfile(p []BlockProfileRecord) (n int, ok bool) {
 	return
 }
 
+// BlockProfileFunc calls fn with each record of the current blocking
+// profile until fn returns false.  It is to BlockProfile what
+// MemProfileFunc is to MemProfile.
+func BlockProfileFunc(fn func(r *BlockProfileRecord) bool) {
+	profflushall()
+	lock(&proflock)
+	first := bbuckets
+	unlock(&proflock)
+	blockprofilefunc(first, fn)
+}
+
+// blockprofilefunc calls fn with the record of each bucket in the list
+// starting at b until fn returns false.
+func blockprofilefunc(b *bucket, fn func(r *BlockProfileRecord) bool) {
+	r := new(BlockProfileRecord)
+	for ; b != nil; b = b.allnext {
+		lock(&proflock)
+		blockrecord(r, b)
+		unlock(&proflock)
+		if !fn(r) {
+			return
+		}
+	}
+}
+
+// Write b's data to r.
+func blockrecord(r *BlockProfileRecord, b *bucket) {
+	bp := b.bp()
+	r.Count = int64(bp.count)
+	r.Cycles = int64(bp.cycles)
+	i := copy(r.Stack0[:], b.stk())
+	for ; i < len(r.Stack0); i++ {
+		r.Stack0[i] = 0
+	}
+}
+
+// MutexProfile returns n, the number of records in the current mutex profile.
+// If len(p) >= n, MutexProfile copies the profile into p and returns n, true.
+// Otherwise, MutexProfile does not change p, and returns n, false.
+//
+// Most clients should use the runtime/pprof package
+// instead of calling MutexProfile directly.
+func MutexProfile(p []BlockProfileRecord) (n int, ok bool) {
+	profflushall()
+	lock(&proflock)
+	for b := xbuckets; b != nil; b = b.allnext {
+		n++
+	}
+	if n <= len(p) {
+		ok = true
+		for b := xbuckets; b != nil; b = b.allnext {
+			blockrecord(&p[0], b)
+			p = p[1:]
+		}
+	}
+	unlock(&proflock)
+	return
+}
+
+// MutexProfileFunc calls fn with each record of the current mutex
+// profile until fn returns false, as BlockProfileFunc does for the
+// blocking profile.
+func MutexProfileFunc(fn func(r *BlockProfileRecord) bool) {
+	profflushall()
+	lock(&proflock)
+	first := xbuckets
+	unlock(&proflock)
+	blockprofilefunc(first, fn)
+}
+
 // ThreadCreateProfile returns n, the number of records in the thread creation profile.
 // If len(p) >= n, ThreadCreateProfile copies the profile into p and returns n, true.
 // If len(p) < n, ThreadCreateProfile does not change p and returns n, false.
@@ -510,9 +830,46 @@ func ThreadCreateProfile(p []StackRecord) (n int, ok bool) {
 		ok = true
 		i := 0
 		for mp := first; mp != nil; mp = mp.alllink {
-			for s := range mp.createstack {
-				p[i].Stack0[s] = uintptr(mp.createstack[s])
-			}
+			copy(p[i].Stack0[:], mp.createstack[:])
+			i++
+		}
+	}
+	return
+}
+
+// A ThreadCreateRecord describes the creation of one OS thread.
+type ThreadCreateRecord struct {
+	ID     int64       // the thread's M ID, as in scheduler traces
+	Vcore  int         // Akaros vcore the creating thread ran on, or -1
+	Stack0 [64]uintptr // stack that created the thread; ends at first 0 entry
+}
+
+// Stack returns the stack trace associated with the record,
+// a prefix of r.Stack0.
+func (r *ThreadCreateRecord) Stack() []uintptr {
+	for i, v := range r.Stack0 {
+		if v == 0 {
+			return r.Stack0[0:i]
+		}
+	}
+	return r.Stack0[0:]
+}
+
+// ThreadCreateRecords is like ThreadCreateProfile, but each record also
+// says which thread it describes and where it was created, and holds a
+// deeper stack, so that a leak of threads can be traced to its cause.
+func ThreadCreateRecords(p []ThreadCreateRecord) (n int, ok bool) {
+	first := (*m)(atomicloadp(unsafe.Pointer(&allm)))
+	for mp := first; mp != nil; mp = mp.alllink {
+		n++
+	}
+	if n <= len(p) {
+		ok = true
+		i := 0
+		for mp := first; mp != nil; mp = mp.alllink {
+			p[i].ID = int64(mp.id)
+			p[i].Vcore = int(mp.createvcore)
+			copy(p[i].Stack0[:], mp.createstack[:])
 			i++
 		}
 	}
@@ -574,14 +931,11 @@ func saveg(pc, sp uintptr, gp *g, r *StackRecord) {
 // and returns the number of bytes written to buf.
 // If all is true, Stack formats stack traces of all other goroutines
 // into buf after the trace for the current goroutine.
+//
+// Stack does not stop the world to trace other goroutines: each is held
+// still only while its own trace is formatted, so the traces are not all
+// from the same instant.
 func Stack(buf []byte, all bool) int {
-	if all {
-		semacquire(&worldsema, false)
-		gp := getg()
-		gp.m.gcing = 1
-		onM(stoptheworld)
-	}
-
 	n := 0
 	if len(buf) > 0 {
 		gp := getg()
@@ -593,20 +947,51 @@ func Stack(buf []byte, all bool) int {
 			goroutineheader(gp)
 			traceback(pc, sp, 0, gp)
 			if all {
-				tracebackothers(gp)
+				tracebackothersconc(gp)
 			}
 			n = len(g0.writebuf)
 			g0.writebuf = nil
 		})
 	}
+	return n
+}
 
-	if all {
-		gp := getg()
-		gp.m.gcing = 0
-		semrelease(&worldsema)
-		onM(starttheworld)
+// StackOf formats a stack trace of the goroutine with the given ID, as
+// shown in the traces Stack formats, into buf.  It returns the number of
+// bytes written to buf and whether the goroutine exists.  Like Stack, it
+// does not stop the world: only the goroutine traced is held still, and
+// only while its trace is formatted.  If that goroutine is running on
+// another thread and does not stop soon, the trace says so in place of
+// the stack.  StackOf writes nothing and reports false if buf is empty.
+func StackOf(goid int64, buf []byte) (n int, ok bool) {
+	if len(buf) == 0 {
+		return 0, false
 	}
-	return n
+	gp := getg()
+	sp := getcallersp(unsafe.Pointer(&goid))
+	pc := getcallerpc(unsafe.Pointer(&goid))
+	onM(func() {
+		g0 := getg()
+		g0.writebuf = buf[0:0:len(buf)]
+		if gp.goid == goid {
+			goroutineheader(gp)
+			traceback(pc, sp, 0, gp)
+			ok = true
+		} else {
+			lock(&allglock)
+			gs := allgs
+			unlock(&allglock)
+			for _, gp1 := range gs {
+				if gp1.goid == goid {
+					ok = tracebackg(gp1, false)
+					break
+				}
+			}
+		}
+		n = len(g0.writebuf)
+		g0.writebuf = nil
+	})
+	return
 }
 
 // Tracing of alloc/free/gc.
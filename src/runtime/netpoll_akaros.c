@@ -4,25 +4,165 @@
 
 #include "runtime.h"
 #include "defs_GOOS_GOARCH.h"
+#include "os_GOOS.h"
+#include "malloc.h"
 
+// Integrated network poller for Akaros, built on FD taps.
+//
+// Every pollable descriptor is tapped for readability, writability,
+// errors and hangups, with all taps reporting to one event queue.  The
+// kernel posts an event when a condition arises, edge-triggered like
+// epoll with EPOLLET; its type is PollTapBase plus the descriptor and its
+// ev_arg2 holds the conditions.  Events carry no user pointer, so pollfds
+// maps descriptors back to their PollDesc.  An event for a descriptor
+// closed since it was posted finds no entry there and is dropped; one
+// that reaches a descriptor number already reused merely causes a
+// spurious wakeup, which the net package tolerates.
+//
+// The same queue receives the completions of system calls that package
+// syscall issues asynchronously.  A goroutine making a call that blocks
+// in the kernel parks, rather than holding an M, until netpoll sees the
+// call's EV_SYSCALL event and makes it runnable again.
+//
+// Once os/signal asks for a signal, the queue also takes the process's
+// EV_POSIX_SIGNAL events, which runtime·sigevent passes on (see
+// signal_akaros.c).
+
+enum
+{
+	PollTapFilter = FDTAP_FILT_READABLE | FDTAP_FILT_WRITABLE |
+	                FDTAP_FILT_ERROR | FDTAP_FILT_HANGUP,
+	PollTapBase = NR_EVENT_TYPES,	// event types below are the kernel's
+	PollMaxFd = (1<<16) - PollTapBase,	// event types are 16 bits
+};
+
+static EventQueue *pollevq;
+static Mutex polllock;
+static PollDesc **pollfds;	// indexed by descriptor, guarded by polllock
+static uintptr npollfds;
+static String asyncreason;
+static bool pollsignals;	// guarded by polllock
+
+void	runtime·park_m(G*);
+
+// Called both by the net package and by package syscall, whichever
+// needs the poller first.
 void
 runtime·netpollinit(void)
 {
+	runtime·lock(&polllock);
+	if(pollevq != nil) {
+		runtime·unlock(&polllock);
+		return;
+	}
+	asyncreason = runtime·gostringnocopy((byte*)"syscall");
+	pollevq = runtime·evqnew();
+	if(pollevq == nil)
+		runtime·throw("netpollinit: failed to create event queue");
+	runtime·unlock(&polllock);
+	runtime·startstamps[StartPoller] = runtime·nanotime();
+	if(runtime·debug.starttrace > 0)
+		runtime·printf("startup: poller %Dus\n",
+		               (runtime·startstamps[StartPoller] - runtime·startstamps[StartOsinit])/1000);
+}
+
+// Route the process's POSIX signals through the poller from now on,
+// starting it if need be.
+void
+runtime·netpollsignals(void)
+{
+	runtime·netpollinit();
+	runtime·lock(&polllock);
+	if(!pollsignals) {
+		pollsignals = true;
+		runtime·evqsignals(pollevq);
+	}
+	runtime·unlock(&polllock);
+}
+
+// Record pd as the PollDesc of fd.  The table only grows; the old one
+// stays behind in persistent memory.
+static void
+setpollfd(uintptr fd, PollDesc *pd)
+{
+	PollDesc **tab;
+	uintptr n;
+
+	runtime·lock(&polllock);
+	if(fd >= npollfds) {
+		n = npollfds ? npollfds : 64;
+		while(n <= fd)
+			n *= 2;
+		tab = runtime·persistentalloc(n*sizeof tab[0], 0, &mstats.other_sys);
+		if(npollfds > 0)
+			runtime·memmove(tab, pollfds, npollfds*sizeof tab[0]);
+		pollfds = tab;
+		npollfds = n;
+	}
+	pollfds[fd] = pd;
+	runtime·unlock(&polllock);
 }
 
 int32
 runtime·netpollopen(uintptr fd, PollDesc *pd)
 {
-	USED(fd);
-	USED(pd);
-	return 0;
+	int32 errno;
+
+	if(fd >= PollMaxFd)
+		return EBADF;
+	setpollfd(fd, pd);
+	errno = runtime·tapfd(fd, FDTAP_CMD_ADD, PollTapFilter, PollTapBase+fd, pollevq);
+	if(errno != 0)
+		setpollfd(fd, nil);
+	return errno;
 }
 
 int32
 runtime·netpollclose(uintptr fd)
 {
-	USED(fd);
-	return 0;
+	int32 errno;
+
+	errno = runtime·tapfd(fd, FDTAP_CMD_REM, 0, PollTapBase+fd, pollevq);
+	setpollfd(fd, nil);
+	return errno;
+}
+
+// Hand the event in msg to the goroutines waiting for it.
+static void
+pollevent(G **gpp, EventMsg *msg)
+{
+	PollDesc *pd;
+	G *gp;
+	uintptr fd;
+	int32 mode;
+
+	if(msg->ev_type == EV_SYSCALL) {
+		gp = (G*)((SyscallArg*)msg->ev_arg3)->u_data;
+		gp->schedlink = *gpp;
+		*gpp = gp;
+		return;
+	}
+	if(msg->ev_type == EV_POSIX_SIGNAL) {
+		runtime·sigevent(msg->ev_arg1);
+		return;
+	}
+	if(msg->ev_type < PollTapBase)
+		return;
+	fd = msg->ev_type - PollTapBase;
+	mode = 0;
+	if(msg->ev_arg2 & (FDTAP_FILT_READABLE|FDTAP_FILT_HANGUP|FDTAP_FILT_ERROR))
+		mode += 'r';
+	if(msg->ev_arg2 & (FDTAP_FILT_WRITABLE|FDTAP_FILT_HANGUP|FDTAP_FILT_ERROR))
+		mode += 'w';
+	if(mode == 0)
+		return;
+	runtime·lock(&polllock);
+	pd = nil;
+	if(fd < npollfds)
+		pd = pollfds[fd];
+	runtime·unlock(&polllock);
+	if(pd != nil)
+		runtime·netpollready(gpp, pd, mode);
 }
 
 // polls for ready network connections
@@ -30,6 +170,58 @@ runtime·netpollclose(uintptr fd)
 G*
 runtime·netpoll(bool block)
 {
-	USED(block);
-	return nil;
+	EventMsg msg;
+	G *gp;
+
+	if(pollevq == nil)
+		return nil;
+	gp = nil;
+	while(runtime·evqnext(pollevq, &msg, false))
+		pollevent(&gp, &msg);
+	// Nothing was ready; the scheduler has nothing else to do, so wait
+	// on the queue, then collect whatever arrived along with the first
+	// event.
+	while(block && gp == nil) {
+		runtime·evqnext(pollevq, &msg, true);
+		pollevent(&gp, &msg);
+		while(runtime·evqnext(pollevq, &msg, false))
+			pollevent(&gp, &msg);
+	}
+	return gp;
+}
+
+// runtime·park_m continuation of syscall·runtime_syscallAsync, on g0
+// with gp already waiting.  Issues the call with its completion posted to
+// pollevq; if the call is done at once, returns false to resume gp.  Once
+// submitted, the call may complete and gp run again on another M before
+// this returns.
+static bool
+asyncsubmit(G *gp, void *sysc)
+{
+	((SyscallArg*)sysc)->u_data = (byte*)gp;
+	return !runtime·syscallsubmit(sysc, pollevq);
+}
+
+// Issue the system call sysc for package syscall and wait for it with the
+// goroutine parked, leaving its M free to run others.  Reports false,
+// having done nothing, if the poller is not running or the goroutine
+// cannot park.  The call and its arguments may point into the goroutine's
+// stack, which runtime·shrinkstack leaves alone while g->usysc is set;
+// nothing here may grow it.
+#pragma textflag NOSPLIT
+void
+syscall·runtime_syscallAsync(SyscallArg *sysc, bool ok)
+{
+	void (*fn)(G*);
+
+	ok = false;
+	if(pollevq != nil && g->m->locks == 0 && g->m->mallocing == 0) {
+		g->m->waitlock = sysc;
+		g->m->waitunlockf = asyncsubmit;
+		g->waitreason = asyncreason;
+		fn = runtime·park_m;
+		runtime·mcall(&fn);
+		ok = true;
+	}
+	FLUSH(&ok);
 }
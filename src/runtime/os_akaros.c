@@ -13,32 +13,96 @@ void runtime·setldt(void)
 	// Do nothing for now
 }
 
+// Locks and notes (lock_sema.go) park an M on a semaphore of its own:
+// the count in m->waitsemacount and a kernel alarm, m->waitalarm, that
+// semawakeup sets to go off at once.  The sleeper blocks its uthread on
+// the alarm's event queue, so an M with nothing to do costs nothing, and
+// a vcore left with no Ms to run yields to the kernel until an event
+// wakes the process.  A timed sleep sets the same alarm for its deadline
+// instead of relying on parlib's futex timeouts, which round up and come
+// from a polling alarm of parlib's own.  Events outlive the sleep they
+// were meant for, so a sleeper woken with no count to take and its
+// deadline not yet reached just waits again.
+//
+// Without the #alarm device, the sleeper waits in a parlib futex on the
+// count instead.
+
 #pragma textflag NOSPLIT
-void
-runtime·futexsleep(uint32 *addr, uint32 val, int64 ns)
+uintptr
+runtime·semacreate(void)
+{
+	runtime·alarminit(&g->m->waitalarm);
+	return (uintptr)&g->m->waitalarm;
+}
+
+// Take one from the count, if there is one.
+#pragma textflag NOSPLIT
+static bool
+sematake(M *mp)
+{
+	uint32 n;
+
+	for(;;) {
+		n = runtime·atomicload(&mp->waitsemacount);
+		if(n == 0)
+			return false;
+		if(runtime·cas(&mp->waitsemacount, n, n-1))
+			return true;
+	}
+}
+
+#pragma textflag NOSPLIT
+int32
+runtime·semasleep(int64 ns)
 {
+	M *mp;
+	int64 deadline;
 	Timespec ts;
-	
-	if(ns < 0) {
-		runtime·futex(addr, FUTEX_WAIT, val, nil, nil, 0);
-		return;
+
+	mp = g->m;
+	deadline = 0;
+	if(ns >= 0)
+		deadline = runtime·nanotime() + ns;
+	for(;;) {
+		if(sematake(mp))
+			return 0;
+		if(ns >= 0) {
+			ns = deadline - runtime·nanotime();
+			if(ns <= 0)
+				return -1;
+		}
+		if(!mp->waitalarm.have) {
+			if(ns < 0) {
+				runtime·futex(&mp->waitsemacount, FUTEX_WAIT, 0, nil, nil, 0);
+				continue;
+			}
+			// NOTE: tv_nsec is int64 on amd64, so this assumes a little-endian system.
+			ts.tv_nsec = 0;
+			ts.tv_sec = runtime·timediv(ns, 1000000000LL, (int32*)&ts.tv_nsec);
+			runtime·futex(&mp->waitsemacount, FUTEX_WAIT, 0, &ts, nil, 0);
+			continue;
+		}
+		if(ns >= 0) {
+			runtime·alarmat(&mp->waitalarm, runtime·tscafter(ns));
+			// A semawakeup since the check above may have set
+			// the alarm to go off at once, only for this to
+			// replace the setting before it went off.
+			if(sematake(mp))
+				return 0;
+		}
+		runtime·alarmblock(&mp->waitalarm);
 	}
-	// NOTE: tv_nsec is int64 on amd64, so this assumes a little-endian system.
-	ts.tv_nsec = 0;
-	ts.tv_sec = runtime·timediv(ns, 1000000000LL, (int32*)&ts.tv_nsec);
-	runtime·futex(addr, FUTEX_WAIT, val, &ts, nil, 0);
 }
 
 #pragma textflag NOSPLIT
 void
-runtime·futexwakeup(uint32 *addr, uint32 cnt)
+runtime·semawakeup(M *mp)
 {
-	int32 ret = runtime·futex(addr, FUTEX_WAKE, cnt, nil, nil, 0);
-	if(ret >= 0)
-		return;
-
-	runtime·printf("futexwakeup addr=%p returned %d\n", addr, ret);
-	runtime·throw("runtime.futexwakeup");
+	runtime·xadd(&mp->waitsemacount, 1);
+	if(mp->waitalarm.have)
+		runtime·alarmat(&mp->waitalarm, runtime·cputicks());
+	else
+		runtime·futex(&mp->waitsemacount, FUTEX_WAKE, 1, nil, nil, 0);
 }
 
 void
@@ -54,6 +118,7 @@ runtime·newosproc(M *mp, void *stk)
 void
 runtime·osinit(void)
 {
+	runtime·startstamps[StartOsinit] = runtime·nanotime();
 	runtime·ncpu = MAX(__procinfo.max_vcores, 1);
 }
 
@@ -66,12 +131,327 @@ runtime·get_random_data(byte **rnd, int32 *rnd_len)
 	*rnd_len = 0;
 }
 
+typedef void (*gcc_call_t)(void *arg);
+
+// The scheduler watchdog is opt-in: GOWATCHDOG=n arms a parlib alarm that
+// fires every n seconds and checks that the runtime scheduled at least one
+// goroutine in the meantime, unless it had nothing to run.  If not, it
+// raises SIGQUIT so that we dump all goroutines along with the state in
+// runtime·akarosdump.
+#pragma cgo_import_static gcc_watchdog_start
+extern gcc_call_t gcc_watchdog_start;
+uint32 runtime·schedticks;
+static WatchdogArg watchdog;
+
+static void
+watchdoginit(void)
+{
+	byte *p;
+	int32 secs;
+
+	p = runtime·getenv("GOWATCHDOG");
+	if(p == nil || (secs = runtime·atoi(p)) <= 0)
+		return;
+	watchdog.period_usec = secs*1000000ULL;
+	watchdog.ticks = &runtime·schedticks;
+	watchdog.npidle = &runtime·sched.npidle;
+	watchdog.runqsize = &runtime·sched.runqsize;
+	watchdog.nprocs = &runtime·gomaxprocs;
+	runtime·asmcgocall(gcc_watchdog_start, &watchdog);
+}
+
+// GOSINGLECORE=1 runs the whole runtime on the single vcore the process
+// starts with: we never request another one, GOMAXPROCS is held at 1 and
+// sysmon does not preempt long-running goroutines, so goroutines only
+// switch at blocking points and explicit yields.  This makes scheduling
+// reproducible from run to run and keeps us off cores we were not given.
+#pragma cgo_import_static gcc_single_core
+extern gcc_call_t gcc_single_core;
+bool runtime·singlecore;
+
+static void
+singlecoreinit(void)
+{
+	byte *p;
+
+	p = runtime·getenv("GOSINGLECORE");
+	if(p == nil || runtime·atoi(p) <= 0)
+		return;
+	runtime·singlecore = true;
+	runtime·ncpu = 1;
+	runtime·asmcgocall(gcc_single_core, nil);
+}
+
+// Unless GOSINGLECORE asked for it, becoming an MCP is not optional for
+// a runtime that wants more than one vcore.  If the process may not have
+// more than one vcore anyway, gcc_mcp_init does not try: warn and carry
+// on exactly as GOSINGLECORE would, with runtime·mcperrno recording why
+// for syscall.MCPStatus.  A refusal from the kernel itself is not
+// recoverable: parlib's vcore_change_to_m asserts and the process dies.
+#pragma cgo_import_static gcc_mcp_init
+extern gcc_call_t gcc_mcp_init;
+extern int32 runtime·mcperrno;
+
+static void
+mcpinit(void)
+{
+	if(runtime·singlecore)
+		return;
+	runtime·asmcgocall(gcc_mcp_init, &runtime·mcperrno);
+	if(runtime·mcperrno == 0)
+		return;
+	runtime·printf("runtime: warning: cannot become an MCP (errno %d), running on a single vcore\n",
+	               runtime·mcperrno);
+	runtime·singlecore = true;
+	runtime·ncpu = 1;
+	runtime·asmcgocall(gcc_single_core, nil);
+}
+
+// Vcore requests.  Once we are an MCP, the runtime alone decides how many
+// vcores to ask the kernel for: one for each P that has work, so that
+// every running P has a core to itself, and never fewer than one.  Ps do
+// not run in vcore context: Ms are still pthreads, which parlib's
+// scheduler runs on whatever vcores we hold, but with requests following
+// the Ps rather than the threads, GOMAXPROCS bounds the cores the process
+// claims and an idle program gives its cores back.  startm raises the
+// request as Ps get busy and sysmon lowers it again as they go idle.
+//
+// The request is not ours alone, though: a vcore that parlib finds with
+// nothing to run yields to the kernel, and takes itself off the request
+// as it goes.  That is how an idle program ends up on no cores at all,
+// but it leaves runtime·vcoreswanted above what the kernel was last
+// asked for, and the next startm would see nothing to change.  So when
+// renew is set, as it is for sysmon, ask again for any vcores we want
+// but do not hold.  The kernel may have no cores to give, and sysmon runs
+// every 20us while the program is busy, so renewals back off: after one
+// that leaves us short, the next waits twice as long, from 1ms up to 1s,
+// until we hold what we want or the count changes.
+//
+// Requests are made under vcorelock, with the count worked out again
+// once it is held, so that the last request the kernel sees is for the
+// latest count rather than whichever of two racing Ms got there last.
+#pragma cgo_import_static gcc_vcore_request
+extern gcc_call_t gcc_vcore_request;
+int32 runtime·vcoreswanted;
+static Mutex vcorelock;
+static int64 renewwait;	// backoff between renewals, in ns; under vcorelock
+static int64 renewnext;	// nanotime of the next renewal; under vcorelock
+
+enum
+{
+	RenewWaitMin = 1000*1000,
+	RenewWaitMax = 1000*1000*1000,
+};
+
+static int32
+vcorestowant(void)
+{
+	int32 want;
+
+	want = runtime·gomaxprocs - (int32)runtime·atomicload(&runtime·sched.npidle);
+	return want < 1 ? 1 : want;
+}
+
+void
+runtime·vcoreadjust(bool renew)
+{
+	int32 want;
+	int64 now;
+
+	if(runtime·singlecore)
+		return;
+	if(!renew && vcorestowant() == (int32)runtime·atomicload((uint32*)&runtime·vcoreswanted))
+		return;
+	runtime·lock(&vcorelock);
+	want = vcorestowant();
+	if(want != runtime·vcoreswanted) {
+		runtime·atomicstore((uint32*)&runtime·vcoreswanted, want);
+		runtime·asmcgocall(gcc_vcore_request, &want);
+		renewwait = renewnext = 0;
+	} else if(renew && __procinfo.num_vcores < want) {
+		now = runtime·nanotime();
+		if(now >= renewnext) {
+			runtime·asmcgocall(gcc_vcore_request, &want);
+			renewwait = renewwait == 0 ? RenewWaitMin : renewwait*2;
+			if(renewwait > RenewWaitMax)
+				renewwait = RenewWaitMax;
+			renewnext = now + renewwait;
+		}
+	} else if(renew)
+		renewwait = renewnext = 0;
+	runtime·unlock(&vcorelock);
+}
+
+// The vcores granted right now, for NumCPU and syscall.WatchVcores.
+int32
+runtime·numvcores(void)
+{
+	return __procinfo.num_vcores;
+}
+
+// The CPU topology, for syscall.Topology, and the placement hint that
+// can go with it: GOPROVISION=1 asks the kernel for pcores one physical
+// core at a time before SMT siblings, unless we are on a single vcore
+// anyway.  Provisioning takes pcores from the rest of the machine, so it
+// is opt-in.  The kernel may ignore the hint; nothing depends on it.
+#pragma cgo_import_static gcc_topology
+extern gcc_call_t gcc_topology;
+extern int32 runtime·topology[4];
+
+static void
+topologyinit(void)
+{
+	byte *p;
+
+	runtime·topology[0] = MAX(__procinfo.max_vcores, 1);
+	runtime·topology[1] = 0;
+	p = runtime·getenv("GOPROVISION");
+	if(p != nil && runtime·atoi(p) > 0 && !runtime·singlecore)
+		runtime·topology[1] = runtime·ncpu;
+	runtime·asmcgocall(gcc_topology, runtime·topology);
+}
+
+static void asyncpreemptinit(void);
+static void asyncprofinit(void);
+static void faultinit(void);
+
 void
 runtime·goenvs(void)
 {
 	runtime·goenvs_unix();
+	runtime·startstamps[StartEnv] = runtime·nanotime();
+	singlecoreinit();
+	mcpinit();
+	runtime·startstamps[StartMCP] = runtime·nanotime();
+	topologyinit();
+	runtime·startstamps[StartTopology] = runtime·nanotime();
+	asyncpreemptinit();
+	faultinit();
+	watchdoginit();
 }
 
+// syscallnames maps system call numbers to their names; it is generated
+// from the kernel headers by syscall/mksysnum_akaros.pl -runtime.
+extern Slice runtime·syscallnames;
+
+static void
+printsyscall(SyscallArg *sysc)
+{
+	String *names;
+
+	names = (String*)runtime·syscallnames.array;
+	if(sysc->num < runtime·syscallnames.len && names[sysc->num].len > 0)
+		runtime·printf("%S", names[sysc->num]);
+	else
+		runtime·printf("syscall %d", sysc->num);
+	runtime·printf("(%X, %X, %X, %X, %X, %X)", sysc->arg0, sysc->arg1,
+	               sysc->arg2, sysc->arg3, sysc->arg4, sysc->arg5);
+}
+
+// Print the Akaros-specific state that a goroutine traceback doesn't
+// show: the vcores we hold and the system calls still in flight.
+void
+runtime·akarosdump(void)
+{
+	uintptr i;
+	Vcore *vc;
+	G *gp;
+	SyscallArg *sysc;
+	int64 now;
+
+	if(watchdog.fired)
+		runtime·printf("watchdog: no goroutine scheduled in %D seconds\n",
+		               (int64)(watchdog.period_usec/1000000));
+
+	runtime·printf("vcores: %d granted, %d wanted, %D max, mcp=%d\n",
+	               __procinfo.num_vcores, runtime·vcoreswanted, __procinfo.max_vcores,
+	               __procinfo.is_mcp);
+	for(i = 0; i < __procinfo.max_vcores && i < nelem(__procinfo.vcoremap); i++) {
+		vc = &__procinfo.vcoremap[i];
+		if(!vc->valid)
+			continue;
+		runtime·printf("vcore %d: pcore=%d preempts=%d/%d preempt_pending=%D\n",
+		               (int32)i, vc->pcoreid, vc->nr_preempts_done,
+		               vc->nr_preempts_sent, vc->preempt_pending);
+	}
+
+	runtime·printf("pending syscalls:\n");
+	now = runtime·nanotime();
+	for(i = 0; i < runtime·allglen; i++) {
+		gp = runtime·allg[i];
+		sysc = (SyscallArg*)gp->sysc;
+		if(sysc->num != 0 && !((uintptr)sysc->flags & SC_DONE)) {
+			runtime·printf("goroutine %D: ", gp->goid);
+			printsyscall(sysc);
+			runtime·printf("\n");
+		}
+		sysc = (SyscallArg*)gp->usysc;
+		if(sysc != nil && !((uintptr)sysc->flags & SC_DONE)) {
+			runtime·printf("goroutine %D: ", gp->goid);
+			printsyscall(sysc);
+			runtime·printf(" for %Dus\n", (now - gp->usysctime)/1000);
+		}
+	}
+}
+
+#pragma cgo_import_static gcc_uthread_state
+extern gcc_call_t gcc_uthread_state;
+
+// At GOTRACEBACK=system, goroutineheader follows each goroutine's header
+// with what the thread under it is doing: its M and that M's uthread, the
+// vcore running the uthread if any, how deeply the uthread has disabled
+// notifications, and the system calls it and the goroutine are waiting
+// on.  A hang in parlib or the kernel shows up as an M off its vcore, one
+// stuck with notifications disabled, or a call that never completes.
+void
+runtime·tracebackthread(G *gp)
+{
+	UthreadStateArg a;
+	SyscallArg *sysc;
+	M *mp;
+
+	mp = gp->m;
+	if(mp == nil)
+		mp = gp->lockedm;
+	if(mp != nil && mp->uthread != nil) {
+		a.uth = mp->uthread;
+		runtime·asmcgocall(gcc_uthread_state, &a);
+		runtime·printf("	m=%d uthread=%p", mp->id, a.uth);
+		if(a.vcoreid >= 0)
+			runtime·printf(" vcore=%d pcore=%d", a.vcoreid,
+			               __procinfo.vcoremap[a.vcoreid].pcoreid);
+		else
+			runtime·printf(" vcore=none");
+		runtime·printf(" state=%d flags=%x notif_disabled=%d",
+		               a.state, a.flags, a.notif_disabled);
+		if(mp->vcorepinned)
+			runtime·printf(" pinned");
+		runtime·printf("\n");
+		if(a.sysc != nil && !((uintptr)a.sysc->flags & SC_DONE)) {
+			runtime·printf("\tuthread blocked in ");
+			printsyscall(a.sysc);
+			runtime·printf("\n");
+		}
+	}
+	sysc = (SyscallArg*)gp->sysc;
+	if(sysc->num != 0 && !((uintptr)sysc->flags & SC_DONE)) {
+		runtime·printf("\tin ");
+		printsyscall(sysc);
+		runtime·printf("\n");
+	}
+	sysc = (SyscallArg*)gp->usysc;
+	if(sysc != nil && !((uintptr)sysc->flags & SC_DONE)) {
+		runtime·printf("\tparked in ");
+		printsyscall(sysc);
+		runtime·printf(" for %Dus\n", (runtime·nanotime() - gp->usysctime)/1000);
+	}
+}
+
+#pragma cgo_import_static gcc_uthread_self
+#pragma cgo_import_static gcc_uthread_running
+extern gcc_call_t gcc_uthread_self;
+extern gcc_call_t gcc_uthread_running;
+
 // Called to initialize a new m (including the bootstrap m).
 // Called on the parent thread (main thread in case of bootstrap), can allocate memory.
 void
@@ -89,12 +469,275 @@ runtime·minit(void)
 	// Initialize signal handling.
 	runtime·unblocksignals();
         runtime·signalstack((byte*)g->m->gsignal->stack.lo, 32*1024);
+	runtime·asmcgocall(gcc_uthread_self, &g->m->uthread);
+	g->m->procid = runtime·threadid();
+	asyncprofinit();
+}
+
+// Whether mp's thread is running on a vcore, rather than waiting for one
+// after its vcore was preempted or revoked, or blocked in the kernel (see
+// vcorerecover in proc.c).
+bool
+runtime·moncore(M *mp)
+{
+	struct { void *uth; int32 running; } a;
+
+	if(mp->uthread == nil)
+		return true;
+	a.uth = mp->uthread;
+	runtime·asmcgocall(gcc_uthread_running, &a);
+	return a.running != 0;
+}
+
+extern gcc_call_t gcc_thread_ids;
+
+// The vcore the calling M is running on, recorded in the M it creates for
+// the thread-create profile.
+int32
+runtime·vcoreid(void)
+{
+	struct { int32 vcoreid; int32 tid; } a;
+
+	runtime·asmcgocall(gcc_thread_ids, &a);
+	return a.vcoreid;
+}
+
+// The id of the pthread the calling M runs as, kept in m->procid for
+// debuggers and heap dumps.
+int32
+runtime·threadid(void)
+{
+	struct { int32 vcoreid; int32 tid; } a;
+
+	runtime·asmcgocall(gcc_thread_ids, &a);
+	return a.tid;
+}
+
+#pragma cgo_import_static gcc_vcore_pin
+extern gcc_call_t gcc_vcore_pin;
+
+// Keep the calling M's uthread to the vcore it is running on, for
+// runtime.LockOSThread, or let it go again (see __gcc_vcore_pin).  Once
+// pinned, the uthread only ever resumes on that vcore while the process
+// holds it; with GODEBUG=pinpcore=1 the pcore under the vcore is
+// provisioned to us too, until the uthread is unpinned.  Pcores that
+// GOPROVISION=1 provisioned at start-up are left alone.
+#pragma textflag NOSPLIT
+void
+runtime·vcorepin(bool pin)
+{
+	VcorePinArg a;
+
+	if(g->m->vcorepinned == pin)
+		return;
+	a.pin = pin;
+	a.provision = runtime·debug.pinpcore > 0 && runtime·topology[1] == 0;
+	a.ok = 0;
+	runtime·asmcgocall(gcc_vcore_pin, &a);
+	g->m->vcorepinned = pin && a.ok;
+}
+
+// Asynchronous preemption.  A goroutine in a loop that makes no calls
+// never reaches the stack check that runtime·preemptone relies on, so on
+// Akaros preemptone also has runtime·preemptasync send a notification to
+// the vcore running the goroutine's M.  The handler, in vcore context,
+// makes the goroutine call runtime·asyncpreempt from wherever it was
+// interrupted, saving its registers in g->asyncregs first, and
+// runtime·asyncpreempt2 parks it if it was in Go code outside the runtime
+// and held nothing.  Until it returns, the stack maps for the frame the
+// goroutine was interrupted in may be wrong, so the collector scans that
+// frame and the saved registers conservatively (see scanframe in mgc0.c)
+// and the stack is not moved.
+//
+// CPU profiling ticks arrive the same way (see runtime·resetcpuprofiler
+// in signal_akaros.c), but interrupt whatever goroutine the M is running
+// with the registers saved in m->asyncprof, and runtime·asyncprof2 takes
+// a sample.
+//
+// The handler only interrupts a goroutine running on its own stack, with
+// at least AsyncStackRoom of it to spare; anything else, including the
+// runtime's C code and parlib's, is left to the next attempt.
+// GODEBUG=asyncpreemptoff=1 turns preemption off.
+#pragma cgo_import_static gcc_asyncpreempt_init
+#pragma cgo_import_static gcc_asyncpreempt
+#pragma cgo_import_static gcc_asyncprof_register
+extern gcc_call_t gcc_asyncpreempt_init;
+extern gcc_call_t gcc_asyncpreempt;
+extern gcc_call_t gcc_asyncprof_register;
+extern void runtime·asyncpreempt(void);
+extern void runtime·asyncprof(void);
+extern void runtime·asyncpreemptend(void);
+static bool asyncok;
+
+static void
+asyncpreemptinit(void)
+{
+	struct { void *preempt; void *prof; void *end; int32 ok; } a;
+
+	a.preempt = runtime·asyncpreempt;
+	a.prof = runtime·asyncprof;
+	a.end = runtime·asyncpreemptend;
+	a.ok = 0;
+	runtime·asmcgocall(gcc_asyncpreempt_init, &a);
+	asyncok = a.ok != 0;
 }
 
-// Called from dropm to undo the effect of an minit.
+// Hardware faults.  In an MCP a trap in a uthread is not turned into a
+// signal: the kernel reflects it to the uthread's vcore, where parlib's
+// pthread scheduler prints the trap frame and exits unless someone has
+// taken its fault hook.  gcc_fault_init takes it, and for the traps that
+// Linux would turn into SIGSEGV, SIGBUS, SIGFPE or SIGILL makes the
+// uthread call runtime·faulttramp from the faulting instruction, as a
+// signal handler would make it call runtime·sigpanic.  So a nil pointer
+// dereference panics with the usual message and traceback, and any other
+// fault dies in runtime·sigpanic with a full goroutine dump.  Page faults
+// on file-backed memory, which the kernel could not satisfy at once, and
+// traps that are not faults stay with parlib.
+#pragma cgo_import_static gcc_fault_init
+extern gcc_call_t gcc_fault_init;
+extern void runtime·faulttramp(void);
+int8*	runtime·signame(int32);
+
+static void
+faultinit(void)
+{
+	void *tramp;
+
+	tramp = runtime·faulttramp;
+	runtime·asmcgocall(gcc_fault_init, &tramp);
+}
+
+// runtime·faulttramp found no g: the fault was in C code on a thread
+// that never entered Go.
+#pragma textflag NOSPLIT
+void
+runtime·badfault(int32 sig, uintptr addr)
+{
+	runtime·printf("fatal error: %s at address %p in a thread with no goroutine\n",
+	               runtime·signame(sig), addr);
+	runtime·exit(2);
+}
+
+// Register the M's profiling request, on its own thread.  An extra M
+// that cgo callbacks borrow runs here once per callback, each time on
+// whichever thread made it; the request goes on parlib's list only the
+// first time, and later just follows the thread.
+static void
+asyncprofinit(void)
+{
+	AsyncProf *a;
+
+	if(!asyncok)
+		return;
+	a = &g->m->asyncprof;
+	a->req.uthread = g->m->uthread;
+	if(a->req.regs != nil)
+		return;
+	a->req.regs = a->regs;
+	a->req.busy = &a->busy;
+	runtime·asmcgocall(gcc_asyncprof_register, a);
+}
+
+// Ask for gp, running on mp, to be interrupted.  Called right after
+// runtime·preemptone asks for it to stop at its next stack check.
+void
+runtime·preemptasync(M *mp, G *gp)
+{
+	AsyncPreempt *a;
+
+	if(!asyncok || runtime·singlecore || runtime·debug.asyncpreemptoff || mp->uthread == nil)
+		return;
+	a = &mp->asyncpreempt;
+	a->uthread = mp->uthread;
+	a->regs = gp->asyncregs;
+	a->busy = &gp->asyncbusy;
+	a->lo = gp->stack.lo + StackGuard + AsyncStackRoom;
+	a->hi = gp->stack.hi;
+	runtime·asmcgocall(gcc_asyncpreempt, a);
+}
+
+// Called by runtime·asyncpreempt with the registers it saved.  The
+// handler cannot tell what g was doing, only that it was on gp's stack:
+// it may have been switching to g0 in runtime·mcall, in which case g is
+// no longer gp, or in the runtime, holding who knows what.  Preempt gp
+// only if it was in Go code outside the runtime, where it could just as
+// well have called runtime.Gosched.
+#pragma textflag NOSPLIT
+void
+runtime·asyncpreempt2(uintreg *regs)
+{
+	G *gp;
+	Func *f;
+	void (*fn)(G*);
+
+	gp = g;
+	if(gp->m == nil || gp != gp->m->curg || regs != gp->asyncregs)
+		return;
+	if(!gp->preempt || gp->m->locks || gp->m->mallocing || gp->m->gcing ||
+	   gp->m->p == nil || gp->m->p->status != Prunning)
+		return;
+	// What follows must not see the preemption request: it would park
+	// gp in the middle of it, or worse, in newstack's preemptscan path.
+	gp->stackguard0 = gp->stack.lo + StackGuard;
+	f = runtime·findfunc(regs[AsyncPC]);
+	if(f == nil || runtime·mcmp((byte*)runtime·funcname(f), (byte*)"runtime.", 8) == 0) {
+		if(gp->preempt)
+			gp->stackguard0 = StackPreempt;
+		return;
+	}
+	fn = runtime·gopreempt_m;
+	runtime·mcall(&fn);
+}
+
+// Point the M's profiling request at gp, which it is about to run.
+#pragma textflag NOSPLIT
+void
+runtime·asyncprofstack(G *gp)
+{
+	AsyncProf *a;
+
+	a = &g->m->asyncprof;
+	a->req.hi = 0;
+	a->req.lo = gp->stack.lo + StackGuard + AsyncStackRoom;
+	a->req.hi = gp->stack.hi;
+}
+
+static void
+asyncprof_m(void)
+{
+	runtime·sigprof((uint8*)g->m->scalararg[0], (uint8*)g->m->scalararg[1], nil, g->m->curg, g->m);
+	g->m->scalararg[0] = 0;
+	g->m->scalararg[1] = 0;
+}
+
+// Called by runtime·asyncprof with the registers it saved.  As in
+// runtime·asyncpreempt2, g may not be the goroutine the handler meant to
+// interrupt.  The sample is taken on g0, so that nothing grows the
+// interrupted stack.
+#pragma textflag NOSPLIT
+void
+runtime·asyncprof2(uintreg *regs)
+{
+	G *gp;
+	void (*fn)(void);
+
+	gp = g;
+	if(gp->m == nil || gp != gp->m->curg || regs != gp->m->asyncprof.regs)
+		return;
+	gp->m->scalararg[0] = regs[AsyncPC];
+	gp->m->scalararg[1] = regs[AsyncSP];
+	fn = asyncprof_m;
+	runtime·onM(&fn);
+}
+
+// Called from dropm to undo the effect of an minit.  The M goes back on
+// the extra list, no longer tied to the C thread that borrowed it, so
+// neither profiling ticks nor preemption requests may go to that thread.
 void
 runtime·unminit(void)
 {
+	g->m->asyncprof.req.uthread = nil;
+	g->m->uthread = nil;
         runtime·signalstack(nil, 0);
 }
 
@@ -110,7 +753,6 @@ runtime·memlimit(void)
  * and calls sighandler().
  */
 #pragma cgo_import_static gcc_sigaction
-typedef void (*gcc_call_t)(void *arg);
 extern gcc_call_t gcc_sigaction;
 extern void runtime·sigtramp(void);
 extern SigTab runtime·sigtab[];
@@ -17,6 +17,88 @@ func netpollopen(fd uintptr, pd *pollDesc) int32
 func netpollclose(fd uintptr) int32
 func netpollarm(pd *pollDesc, mode int)
 
+func tscfreq() int64
+func tracebackthread(gp *g)
+
+// Use the kernel's TSC calibration rather than timing a sleep, which on
+// Akaros would only reproduce it less accurately.
+func init() {
+	atomicstore64(&ticks.val, uint64(tscfreq()))
+}
+
+// mcperrno is why the process did not become an MCP at startup, or 0.
+// It is set by mcpinit in os_akaros.c.
+var mcperrno int32
+
+// mcpstatus is syscall.mcpStatus.
+func mcpstatus() (mcp bool, errno int32) {
+	return !singlecore, mcperrno
+}
+
+func numvcores() int32
+
+// numcpu is the vcores granted, for NumCPU.  A running program holds at
+// least one, but num_vcores can lag behind while a vcore is being
+// granted or yielded.
+func numcpu() int32 {
+	n := numvcores()
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Changes in the vcore grant, for syscall.WatchVcores.  A goroutine in
+// vcorewait parks in vcorewatch.g until sysmon, polling num_vcores each
+// time round, sees the grant change.  Once every P is idle, sysmon polls
+// only once a minute, but then nobody is using the vcores anyway.
+var vcorewatch struct {
+	lock mutex
+	g    *g
+	last int32 // grant at sysmon's last look; sysmon's alone
+}
+
+// vcorewait is syscall.vcoreWait.  It blocks until the grant differs
+// from n, and returns the new grant.  Only one goroutine may call it.
+func vcorewait(n int) int {
+	lock(&vcorewatch.lock)
+	for {
+		if cur := int(numcpu()); cur != n {
+			unlock(&vcorewatch.lock)
+			return cur
+		}
+		vcorewatch.g = getg()
+		goparkunlock(&vcorewatch.lock, "vcore wait")
+		lock(&vcorewatch.lock)
+	}
+}
+
+// vcorechanged is called by sysmon.  If the grant changed since the last
+// call, it returns the goroutine waiting in vcorewait, if there is one,
+// for sysmon to make runnable.
+func vcorechanged() *g {
+	n := numcpu()
+	if n == vcorewatch.last {
+		return nil
+	}
+	vcorewatch.last = n
+	lock(&vcorewatch.lock)
+	gp := vcorewatch.g
+	vcorewatch.g = nil
+	unlock(&vcorewatch.lock)
+	return gp
+}
+
+// topology is filled in by topologyinit in os_akaros.c, laid out as
+// gcc_topology_arg_t: pcores, pcores provisioned, threads per core and
+// cores per socket.
+var topology [4]int32
+
+// cputopology is syscall.cpuTopology.
+func cputopology() (pcores, threadsPerCore, coresPerSocket int) {
+	return int(topology[0]), int(topology[2]), int(topology[3])
+}
+
 func os_sigpipe() {
 	gothrow("too many writes on closed pipe")
 }
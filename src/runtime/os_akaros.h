@@ -12,6 +12,20 @@ int32	runtime·clone(int32, void*, M*, G*, void(*)(void));
 void runtime·enable_profalarm(uint64 usecs);
 void runtime·disable_profalarm(void);
 
+struct EventQueue;
+struct EventMsg;
+struct EventQueue*	runtime·evqnew(void);
+bool	runtime·evqnext(struct EventQueue*, struct EventMsg*, bool);
+void	runtime·evqsignals(struct EventQueue*);
+int32	runtime·tapfd(int32, int32, int32, int32, struct EventQueue*);
+bool	runtime·syscallsubmit(void*, struct EventQueue*);
+
+struct AlarmArg;
+bool	runtime·alarminit(struct AlarmArg*);
+int64	runtime·tscafter(int64);
+void	runtime·alarmat(struct AlarmArg*, int64);
+void	runtime·alarmblock(struct AlarmArg*);
+
 struct SigactionT;
 int32	runtime·sigaction(int32, struct SigactionT*, struct SigactionT*);
 void	runtime·sigpanic(void);
@@ -34,3 +48,9 @@ struct Rlimit {
 	uintptr	rlim_max;
 };
 int32	runtime·getrlimit(int32, Rlimit*);
+
+void	runtime·akarosdump(void);
+void	runtime·netpollsignals(void);
+void	runtime·sigevent(int32);
+struct Siginfo;
+void	runtime·crashcontext(struct Siginfo*, void*, G*);
@@ -0,0 +1,82 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// A PacingStats records how fast the program is allocating and how far
+// that allocation has run ahead of the garbage collector.  Unlike
+// MemStats it is read without stopping the world, so the numbers are
+// approximate: allocations still buffered in per-P caches may be missing
+// from HeapAlloc, and the fields are not read as one snapshot.
+type PacingStats struct {
+	TotalAlloc uint64  // bytes allocated since the program started (even if freed)
+	HeapAlloc  uint64  // bytes allocated and not yet freed
+	NextGC     uint64  // next collection will happen when HeapAlloc ≥ this amount
+	AllocRate  float64 // bytes allocated per second since the last collection finished
+	NumGC      uint32
+
+	// GCDebt is HeapAlloc minus NextGC.  It is negative while there is
+	// headroom left before the next collection and reaches zero when
+	// allocation triggers one.
+	GCDebt int64
+
+	// SweepDebt is the number of spans left from the last collection
+	// that have not been swept yet.  Allocating goroutines must sweep
+	// before they can reuse memory, so a large value means allocation
+	// is paying for the collector.
+	SweepDebt uint32
+}
+
+// State at the end of the last collection, for AllocRate.
+var pacingGC struct {
+	totalAlloc uint64
+	when       int64
+}
+
+func totalalloc() uint64 {
+	n := allocfolded
+	for _, p := range &allp {
+		if p == nil {
+			break
+		}
+		if c := p.mcache; c != nil {
+			n += uint64(c.local_allocbytes)
+		}
+	}
+	return n
+}
+
+func init() {
+	pacingGC.when = nanotime()
+}
+
+// pacinggcdone is called with the world stopped at the end of a
+// collection.
+func pacinggcdone() {
+	pacingGC.totalAlloc = totalalloc()
+	pacingGC.when = nanotime()
+}
+
+// ReadPacingStats populates s with allocation pacing statistics.  It is
+// cheap enough to call on every request of a busy server.
+func ReadPacingStats(s *PacingStats) {
+	s.TotalAlloc = totalalloc()
+	s.HeapAlloc = memstats.heap_alloc
+	s.NextGC = memstats.next_gc
+	s.NumGC = memstats.numgc
+	s.GCDebt = int64(s.HeapAlloc - s.NextGC)
+
+	s.AllocRate = 0
+	base, when := pacingGC.totalAlloc, pacingGC.when
+	if d := nanotime() - when; d > 0 && s.TotalAlloc >= base {
+		s.AllocRate = float64(s.TotalAlloc-base) * 1e9 / float64(d)
+	}
+
+	s.SweepDebt = 0
+	if mheap_.sweepdone == 0 {
+		if n, i := work.nspan, sweep.spanidx; i < n {
+			s.SweepDebt = n - i
+		}
+	}
+}
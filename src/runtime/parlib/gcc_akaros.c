@@ -2,8 +2,18 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+#include <cpuid.h>
+#include <errno.h>
 #include <futex.h>
+#include <parlib/event.h>
+#include <parlib/parlib.h>
+#include <parlib/spinlock.h>
+#include <parlib/uthread.h>
 #include <pthread.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <unistd.h>
+#include <ros/resource.h>
 #include <sys/syscall.h>
 #include "gcc_akaros.h"
 
@@ -11,6 +21,148 @@
 typedef void (*gcc_call_t)(void *arg);
 const gcc_call_t gcc_syscall = (gcc_call_t)ros_syscall_sync;
 
+// Submit a->n contiguous syscalls with one kernel entry, then wait for
+// each of them the way ros_syscall_sync waits for one.
+static void __gcc_syscall_batch(void *__arg)
+{
+	gcc_syscall_batch_arg_t *a = (gcc_syscall_batch_arg_t*)__arg;
+	struct syscall *sysc;
+	int i;
+
+	__ros_arch_syscall((long)a->sysc, a->n);
+	for (i = 0; i < a->n; i++) {
+		sysc = &a->sysc[i];
+		if (!(atomic_read(&sysc->flags) & (SC_DONE | SC_PROGRESS)))
+			__ros_syscall_blockon(sysc);
+		while (!(atomic_read(&sysc->flags) & SC_DONE))
+			cpu_relax();
+	}
+}
+const gcc_call_t gcc_syscall_batch = __gcc_syscall_batch;
+
+// Asynchronous syscalls.  Calls submitted without waiting post their
+// completion to async_evq, which a single reaper blocks on.
+static struct event_queue *async_evq;
+static pthread_once_t async_once = PTHREAD_ONCE_INIT;
+
+static void async_init(void)
+{
+	async_evq = get_eventq(EV_MBOX_UCQ);
+	async_evq->ev_flags = EVENT_INDIR | EVENT_SPAM_INDIR | EVENT_WAKEUP;
+	evq_attach_wakeup_ctlr(async_evq);
+}
+
+// Issue a->sysc and return without waiting for it.  a->done is set if the
+// call finished before an event could be asked for; otherwise exactly one
+// event for it will be posted to a->evq or, if that is NULL, reach
+// __gcc_syscall_reap.
+static void __gcc_syscall_submit(void *__arg)
+{
+	gcc_syscall_submit_arg_t *a = (gcc_syscall_submit_arg_t*)__arg;
+
+	pthread_once(&async_once, async_init);
+	__ros_arch_syscall((long)a->sysc, 1);
+	a->done = !register_evq(a->sysc, a->evq ? a->evq : async_evq);
+}
+const gcc_call_t gcc_syscall_submit = __gcc_syscall_submit;
+
+// Block until a submitted syscall completes and return it in a->sysc.
+static void __gcc_syscall_reap(void *__arg)
+{
+	gcc_syscall_reap_arg_t *a = (gcc_syscall_reap_arg_t*)__arg;
+	struct event_msg msg;
+
+	pthread_once(&async_once, async_init);
+	uth_blockon_evqs(&msg, NULL, 1, async_evq);
+	a->sysc = (struct syscall*)msg.ev_arg3;
+}
+const gcc_call_t gcc_syscall_reap = __gcc_syscall_reap;
+
+// Event queues for syscall.EventQueue, set up like async_evq.
+static void __gcc_evq_new(void *__arg)
+{
+	gcc_evq_arg_t *a = (gcc_evq_arg_t*)__arg;
+
+	a->evq = get_eventq(EV_MBOX_UCQ);
+	a->evq->ev_flags = EVENT_INDIR | EVENT_SPAM_INDIR | EVENT_WAKEUP;
+	evq_attach_wakeup_ctlr(a->evq);
+}
+const gcc_call_t gcc_evq_new = __gcc_evq_new;
+
+// Block until an event arrives on a->evq and return it in a->msg.
+static void __gcc_evq_wait(void *__arg)
+{
+	gcc_evq_arg_t *a = (gcc_evq_arg_t*)__arg;
+
+	uth_blockon_evqs(&a->msg, NULL, 1, a->evq);
+}
+const gcc_call_t gcc_evq_wait = __gcc_evq_wait;
+
+// Take the next event waiting on a->evq, if there is one, without
+// blocking.  a->ok reports whether there was.
+static void __gcc_evq_poll(void *__arg)
+{
+	gcc_evq_poll_arg_t *a = (gcc_evq_poll_arg_t*)__arg;
+
+	a->ok = extract_one_mbox_msg(a->evq->ev_mbox, &a->msg);
+}
+const gcc_call_t gcc_evq_poll = __gcc_evq_poll;
+
+static void __gcc_evq_free(void *__arg)
+{
+	gcc_evq_arg_t *a = (gcc_evq_arg_t*)__arg;
+
+	evq_remove_wakeup_ctlr(a->evq);
+	put_eventq(a->evq);
+	a->evq = NULL;
+}
+const gcc_call_t gcc_evq_free = __gcc_evq_free;
+
+// Have the kernel post POSIX signals sent to the process to a->evq
+// rather than to parlib's handler, which would run them in vcore context.
+static void __gcc_evq_signals(void *__arg)
+{
+	gcc_evq_arg_t *a = (gcc_evq_arg_t*)__arg;
+
+	register_kevent_q(a->evq, EV_POSIX_SIGNAL);
+}
+const gcc_call_t gcc_evq_signals = __gcc_evq_signals;
+
+// Kernel alarms for runtime timers (see timer_akaros.go).  The alarm's
+// events go to a queue of its own that the timer goroutine's M blocks on
+// with gcc_evq_wait.
+static void __gcc_alarm_new(void *__arg)
+{
+	gcc_alarm_arg_t *a = (gcc_alarm_arg_t*)__arg;
+
+	a->have = 0;
+	if (devalarm_get_fds(&a->ctlfd, &a->timerfd, &a->id) < 0)
+		return;
+	a->evq = get_eventq(EV_MBOX_UCQ);
+	a->evq->ev_flags = EVENT_INDIR | EVENT_SPAM_INDIR | EVENT_WAKEUP;
+	evq_attach_wakeup_ctlr(a->evq);
+	if (devalarm_set_evq(a->timerfd, a->evq, a->id) < 0) {
+		evq_remove_wakeup_ctlr(a->evq);
+		put_eventq(a->evq);
+		a->evq = NULL;
+		close(a->timerfd);
+		close(a->ctlfd);
+		return;
+	}
+	a->have = 1;
+}
+const gcc_call_t gcc_alarm_new = __gcc_alarm_new;
+
+// Set the alarm to go off at TSC time a->tsc, replacing any earlier
+// setting.  A time already past makes it go off at once.
+static void __gcc_alarm_set(void *__arg)
+{
+	gcc_alarm_arg_t *a = (gcc_alarm_arg_t*)__arg;
+
+	a->ok = devalarm_set_time(a->timerfd, a->tsc) == 0;
+}
+const gcc_call_t gcc_alarm_set = __gcc_alarm_set;
+
 // Akaros style futexes
 static void __gcc_futex(void *__arg)
 {
@@ -29,12 +181,21 @@ static void __gcc_futex(void *__arg)
 }
 const gcc_call_t gcc_futex = __gcc_futex;
 
-// Akaros style pthread yields
+// Akaros style pthread yields, for runtime·osyield.  The runtime yields
+// while it waits for another M, so let any other pthread run first.  If
+// there was none, pthread_yield comes straight back; an SCP then yields
+// its core to the kernel, which runs other processes before us, rather
+// than spinning until the kernel's timeslice runs out.  An MCP keeps its
+// vcore: the vcore went through its event handling on the way, which is
+// what recovers an M stranded on a preempted vcore, and the vcore goes
+// back to the kernel anyway once parlib has nothing to run on it.
 static void __gcc_myield(void *__arg)
 {
 	// We should never pass an argument here
 	assert(__arg == NULL);
 	pthread_yield();
+	if (!__procinfo.is_mcp)
+		sys_yield(TRUE);
 }
 const gcc_call_t gcc_myield = __gcc_myield;
 
@@ -61,15 +222,595 @@ static void __gcc_sigprocmask(void *__arg)
 }
 const gcc_call_t gcc_sigprocmask = __gcc_sigprocmask;
 
-// enable_profalarm() and disable_profalarm()
+// Scheduler watchdog.  The runtime bumps *ticks every time it schedules a
+// goroutine.  If a whole period goes by without that happening while there
+// was work to do, we ask the runtime for a SIGQUIT dump; if it can't even
+// manage that by the end of the next period, it is wedged for good and we
+// destroy the process.  A program with every P idle and nothing on the
+// global run queue is just waiting (on a timer, a syscall, the network),
+// not stuck, so staleness only counts while some P is busy or a goroutine
+// is runnable.
+static struct alarm_waiter watchdog_waiter;
+
+static void watchdog_handler(struct alarm_waiter *waiter)
+{
+	gcc_watchdog_arg_t *a = (gcc_watchdog_arg_t*)waiter->data;
+	uint32_t now = *(volatile uint32_t*)a->ticks;
+	int idle = *(volatile uint32_t*)a->npidle == *(volatile int32_t*)a->nprocs
+	           && *(volatile int32_t*)a->runqsize == 0;
+
+	if (now != a->last || idle) {
+		a->last = now;
+		a->stale = 0;
+	} else if (a->stale++ == 0) {
+		a->fired = 1;
+		kill(getpid(), SIGQUIT);
+	} else {
+		// This runs in vcore context, where stdio's locks and abort's
+		// signal delivery are off limits: write the message raw and
+		// have the kernel destroy the process, with the runtime's
+		// exit status for a fatal error.
+		static const char msg[] = "runtime: watchdog: no response to SIGQUIT, aborting\n";
+		write(2, msg, sizeof(msg) - 1);
+		sys_proc_destroy(getpid(), 2);
+	}
+	set_awaiter_inc(waiter, a->period_usec);
+	__set_alarm(waiter);
+}
+
+static void __gcc_watchdog_start(void *__arg)
+{
+	gcc_watchdog_arg_t *a = (gcc_watchdog_arg_t*)__arg;
+	a->last = *(volatile uint32_t*)a->ticks;
+	init_awaiter(&watchdog_waiter, watchdog_handler);
+	watchdog_waiter.data = a;
+	set_awaiter_rel(&watchdog_waiter, a->period_usec);
+	set_alarm(&watchdog_waiter);
+}
+const gcc_call_t gcc_watchdog_start = __gcc_watchdog_start;
+
+// Single-core mode: never ask the kernel for more vcores than the one we
+// are running on, so every pthread (and thus every M) is multiplexed on it.
+static void __gcc_single_core(void *__arg)
+{
+	assert(__arg == NULL);
+	pthread_can_vcore_request(FALSE);
+}
+const gcc_call_t gcc_single_core = __gcc_single_core;
+
+// MCP transition.  Becoming a multicore process is what lets us ask the
+// kernel for more vcores.  Try it up front, so that a kernel that refuses
+// (or that will only ever give us one vcore) leaves us running as an SCP
+// instead of failing the first time a pthread wants a vcore of its own.
+// *arg gets 0 on success or the reason we stayed an SCP.
+static void __gcc_mcp_init(void *__arg)
+{
+	int *err = (int*)__arg;
+
+	*err = 0;
+	if (__procinfo.is_mcp)
+		;
+	else if (__procinfo.max_vcores <= 1)
+		*err = EBUSY;
+	else
+		// parlib's helper also sets up the vcore request the kernel
+		// expects of a new MCP.  It asserts rather than returning an
+		// error, but the kernel refuses only a process that is not a
+		// running SCP, which is what we are here.
+		vcore_change_to_m();
+	// As an MCP, the runtime asks for vcores itself with
+	// gcc_vcore_request, so the pthread scheduler stops asking on its
+	// own.  If we stayed an SCP, the runtime falls back to gcc_single_core.
+	if (!*err)
+		pthread_can_vcore_request(FALSE);
+}
+const gcc_call_t gcc_mcp_init = __gcc_mcp_init;
+
+// Ask the kernel for *arg vcores in all, replacing any earlier request.
+// The pthread scheduler still yields a vcore it has nothing to run on.
+static void __gcc_vcore_request(void *__arg)
+{
+	vcore_request_total(*(int*)__arg);
+}
+const gcc_call_t gcc_vcore_request = __gcc_vcore_request;
+
+// The uthread the caller runs as, in *arg, for runtime·moncore.
+static void __gcc_uthread_self(void *__arg)
+{
+	*(struct uthread**)__arg = current_uthread;
+}
+const gcc_call_t gcc_uthread_self = __gcc_uthread_self;
+
+// Whether a->uth is running on a vcore.  A uthread whose vcore was
+// preempted is paused, once another vcore has recovered it, until the
+// pthread scheduler runs it again.
+static void __gcc_uthread_running(void *__arg)
+{
+	gcc_uthread_running_arg_t *a = (gcc_uthread_running_arg_t*)__arg;
+
+	a->running = a->uth->state == UT_RUNNING;
+}
+const gcc_call_t gcc_uthread_running = __gcc_uthread_running;
+
+// Asynchronous preemption and profiling (see runtime·preemptasync in
+// os_akaros.c).  A request goes to the vcore running the goroutine's
+// uthread as an EV_USER_IPI whose ev_arg1 says what for and whose ev_arg3
+// is the request, and async_handler runs in vcore context there, with the
+// uthread's context in vcpd->uthread_ctx.  The request may be stale by
+// then, so the handler checks everything again before it touches the
+// context: the same uthread, interrupted in hardware rather than at a
+// system call or yield, on the goroutine's stack with room to spare, and
+// not already inside runtime·asyncpreempt or runtime·asyncprof.
+static uintptr_t async_preempt_fn, async_prof_fn, async_end;
+
+static void async_handler(struct event_msg *ev_msg, unsigned int ev_type,
+                          void *data)
+{
+	gcc_asyncpreempt_arg_t *a;
+	struct uthread *uth = current_uthread;
+	struct user_context *ctx;
+	struct hw_trapframe *tf;
+	uint64_t *regs;
+
+	if (!ev_msg || !(a = ev_msg->ev_arg3))
+		return;
+	if (!uth || uth != a->uth || (uth->flags & UTHREAD_SAVED))
+		return;
+	ctx = &vcpd_of(vcore_id())->uthread_ctx;
+	if (ctx->type != ROS_HW_CTX)
+		return;
+	tf = &ctx->tf.hw_tf;
+	if (tf->tf_rsp < a->lo || tf->tf_rsp >= a->hi)
+		return;
+	if (tf->tf_rip >= async_preempt_fn && tf->tf_rip < async_end)
+		return;
+	if (!__sync_bool_compare_and_swap(a->busy, 0, 1))
+		return;
+	regs = a->regs;
+	regs[ASYNC_RAX] = tf->tf_rax;
+	regs[ASYNC_RBX] = tf->tf_rbx;
+	regs[ASYNC_RCX] = tf->tf_rcx;
+	regs[ASYNC_RDX] = tf->tf_rdx;
+	regs[ASYNC_RSI] = tf->tf_rsi;
+	regs[ASYNC_RDI] = tf->tf_rdi;
+	regs[ASYNC_RBP] = tf->tf_rbp;
+	regs[ASYNC_R8] = tf->tf_r8;
+	regs[ASYNC_R9] = tf->tf_r9;
+	regs[ASYNC_R10] = tf->tf_r10;
+	regs[ASYNC_R11] = tf->tf_r11;
+	regs[ASYNC_R12] = tf->tf_r12;
+	regs[ASYNC_R13] = tf->tf_r13;
+	regs[ASYNC_R14] = tf->tf_r14;
+	regs[ASYNC_R15] = tf->tf_r15;
+	regs[ASYNC_RFLAGS] = tf->tf_rflags;
+	regs[ASYNC_RIP] = tf->tf_rip;
+	regs[ASYNC_RSP] = tf->tf_rsp;
+	// Fake a call from the interrupted instruction.
+	tf->tf_rsp -= sizeof(uint64_t);
+	*(uint64_t*)tf->tf_rsp = tf->tf_rip;
+	tf->tf_rip = ev_msg->ev_arg1 == ASYNC_PROF ? async_prof_fn : async_preempt_fn;
+	tf->tf_r12 = (uint64_t)regs;
+}
+
+static void __gcc_asyncpreempt_init(void *__arg)
+{
+	gcc_asyncpreempt_init_arg_t *a = (gcc_asyncpreempt_init_arg_t*)__arg;
+
+	async_preempt_fn = a->preempt;
+	async_prof_fn = a->prof;
+	async_end = a->end;
+	register_ev_handler(EV_USER_IPI, async_handler, 0);
+	a->ok = 1;
+}
+const gcc_call_t gcc_asyncpreempt_init = __gcc_asyncpreempt_init;
+
+// The uthread vcoreid is running.  It comes from the vcore's TLS and may
+// change at any moment; async_handler sorts that out.
+static struct uthread *vcore_uthread(uint32_t vcoreid)
+{
+	return *get_tlsvar_linaddr(vcoreid, current_uthread);
+}
+
+static void async_send(uint32_t vcoreid, uint16_t kind, void *a)
+{
+	struct event_msg msg = {0};
+
+	msg.ev_type = EV_USER_IPI;
+	msg.ev_arg1 = kind;
+	msg.ev_arg3 = a;
+	sys_self_notify(vcoreid, EV_USER_IPI, &msg, TRUE);
+}
+
+// Send the preemption request in arg to the vcore running its uthread,
+// if any.
+static void __gcc_asyncpreempt(void *__arg)
+{
+	gcc_asyncpreempt_arg_t *a = (gcc_asyncpreempt_arg_t*)__arg;
+	uint32_t i;
+
+	for (i = 0; i < max_vcores(); i++) {
+		if (vcore_uthread(i) == a->uth) {
+			async_send(i, ASYNC_PREEMPT, a);
+			return;
+		}
+	}
+}
+const gcc_call_t gcc_asyncpreempt = __gcc_asyncpreempt;
+
+// A snapshot of a->uth for runtime·tracebackthread.  Nothing stops it
+// from changing as we look, which is fine for a traceback.
+static void __gcc_uthread_state(void *__arg)
+{
+	gcc_uthread_state_arg_t *a = (gcc_uthread_state_arg_t*)__arg;
+	uint32_t i;
+
+	a->state = a->uth->state;
+	a->flags = a->uth->flags;
+	a->notif_disabled = a->uth->notif_disabled_depth;
+	a->sysc = a->uth->sysc;
+	a->vcoreid = -1;
+	for (i = 0; i < max_vcores(); i++) {
+		if (vcore_uthread(i) == a->uth) {
+			a->vcoreid = i;
+			break;
+		}
+	}
+}
+const gcc_call_t gcc_uthread_state = __gcc_uthread_state;
+
+// Hardware faults (see faultinit in os_akaros.c).  The pthread scheduler
+// hands a trap reflected to a uthread's vcore to its thread_refl_fault
+// op; go_refl_fault stands in front of it.  For the traps Linux turns
+// into signals, it rewrites the uthread's context as async_handler does,
+// to call fault_tramp from the faulting instruction with the signal, its
+// si_code and the fault address in R12, R13 and R14, and runs the
+// uthread again straight away.  Everything else goes on to parlib.
+static uintptr_t fault_tramp;
+static void (*pth_refl_fault)(struct uthread *, unsigned int, unsigned int,
+                              unsigned long);
+
+static void go_refl_fault(struct uthread *uth, unsigned int trap_nr,
+                          unsigned int err, unsigned long aux)
+{
+	struct hw_trapframe *tf;
+	int sig, code;
+	uint64_t addr;
+
+	if (uth->u_ctx.type != ROS_HW_CTX)
+		goto pass;
+	tf = &uth->u_ctx.tf.hw_tf;
+	addr = tf->tf_rip;
+	switch (trap_nr) {
+	case HW_TRAP_PAGE_FAULT:
+		if (err & PF_VMR_BACKED)
+			goto pass;
+		sig = SIGSEGV;
+		// Bit 0 of the error code: the page was there, but the
+		// access was not allowed.
+		code = (err & 1) ? SEGV_ACCERR : SEGV_MAPERR;
+		addr = aux;
+		break;
+	case HW_TRAP_GEN_PROT_FAULT:
+	case HW_TRAP_STACK_FAULT:
+		sig = SIGSEGV;
+		code = 0x80;	// SI_KERNEL: no address to report
+		addr = 0;
+		break;
+	case HW_TRAP_DIV_ZERO:
+		sig = SIGFPE;
+		code = FPE_INTDIV;
+		break;
+	case HW_TRAP_OVERFLOW:
+		sig = SIGFPE;
+		code = FPE_INTOVF;
+		break;
+	case HW_TRAP_FP_EXCP:
+	case HW_TRAP_SIMD:
+		sig = SIGFPE;
+		code = 0;
+		break;
+	case HW_TRAP_ALIGNMENT:
+		sig = SIGBUS;
+		code = BUS_ADRALN;
+		break;
+	case HW_TRAP_INVALID_OPCODE:
+		sig = SIGILL;
+		code = ILL_ILLOPN;
+		break;
+	default:
+		goto pass;
+	}
+	tf->tf_rsp -= sizeof(uint64_t);
+	*(uint64_t*)tf->tf_rsp = tf->tf_rip;
+	tf->tf_rip = fault_tramp;
+	tf->tf_r12 = sig;
+	tf->tf_r13 = code;
+	tf->tf_r14 = addr;
+	run_uthread(uth);
+pass:
+	if (!pth_refl_fault) {
+		fprintf(stderr, "unhandled trap %u, err %u, aux %p\n",
+		        trap_nr, err, (void*)aux);
+		exit(2);
+	}
+	pth_refl_fault(uth, trap_nr, err, aux);
+}
+
+// Put go_refl_fault in front of the scheduler's fault op; *arg is
+// runtime·faulttramp.
+static void __gcc_fault_init(void *__arg)
+{
+	fault_tramp = *(uintptr_t*)__arg;
+	pth_refl_fault = sched_ops->thread_refl_fault;
+	sched_ops->thread_refl_fault = go_refl_fault;
+}
+const gcc_call_t gcc_fault_init = __gcc_fault_init;
+
+// Vcore affinity for locked goroutines (see runtime·vcorepin in
+// os_akaros.c).  A pinned uthread has an entry in pins naming its vcore.
+// go_thread_runnable keeps it off the pthread scheduler's queue, marking
+// the entry instead, and go_sched_entry runs it the next time that vcore
+// looks for work, ahead of anything the scheduler would pick.  A vcore
+// yielded or revoked in the meantime would strand its pinned uthreads, so
+// any vcore that finds one runnable there adopts it.  The uthread running
+// on a vcore is not interrupted for a pinned one, any more than for any
+// other pthread; and a uthread recovered from a preempted vcore goes
+// through the scheduler's own queue, so it may run once elsewhere before
+// it next blocks and its pin takes hold again.
+struct vcore_pin {
+	struct uthread *uth;
+	uint32_t vcoreid;
+	int pcoreid;	// provisioned for this pin, or -1
+	int runnable;
+	struct vcore_pin *next;
+};
+static struct vcore_pin *pins;
+static struct spin_pdr_lock pin_lock = SPINPDR_INITIALIZER;
+static void (*pth_sched_entry)(void);
+static void (*pth_thread_runnable)(struct uthread *);
+
+// A uthread must not be interrupted while it holds pin_lock.
+static void pins_lock(void)
+{
+	if (!in_vcore_context())
+		uth_disable_notifs();
+	spin_pdr_lock(&pin_lock);
+}
+
+static void pins_unlock(void)
+{
+	spin_pdr_unlock(&pin_lock);
+	if (!in_vcore_context())
+		uth_enable_notifs();
+}
+
+// The pthread scheduler's thread_runnable would put a pinned uthread on
+// its ready queue, for any vcore to take, so a pinned one only gets the
+// part of its bookkeeping that is visible outside pthread.c, its state.
+// Nor does anyone else ask for a vcore for it: the runtime asks for one
+// per busy P, and the pthread scheduler's own requests are off.  So if
+// its vcore has gone, ask for one more, which go_sched_entry will find
+// the uthread for.
+static void go_thread_runnable(struct uthread *uth)
+{
+	struct vcore_pin *p;
+	int lost = 0;
+
+	pins_lock();
+	for (p = pins; p; p = p->next)
+		if (p->uth == uth)
+			break;
+	if (p) {
+		((struct pthread_tcb*)uth)->state = PTH_RUNNABLE;
+		p->runnable = 1;
+		lost = !vcore_is_mapped(p->vcoreid);
+	}
+	pins_unlock();
+	if (!p)
+		pth_thread_runnable(uth);
+	else if (lost)
+		vcore_request_more(1);
+}
+
+static void go_sched_entry(void)
+{
+	uint32_t vcoreid = vcore_id();
+	struct vcore_pin *p;
+
+	if (!current_uthread) {
+		pins_lock();
+		for (p = pins; p; p = p->next)
+			if (p->runnable && (p->vcoreid == vcoreid ||
+			                    !vcore_is_mapped(p->vcoreid)))
+				break;
+		if (p) {
+			p->runnable = 0;
+			p->vcoreid = vcoreid;
+			((struct pthread_tcb*)p->uth)->state = PTH_RUNNING;
+		}
+		pins_unlock();
+		if (p)
+			run_uthread(p->uth);
+	}
+	pth_sched_entry();
+}
+
+// Pin the calling uthread to the vcore it is running on or, with a->pin
+// clear, unpin it.  a->vcoreid and a->pcoreid report where it is.  With
+// a->provision set, the pcore is provisioned to us as well, so that the
+// kernel gives the vcore back on that pcore should it preempt it; the
+// pcore is deprovisioned again (sys_provision to pid 0) when its last
+// pin goes.
+static void __gcc_vcore_pin(void *__arg)
+{
+	gcc_vcore_pin_arg_t *a = (gcc_vcore_pin_arg_t*)__arg;
+	struct vcore_pin *p, **pp, *n, *q;
+	int deprovision = -1;
+
+	n = a->pin ? malloc(sizeof *n) : NULL;
+	pins_lock();
+	if (!pth_sched_entry) {
+		pth_sched_entry = sched_ops->sched_entry;
+		pth_thread_runnable = sched_ops->thread_runnable;
+		sched_ops->sched_entry = go_sched_entry;
+		sched_ops->thread_runnable = go_thread_runnable;
+	}
+	a->vcoreid = vcore_id();
+	a->pcoreid = __procinfo.vcoremap[a->vcoreid].pcoreid;
+	for (pp = &pins; (p = *pp) != NULL; pp = &p->next)
+		if (p->uth == current_uthread)
+			break;
+	if (a->pin) {
+		if (!p && n) {
+			n->uth = current_uthread;
+			n->pcoreid = -1;
+			n->runnable = 0;
+			n->next = pins;
+			pins = p = n;
+			n = NULL;
+		}
+		if (p) {
+			p->vcoreid = a->vcoreid;
+			if (a->provision)
+				p->pcoreid = a->pcoreid;
+		}
+	} else if (p) {
+		*pp = p->next;
+		n = p;
+		deprovision = p->pcoreid;
+		for (q = pins; q && deprovision >= 0; q = q->next)
+			if (q->pcoreid == deprovision)
+				deprovision = -1;
+	}
+	pins_unlock();
+	free(n);
+	a->ok = !a->pin || p != NULL;
+	if (a->ok && a->pin && a->provision)
+		sys_provision(getpid(), RES_CORES, a->pcoreid);
+	if (deprovision >= 0)
+		sys_provision(0, RES_CORES, deprovision);
+}
+const gcc_call_t gcc_vcore_pin = __gcc_vcore_pin;
+
+// Profiling.  Every M registers its gcc_asyncprof_arg_t once; the list
+// only grows.  While the runtime profiles, a parlib alarm goes off every
+// prof_usec microseconds and sends each vcore running an M's uthread a
+// profiling tick for that M.
+static gcc_asyncprof_arg_t *asyncprof_list;
+static struct alarm_waiter prof_waiter;
+static uint64_t prof_usec;
+static int prof_lock;
+
+static void __gcc_asyncprof_register(void *__arg)
+{
+	gcc_asyncprof_arg_t *a = (gcc_asyncprof_arg_t*)__arg;
+
+	do
+		a->next = asyncprof_list;
+	while (!__sync_bool_compare_and_swap(&asyncprof_list, a->next, a));
+}
+const gcc_call_t gcc_asyncprof_register = __gcc_asyncprof_register;
+
+// Runs in vcore context, so it must not wait for prof_lock: whoever holds
+// it rearms the alarm or stops it.
+static void prof_handler(struct alarm_waiter *waiter)
+{
+	gcc_asyncprof_arg_t *a;
+	struct uthread *uth;
+	uint32_t i;
+
+	if (__sync_lock_test_and_set(&prof_lock, 1))
+		return;
+	if (prof_usec == 0) {
+		__sync_lock_release(&prof_lock);
+		return;
+	}
+	for (i = 0; i < max_vcores(); i++) {
+		if (!(uth = vcore_uthread(i)))
+			continue;
+		for (a = asyncprof_list; a; a = a->next) {
+			if (a->req.uth == uth) {
+				async_send(i, ASYNC_PROF, a);
+				break;
+			}
+		}
+	}
+	set_awaiter_inc(waiter, prof_usec);
+	__set_alarm(waiter);
+	__sync_lock_release(&prof_lock);
+}
+
+// Profile every *arg microseconds, starting afresh.
 static void __gcc_enable_profalarm(void *__arg)
 {
-	enable_profalarm(*((uint64_t*)__arg));
+	while (__sync_lock_test_and_set(&prof_lock, 1))
+		cpu_relax();
+	if (prof_usec != 0)
+		unset_alarm(&prof_waiter);
+	prof_usec = *(uint64_t*)__arg;
+	init_awaiter(&prof_waiter, prof_handler);
+	set_awaiter_rel(&prof_waiter, prof_usec);
+	set_alarm(&prof_waiter);
+	__sync_lock_release(&prof_lock);
 }
 const gcc_call_t gcc_enable_profalarm = __gcc_enable_profalarm;
 
 static void __gcc_disable_profalarm(void *__arg)
 {
-	disable_profalarm();
+	while (__sync_lock_test_and_set(&prof_lock, 1))
+		cpu_relax();
+	if (prof_usec != 0) {
+		prof_usec = 0;
+		unset_alarm(&prof_waiter);
+	}
+	__sync_lock_release(&prof_lock);
 }
 const gcc_call_t gcc_disable_profalarm = __gcc_disable_profalarm;
+
+// Where the calling pthread is running: its vcore and its pthread id.
+static void __gcc_thread_ids(void *__arg)
+{
+	gcc_thread_ids_arg_t *a = (gcc_thread_ids_arg_t*)__arg;
+	a->vcoreid = vcore_id();
+	a->tid = pthread_self()->id;
+}
+const gcc_call_t gcc_thread_ids = __gcc_thread_ids;
+
+// CPU topology from CPUID leaf 0xB: hardware threads per physical core
+// and physical cores per socket.  The kernel numbers pcores with threads
+// varying fastest, then cores, then sockets, so the first a->provision
+// pcores are provisioned to us in an order that spreads over physical
+// cores before doubling up on SMT siblings.
+static void __gcc_topology(void *__arg)
+{
+	gcc_topology_arg_t *a = (gcc_topology_arg_t*)__arg;
+	unsigned int eax, ebx, ecx, edx;
+	int i, t, c, per_core, per_socket;
+
+	a->threads_per_core = 1;
+	a->cores_per_socket = a->npcores;
+	if (__get_cpuid_max(0, NULL) >= 0xb) {
+		per_core = per_socket = 0;
+		for (i = 0; i < 8; i++) {
+			__cpuid_count(0xb, i, eax, ebx, ecx, edx);
+			if (((ecx >> 8) & 0xff) == 1)
+				per_core = ebx & 0xffff;
+			else if (((ecx >> 8) & 0xff) == 2)
+				per_socket = ebx & 0xffff;
+			else if (((ecx >> 8) & 0xff) == 0)
+				break;
+		}
+		if (per_core > 0)
+			a->threads_per_core = per_core;
+		if (per_socket >= per_core && per_core > 0)
+			a->cores_per_socket = per_socket / per_core;
+	}
+	if (a->cores_per_socket < 1)
+		a->cores_per_socket = 1;
+
+	i = 0;
+	for (t = 0; t < a->threads_per_core && i < a->provision; t++)
+		for (c = t; c < a->npcores && i < a->provision; c += a->threads_per_core, i++)
+			sys_provision(getpid(), RES_CORES, c);
+}
+const gcc_call_t gcc_topology = __gcc_topology;
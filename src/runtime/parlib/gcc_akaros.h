@@ -51,6 +51,131 @@ typedef struct gcc_sigprocmask_arg {
 	int retval;
 } gcc_sigprocmask_arg_t;
 
+typedef struct gcc_watchdog_arg {
+	uint64_t period_usec;
+	uint32_t *ticks;
+	uint32_t *npidle;	// runtime·sched.npidle
+	int32_t *runqsize;	// runtime·sched.runqsize
+	int32_t *nprocs;	// runtime·gomaxprocs
+	uint32_t last;
+	int stale;
+	int fired;
+} gcc_watchdog_arg_t;
+
+typedef struct gcc_thread_ids_arg {
+	int vcoreid;
+	int tid;
+} gcc_thread_ids_arg_t;
+
+typedef struct gcc_syscall_batch_arg {
+	struct syscall *sysc;
+	int n;
+} gcc_syscall_batch_arg_t;
+
+typedef struct gcc_topology_arg {
+	int npcores;
+	int provision;
+	int threads_per_core;
+	int cores_per_socket;
+} gcc_topology_arg_t;
+
+typedef struct gcc_syscall_submit_arg {
+	struct syscall *sysc;
+	struct event_queue *evq;
+	int done;
+} gcc_syscall_submit_arg_t;
+
+typedef struct gcc_syscall_reap_arg {
+	struct syscall *sysc;
+} gcc_syscall_reap_arg_t;
+
+typedef struct gcc_evq_arg {
+	struct event_queue *evq;
+	struct event_msg msg;
+} gcc_evq_arg_t;
+
+typedef struct gcc_uthread_running_arg {
+	struct uthread *uth;
+	int running;
+} gcc_uthread_running_arg_t;
+
+// What a uthread is doing, for tracebacks; UthreadStateArg in the runtime.
+typedef struct gcc_uthread_state_arg {
+	struct uthread *uth;
+	struct syscall *sysc;	// the call it is blocked on, if any
+	int state;
+	int flags;
+	int notif_disabled;	// depth of uth_disable_notifs
+	int vcoreid;		// the vcore running it, or -1
+} gcc_uthread_state_arg_t;
+
+typedef struct gcc_evq_poll_arg {
+	struct event_queue *evq;
+	struct event_msg msg;
+	int ok;
+} gcc_evq_poll_arg_t;
+
+// A kernel alarm from the #alarm device, posting to an event queue of
+// its own; AlarmArg in runtime.h.
+typedef struct gcc_alarm_arg {
+	struct event_queue *evq;
+	int ctlfd;
+	int timerfd;
+	int id;
+	int have;	// the device gave us the alarm; set by gcc_alarm_new
+	int ok;		// the last gcc_alarm_set worked
+	uint64_t tsc;	// when to go off, for gcc_alarm_set
+} gcc_alarm_arg_t;
+
+// Register layout of the block runtime·asyncpreempt and runtime·asyncprof
+// restore from, as in runtime.h.
+enum {
+	ASYNC_RAX, ASYNC_RBX, ASYNC_RCX, ASYNC_RDX, ASYNC_RSI, ASYNC_RDI, ASYNC_RBP,
+	ASYNC_R8, ASYNC_R9, ASYNC_R10, ASYNC_R11, ASYNC_R12, ASYNC_R13, ASYNC_R14,
+	ASYNC_R15, ASYNC_RFLAGS, ASYNC_RIP, ASYNC_RSP,
+	ASYNC_X0,
+	ASYNC_REGS = ASYNC_X0 + 2*16,
+};
+
+// Kinds of EV_USER_IPI sent by the runtime, in ev_arg1.
+enum {
+	ASYNC_PREEMPT,
+	ASYNC_PROF,
+};
+
+// An asynchronous preemption request; struct AsyncPreempt in runtime.h.
+typedef struct gcc_asyncpreempt_arg {
+	struct uthread *uth;
+	uint64_t *regs;
+	uint32_t *busy;
+	uintptr_t lo;
+	uintptr_t hi;
+} gcc_asyncpreempt_arg_t;
+
+// An M's standing profiling request; struct AsyncProf in runtime.h.
+typedef struct gcc_asyncprof_arg {
+	gcc_asyncpreempt_arg_t req;
+	uint64_t regs[ASYNC_REGS];
+	uint32_t busy;
+	struct gcc_asyncprof_arg *next;
+} gcc_asyncprof_arg_t;
+
+// Vcore affinity for runtime.LockOSThread; VcorePinArg in the runtime.
+typedef struct gcc_vcore_pin_arg {
+	int pin;	// pin, or unpin
+	int provision;	// also provision the pcore under the vcore
+	int vcoreid;
+	int pcoreid;
+	int ok;
+} gcc_vcore_pin_arg_t;
+
+typedef struct gcc_asyncpreempt_init_arg {
+	uintptr_t preempt;	// runtime·asyncpreempt
+	uintptr_t prof;		// runtime·asyncprof
+	uintptr_t end;		// runtime·asyncpreemptend
+	int ok;
+} gcc_asyncpreempt_init_arg_t;
+
 typedef TAILQ_ENTRY(parlib_alarm_waiter) parlib_alarm_waiter_tailq_entry_t;
 struct parlib_alarm_waiter {
     uint64_t                          wake_up_time;   /* tsc time */
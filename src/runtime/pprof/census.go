@@ -0,0 +1,217 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pprof
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+)
+
+// A HeapCensus is a summary of the live heap, small enough to keep in
+// memory and compare with a later one when hunting a leak on a machine
+// with no room for full heap dumps.
+//
+// The heap does not record the type of each object, only its size, so
+// BySize counts every live object but ByType and ByStack count only the
+// allocations sampled by the memory profiler (see runtime.MemProfileRate),
+// which records their type and the stack that allocated them.  ByType
+// leaves out the few allocations whose type the runtime is not told.  Set
+// MemProfileRate to 1 before the allocations of interest for exact counts.
+type HeapCensus struct {
+	BySize  []CensusCount // one per size class, plus Size 0 for large objects
+	ByType  []CensusCount // sampled allocations still in use
+	ByStack []CensusCount // sampled allocations still in use
+}
+
+// A CensusCount is one line of a HeapCensus.
+type CensusCount struct {
+	Size    uint32    // object size class, in BySize
+	Type    string    // type allocated (element type, for arrays), in ByType
+	Stack   []uintptr // allocation stack, in ByStack
+	Objects int64
+	Bytes   int64
+}
+
+// TakeHeapCensus runs a garbage collection, so that only live objects are
+// counted, and returns a census of the heap.
+func TakeHeapCensus() *HeapCensus {
+	runtime.GC()
+	c := new(HeapCensus)
+
+	var s runtime.MemStats
+	runtime.ReadMemStats(&s)
+	var objects, bytes int64
+	for _, sz := range s.BySize {
+		n := int64(sz.Mallocs - sz.Frees)
+		if sz.Size == 0 || n == 0 {
+			continue
+		}
+		c.BySize = append(c.BySize, CensusCount{Size: sz.Size, Objects: n, Bytes: n * int64(sz.Size)})
+		objects += n
+		bytes += n * int64(sz.Size)
+	}
+	if n := int64(s.HeapObjects) - objects; n > 0 {
+		c.BySize = append(c.BySize, CensusCount{Objects: n, Bytes: int64(s.HeapAlloc) - bytes})
+	}
+
+	var p []runtime.MemProfileRecord
+	n, ok := runtime.MemProfile(nil, false)
+	for {
+		p = make([]runtime.MemProfileRecord, n+50)
+		n, ok = runtime.MemProfile(p, false)
+		if ok {
+			p = p[0:n]
+			break
+		}
+	}
+	for i := range p {
+		r := &p[i]
+		c.ByStack = append(c.ByStack, CensusCount{
+			Stack:   r.Stack(),
+			Objects: r.InUseObjects(),
+			Bytes:   r.InUseBytes(),
+		})
+	}
+
+	runtime_heapTypes(func(typ string, objects, bytes int64) {
+		c.ByType = append(c.ByType, CensusCount{Type: typ, Objects: objects, Bytes: bytes})
+	})
+	return c
+}
+
+// runtime_heapTypes calls fn with the sampled objects and bytes still in
+// use of each type the memory profiler has seen.
+func runtime_heapTypes(fn func(typ string, objects, bytes int64))
+
+// Diff returns the change from base to c: for each size class, type and stack,
+// how many more (or, if negative, fewer) objects and bytes c holds.  Lines
+// that did not change are left out.
+func (c *HeapCensus) Diff(base *HeapCensus) *HeapCensus {
+	d := new(HeapCensus)
+
+	sizes := make(map[uint32]CensusCount)
+	for _, e := range base.BySize {
+		sizes[e.Size] = CensusCount{Size: e.Size, Objects: -e.Objects, Bytes: -e.Bytes}
+	}
+	for _, e := range c.BySize {
+		o := sizes[e.Size]
+		sizes[e.Size] = CensusCount{Size: e.Size, Objects: o.Objects + e.Objects, Bytes: o.Bytes + e.Bytes}
+	}
+	for _, e := range sizes {
+		if e.Objects != 0 || e.Bytes != 0 {
+			d.BySize = append(d.BySize, e)
+		}
+	}
+
+	types := make(map[string]CensusCount)
+	for _, e := range base.ByType {
+		types[e.Type] = CensusCount{Type: e.Type, Objects: -e.Objects, Bytes: -e.Bytes}
+	}
+	for _, e := range c.ByType {
+		o := types[e.Type]
+		types[e.Type] = CensusCount{Type: e.Type, Objects: o.Objects + e.Objects, Bytes: o.Bytes + e.Bytes}
+	}
+	for _, e := range types {
+		if e.Objects != 0 || e.Bytes != 0 {
+			d.ByType = append(d.ByType, e)
+		}
+	}
+
+	stacks := make(map[string]CensusCount)
+	for _, e := range base.ByStack {
+		stacks[stackKey(e.Stack)] = CensusCount{Stack: e.Stack, Objects: -e.Objects, Bytes: -e.Bytes}
+	}
+	for _, e := range c.ByStack {
+		k := stackKey(e.Stack)
+		o := stacks[k]
+		stacks[k] = CensusCount{Stack: e.Stack, Objects: o.Objects + e.Objects, Bytes: o.Bytes + e.Bytes}
+	}
+	for _, e := range stacks {
+		if e.Objects != 0 || e.Bytes != 0 {
+			d.ByStack = append(d.ByStack, e)
+		}
+	}
+
+	sort.Sort(byCensusBytes(d.BySize))
+	sort.Sort(byCensusBytes(d.ByType))
+	sort.Sort(byCensusBytes(d.ByStack))
+	return d
+}
+
+func stackKey(stk []uintptr) string {
+	b := make([]byte, 0, 8*len(stk))
+	for _, pc := range stk {
+		for i := uint(0); i < 64; i += 8 {
+			b = append(b, byte(pc>>i))
+		}
+	}
+	return string(b)
+}
+
+// WriteTo writes c to w as text, largest lines first.  With debug > 0
+// each stack is followed by its function names and line numbers.
+func (c *HeapCensus) WriteTo(w io.Writer, debug int) error {
+	bySize := append([]CensusCount(nil), c.BySize...)
+	byType := append([]CensusCount(nil), c.ByType...)
+	byStack := append([]CensusCount(nil), c.ByStack...)
+	sort.Sort(byCensusBytes(bySize))
+	sort.Sort(byCensusBytes(byType))
+	sort.Sort(byCensusBytes(byStack))
+
+	b := bufio.NewWriter(w)
+	tw := tabwriter.NewWriter(b, 1, 8, 1, '\t', 0)
+	fmt.Fprintf(tw, "heap census by size class\n")
+	for _, e := range bySize {
+		if e.Size == 0 {
+			fmt.Fprintf(tw, "large\t%d objects\t%d bytes\n", e.Objects, e.Bytes)
+		} else {
+			fmt.Fprintf(tw, "%d\t%d objects\t%d bytes\n", e.Size, e.Objects, e.Bytes)
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(b, "\nheap census by type\n")
+	tw = tabwriter.NewWriter(b, 1, 8, 1, '\t', 0)
+	for _, e := range byType {
+		fmt.Fprintf(tw, "%s\t%d objects\t%d bytes\n", e.Type, e.Objects, e.Bytes)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(b, "\nheap census by allocation stack\n")
+	for _, e := range byStack {
+		fmt.Fprintf(b, "%d: %d @", e.Objects, e.Bytes)
+		for _, pc := range e.Stack {
+			fmt.Fprintf(b, " %#x", pc)
+		}
+		fmt.Fprintf(b, "\n")
+		if debug > 0 {
+			printStackRecord(b, e.Stack, false)
+		}
+	}
+	return b.Flush()
+}
+
+// byCensusBytes sorts by the size of the change, growth first.
+type byCensusBytes []CensusCount
+
+func (x byCensusBytes) Len() int      { return len(x) }
+func (x byCensusBytes) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+func (x byCensusBytes) Less(i, j int) bool {
+	a, b := x[i].Bytes, x[j].Bytes
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	if a != b {
+		return a > b
+	}
+	return x[i].Bytes > x[j].Bytes
+}
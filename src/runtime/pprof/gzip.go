@@ -0,0 +1,67 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pprof
+
+import "io"
+
+// runtime/pprof cannot import compress/gzip: testing imports
+// runtime/pprof, so the tests of compress/flate, compress/gzip and
+// hash/crc32 would end up importing themselves.  Profiles are small
+// and pprof only needs a valid gzip stream, so writeGzip emits one
+// made of stored (uncompressed) deflate blocks, as described in
+// RFC 1951 section 3.2.4 and RFC 1952.
+
+// maxStored is the most data a stored deflate block can hold.
+const maxStored = 1<<16 - 1
+
+// writeGzip writes data to w as a single gzip member.
+func writeGzip(w io.Writer, data []byte) error {
+	// ID1, ID2, CM=deflate, no flags, no mtime, no XFL, OS unknown.
+	b := make([]byte, 0, 10+len(data)+5*(len(data)/maxStored+1)+8)
+	b = append(b, 0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255)
+	for p := data; ; {
+		n := len(p)
+		final := byte(1)
+		if n > maxStored {
+			n, final = maxStored, 0
+		}
+		b = append(b, final, byte(n), byte(n>>8), ^byte(n), ^byte(n>>8))
+		b = append(b, p[:n]...)
+		p = p[n:]
+		if final == 1 {
+			break
+		}
+	}
+	crc, size := crc32(data), uint32(len(data))
+	b = append(b, byte(crc), byte(crc>>8), byte(crc>>16), byte(crc>>24))
+	b = append(b, byte(size), byte(size>>8), byte(size>>16), byte(size>>24))
+	_, err := w.Write(b)
+	return err
+}
+
+var crcTable [256]uint32
+
+func init() {
+	for i := range crcTable {
+		c := uint32(i)
+		for j := 0; j < 8; j++ {
+			if c&1 != 0 {
+				c = c>>1 ^ 0xedb88320 // IEEE polynomial, reversed
+			} else {
+				c >>= 1
+			}
+		}
+		crcTable[i] = c
+	}
+}
+
+// crc32 returns the IEEE CRC-32 checksum of data, as hash/crc32 would.
+func crc32(data []byte) uint32 {
+	c := ^uint32(0)
+	for _, v := range data {
+		c = crcTable[byte(c)^v] ^ c>>8
+	}
+	return ^c
+}
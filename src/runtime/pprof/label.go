@@ -0,0 +1,114 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pprof
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// A LabelSet is a set of profiler labels, pairs of a key and a value.
+// While a goroutine runs with a set of labels, the samples that the CPU
+// profile takes of it carry them, so that a server can attribute the
+// cost of its work to the requests or tenants it serves.  The labels
+// appear in profiles written by StartCPUProfileProto; the legacy format
+// has no room for them.
+type LabelSet struct {
+	list []label
+}
+
+type label struct {
+	key, value string
+}
+
+// labelMap is the set of labels the runtime holds for a goroutine.  A
+// labelMap is never changed once a goroutine has it.
+type labelMap map[string]string
+
+// Labels returns a set of the labels given as alternating keys and
+// values.  A later value for a key replaces an earlier one.
+func Labels(args ...string) LabelSet {
+	if len(args)%2 != 0 {
+		panic("uneven number of arguments to pprof.Labels")
+	}
+	var s LabelSet
+	for i := 0; i < len(args); i += 2 {
+		s.list = append(s.list, label{args[i], args[i+1]})
+	}
+	return s
+}
+
+func runtime_setProfLabel(labels unsafe.Pointer)
+func runtime_getProfLabel() unsafe.Pointer
+func runtime_setCPUProfileLabels(on bool)
+
+// goroutineLabels returns the current goroutine's labels.
+func goroutineLabels() labelMap {
+	p := runtime_getProfLabel()
+	if p == nil {
+		return nil
+	}
+	return *(*labelMap)(p)
+}
+
+// Do calls f with the current goroutine's labels extended by labels, and
+// restores them when f returns.  Goroutines that f starts keep the
+// extended set.
+func Do(labels LabelSet, f func()) {
+	old := runtime_getProfLabel()
+	defer runtime_setProfLabel(old)
+	m := labelMap{}
+	for k, v := range goroutineLabels() {
+		m[k] = v
+	}
+	for _, l := range labels.list {
+		m[l.key] = l.value
+	}
+	runtime_setProfLabel(unsafe.Pointer(&m))
+	f()
+}
+
+// SetGoroutineLabels replaces the current goroutine's labels with labels.
+// Goroutines it starts from then on begin with the same set.  Most code
+// should use Do instead.
+func SetGoroutineLabels(labels LabelSet) {
+	if len(labels.list) == 0 {
+		runtime_setProfLabel(nil)
+		return
+	}
+	m := labelMap{}
+	for _, l := range labels.list {
+		m[l.key] = l.value
+	}
+	runtime_setProfLabel(unsafe.Pointer(&m))
+}
+
+// Label returns the value of the label key on the current goroutine,
+// and whether it has one.
+func Label(key string) (string, bool) {
+	v, ok := goroutineLabels()[key]
+	return v, ok
+}
+
+// ForLabels calls f with each label on the current goroutine, in order of
+// key, until f returns false.
+func ForLabels(f func(key, value string) bool) {
+	m := goroutineLabels()
+	for _, k := range m.keys() {
+		if !f(k, m[k]) {
+			return
+		}
+	}
+}
+
+// keys returns the keys of m in order.
+func (m labelMap) keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
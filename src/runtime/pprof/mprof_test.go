@@ -97,3 +97,84 @@ func TestMemoryProfiler(t *testing.T) {
 		}
 	}
 }
+
+var censusSink []*Obj32
+
+func TestHeapCensusDiff(t *testing.T) {
+	oldRate := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() {
+		runtime.MemProfileRate = oldRate
+	}()
+
+	base := TakeHeapCensus()
+	for i := 0; i < 1000; i++ {
+		censusSink = append(censusSink, new(Obj32))
+	}
+	d := TakeHeapCensus().Diff(base)
+
+	var objects int64
+	for _, e := range d.BySize {
+		if e.Size == 32 {
+			objects = e.Objects
+		}
+	}
+	if objects < 1000 {
+		t.Errorf("size class 32 grew by %d objects, want at least 1000", objects)
+	}
+	objects = 0
+	for _, e := range d.ByType {
+		if e.Type == "pprof_test.Obj32" {
+			objects = e.Objects
+		}
+	}
+	if objects < 1000 {
+		t.Errorf("type pprof_test.Obj32 grew by %d objects, want at least 1000", objects)
+	}
+	found := false
+	for _, e := range d.ByStack {
+		if e.Objects < 1000 {
+			continue
+		}
+		for _, pc := range e.Stack {
+			if f := runtime.FuncForPC(pc); f != nil && f.Name() == "runtime/pprof_test.TestHeapCensusDiff" {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no stack in TestHeapCensusDiff grew by 1000 objects:\n%v", d.ByStack)
+	}
+	censusSink = nil
+}
+
+func TestMemProfileFunc(t *testing.T) {
+	oldRate := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() {
+		runtime.MemProfileRate = oldRate
+	}()
+	allocatePersistent1K()
+	runtime.GC()
+
+	seen := 0
+	runtime.MemProfileFunc(true, func(r *runtime.MemProfileRecord) bool {
+		if r.AllocBytes < r.FreeBytes || len(r.Stack()) == 0 {
+			t.Errorf("bad record %+v", *r)
+		}
+		seen++
+		return true
+	})
+	if seen == 0 {
+		t.Errorf("MemProfileFunc saw no records")
+	}
+
+	seen = 0
+	runtime.MemProfileFunc(true, func(r *runtime.MemProfileRecord) bool {
+		seen++
+		return false
+	})
+	if seen != 1 {
+		t.Errorf("MemProfileFunc called fn %d times after it returned false", seen)
+	}
+}
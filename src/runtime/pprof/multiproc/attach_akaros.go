@@ -0,0 +1,57 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiproc
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ControlName is the name under which the control channel appears in the
+// child's warm-start fd manifest.
+const ControlName = "pprof"
+
+// Attach arranges for a process started with attr to receive a profiling
+// control channel.  It returns the parent's end, to be registered with a
+// Collector once the process is running, and the child's end, which the
+// caller should close after os.StartProcess returns.
+func Attach(attr *os.ProcAttr) (ctl, childEnd *os.File, err error) {
+	// Akaros pipes are bidirectional.
+	ctl, childEnd, err = os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if attr.Sys == nil {
+		attr.Sys = new(syscall.SysProcAttr)
+	}
+	attr.Sys.Fds = append(attr.Sys.Fds, syscall.InheritedFd{
+		Fd:   len(attr.Files),
+		Kind: syscall.FdControl,
+		Name: ControlName,
+	})
+	attr.Files = append(attr.Files, childEnd)
+	return ctl, childEnd, nil
+}
+
+// Serve answers profile requests on the control channel handed down by
+// the parent with Attach.  It is meant to be run in its own goroutine and
+// returns when the parent closes the channel.
+func Serve() error {
+	// InheritedFiles makes each inherited File once and hands the same
+	// ones to every caller, so the entries skipped here stay open for
+	// the application that owns them.
+	files, err := os.InheritedFiles()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Kind == syscall.FdControl && f.Name == ControlName {
+			defer f.Close()
+			return ServeConn(f.File)
+		}
+	}
+	return errors.New("multiproc: no profiling control channel")
+}
@@ -0,0 +1,250 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiproc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var errCPUFormat = errors.New("multiproc: malformed CPU profile")
+
+// A cpuProfile is a decoded legacy CPU profile: a header of
+// 0, 3, 0, period, 0, then records of count, n, pc[n], then the
+// trailer 0, 1, 0, all in native little-endian words.
+type cpuProfile struct {
+	wordSize int
+	period   uint64
+	order    []string // stack keys in first-seen order
+	stacks   map[string][]uint64
+	counts   map[string]uint64
+	tail     []byte // anything after the trailer
+}
+
+func parseCPU(data []byte) (*cpuProfile, error) {
+	p := &cpuProfile{
+		stacks: make(map[string][]uint64),
+		counts: make(map[string]uint64),
+	}
+	// The second header word is 3; use it to find the word size.
+	switch {
+	case len(data) >= 5*8 && binary.LittleEndian.Uint64(data[8:]) == 3:
+		p.wordSize = 8
+	case len(data) >= 5*4 && binary.LittleEndian.Uint32(data[4:]) == 3:
+		p.wordSize = 4
+	default:
+		return nil, errCPUFormat
+	}
+	word := func() (uint64, bool) {
+		if len(data) < p.wordSize {
+			return 0, false
+		}
+		var w uint64
+		if p.wordSize == 8 {
+			w = binary.LittleEndian.Uint64(data)
+		} else {
+			w = uint64(binary.LittleEndian.Uint32(data))
+		}
+		data = data[p.wordSize:]
+		return w, true
+	}
+	var hdr [5]uint64
+	for i := range hdr {
+		hdr[i], _ = word()
+	}
+	if hdr[0] != 0 || hdr[1] != 3 || hdr[2] != 0 || hdr[4] != 0 {
+		return nil, errCPUFormat
+	}
+	p.period = hdr[3]
+	for {
+		count, ok1 := word()
+		n, ok2 := word()
+		if !ok1 || !ok2 || n > uint64(len(data)/p.wordSize) {
+			return nil, errCPUFormat
+		}
+		stk := make([]uint64, n)
+		for i := range stk {
+			stk[i], _ = word()
+		}
+		if count == 0 && n == 1 && stk[0] == 0 {
+			break // trailer
+		}
+		key := stackKey(stk)
+		if _, ok := p.counts[key]; !ok {
+			p.order = append(p.order, key)
+			p.stacks[key] = stk
+		}
+		p.counts[key] += count
+	}
+	p.tail = data
+	return p, nil
+}
+
+func stackKey(stk []uint64) string {
+	b := make([]byte, 8*len(stk))
+	for i, pc := range stk {
+		binary.LittleEndian.PutUint64(b[8*i:], pc)
+	}
+	return string(b)
+}
+
+// MergeCPU merges CPU profiles, as written by runtime/pprof, into one
+// written to w.  Samples with identical stacks are combined.  All the
+// profiles must have the same sampling period and word size; anything
+// following the first profile's trailer is copied through.
+func MergeCPU(w io.Writer, profs ...[]byte) error {
+	if len(profs) == 0 {
+		return errors.New("multiproc: no profiles to merge")
+	}
+	var m *cpuProfile
+	for _, data := range profs {
+		p, err := parseCPU(data)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			m = p
+			continue
+		}
+		if p.wordSize != m.wordSize || p.period != m.period {
+			return errors.New("multiproc: CPU profiles have different formats or periods")
+		}
+		for _, key := range p.order {
+			if _, ok := m.counts[key]; !ok {
+				m.order = append(m.order, key)
+				m.stacks[key] = p.stacks[key]
+			}
+			m.counts[key] += p.counts[key]
+		}
+	}
+
+	var buf bytes.Buffer
+	put := func(v uint64) {
+		var b [8]byte
+		if m.wordSize == 8 {
+			binary.LittleEndian.PutUint64(b[:], v)
+		} else {
+			binary.LittleEndian.PutUint32(b[:], uint32(v))
+		}
+		buf.Write(b[:m.wordSize])
+	}
+	for _, v := range []uint64{0, 3, 0, m.period, 0} {
+		put(v)
+	}
+	for _, key := range m.order {
+		stk := m.stacks[key]
+		put(m.counts[key])
+		put(uint64(len(stk)))
+		for _, pc := range stk {
+			put(pc)
+		}
+	}
+	for _, v := range []uint64{0, 1, 0} {
+		put(v)
+	}
+	buf.Write(m.tail)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// heapCounts holds the four numbers on a heap profile line:
+// in-use objects and bytes, allocated objects and bytes.
+type heapCounts [4]int64
+
+func (c *heapCounts) add(d heapCounts) {
+	for i := range c {
+		c[i] += d[i]
+	}
+}
+
+// parseHeapCounts parses "a: b [c: d]".
+func parseHeapCounts(s string) (heapCounts, bool) {
+	var c heapCounts
+	f := strings.Fields(strings.NewReplacer(":", " ", "[", " ", "]", " ").Replace(s))
+	if len(f) != 4 {
+		return c, false
+	}
+	for i := range c {
+		v, err := strconv.ParseInt(f[i], 10, 64)
+		if err != nil {
+			return c, false
+		}
+		c[i] = v
+	}
+	return c, true
+}
+
+// MergeHeap merges heap profiles, as written by runtime/pprof with
+// debug=0, into one written to w.  Records with identical stacks are
+// combined.  All the profiles must use the same sampling rate.
+func MergeHeap(w io.Writer, profs ...[]byte) error {
+	if len(profs) == 0 {
+		return errors.New("multiproc: no profiles to merge")
+	}
+	var (
+		total  heapCounts
+		rate   string
+		order  []string
+		counts = make(map[string]*heapCounts)
+	)
+	for i, data := range profs {
+		s := bufio.NewScanner(bytes.NewReader(data))
+		if !s.Scan() {
+			return errors.New("multiproc: empty heap profile")
+		}
+		hdr := strings.TrimPrefix(s.Text(), "heap profile: ")
+		at := strings.Index(hdr, " @ ")
+		if at < 0 || len(hdr) == len(s.Text()) {
+			return fmt.Errorf("multiproc: malformed heap profile header %q", s.Text())
+		}
+		c, ok := parseHeapCounts(hdr[:at])
+		if !ok {
+			return fmt.Errorf("multiproc: malformed heap profile header %q", s.Text())
+		}
+		if i == 0 {
+			rate = hdr[at+3:]
+		} else if hdr[at+3:] != rate {
+			return errors.New("multiproc: heap profiles have different sampling rates")
+		}
+		total.add(c)
+		for s.Scan() {
+			line := s.Text()
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			at := strings.Index(line, " @")
+			if at < 0 {
+				return fmt.Errorf("multiproc: malformed heap profile line %q", line)
+			}
+			c, ok := parseHeapCounts(line[:at])
+			if !ok {
+				return fmt.Errorf("multiproc: malformed heap profile line %q", line)
+			}
+			stk := line[at+2:]
+			if counts[stk] == nil {
+				order = append(order, stk)
+				counts[stk] = new(heapCounts)
+			}
+			counts[stk].add(c)
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "heap profile: %d: %d [%d: %d] @ %s\n", total[0], total[1], total[2], total[3], rate)
+	for _, stk := range order {
+		c := counts[stk]
+		fmt.Fprintf(b, "%d: %d [%d: %d] @%s\n", c[0], c[1], c[2], c[3], stk)
+	}
+	return b.Flush()
+}
@@ -0,0 +1,56 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func cpuWords(words ...uint64) []byte {
+	b := make([]byte, 8*len(words))
+	for i, w := range words {
+		binary.LittleEndian.PutUint64(b[8*i:], w)
+	}
+	return b
+}
+
+func TestMergeCPU(t *testing.T) {
+	a := cpuWords(0, 3, 0, 10000, 0, 5, 2, 0x10, 0x20, 1, 1, 0x30, 0, 1, 0)
+	b := cpuWords(0, 3, 0, 10000, 0, 2, 1, 0x40, 7, 2, 0x10, 0x20, 0, 1, 0)
+	var out bytes.Buffer
+	if err := MergeCPU(&out, a, b); err != nil {
+		t.Fatal(err)
+	}
+	want := cpuWords(0, 3, 0, 10000, 0, 12, 2, 0x10, 0x20, 1, 1, 0x30, 2, 1, 0x40, 0, 1, 0)
+	if !reflect.DeepEqual(out.Bytes(), want) {
+		t.Errorf("merged profile mismatch:\nhave % x\nwant % x", out.Bytes(), want)
+	}
+
+	c := cpuWords(0, 3, 0, 5000, 0, 0, 1, 0)
+	if err := MergeCPU(&out, a, c); err == nil {
+		t.Errorf("merging profiles with different periods succeeded")
+	}
+}
+
+func TestMergeHeap(t *testing.T) {
+	a := "heap profile: 3: 300 [5: 500] @ heap/1048576\n" +
+		"2: 200 [3: 300] @ 0x10 0x20\n" +
+		"1: 100 [2: 200] @ 0x30\n"
+	b := "heap profile: 1: 50 [4: 400] @ heap/1048576\n" +
+		"1: 50 [4: 400] @ 0x10 0x20\n"
+	var out bytes.Buffer
+	if err := MergeHeap(&out, []byte(a), []byte(b)); err != nil {
+		t.Fatal(err)
+	}
+	want := "heap profile: 4: 350 [9: 900] @ heap/1048576\n" +
+		"3: 250 [7: 700] @ 0x10 0x20\n" +
+		"1: 100 [2: 200] @ 0x30\n"
+	if out.String() != want {
+		t.Errorf("merged profile:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package multiproc collects CPU and heap profiles from a group of
+// cooperating processes and merges them into a single profile, for
+// programs built as many processes rather than one.
+//
+// Each child answers profile requests on a control channel set up when it
+// was started.  On Akaros, Attach adds that channel to a child's
+// os.ProcAttr and Serve, called from the child, finds and answers it; any
+// other io.ReadWriter can be served with ServeConn.  The parent registers
+// each child's end of the channel with a Collector, which fans requests out
+// to all children and merges the replies.
+//
+// Merging assumes the children run the same executable, so that a program
+// counter means the same thing in every one of them.
+//
+// The protocol is line based.  A request is "cpu <seconds>\n" or "heap\n".
+// A reply is "ok <n>\n" followed by n bytes of profile in the format
+// written by runtime/pprof, or "err <message>\n".
+package multiproc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServeConn answers profile requests read from rw until rw returns an
+// error.  It returns nil when rw reaches EOF.
+func ServeConn(rw io.ReadWriter) error {
+	r := bufio.NewReader(rw)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		err = profile(&buf, strings.TrimSpace(line))
+		if err != nil {
+			_, err = fmt.Fprintf(rw, "err %s\n", err)
+		} else if _, err = fmt.Fprintf(rw, "ok %d\n", buf.Len()); err == nil {
+			_, err = rw.Write(buf.Bytes())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func profile(w io.Writer, req string) error {
+	f := strings.Fields(req)
+	switch {
+	case len(f) == 2 && f[0] == "cpu":
+		secs, err := strconv.Atoi(f[1])
+		if err != nil || secs <= 0 {
+			return fmt.Errorf("bad duration %q", f[1])
+		}
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return err
+		}
+		time.Sleep(time.Duration(secs) * time.Second)
+		pprof.StopCPUProfile()
+		return nil
+	case len(f) == 1 && f[0] == "heap":
+		return pprof.WriteHeapProfile(w)
+	}
+	return fmt.Errorf("bad request %q", req)
+}
+
+// A Collector requests profiles from a set of child processes and merges
+// them.  It is safe for concurrent use.
+type Collector struct {
+	mu       sync.Mutex
+	children map[int]*child
+}
+
+type child struct {
+	mu  sync.Mutex // one request at a time
+	ctl io.ReadWriter
+	r   *bufio.Reader
+}
+
+// Add registers the parent's end of the control channel for process pid.
+func (c *Collector) Add(pid int, ctl io.ReadWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.children == nil {
+		c.children = make(map[int]*child)
+	}
+	c.children[pid] = &child{ctl: ctl, r: bufio.NewReader(ctl)}
+}
+
+// Remove forgets process pid, typically after it has exited.
+func (c *Collector) Remove(pid int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.children, pid)
+}
+
+// request sends req to every child at once and returns their replies,
+// ordered by pid.  It fails if any child fails.
+func (c *Collector) request(req string) ([][]byte, error) {
+	c.mu.Lock()
+	pids := make([]int, 0, len(c.children))
+	for pid := range c.children {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	kids := make([]*child, len(pids))
+	for i, pid := range pids {
+		kids[i] = c.children[pid]
+	}
+	c.mu.Unlock()
+
+	if len(kids) == 0 {
+		return nil, errors.New("multiproc: no processes to profile")
+	}
+	profs := make([][]byte, len(kids))
+	errs := make([]error, len(kids))
+	var wg sync.WaitGroup
+	for i, k := range kids {
+		wg.Add(1)
+		go func(i int, k *child) {
+			defer wg.Done()
+			profs[i], errs[i] = k.request(req)
+		}(i, k)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("multiproc: process %d: %v", pids[i], err)
+		}
+	}
+	return profs, nil
+}
+
+func (k *child) request(req string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, err := io.WriteString(k.ctl, req+"\n"); err != nil {
+		return nil, err
+	}
+	line, err := k.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "err ") {
+		return nil, errors.New(line[len("err "):])
+	}
+	if !strings.HasPrefix(line, "ok ") {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	n, err := strconv.Atoi(line[len("ok "):])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(k.r, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CPUProfile profiles every registered process for d, rounded up to a
+// whole second, and writes the merged CPU profile to w.
+func (c *Collector) CPUProfile(w io.Writer, d time.Duration) error {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs <= 0 {
+		secs = 1
+	}
+	profs, err := c.request("cpu " + strconv.Itoa(secs))
+	if err != nil {
+		return err
+	}
+	return MergeCPU(w, profs...)
+}
+
+// HeapProfile writes the merged heap profile of every registered process
+// to w.
+func (c *Collector) HeapProfile(w io.Writer) error {
+	profs, err := c.request("heap")
+	if err != nil {
+		return err
+	}
+	return MergeHeap(w, profs...)
+}
@@ -37,6 +37,8 @@ import (
 //	heap         - a sampling of all heap allocations
 //	threadcreate - stack traces that led to the creation of new OS threads
 //	block        - stack traces that led to blocking on synchronization primitives
+//	mutex        - stack traces of holders of contended mutexes
+//	syscall      - system calls the kernel has not completed yet (Akaros only)
 //
 // These predefined profiles maintain themselves and panic on an explicit
 // Add or Remove method call.
@@ -51,6 +53,7 @@ type Profile struct {
 	m     map[interface{}][]uintptr
 	count func() int
 	write func(io.Writer, int) error
+	proto func(io.Writer) error
 }
 
 // profiles records all registered profiles.
@@ -63,24 +66,41 @@ var goroutineProfile = &Profile{
 	name:  "goroutine",
 	count: countGoroutine,
 	write: writeGoroutine,
+	proto: writeGoroutineProto,
 }
 
 var threadcreateProfile = &Profile{
 	name:  "threadcreate",
 	count: countThreadCreate,
 	write: writeThreadCreate,
+	proto: writeThreadCreateProto,
 }
 
 var heapProfile = &Profile{
 	name:  "heap",
 	count: countHeap,
 	write: writeHeap,
+	proto: writeHeapProto,
 }
 
 var blockProfile = &Profile{
 	name:  "block",
 	count: countBlock,
 	write: writeBlock,
+	proto: writeBlockProto,
+}
+
+var mutexProfile = &Profile{
+	name:  "mutex",
+	count: countMutex,
+	write: writeMutex,
+	proto: writeMutexProto,
+}
+
+var syscallProfile = &Profile{
+	name:  "syscall",
+	count: countSyscall,
+	write: writeSyscall,
 }
 
 func lockProfiles() {
@@ -92,6 +112,8 @@ func lockProfiles() {
 			"threadcreate": threadcreateProfile,
 			"heap":         heapProfile,
 			"block":        blockProfile,
+			"mutex":        mutexProfile,
+			"syscall":      syscallProfile,
 		}
 	}
 }
@@ -220,7 +242,9 @@ func (p *Profile) Remove(value interface{}) {
 // The predefined profiles may assign meaning to other debug values;
 // for example, when printing the "goroutine" profile, debug=2 means to
 // print the goroutine stacks in the same form that a Go program uses
-// when dying due to an unrecovered panic.
+// when dying due to an unrecovered panic, and when printing the
+// "threadcreate" profile, debug=2 means to list each thread with its ID,
+// the vcore it was created from, and its full creation stack.
 func (p *Profile) WriteTo(w io.Writer, debug int) error {
 	if p.name == "" {
 		panic("pprof: use of zero Profile")
@@ -228,7 +252,32 @@ func (p *Profile) WriteTo(w io.Writer, debug int) error {
 	if p.write != nil {
 		return p.write(w, debug)
 	}
+	return printCountProfile(w, debug, p.name, p.snapshot())
+}
 
+// WriteProtoTo writes a snapshot of the profile to w as a gzip-compressed
+// protocol buffer in the profile.proto format, which carries function
+// names and line numbers along with the addresses.  Newer versions of
+// pprof and the tools built around it read this format directly.
+// If a write to w returns an error, WriteProtoTo returns that error.
+//
+// The syscall profile has no proto form; WriteProtoTo returns an error
+// for it.
+func (p *Profile) WriteProtoTo(w io.Writer) error {
+	if p.name == "" {
+		panic("pprof: use of zero Profile")
+	}
+	if p.proto != nil {
+		return p.proto(w)
+	}
+	if p.write != nil {
+		return fmt.Errorf("pprof: %s profile has no proto form", p.name)
+	}
+	return writeCountProto(w, p.name, p.snapshot())
+}
+
+// snapshot returns the stacks in the user-defined profile p.
+func (p *Profile) snapshot() stackProfile {
 	// Obtain consistent snapshot under lock; then process without lock.
 	var all [][]uintptr
 	p.mu.Lock()
@@ -239,8 +288,7 @@ func (p *Profile) WriteTo(w io.Writer, debug int) error {
 
 	// Map order is non-deterministic; make output deterministic.
 	sort.Sort(stackProfile(all))
-
-	return printCountProfile(w, debug, p.name, stackProfile(all))
+	return stackProfile(all)
 }
 
 type stackProfile [][]uintptr
@@ -486,9 +534,60 @@ func countThreadCreate() int {
 
 // writeThreadCreate writes the current runtime ThreadCreateProfile to w.
 func writeThreadCreate(w io.Writer, debug int) error {
+	if debug >= 2 {
+		return writeThreads(w)
+	}
 	return writeRuntimeProfile(w, debug, "threadcreate", runtime.ThreadCreateProfile)
 }
 
+// fetchThreadCreateRecords returns the current runtime
+// ThreadCreateRecords.
+func fetchThreadCreateRecords() []runtime.ThreadCreateRecord {
+	var p []runtime.ThreadCreateRecord
+	n, ok := runtime.ThreadCreateRecords(nil)
+	for {
+		p = make([]runtime.ThreadCreateRecord, n+10)
+		n, ok = runtime.ThreadCreateRecords(p)
+		if ok {
+			return p[0:n]
+		}
+	}
+}
+
+// writeThreads writes each thread the runtime has created, with its M ID,
+// the vcore it was created from, and the stack that created it.
+func writeThreads(w io.Writer) error {
+	p := fetchThreadCreateRecords()
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "threadcreate profile: total %d\n", len(p))
+	for i := range p {
+		r := &p[i]
+		fmt.Fprintf(b, "m=%d vcore=%d @", r.ID, r.Vcore)
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(b, " %#x", pc)
+		}
+		fmt.Fprintf(b, "\n")
+		printStackRecord(b, r.Stack(), true)
+	}
+	return b.Flush()
+}
+
+// writeThreadCreateProto writes the current runtime ThreadCreateProfile
+// to w in proto form, one sample per thread labeled with its M ID and
+// the vcore it was created from.
+func writeThreadCreateProto(w io.Writer) error {
+	b := newProfileBuilder("threadcreate", "count")
+	b.period("threadcreate", "count", 1)
+	for _, r := range fetchThreadCreateRecords() {
+		labels := labelMap{
+			"m":     fmt.Sprint(r.ID),
+			"vcore": fmt.Sprint(r.Vcore),
+		}
+		b.sample(r.Stack(), labels, 0, 1)
+	}
+	return b.write(w)
+}
+
 // countGoroutine returns the number of goroutines.
 func countGoroutine() int {
 	return runtime.NumGoroutine()
@@ -502,6 +601,13 @@ func writeGoroutine(w io.Writer, debug int) error {
 	return writeRuntimeProfile(w, debug, "goroutine", runtime.GoroutineProfile)
 }
 
+// writeGoroutineProto writes the current runtime GoroutineProfile to w in
+// proto form.
+func writeGoroutineProto(w io.Writer) error {
+	p := fetchRuntimeProfile(runtime.GoroutineProfile)
+	return writeCountProto(w, "goroutine", runtimeProfile(p))
+}
+
 func writeGoroutineStacks(w io.Writer) error {
 	// We don't know how big the buffer needs to be to collect
 	// all the goroutines.  Start with 1 MB and try a few times, doubling each time.
@@ -524,6 +630,12 @@ func writeGoroutineStacks(w io.Writer) error {
 }
 
 func writeRuntimeProfile(w io.Writer, debug int, name string, fetch func([]runtime.StackRecord) (int, bool)) error {
+	p := fetchRuntimeProfile(fetch)
+	return printCountProfile(w, debug, name, runtimeProfile(p))
+}
+
+// fetchRuntimeProfile returns all the records fetch has.
+func fetchRuntimeProfile(fetch func([]runtime.StackRecord) (int, bool)) []runtime.StackRecord {
 	// Find out how many records there are (fetch(nil)),
 	// allocate that many records, and get the data.
 	// There's a race—more records might be added between
@@ -544,8 +656,7 @@ func writeRuntimeProfile(w io.Writer, debug int, name string, fetch func([]runti
 		}
 		// Profile grew; try again.
 	}
-
-	return printCountProfile(w, debug, name, runtimeProfile(p))
+	return p
 }
 
 type runtimeProfile []runtime.StackRecord
@@ -556,13 +667,26 @@ func (p runtimeProfile) Stack(i int) []uintptr { return p[i].Stack() }
 var cpu struct {
 	sync.Mutex
 	profiling bool
-	done      chan bool
+	done      chan error
 }
 
 // StartCPUProfile enables CPU profiling for the current process.
 // While profiling, the profile will be buffered and written to w.
 // StartCPUProfile returns an error if profiling is already enabled.
 func StartCPUProfile(w io.Writer) error {
+	return startCPUProfile(w, false)
+}
+
+// StartCPUProfileProto is like StartCPUProfile but writes the profile in
+// the profile.proto format, as Profile.WriteProtoTo does, with each
+// sample carrying the profiler labels of the goroutine it caught (see
+// Do).  The profile is held in memory and written to w only when
+// StopCPUProfile is called.
+func StartCPUProfileProto(w io.Writer) error {
+	return startCPUProfile(w, true)
+}
+
+func startCPUProfile(w io.Writer, proto bool) error {
 	// The runtime routines allow a variable profiling rate,
 	// but in practice operating systems cannot trigger signals
 	// at more than about 500 Hz, and our processing of the
@@ -577,32 +701,44 @@ func StartCPUProfile(w io.Writer) error {
 	cpu.Lock()
 	defer cpu.Unlock()
 	if cpu.done == nil {
-		cpu.done = make(chan bool)
+		cpu.done = make(chan error)
 	}
 	// Double-check.
 	if cpu.profiling {
 		return fmt.Errorf("cpu profiling already in use")
 	}
 	cpu.profiling = true
+	runtime_setCPUProfileLabels(proto)
 	runtime.SetCPUProfileRate(hz)
-	go profileWriter(w)
+	go profileWriter(w, proto)
 	return nil
 }
 
-func profileWriter(w io.Writer) {
+func profileWriter(w io.Writer, proto bool) {
+	var all []byte
+	var err error
 	for {
 		data := runtime.CPUProfile()
 		if data == nil {
 			break
 		}
-		w.Write(data)
+		if proto {
+			all = append(all, data...)
+		} else if _, werr := w.Write(data); werr != nil && err == nil {
+			err = werr
+		}
 	}
-	cpu.done <- true
+	if proto {
+		err = writeCPUProto(w, all, true)
+		runtime_setCPUProfileLabels(false)
+	}
+	cpu.done <- err
 }
 
 // StopCPUProfile stops the current CPU profile, if any.
 // StopCPUProfile only returns after all the writes for the
-// profile have completed.
+// profile have completed.  If writing the profile failed, it
+// says why on standard error.
 func StopCPUProfile() {
 	cpu.Lock()
 	defer cpu.Unlock()
@@ -612,7 +748,9 @@ func StopCPUProfile() {
 	}
 	cpu.profiling = false
 	runtime.SetCPUProfileRate(0)
-	<-cpu.done
+	if err := <-cpu.done; err != nil {
+		print("runtime/pprof: writing CPU profile: ", err.Error(), "\n")
+	}
 }
 
 type byCycles []runtime.BlockProfileRecord
@@ -629,11 +767,38 @@ func countBlock() int {
 
 // writeBlock writes the current blocking profile to w.
 func writeBlock(w io.Writer, debug int) error {
+	return writeCycleProfile(w, debug, "contention", runtime.BlockProfile)
+}
+
+// writeBlockProto writes the current blocking profile to w in proto form.
+func writeBlockProto(w io.Writer) error {
+	return writeCycleProto(w, 1, runtime.BlockProfileFunc)
+}
+
+// countMutex returns the number of records in the mutex profile.
+func countMutex() int {
+	n, _ := runtime.MutexProfile(nil)
+	return n
+}
+
+// writeMutex writes the current mutex profile to w.
+func writeMutex(w io.Writer, debug int) error {
+	return writeCycleProfile(w, debug, "mutex", runtime.MutexProfile)
+}
+
+// writeMutexProto writes the current mutex profile to w in proto form.
+func writeMutexProto(w io.Writer) error {
+	return writeCycleProto(w, int64(runtime.SetMutexProfileFraction(-1)), runtime.MutexProfileFunc)
+}
+
+// writeCycleProfile writes the profile that fetch returns, one whose
+// records are delays measured in cycles, under the heading name.
+func writeCycleProfile(w io.Writer, debug int, name string, fetch func([]runtime.BlockProfileRecord) (int, bool)) error {
 	var p []runtime.BlockProfileRecord
-	n, ok := runtime.BlockProfile(nil)
+	n, ok := fetch(nil)
 	for {
 		p = make([]runtime.BlockProfileRecord, n+50)
-		n, ok = runtime.BlockProfile(p)
+		n, ok = fetch(p)
 		if ok {
 			p = p[:n]
 			break
@@ -650,8 +815,11 @@ func writeBlock(w io.Writer, debug int) error {
 		w = tw
 	}
 
-	fmt.Fprintf(w, "--- contention:\n")
+	fmt.Fprintf(w, "--- %s:\n", name)
 	fmt.Fprintf(w, "cycles/second=%v\n", runtime_cyclesPerSecond())
+	if name == "mutex" {
+		fmt.Fprintf(w, "sampling period=%d\n", runtime.SetMutexProfileFraction(-1))
+	}
 	for i := range p {
 		r := &p[i]
 		fmt.Fprintf(w, "%v %v @", r.Cycles, r.Count)
@@ -670,4 +838,65 @@ func writeBlock(w io.Writer, debug int) error {
 	return b.Flush()
 }
 
+// countSyscall returns the number of system calls in flight.
+func countSyscall() int {
+	n, _ := runtime.PendingSyscalls(nil)
+	return n
+}
+
+// writeSyscall writes the system calls in flight to w, longest-running
+// first.  There are no stacks; match the goroutine IDs against the
+// goroutine profile at debug=2.
+func writeSyscall(w io.Writer, debug int) error {
+	var p []runtime.PendingSyscall
+	n, ok := runtime.PendingSyscalls(nil)
+	for {
+		p = make([]runtime.PendingSyscall, n+10)
+		n, ok = runtime.PendingSyscalls(p)
+		if ok {
+			p = p[:n]
+			break
+		}
+	}
+
+	sort.Sort(byElapsed(p))
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "syscall profile: total %d\n", len(p))
+	for i := range p {
+		r := &p[i]
+		name := r.Name()
+		if name == "" {
+			name = fmt.Sprintf("syscall %d", r.Num)
+		}
+		fmt.Fprintf(b, "goroutine %d: %s(%#x, %#x, %#x, %#x, %#x, %#x)",
+			r.Goid, name, r.Args[0], r.Args[1], r.Args[2], r.Args[3], r.Args[4], r.Args[5])
+		if r.Elapsed >= 0 {
+			fmt.Fprintf(b, " for %dus", r.Elapsed/1000)
+		}
+		fmt.Fprint(b, "\n")
+	}
+	return b.Flush()
+}
+
+type byElapsed []runtime.PendingSyscall
+
+func (x byElapsed) Len() int           { return len(x) }
+func (x byElapsed) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x byElapsed) Less(i, j int) bool { return x[i].Elapsed > x[j].Elapsed }
+
 func runtime_cyclesPerSecond() int64
+
+// CyclesPerSecond returns the rate of the clock in which block profile
+// delays (runtime.BlockProfileRecord.Cycles) are measured.  It is the
+// same clock the runtime's monotonic time is derived from.
+func CyclesPerSecond() int64 {
+	return runtime_cyclesPerSecond()
+}
+
+// CyclesToNanoseconds converts a delay measured in block profile cycles to
+// nanoseconds.
+func CyclesToNanoseconds(cycles int64) int64 {
+	cps := runtime_cyclesPerSecond()
+	return cycles/cps*1e9 + cycles%cps*1e9/cps
+}
@@ -8,7 +8,9 @@ package pprof_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"os/exec"
 	"regexp"
@@ -450,3 +452,134 @@ func blockCond() {
 	c.Wait()
 	mu.Unlock()
 }
+
+func TestMutexProfile(t *testing.T) {
+	old := runtime.SetMutexProfileFraction(1)
+	defer runtime.SetMutexProfileFraction(old)
+	if old != 0 {
+		t.Fatalf("need MutexProfileRate 0, got %d", old)
+	}
+
+	blockMutex()
+
+	var w bytes.Buffer
+	Lookup("mutex").WriteTo(&w, 1)
+	prof := w.String()
+
+	if !strings.HasPrefix(prof, "--- mutex:\ncycles/second=") {
+		t.Errorf("Bad profile header:\n%v", prof)
+	}
+	if !strings.Contains(prof, "\nsampling period=1\n") {
+		t.Errorf("Bad sampling period:\n%v", prof)
+	}
+	r := `\d+ \d+ @ 0x[0-9a-f]+( 0x[0-9a-f]+)*
+#	0x[0-9a-f]+	sync\.\(\*Mutex\)\.Unlock\+0x[0-9a-f]+	.*/src/sync/mutex\.go:[0-9]+
+`
+	if !regexp.MustCompile(r).MatchString(prof) {
+		t.Errorf("Bad mutex profile, want\n%v\ngot\n%v", r, prof)
+	}
+}
+
+func TestHeapProfileProto(t *testing.T) {
+	oldRate := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() {
+		runtime.MemProfileRate = oldRate
+	}()
+	allocatePersistent1K()
+	runtime.GC()
+
+	var buf bytes.Buffer
+	if err := Lookup("heap").WriteProtoTo(&buf); err != nil {
+		t.Fatalf("failed to write heap profile: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("heap profile is not gzip-compressed: %v", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading heap profile: %v", err)
+	}
+	for _, s := range []string{"inuse_space", "alloc_objects", "runtime/pprof_test.allocatePersistent1K", "mprof_test.go"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("heap profile lacks %q", s)
+		}
+	}
+}
+
+func TestDoLabels(t *testing.T) {
+	Do(Labels("tenant", "a", "request", "1"), func() {
+		Do(Labels("request", "2"), func() {
+			if v, _ := Label("tenant"); v != "a" {
+				t.Errorf("Label(tenant) = %q, want a", v)
+			}
+			if v, _ := Label("request"); v != "2" {
+				t.Errorf("Label(request) = %q, want 2", v)
+			}
+			c := make(chan string)
+			go func() {
+				v, _ := Label("request")
+				c <- v
+			}()
+			if v := <-c; v != "2" {
+				t.Errorf("new goroutine has request label %q, want 2", v)
+			}
+		})
+		var keys []string
+		ForLabels(func(k, v string) bool {
+			keys = append(keys, k+"="+v)
+			return true
+		})
+		if got := strings.Join(keys, ","); got != "request=1,tenant=a" {
+			t.Errorf("labels after inner Do are %s, want request=1,tenant=a", got)
+		}
+	})
+	if _, ok := Label("tenant"); ok {
+		t.Errorf("label tenant still set after Do")
+	}
+}
+
+func TestCPUProfileLabels(t *testing.T) {
+	if runtime.GOOS == "plan9" {
+		t.Skip("no CPU profiling on plan9")
+	}
+	var prof bytes.Buffer
+	if err := StartCPUProfileProto(&prof); err != nil {
+		t.Fatal(err)
+	}
+	Do(Labels("tenant", "cpuhog"), func() {
+		cpuHogger(cpuHog1)
+	})
+	StopCPUProfile()
+
+	zr, err := gzip.NewReader(&prof)
+	if err != nil {
+		t.Fatalf("CPU profile is not gzip-compressed: %v", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading CPU profile: %v", err)
+	}
+	for _, s := range []string{"runtime/pprof_test.cpuHog1", "tenant", "cpuhog"} {
+		if !bytes.Contains(data, []byte(s)) {
+			if badOS[runtime.GOOS] {
+				t.Skipf("ignoring failure on %s; see golang.org/issue/6047", runtime.GOOS)
+			}
+			t.Errorf("CPU profile lacks %q", s)
+		}
+	}
+}
+
+func TestThreadCreateThreads(t *testing.T) {
+	var w bytes.Buffer
+	Lookup("threadcreate").WriteTo(&w, 2)
+	n, _ := runtime.ThreadCreateRecords(nil)
+	prof := w.String()
+	if !strings.HasPrefix(prof, fmt.Sprintf("threadcreate profile: total %d\n", n)) {
+		t.Fatalf("threadcreate profile does not begin with its total:\n%s", prof)
+	}
+	if !regexp.MustCompile(`(?m)^m=[0-9]+ vcore=-?[0-9]+ @( 0x[0-9a-f]+)*$`).MatchString(prof) {
+		t.Errorf("threadcreate profile lists no threads:\n%s", prof)
+	}
+}
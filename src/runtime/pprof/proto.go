@@ -0,0 +1,384 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pprof
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"unsafe"
+)
+
+// Profiles in the profile.proto format read by go tool pprof and the
+// tools built around it.  A profile is one gzip-compressed Profile
+// message; its samples refer to locations, which carry their own
+// function and line information, so the profile can be read without
+// the binary that wrote it.
+
+// Field numbers in profile.proto.
+const (
+	// Profile
+	tagProfileSampleType  = 1
+	tagProfileSample      = 2
+	tagProfileLocation    = 4
+	tagProfileFunction    = 5
+	tagProfileStringTable = 6
+	tagProfilePeriodType  = 11
+	tagProfilePeriod      = 12
+
+	// ValueType
+	tagValueTypeType = 1
+	tagValueTypeUnit = 2
+
+	// Sample
+	tagSampleLocation = 1
+	tagSampleValue    = 2
+	tagSampleLabel    = 3
+
+	// Label
+	tagLabelKey = 1
+	tagLabelStr = 2
+	tagLabelNum = 3
+
+	// Location
+	tagLocationID      = 1
+	tagLocationAddress = 3
+	tagLocationLine    = 4
+
+	// Line
+	tagLineFunction = 1
+	tagLineLine     = 2
+
+	// Function
+	tagFunctionID         = 1
+	tagFunctionName       = 2
+	tagFunctionSystemName = 3
+	tagFunctionFilename   = 4
+)
+
+// A protobuf accumulates a message in the protocol buffer wire format.
+// Only the field types profile.proto uses are provided.
+type protobuf struct {
+	data []byte
+}
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protobuf) key(tag, wiretype int) {
+	b.varint(uint64(tag)<<3 | uint64(wiretype))
+}
+
+// uint64 adds a varint field, omitted if x is zero, the default.
+func (b *protobuf) uint64(tag int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(tag, 0)
+	b.varint(x)
+}
+
+func (b *protobuf) int64(tag int, x int64) {
+	b.uint64(tag, uint64(x))
+}
+
+// uint64s adds a repeated varint field in packed form.
+func (b *protobuf) uint64s(tag int, x []uint64) {
+	var p protobuf
+	for _, u := range x {
+		p.varint(u)
+	}
+	b.bytes(tag, p.data)
+}
+
+func (b *protobuf) int64s(tag int, x []int64) {
+	var p protobuf
+	for _, u := range x {
+		p.varint(uint64(u))
+	}
+	b.bytes(tag, p.data)
+}
+
+func (b *protobuf) bytes(tag int, x []byte) {
+	b.key(tag, 2)
+	b.varint(uint64(len(x)))
+	b.data = append(b.data, x...)
+}
+
+// string adds a string field even if s is empty, as the string table
+// must begin with one.
+func (b *protobuf) string(tag int, s string) {
+	b.key(tag, 2)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protobuf) message(tag int, m *protobuf) {
+	b.bytes(tag, m.data)
+}
+
+// A profileBuilder collects the samples of one profile and writes it out
+// in the profile.proto format.
+type profileBuilder struct {
+	pb      protobuf
+	strings map[string]int64
+	strtab  []string
+	locs    map[uintptr]uint64
+	funcs   map[string]uint64
+}
+
+// newProfileBuilder starts a profile whose samples carry one value of
+// each type given as a pair of strings, the type and its unit.
+func newProfileBuilder(types ...string) *profileBuilder {
+	b := &profileBuilder{
+		strings: map[string]int64{},
+		locs:    map[uintptr]uint64{},
+		funcs:   map[string]uint64{},
+	}
+	b.str("")
+	for i := 0; i+1 < len(types); i += 2 {
+		b.valueType(tagProfileSampleType, types[i], types[i+1])
+	}
+	return b
+}
+
+// str returns the index of s in the string table, adding it if need be.
+func (b *profileBuilder) str(s string) int64 {
+	if i, ok := b.strings[s]; ok {
+		return i
+	}
+	i := int64(len(b.strtab))
+	b.strings[s] = i
+	b.strtab = append(b.strtab, s)
+	return i
+}
+
+func (b *profileBuilder) valueType(tag int, typ, unit string) {
+	var m protobuf
+	m.int64(tagValueTypeType, b.str(typ))
+	m.int64(tagValueTypeUnit, b.str(unit))
+	b.pb.message(tag, &m)
+}
+
+// period records that the profile samples one event per period units of
+// typ.
+func (b *profileBuilder) period(typ, unit string, period int64) {
+	b.valueType(tagProfilePeriodType, typ, unit)
+	b.pb.int64(tagProfilePeriod, period)
+}
+
+// sample adds a sample of the values given for stk, in the order of the
+// types passed to newProfileBuilder, with the profiler labels in labels.
+// If bytes is not zero, the sample is also labeled with it as the size of
+// each object counted.
+func (b *profileBuilder) sample(stk []uintptr, labels labelMap, bytes int64, values ...int64) {
+	ids := make([]uint64, len(stk))
+	for i, pc := range stk {
+		ids[i] = b.location(pc, i > 0)
+	}
+	var m protobuf
+	m.uint64s(tagSampleLocation, ids)
+	m.int64s(tagSampleValue, values)
+	for _, k := range labels.keys() {
+		var l protobuf
+		l.int64(tagLabelKey, b.str(k))
+		l.int64(tagLabelStr, b.str(labels[k]))
+		m.message(tagSampleLabel, &l)
+	}
+	if bytes != 0 {
+		var l protobuf
+		l.int64(tagLabelKey, b.str("bytes"))
+		l.int64(tagLabelNum, bytes)
+		m.message(tagSampleLabel, &l)
+	}
+	b.pb.message(tagProfileSample, &m)
+}
+
+// location returns the ID of the location for pc, adding it if need be.
+// A return address is looked up at the call instruction before it, as
+// printStackRecord does.
+func (b *profileBuilder) location(pc uintptr, ret bool) uint64 {
+	if id, ok := b.locs[pc]; ok {
+		return id
+	}
+	id := uint64(len(b.locs) + 1)
+	b.locs[pc] = id
+	var m protobuf
+	m.uint64(tagLocationID, id)
+	m.uint64(tagLocationAddress, uint64(pc))
+	if f := runtime.FuncForPC(pc); f != nil {
+		tracepc := pc
+		if ret && pc > f.Entry() {
+			if runtime.GOARCH == "386" || runtime.GOARCH == "amd64" {
+				tracepc--
+			} else {
+				tracepc -= 4 // arm, etc
+			}
+		}
+		file, line := f.FileLine(tracepc)
+		var l protobuf
+		l.uint64(tagLineFunction, b.function(f.Name(), file))
+		l.int64(tagLineLine, int64(line))
+		m.message(tagLocationLine, &l)
+	}
+	b.pb.message(tagProfileLocation, &m)
+	return id
+}
+
+// function returns the ID of the named function, adding it if need be.
+func (b *profileBuilder) function(name, file string) uint64 {
+	if id, ok := b.funcs[name]; ok {
+		return id
+	}
+	id := uint64(len(b.funcs) + 1)
+	b.funcs[name] = id
+	var m protobuf
+	m.uint64(tagFunctionID, id)
+	m.int64(tagFunctionName, b.str(name))
+	m.int64(tagFunctionSystemName, b.str(name))
+	m.int64(tagFunctionFilename, b.str(file))
+	b.pb.message(tagProfileFunction, &m)
+	return id
+}
+
+// write writes the profile to w, compressed.
+func (b *profileBuilder) write(w io.Writer) error {
+	for _, s := range b.strtab {
+		b.pb.string(tagProfileStringTable, s)
+	}
+	return writeGzip(w, b.pb.data)
+}
+
+// writeHeapProto writes the current heap profile to w in proto form.
+// The runtime samples one allocation per MemProfileRate bytes, so the
+// counts are scaled up to estimate all allocations, as pprof does for
+// the text form.
+func writeHeapProto(w io.Writer) error {
+	b := newProfileBuilder(
+		"alloc_objects", "count",
+		"alloc_space", "bytes",
+		"inuse_objects", "count",
+		"inuse_space", "bytes")
+	rate := int64(runtime.MemProfileRate)
+	b.period("space", "bytes", rate)
+	runtime.MemProfileFunc(true, func(r *runtime.MemProfileRecord) bool {
+		var size int64
+		if r.AllocObjects > 0 {
+			size = r.AllocBytes / r.AllocObjects
+		}
+		allocObjects, allocBytes := scaleHeapSample(r.AllocObjects, r.AllocBytes, rate)
+		inuseObjects, inuseBytes := scaleHeapSample(r.InUseObjects(), r.InUseBytes(), rate)
+		b.sample(r.Stack(), nil, size, allocObjects, allocBytes, inuseObjects, inuseBytes)
+		return true
+	})
+	return b.write(w)
+}
+
+// scaleHeapSample estimates the number and size of all the objects
+// allocated, given the count and bytes of those sampled at rate.  An
+// object of size bytes is sampled with probability 1-exp(-size/rate).
+func scaleHeapSample(count, size, rate int64) (int64, int64) {
+	if count == 0 || size == 0 {
+		return 0, 0
+	}
+	if rate <= 1 {
+		return count, size
+	}
+	avg := float64(size) / float64(count)
+	scale := 1 / (1 - math.Exp(-avg/float64(rate)))
+	return int64(float64(count) * scale), int64(float64(size) * scale)
+}
+
+// writeCycleProto writes the block or mutex profile that each calls
+// for, in proto form.
+func writeCycleProto(w io.Writer, period int64, each func(func(*runtime.BlockProfileRecord) bool)) error {
+	b := newProfileBuilder(
+		"contentions", "count",
+		"delay", "nanoseconds")
+	b.period("contentions", "count", period)
+	each(func(r *runtime.BlockProfileRecord) bool {
+		b.sample(r.Stack(), nil, 0, r.Count, CyclesToNanoseconds(r.Cycles))
+		return true
+	})
+	return b.write(w)
+}
+
+// writeCountProto writes p in proto form, one sample per distinct
+// stack counting the stacks in p like it.
+func writeCountProto(w io.Writer, name string, p countProfile) error {
+	b := newProfileBuilder(name, "count")
+	b.period(name, "count", 1)
+	m := map[string]int64{}
+	var stks [][]uintptr
+	for i := 0; i < p.Len(); i++ {
+		stk := p.Stack(i)
+		k := fmt.Sprint(stk)
+		if m[k] == 0 {
+			stks = append(stks, stk)
+		}
+		m[k]++
+	}
+	for _, stk := range stks {
+		b.sample(stk, nil, 0, m[fmt.Sprint(stk)])
+	}
+	return b.write(w)
+}
+
+// writeCPUProto converts data, a complete CPU profile in the format
+// runtime.CPUProfile returns, to proto form and writes it to w.  If
+// tagged, each record's stack begins with the address of the labelMap of
+// the goroutine sampled, or 0; the runtime keeps those maps alive until
+// runtime_setCPUProfileLabels(false).
+func writeCPUProto(w io.Writer, data []byte, tagged bool) error {
+	b := newProfileBuilder(
+		"samples", "count",
+		"cpu", "nanoseconds")
+	words := len(data) / int(unsafe.Sizeof(uintptr(0)))
+	if words == 0 {
+		return b.write(w)
+	}
+	val := (*[1 << 30]uintptr)(unsafe.Pointer(&data[0]))[:words:words]
+
+	// A header of 5 words: 0, 3, 0, the sampling period in
+	// microseconds, and 0.
+	if len(val) < 5 || val[0] != 0 || val[1] != 3 {
+		return errBadCPUProfile
+	}
+	period := int64(val[3]) * 1000
+	b.period("cpu", "nanoseconds", period)
+	val = val[5:]
+
+	// Then records of a count, a stack depth n and n PCs, ending with
+	// the record 0, 1, 0.
+	for len(val) >= 2 {
+		count, n := val[0], val[1]
+		if uintptr(len(val)) < 2+n {
+			return errBadCPUProfile
+		}
+		stk := val[2 : 2+n]
+		val = val[2+n:]
+		if count == 0 && n == 1 && stk[0] == 0 {
+			break
+		}
+		var labels labelMap
+		if tagged && len(stk) > 0 {
+			if stk[0] != 0 {
+				labels = *(*labelMap)(unsafe.Pointer(stk[0]))
+			}
+			stk = stk[1:]
+		}
+		b.sample(stk, labels, 0, int64(count), int64(count)*period)
+	}
+	return b.write(w)
+}
+
+var errBadCPUProfile = errors.New("pprof: malformed CPU profile")
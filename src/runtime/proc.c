@@ -78,6 +78,7 @@ static void exitsyscall0(G*);
 void runtime·park_m(G*);
 static void goexit0(G*);
 static void gfput(P*, G*);
+static void gocount(void);
 static G* gfget(P*);
 static void gfpurge(P*);
 static void globrunqput(G*);
@@ -88,13 +89,24 @@ static void pidleput(P*);
 static void injectglist(G*);
 static bool preemptall(void);
 static bool preemptone(P*);
+static uint32 runqgrab(P*, G**);
+#ifdef GOOS_akaros
+static void vcorerecover(int64);
+#endif
 static bool exitsyscallfast(void);
+static void goschedimpl(G*);
 static bool haveexperiment(int8*);
 void runtime·allgadd(G*);
 static void dropg(void);
 
 extern String runtime·buildVersion;
 
+// Goroutine counters for ReadGoroutineStats (gochurn.go), maintained by
+// newproc1 and goexit0.
+extern uint64 runtime·gocreated;
+extern uint64 runtime·gofinished;
+extern uint64 runtime·gopeak;
+
 // For cgo-using programs with external linking,
 // export "main" (defined in assembly) so that libc can handle basic
 // C runtime startup and call the Go program as if it were
@@ -136,8 +148,14 @@ runtime·schedinit(void)
 	runtime·stackinit();
 	runtime·mallocinit();
 	mcommoninit(g->m);
+#ifdef GOOS_akaros
+	runtime·startstamps[StartMalloc] = runtime·nanotime();
+#endif
 	
 	runtime·goargs();
+#ifdef GOOS_akaros
+	runtime·startstamps[StartArgs] = runtime·nanotime();
+#endif
 	runtime·goenvs();
 	runtime·parsedebugvars();
 	runtime·gcinit();
@@ -161,6 +179,9 @@ runtime·schedinit(void)
 
 	runtime·cgoMalloc = _cgo_malloc;
 	runtime·cgoFree = _cgo_free;
+#ifdef GOOS_akaros
+	runtime·startstamps[StartSched] = runtime·nanotime();
+#endif
 }
 
 void
@@ -190,8 +211,13 @@ static void
 mcommoninit(M *mp)
 {
 	// g0 stack won't make sense for user (and is not necessary unwindable).
-	if(g != g->m->g0)
+	mp->createvcore = -1;
+	if(g != g->m->g0) {
 		runtime·callers(1, mp->createstack, nelem(mp->createstack));
+#ifdef GOOS_akaros
+		mp->createvcore = runtime·vcoreid();
+#endif
+	}
 
 	mp->fastrand = 0x49f6428aUL + mp->id + runtime·cputicks();
 
@@ -225,6 +251,8 @@ runtime·ready(G *gp)
 		runtime·throw("bad g->status in ready");
 	}
 	// status is Gwaiting or Gscanwaiting, make Grunnable and put on runq
+	if(runtime·traceEnabled)
+		runtime·traceGoUnblock(gp);
 	runtime·casgstatus(gp, Gwaiting, Grunnable);
 	runqput(g->m->p, gp);
 	if(runtime·atomicload(&runtime·sched.npidle) != 0 && runtime·atomicload(&runtime·sched.nmspinning) == 0)  // TODO: fast atomic
@@ -703,8 +731,14 @@ runtime·stoptheworld(void)
 	for(i = 0; i < runtime·gomaxprocs; i++) {
 		p = runtime·allp[i];
 		s = p->status;
-		if(s == Psyscall && runtime·cas(&p->status, s, Pgcstop))
+		if(s == Psyscall && runtime·cas(&p->status, s, Pgcstop)) {
+			if(runtime·traceEnabled) {
+				runtime·traceGoSysBlock(p);
+				runtime·traceProcStop(p);
+			}
+			p->syscalltick++;
 			runtime·sched.stopwait--;
+		}
 	}
 	// stop idle P's
 	while(p = pidleget()) {
@@ -1213,6 +1247,9 @@ startm(P *p, bool spinning)
 	}
 	mp = mget();
 	runtime·unlock(&runtime·sched.lock);
+#ifdef GOOS_akaros
+	runtime·vcoreadjust(false);
+#endif
 	if(mp == nil) {
 		fn = nil;
 		if(spinning)
@@ -1363,8 +1400,20 @@ execute(G *gp)
 	gp->preempt = false;
 	gp->stackguard0 = gp->stack.lo + StackGuard;
 	g->m->p->schedtick++;
+#ifdef GOOS_akaros
+	runtime·schedticks++;
+#endif
 	g->m->curg = gp;
 	gp->m = g->m;
+#ifdef GOOS_akaros
+	runtime·asyncprofstack(gp);
+#endif
+	if(runtime·traceEnabled) {
+		// GoSysExit has to happen when we have a P, but before GoStart.
+		if(gp->syscallsp != 0 && gp->sysblocktraced)
+			runtime·traceGoSysExit(gp);
+		runtime·traceGoStart();
+	}
 
 	// Check whether the profiler needs to be turned on or off.
 	hz = runtime·sched.profilehz;
@@ -1406,6 +1455,8 @@ top:
 	gp = runtime·netpoll(false);  // non-blocking
 	if(gp) {
 		injectglist(gp->schedlink);
+		if(runtime·traceEnabled)
+			runtime·traceGoUnblock(gp);
 		runtime·casgstatus(gp, Gwaiting, Grunnable);
 		return gp;
 	}
@@ -1478,6 +1529,8 @@ stop:
 			if(p) {
 				acquirep(p);
 				injectglist(gp->schedlink);
+				if(runtime·traceEnabled)
+					runtime·traceGoUnblock(gp);
 				runtime·casgstatus(gp, Gwaiting, Grunnable);
 				return gp;
 			}
@@ -1517,6 +1570,10 @@ injectglist(G *glist)
 
 	if(glist == nil)
 		return;
+	if(runtime·traceEnabled) {
+		for(gp = glist; gp; gp = gp->schedlink)
+			runtime·traceGoUnblock(gp);
+	}
 	runtime·lock(&runtime·sched.lock);
 	for(n = 0; glist; n++) {
 		gp = glist;
@@ -1551,15 +1608,30 @@ top:
 		gcstopm();
 		goto top;
 	}
+#ifdef GOOS_akaros
+	if(g->m->yieldvcore) {
+		// sysmon wants our vcore for an M that lost its own.
+		g->m->yieldvcore = false;
+		runtime·osyield();
+	}
+#endif
 
 	gp = nil;
+	if(runtime·traceEnabled || runtime·traceShutdown) {
+		gp = runtime·traceReader();
+		if(gp) {
+			runtime·casgstatus(gp, Gwaiting, Grunnable);
+			runtime·traceGoUnblock(gp);
+			resetspinning();
+		}
+	}
 	// Check the global runnable queue once in a while to ensure fairness.
 	// Otherwise two goroutines can completely occupy the local runqueue
 	// by constantly respawning each other.
 	tick = g->m->p->schedtick;
 	// This is a fancy way to say tick%61==0,
 	// it uses 2 MUL instructions instead of a single DIV and so is faster on modern processors.
-	if(tick - (((uint64)tick*0x4325c53fu)>>36)*61 == 0 && runtime·sched.runqsize > 0) {
+	if(gp == nil && tick - (((uint64)tick*0x4325c53fu)>>36)*61 == 0 && runtime·sched.runqsize > 0) {
 		runtime·lock(&runtime·sched.lock);
 		gp = globrunqget(g->m->p, 1);
 		runtime·unlock(&runtime·sched.lock);
@@ -1639,6 +1711,8 @@ runtime·park_m(G *gp)
 	bool ok;
 
 	runtime·casgstatus(gp, Grunning, Gwaiting);
+	if(runtime·traceEnabled)
+		runtime·traceGoPark(gp);
 	dropg();
 
 	if(g->m->waitunlockf) {
@@ -1646,6 +1720,8 @@ runtime·park_m(G *gp)
 		g->m->waitunlockf = nil;
 		g->m->waitlock = nil;
 		if(!ok) {
+			if(runtime·traceEnabled)
+				runtime·traceGoUnblock(gp);
 			runtime·casgstatus(gp, Gwaiting, Grunnable); 
 			execute(gp);  // Schedule it back, never returns.
 		}
@@ -1657,6 +1733,24 @@ runtime·park_m(G *gp)
 // Gosched continuation on g0.
 void
 runtime·gosched_m(G *gp)
+{
+	if(runtime·traceEnabled)
+		runtime·traceGoSched();
+	goschedimpl(gp);
+}
+
+// runtime·gosched_m for a goroutine that was preempted rather than one
+// that yielded; only the execution tracer tells the two apart.
+void
+runtime·gopreempt_m(G *gp)
+{
+	if(runtime·traceEnabled)
+		runtime·traceGoPreempt();
+	goschedimpl(gp);
+}
+
+static void
+goschedimpl(G *gp)
 {
 	uint32 status;
 
@@ -1692,7 +1786,10 @@ runtime·goexit1(void)
 static void
 goexit0(G *gp)
 {
+	if(runtime·traceEnabled)
+		runtime·traceGoEnd();
 	runtime·casgstatus(gp, Grunning, Gdead);
+	runtime·xadd64(&runtime·gofinished, 1);
 	gp->m = nil;
 	gp->lockedm = nil;
 	g->m->lockedg = nil;
@@ -1705,6 +1802,7 @@ goexit0(G *gp)
 	gp->waitreason.str = nil;
 	gp->waitreason.len = 0;
 	gp->param = nil;
+	gp->labels = nil;
 
 	dropg();
 
@@ -1712,6 +1810,9 @@ goexit0(G *gp)
 		runtime·printf("invalid m->locked = %d\n", g->m->locked);
 		runtime·throw("internal lockOSThread error");
 	}	
+#ifdef GOOS_akaros
+	runtime·vcorepin(false);
+#endif
 	g->m->locked = 0;
 	gfput(g->m->p, gp);
 	schedule();
@@ -1782,12 +1883,19 @@ runtime·reentersyscall(uintptr pc, uintptr sp)
 		runtime·onM(&fn);
 	}
 
+	if(runtime·traceEnabled) {
+		fn = runtime·traceGoSysCall;
+		runtime·onM(&fn);
+		save(pc, sp);
+	}
+
 	if(runtime·atomicload(&runtime·sched.sysmonwait)) {  // TODO: fast atomic
 		fn = entersyscall_sysmon;
 		runtime·onM(&fn);
 		save(pc, sp);
 	}
 
+	g->m->syscalltick = g->m->p->syscalltick;
 	g->m->mcache = nil;
 	g->m->p->m = nil;
 	runtime·atomicstore(&g->m->p->status, Psyscall);
@@ -1839,6 +1947,11 @@ entersyscall_gcwait(void)
 {
 	runtime·lock(&runtime·sched.lock);
 	if (runtime·sched.stopwait > 0 && runtime·cas(&g->m->p->status, Psyscall, Pgcstop)) {
+		if(runtime·traceEnabled) {
+			runtime·traceGoSysBlock(g->m->p);
+			runtime·traceProcStop(g->m->p);
+		}
+		g->m->p->syscalltick++;
 		if(--runtime·sched.stopwait == 0)
 			runtime·notewakeup(&runtime·sched.stopnote);
 	}
@@ -1880,6 +1993,10 @@ void
 static void
 entersyscallblock_handoff(void)
 {
+	if(runtime·traceEnabled) {
+		runtime·traceGoSysCall();
+		runtime·traceGoSysBlock(g->m->p);
+	}
 	handoffp(releasep());
 }
 
@@ -1908,6 +2025,7 @@ void
 		// Garbage collector isn't running (since we are),
 		// so okay to clear syscallsp.
 		g->syscallsp = (uintptr)nil;
+		g->sysblocktraced = false;
 		g->m->locks--;
 		if(g->preempt) {
 			// restore the preemption request in case we've cleared it in newstack
@@ -1933,11 +2051,13 @@ void
 	// we don't know for sure that the garbage collector
 	// is not running.
 	g->syscallsp = (uintptr)nil;
+	g->sysblocktraced = false;
 	g->m->p->syscalltick++;
 	g->throwsplit = 0;
 }
 
 static void exitsyscallfast_pidle(void);
+static void exitsyscallfast_tracewait(void);
 
 #pragma textflag NOSPLIT
 static bool
@@ -1959,6 +2079,10 @@ exitsyscallfast(void)
 		return true;
 	}
 	// Try to get any other idle P.
+	if(runtime·traceEnabled && g->m->p) {
+		fn = exitsyscallfast_tracewait;
+		runtime·onM(&fn);
+	}
 	g->m->p = nil;
 	if(runtime·sched.pidle) {
 		fn = exitsyscallfast_pidle;
@@ -1985,11 +2109,26 @@ exitsyscallfast_pidle(void)
 	runtime·unlock(&runtime·sched.lock);
 	if(p) {
 		acquirep(p);
+		if(runtime·traceEnabled) {
+			if(g->m->curg->sysblocktraced)
+				runtime·traceGoSysExit(g->m->curg);
+			runtime·traceGoStart();
+		}
 		g->m->scalararg[0] = 1;
 	} else
 		g->m->scalararg[0] = 0;
 }
 
+// Whoever took our P while we were in the system call bumps its
+// syscalltick once it has traced the P's loss, which our GoSysExit
+// must follow.
+static void
+exitsyscallfast_tracewait(void)
+{
+	while(g->m->p->syscalltick == g->m->syscalltick)
+		runtime·osyield();
+}
+
 // runtime·exitsyscall slow path on g0.
 // Failed to acquire P, enqueue gp as runnable.
 static void
@@ -2226,6 +2365,10 @@ runtime·newproc1(FuncVal *fn, byte *argp, int32 narg, int32 nret, void *callerp
 	newg->sched.g = newg;
 	runtime·gostartcallfn(&newg->sched, fn);
 	newg->gopc = (uintptr)callerpc;
+	newg->startpc = (uintptr)fn->fn;
+	// A goroutine inherits its creator's profiler labels.
+	if(g->m->curg != nil)
+		newg->labels = g->m->curg->labels;
 	runtime·casgstatus(newg, Gdead, Grunnable);
 
 	if(p->goidcache == p->goidcacheend) {
@@ -2237,6 +2380,9 @@ runtime·newproc1(FuncVal *fn, byte *argp, int32 narg, int32 nret, void *callerp
 		p->goidcacheend = p->goidcache + GoidCacheBatch;
 	}
 	newg->goid = p->goidcache++;
+	gocount();
+	if(runtime·traceEnabled)
+		runtime·traceGoCreate(newg, newg->startpc);
 	if(raceenabled)
 		newg->racectx = runtime·racegostart((void*)callerpc);
 	runqput(p, newg);
@@ -2249,6 +2395,21 @@ runtime·newproc1(FuncVal *fn, byte *argp, int32 narg, int32 nret, void *callerp
 	return newg;
 }
 
+// Count a new goroutine for ReadGoroutineStats (gochurn.go), raising
+// the peak if it is now higher.
+static void
+gocount(void)
+{
+	uint64 live, peak;
+
+	live = runtime·xadd64(&runtime·gocreated, 1) - runtime·atomicload64(&runtime·gofinished);
+	for(;;) {
+		peak = runtime·atomicload64(&runtime·gopeak);
+		if(live <= peak || runtime·cas64(&runtime·gopeak, peak, live))
+			break;
+	}
+}
+
 // Put on gfree list.
 // If local list is too long, transfer a batch to the global list.
 static void
@@ -2374,6 +2535,9 @@ runtime·LockOSThread(void)
 {
 	g->m->locked |= LockExternal;
 	lockOSThread();
+#ifdef GOOS_akaros
+	runtime·vcorepin(true);
+#endif
 }
 
 #pragma textflag NOSPLIT
@@ -2404,6 +2568,9 @@ runtime·UnlockOSThread(void)
 {
 	g->m->locked &= ~LockExternal;
 	unlockOSThread();
+#ifdef GOOS_akaros
+	runtime·vcorepin(false);
+#endif
 }
 
 static void badunlockOSThread(void);
@@ -2460,7 +2627,7 @@ static void System(void) { System(); }
 static void ExternalCode(void) { ExternalCode(); }
 static void GC(void) { GC(); }
 
-extern void runtime·cpuproftick(uintptr*, int32);
+extern void runtime·cpuproftick(uintptr*, int32, uintptr);
 extern byte runtime·etext[];
 
 // Called if we receive a SIGPROF signal.
@@ -2601,7 +2768,7 @@ runtime·sigprof(uint8 *pc, uint8 *sp, uint8 *lr, G *gp, M *mp)
 		while(!runtime·cas(&prof.lock, 0, 1))
 			runtime·osyield();
 		if(prof.hz != 0)
-			runtime·cpuproftick(stk, n);
+			runtime·cpuproftick(stk, n, mp->curg != nil ? (uintptr)mp->curg->labels : 0);
 		runtime·atomicstore(&prof.lock, 0);
 	}
 	mp->mallocing--;
@@ -2658,6 +2825,10 @@ procresize(int32 new)
 	old = runtime·gomaxprocs;
 	if(old < 0 || old > MaxGomaxprocs || new <= 0 || new >MaxGomaxprocs)
 		runtime·throw("procresize: invalid arg");
+#ifdef GOOS_akaros
+	if(runtime·singlecore)
+		new = 1;
+#endif
 	// initialize new P's
 	for(i = 0; i < new; i++) {
 		p = runtime·allp[i];
@@ -2720,6 +2891,13 @@ procresize(int32 new)
 		// can't free P itself because it can be referenced by an M in syscall
 	}
 
+	if(runtime·traceEnabled && g->m->p) {
+		// The current goroutine moves to allp[0]; pretend that it
+		// was descheduled and scheduled again there, to keep the
+		// trace consistent.
+		runtime·traceGoSched();
+		runtime·traceProcStop(g->m->p);
+	}
 	if(g->m->p)
 		g->m->p->m = nil;
 	g->m->p = nil;
@@ -2728,12 +2906,19 @@ procresize(int32 new)
 	p->m = nil;
 	p->status = Pidle;
 	acquirep(p);
+	if(runtime·traceEnabled)
+		runtime·traceGoStart();
 	for(i = new-1; i > 0; i--) {
 		p = runtime·allp[i];
 		p->status = Pidle;
 		pidleput(p);
 	}
 	runtime·atomicstore((uint32*)&runtime·gomaxprocs, new);
+	if(runtime·traceEnabled && old != new)
+		runtime·traceGomaxprocs(new);
+#ifdef GOOS_akaros
+	runtime·vcoreadjust(false);
+#endif
 }
 
 // Associate p and the current m.
@@ -2750,6 +2935,8 @@ acquirep(P *p)
 	g->m->p = p;
 	p->m = g->m;
 	p->status = Prunning;
+	if(runtime·traceEnabled)
+		runtime·traceProcStart();
 }
 
 // Disassociate p and the current m.
@@ -2766,6 +2953,8 @@ releasep(void)
 			g->m, g->m->p, p->m, g->m->mcache, p->mcache, p->status);
 		runtime·throw("releasep: invalid p state");
 	}
+	if(runtime·traceEnabled)
+		runtime·traceProcStop(p);
 	g->m->p = nil;
 	g->m->mcache = nil;
 	p->m = nil;
@@ -2835,6 +3024,8 @@ checkdead(void)
 
 	// Maybe jump time forward for playground.
 	if((gp = runtime·timejump()) != nil) {
+		if(runtime·traceEnabled)
+			runtime·traceGoUnblock(gp);
 		runtime·casgstatus(gp, Gwaiting, Grunnable);
 		globrunqput(gp);
  		p = pidleget();
@@ -2890,6 +3081,15 @@ sysmon(void)
 		if(delay > 10*1000)  // up to 10ms
 			delay = 10*1000;
 		runtime·usleep(delay);
+#ifdef GOOS_akaros
+		// give back the vcores of Ps that went idle, and ask
+		// again for any that busy Ps lost
+		runtime·vcoreadjust(true);
+		// tell syscall.WatchVcores about the new grant
+		gp = runtime·vcorechanged();
+		if(gp != nil)
+			injectglist(gp);
+#endif
 		if(runtime·debug.schedtrace <= 0 &&
 			(runtime·sched.gcwaiting || runtime·atomicload(&runtime·sched.npidle) == runtime·gomaxprocs)) {  // TODO: fast atomic
 			runtime·lock(&runtime·sched.lock);
@@ -2931,6 +3131,9 @@ sysmon(void)
 			idle = 0;
 		else
 			idle++;
+#ifdef GOOS_akaros
+		vcorerecover(now);
+#endif
 
 		// check if we need to force a GC
 		lastgc = runtime·atomicload64(&mstats.last_gc);
@@ -3003,7 +3206,12 @@ retake(int64 now)
 			// increment nmidle and report deadlock.
 			incidlelocked(-1);
 			if(runtime·cas(&p->status, s, Pidle)) {
+				if(runtime·traceEnabled) {
+					runtime·traceGoSysBlock(p);
+					runtime·traceProcStop(p);
+				}
 				n++;
+				p->syscalltick++;
 				handoffp(p);
 			}
 			incidlelocked(1);
@@ -3017,12 +3225,75 @@ retake(int64 now)
 			}
 			if(pd->schedwhen + 10*1000*1000 > now)
 				continue;
+#ifdef GOOS_akaros
+			if(runtime·singlecore)
+				continue;
+#endif
 			preemptone(p);
 		}
 	}
 	return n;
 }
 
+#ifdef GOOS_akaros
+// Vcore preemption and revocation.  When the kernel takes a vcore away,
+// parlib recovers the thread that was running there and requeues it with
+// the pthread scheduler.  But an M holding a P never gives up its vcore
+// on its own, so once there are fewer vcores than running Ps the thread
+// can wait indefinitely, and with it its P's goroutines.  sysmon looks for
+// running Ps whose M has been off its vcore for VcoreStall.  It moves the
+// goroutines queued on such a P to the global queue, where the Ms still
+// running find them, and preempts one running M, which hands its vcore to
+// the stranded thread on its next pass through schedule.  Repeated every
+// sysmon tick, that time-slices the Ms over the vcores we have left.
+enum { VcoreStall = 10*1000*1000 };
+
+static void
+vcorerecover(int64 now)
+{
+	P *p, *victim;
+	G *batch[nelem(p->runq)/2];
+	M *mp;
+	uint32 i, n;
+	int32 j;
+	bool stranded;
+
+	if(runtime·singlecore)
+		return;
+	victim = nil;
+	stranded = false;
+	for(j = 0; j < runtime·gomaxprocs; j++) {
+		p = runtime·allp[j];
+		if(p == nil || p->status != Prunning || (mp = p->m) == nil)
+			continue;
+		if(runtime·moncore(mp)) {
+			mp->offcoresince = 0;
+			if(victim == nil && !mp->yieldvcore)
+				victim = p;
+			continue;
+		}
+		if(mp->offcoresince == 0) {
+			mp->offcoresince = now;
+			continue;
+		}
+		if(now - mp->offcoresince < VcoreStall)
+			continue;
+		stranded = true;
+		while((n = runqgrab(p, batch)) > 0) {
+			for(i = 0; i < n-1; i++)
+				batch[i]->schedlink = batch[i+1];
+			runtime·lock(&runtime·sched.lock);
+			globrunqputbatch(batch[0], batch[n-1], n);
+			runtime·unlock(&runtime·sched.lock);
+		}
+	}
+	if(stranded && victim != nil && (mp = victim->m) != nil) {
+		mp->yieldvcore = true;
+		preemptone(victim);
+	}
+}
+#endif
+
 // Tell all goroutines that they have been preempted and they should stop.
 // This function is purely best-effort.  It can fail to inform a goroutine if a
 // processor just started running it.
@@ -3073,6 +3344,10 @@ preemptone(P *p)
 	// Setting gp->stackguard0 to StackPreempt folds
 	// preemption into the normal stack overflow check.
 	gp->stackguard0 = StackPreempt;
+#ifdef GOOS_akaros
+	// A goroutine that makes no calls never checks; interrupt it.
+	runtime·preemptasync(mp, gp);
+#endif
 	return true;
 }
 
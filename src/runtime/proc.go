@@ -55,11 +55,13 @@ func main() {
 
 	memstats.enablegc = true // now that runtime is initialized, GC is okay
 
+	startphase(startInit)
 	main_init()
 
 	needUnlock = false
 	unlockOSThread()
 
+	startphase(startMain)
 	main_main()
 	if raceenabled {
 		racefini()
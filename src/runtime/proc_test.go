@@ -478,3 +478,34 @@ func matmult(done chan<- struct{}, A, B, C Matrix, i0, i1, j0, j1, k0, k1, thres
 		done <- struct{}{}
 	}
 }
+
+func TestReadGoroutineStats(t *testing.T) {
+	const n = 50
+	var before, after runtime.GoroutineStats
+	runtime.ReadGoroutineStats(&before)
+	release := make(chan bool)
+	started := make(chan bool)
+	for i := 0; i < n; i++ {
+		go func() {
+			started <- true
+			<-release
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-started
+	}
+	runtime.ReadGoroutineStats(&after)
+	close(release)
+	if got := after.Created - before.Created; got < n {
+		t.Errorf("Created grew by %d, want at least %d", got, n)
+	}
+	if live := after.Created - after.Finished; after.Peak < live || after.Peak < n {
+		t.Errorf("Peak=%d, want at least %d and at least %d live", after.Peak, n, live)
+	}
+	if r := after.ChurnRate(&before); r <= 0 {
+		t.Errorf("ChurnRate=%v, want positive", r)
+	}
+	if r := before.ChurnRate(&after); r != 0 {
+		t.Errorf("ChurnRate against a later reading=%v, want 0", r)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Profiler labels.
+//
+// Package runtime/pprof gives each goroutine a set of labels, which the
+// runtime keeps in g.labels without looking inside.  A goroutine starts
+// with its creator's set.  When runtime/pprof asks for it, the CPU
+// profile tags each sample with the address of the interrupted
+// goroutine's set, and runtime/pprof turns the address back into labels
+// when it writes the profile.  The log holds those addresses as plain
+// words, so from the start of a tagged profile until runtime/pprof is done
+// with it, every set a goroutine has is also kept in proflabels.keep,
+// where the garbage collector can see it.
+
+package runtime
+
+import "unsafe"
+
+var proflabels struct {
+	lock   mutex
+	tagcpu bool   // tag the next CPU profile
+	on     uint32 // keeping sets for a tagged profile
+	keep   ptrset // the sets that profile may refer to
+}
+
+// A ptrset is a set of pointers, held where the garbage collector can see
+// them.  Goroutines switch back and forth between a few label sets, so
+// keeping each set once keeps the set as small as the sets themselves.
+type ptrset struct {
+	n     int
+	slots []unsafe.Pointer // open addressing; len is 0 or a power of 2
+}
+
+func (s *ptrset) add(p unsafe.Pointer) {
+	if 2*(s.n+1) > len(s.slots) {
+		old := s.slots
+		n := 2 * len(old)
+		if n == 0 {
+			n = 16
+		}
+		s.slots, s.n = make([]unsafe.Pointer, n), 0
+		for _, q := range old {
+			if q != nil {
+				s.add(q)
+			}
+		}
+	}
+	mask := uintptr(len(s.slots) - 1)
+	for i := uintptr(p) >> 4 & mask; ; i = (i + 1) & mask {
+		switch s.slots[i] {
+		case p:
+			return
+		case nil:
+			s.slots[i] = p
+			s.n++
+			return
+		}
+	}
+}
+
+// setproflabel sets the current goroutine's labels.  Either it sees
+// proflabels.on or keepproflabels sees the new set: both store before
+// they load, with atomics that order the two.
+func setproflabel(labels unsafe.Pointer) {
+	atomicstorep(unsafe.Pointer(&getg().labels), labels)
+	if labels == nil || atomicload(&proflabels.on) == 0 {
+		return
+	}
+	lock(&proflabels.lock)
+	if proflabels.on != 0 {
+		proflabels.keep.add(labels)
+	}
+	unlock(&proflabels.lock)
+}
+
+// getproflabel returns the current goroutine's labels.
+func getproflabel() unsafe.Pointer {
+	return getg().labels
+}
+
+// setcpuproflabels arranges for the CPU profile started next to be
+// tagged, if on, or, if not, stops keeping the label sets of the last
+// tagged profile.
+func setcpuproflabels(on bool) {
+	lock(&proflabels.lock)
+	proflabels.tagcpu = on
+	if !on {
+		atomicstore(&proflabels.on, 0)
+		proflabels.keep = ptrset{}
+	}
+	unlock(&proflabels.lock)
+}
+
+// keepproflabels starts keeping label sets for a tagged profile, beginning
+// with those the goroutines have now.
+func keepproflabels() {
+	lock(&proflabels.lock)
+	atomicstore(&proflabels.on, 1)
+	lock(&allglock)
+	for _, gp := range allgs {
+		if l := atomicloadp(unsafe.Pointer(&gp.labels)); l != nil {
+			proflabels.keep.add(l)
+		}
+	}
+	unlock(&allglock)
+	unlock(&proflabels.lock)
+}
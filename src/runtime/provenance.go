@@ -0,0 +1,36 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// An AllocProvenance records where a heap object came from.
+type AllocProvenance struct {
+	Addr  uintptr    // start of the object
+	Size  uintptr    // size of the object, rounded up to its size class
+	Stack [4]uintptr // innermost frames of the allocating call, 0-terminated
+	Goid  int64      // goroutine that allocated it
+	Cycle uint32     // number of garbage collections completed before
+}
+
+// LookupProvenance returns the provenance of the heap object containing
+// addr.  Provenance is only recorded by programs built with the
+// provenance build tag (go build -tags provenance), where every
+// allocation pays for it; otherwise ok is always false.
+//
+// The records live in a fixed table indexed by address, so a record can
+// be displaced by a later allocation elsewhere, and ok is false for an
+// object whose record has been.  An object freed and its memory reused
+// reports its successor.
+func LookupProvenance(addr uintptr) (p AllocProvenance, ok bool) {
+	if !provenanceEnabled {
+		return
+	}
+	_, x, n := findObject(unsafe.Pointer(addr))
+	if x == nil {
+		return
+	}
+	return lookupProvenance(uintptr(x), n)
+}
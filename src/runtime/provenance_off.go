@@ -0,0 +1,20 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !provenance
+
+package runtime
+
+import "unsafe"
+
+const provenanceEnabled = false
+
+// Because provenanceEnabled is false, these should never be called.
+
+func recordProvenance(x unsafe.Pointer) { gothrow("provenance") }
+
+func lookupProvenance(x, n uintptr) (p AllocProvenance, ok bool) {
+	gothrow("provenance")
+	return
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build provenance
+
+// Allocation provenance, recorded by mallocgc for every object.
+
+package runtime
+
+import "unsafe"
+
+const provenanceEnabled = true
+
+// provTabSize is the number of records kept; a power of two.
+const provTabSize = 1 << 18
+
+type provRecord struct {
+	addr  uintptr
+	stk   [4]uintptr
+	goid  int64
+	cycle uint32
+}
+
+var (
+	provLock mutex
+	provTab  [provTabSize]provRecord
+)
+
+func provSlot(addr uintptr) *provRecord {
+	h := addr >> 4
+	h ^= h >> 18
+	return &provTab[h&(provTabSize-1)]
+}
+
+// recordProvenance is called by mallocgc for the new object x.
+func recordProvenance(x unsafe.Pointer) {
+	mp := acquirem()
+	var r provRecord
+	r.addr = uintptr(x)
+	callers(3, &r.stk[0], len(r.stk))
+	if mp.curg != nil {
+		r.goid = mp.curg.goid
+	}
+	r.cycle = memstats.numgc
+	lock(&provLock)
+	*provSlot(r.addr) = r
+	unlock(&provLock)
+	releasem(mp)
+}
+
+func lookupProvenance(x, n uintptr) (p AllocProvenance, ok bool) {
+	lock(&provLock)
+	r := *provSlot(x)
+	unlock(&provLock)
+	if r.addr != x {
+		return
+	}
+	return AllocProvenance{Addr: x, Size: n, Stack: r.stk, Goid: r.goid, Cycle: r.cycle}, true
+}
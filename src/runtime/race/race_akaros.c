@@ -0,0 +1,79 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build race,akaros,amd64
+
+// Platform services for the Akaros build of the race runtime.
+//
+// ThreadSanitizer's sanitizer_common layer normally makes raw Linux
+// system calls for memory, thread identity and time.  None of those mean
+// the same thing on Akaros: threads are parlib uthreads that move between
+// vcores, the kernel has no notion of a thread ID, and the cheap clock is
+// the TSC.  race_akaros_amd64.syso is built with a platform layer that
+// calls the functions below instead (see README).
+
+#include <stdint.h>
+#include <sys/mman.h>
+#include <parlib/parlib.h>
+#include <parlib/tsc-compat.h>
+#include <parlib/vcore.h>
+#include <pthread.h>
+
+// Map size bytes of zeroed memory at addr, which must be exactly where
+// it lands if fixed is set: the shadow and meta regions sit at fixed
+// offsets from the heap at 0x00c000000000.  Akaros maps anonymous memory
+// lazily, so the terabytes of shadow cost nothing until touched.
+void*
+__tsan_akaros_mmap(void *addr, uintptr_t size, int fixed)
+{
+	int flags;
+	void *p;
+
+	flags = MAP_PRIVATE | MAP_ANONYMOUS;
+	if (fixed)
+		flags |= MAP_FIXED;
+	p = mmap(addr, size, PROT_READ | PROT_WRITE, flags, -1, 0);
+	if (p == MAP_FAILED)
+		return 0;
+	return p;
+}
+
+int
+__tsan_akaros_munmap(void *addr, uintptr_t size)
+{
+	return munmap(addr, size);
+}
+
+// A thread's identity is its pthread, which keeps its ID whichever vcore
+// runs it; the vcore ID changes under it and must not be used.
+uint64_t
+__tsan_akaros_tid(void)
+{
+	if (in_vcore_context())
+		return 0;
+	return pthread_self()->id;
+}
+
+// The stack of the calling thread, for reports about the race runtime's
+// own threads.  Go code never runs on these stacks.
+void
+__tsan_akaros_stack(uintptr_t *addr, uintptr_t *size)
+{
+	struct pthread_tcb *t;
+
+	*addr = 0;
+	*size = 0;
+	if (in_vcore_context())
+		return;
+	t = pthread_self();
+	*addr = (uintptr_t)t->stacktop - t->stacksize;
+	*size = t->stacksize;
+}
+
+// Nanoseconds since boot, from the TSC.
+uint64_t
+__tsan_akaros_nanotime(void)
+{
+	return tsc2nsec(read_tsc());
+}
@@ -19,6 +19,26 @@ func setGCPercent(in int32) (out int32) {
 	return out
 }
 
+func setMemoryLimit(in int64) (out int64) {
+	// setmemorylimit_m works out the new GC goal from the heap
+	// statistics, which only hold still with the world stopped.
+	semacquire(&worldsema, false)
+	gp := getg()
+	gp.m.gcing = 1
+	onM(stoptheworld)
+
+	gp.m.scalararg[0] = uintptr(in)
+	onM(setmemorylimit_m)
+	out = int64(gp.m.scalararg[0])
+
+	gp.m.gcing = 0
+	gp.m.locks++
+	semrelease(&worldsema)
+	onM(starttheworld)
+	gp.m.locks--
+	return out
+}
+
 func setPanicOnFault(new bool) (old bool) {
 	mp := acquirem()
 	old = mp.curg.paniconfault
@@ -20,6 +20,7 @@ static uint32 traceback_cache = 2<<1;
 //	GOTRACEBACK=0   suppress all tracebacks
 //	GOTRACEBACK=1   default behavior - show tracebacks but exclude runtime frames
 //	GOTRACEBACK=2   show tracebacks including runtime frames
+//	GOTRACEBACK=system   same as 2
 //	GOTRACEBACK=crash   show tracebacks including runtime frames, then crash (core dump etc)
 #pragma textflag NOSPLIT
 int32
@@ -289,6 +290,16 @@ static DbgVar dbgvar[] = {
 	{"scheddetail", &runtime·debug.scheddetail},
 	{"schedtrace", &runtime·debug.schedtrace},
 	{"scavenge", &runtime·debug.scavenge},
+#ifdef GOOS_akaros
+	{"starttrace", &runtime·debug.starttrace},
+	{"tracekernel", &runtime·debug.tracekernel},
+	{"akarostrace", &runtime·debug.akarostrace},
+	{"asyncpreemptoff", &runtime·debug.asyncpreemptoff},
+	{"hugepages", &runtime·debug.hugepages},
+	{"pinpcore", &runtime·debug.pinpcore},
+	{"akarossync", &runtime·debug.akarossync},
+	{"akarosleaks", &runtime·debug.akarosleaks},
+#endif
 };
 
 void
@@ -317,12 +328,35 @@ runtime·parsedebugvars(void)
 		p = (byte*)"";
 	if(p[0] == '\0')
 		traceback_cache = 1<<1;
+	else if(runtime·strcmp(p, (byte*)"system") == 0)
+		traceback_cache = 2<<1;
 	else if(runtime·strcmp(p, (byte*)"crash") == 0)
 		traceback_cache = (2<<1) | 1;
 	else
 		traceback_cache = runtime·atoi(p)<<1;	
 }
 
+#ifdef GOOS_akaros
+// The value of the GODEBUG variable named key, as parsed into dbgvar, or
+// 0 if there is no such variable.  For package syscall, so that its
+// knobs follow the same rules as the runtime's own.
+void
+syscall·godebug(String key, intgo ret)
+{
+	intgo i;
+
+	ret = 0;
+	for(i=0; i<nelem(dbgvar); i++) {
+		if(runtime·findnull((byte*)dbgvar[i].name) == key.len &&
+		   runtime·mcmp(key.str, (byte*)dbgvar[i].name, key.len) == 0) {
+			ret = *dbgvar[i].value;
+			break;
+		}
+	}
+	FLUSH(&ret);
+}
+#endif
+
 // Poor mans 64-bit division.
 // This is a very special function, do not use it if you are not sure what you are doing.
 // int64 division is lowered into _divv() call on 386, which does not fit into nosplit functions.
@@ -94,6 +94,11 @@ typedef	struct	PollDesc	PollDesc;
 typedef	struct	DebugVars	DebugVars;
 typedef	struct	ForceGCState	ForceGCState;
 typedef	struct	Stack		Stack;
+#ifdef GOOS_akaros
+typedef	struct	AsyncPreempt	AsyncPreempt;
+typedef	struct	AsyncProf	AsyncProf;
+typedef	struct	AlarmArg	AlarmArg;
+#endif
 
 /*
  * Per-CPU declaration.
@@ -233,6 +238,7 @@ struct	SudoG
 	SudoG*	prev;
 	void*	elem;		// data element
 	int64	releasetime;
+	int64	acquiretime;	// when a sync.Mutex waiter began waiting, for the mutex profile
 	int32	nrelease;	// -1 for acquire
 	SudoG*	waitlink;	// G.waiting list
 };
@@ -266,6 +272,63 @@ struct	WinCallbackContext
 	bool	cleanstack;
 };
 
+#ifdef GOOS_akaros
+// Asynchronous preemption and profiling (see runtime·preemptasync in
+// os_akaros.c).  The notification handler in parlib/gcc_akaros.c saves
+// the interrupted goroutine's registers in this order, and
+// runtime·asyncpreempt and runtime·asyncprof restore them; both sides
+// have their own copy of it.
+enum
+{
+	AsyncAX, AsyncBX, AsyncCX, AsyncDX, AsyncSI, AsyncDI, AsyncBP,
+	AsyncR8, AsyncR9, AsyncR10, AsyncR11, AsyncR12, AsyncR13, AsyncR14, AsyncR15,
+	AsyncFlags,
+	AsyncPC,
+	AsyncSP,	// saved but not restored
+	AsyncX0,	// X0 through X15, two words each
+	AsyncRegs = AsyncX0 + 2*16,
+
+	// Room a goroutine must have left on its stack to be interrupted,
+	// so that nothing runtime·asyncpreempt calls has to grow it.
+	AsyncStackRoom = 1024,
+};
+
+// A request to interrupt the goroutine an M runs, read by the
+// notification handler whenever the notification arrives.
+struct	AsyncPreempt
+{
+	void*	uthread;	// the uthread that must be running the goroutine
+	uintreg*	regs;	// the goroutine's asyncregs
+	uint32*	busy;	// and its asyncbusy
+	uintptr	lo;	// the goroutine's stack, less AsyncStackRoom
+	uintptr	hi;
+};
+
+// An M's standing request for profiling ticks (see runtime·resetcpuprofiler
+// in signal_akaros.c).  regs and busy are laid out as in G, where the
+// handler and runtime·asyncprof expect them.
+struct	AsyncProf
+{
+	AsyncPreempt	req;	// regs and busy point below; lo and hi follow m->curg
+	uintreg	regs[AsyncRegs];
+	uint32	busy;
+	AsyncProf*	next;	// list of every M's, kept by parlib/gcc_akaros.c
+};
+
+// A kernel alarm from the #alarm device, posting to an event queue of
+// its own (see sys_akaros.c); gcc_alarm_arg_t in parlib/gcc_akaros.h.
+struct	AlarmArg
+{
+	struct EventQueue*	evq;
+	int32	ctlfd;
+	int32	timerfd;
+	int32	id;
+	int32	have;	// the device gave us the alarm; set by gcc_alarm_new
+	int32	ok;	// the last gcc_alarm_set worked
+	uint64	tsc;	// when to go off, for gcc_alarm_set
+};
+#endif
+
 // Stack describes a Go execution stack.
 // The bounds of the stack are exactly [lo, hi),
 // with no implicit data structures on either side.
@@ -305,6 +368,7 @@ struct	G
 	bool	preemptscan;    // preempted g does scan for GC
 	bool	gcworkdone;     // debug: cleared at begining of gc work phase cycle, set by gcphasework, tested at end of cycle
 	bool	throwsplit; // must not split stack
+	bool	sysblocktraced;	// the execution tracer shows the G blocked in a system call
 	int8	raceignore;	// ignore race detection events
 	M*	m;		// for debuggers, but offset not hard-coded
 	M*	lockedm;
@@ -314,9 +378,15 @@ struct	G
 	uintptr	sigcode1;
 	uintptr	sigpc;
 	uintptr	gopc;		// pc of go statement that created this goroutine
+	uintptr	startpc;	// pc of goroutine function
 	uintptr	racectx;
+	void*	labels;		// profiler labels, set by runtime/pprof (see proflabel.go)
 #ifdef GOOS_akaros
 	int8	sysc[216];
+	void*	usysc;		// system call issued by package syscall, if in one
+	int64	usysctime;	// nanotime when usysc was issued
+	uintreg	asyncregs[AsyncRegs];	// registers saved by an asynchronous preemption
+	uint32	asyncbusy;	// asyncregs in use; the stack must not move
 #endif
 	SudoG*	waiting;	// sudog structures this G is waiting on (that have a valid elem ptr)
 	uintptr	end[];
@@ -347,6 +417,7 @@ struct	M
 	int32	helpgc;
 	bool	spinning;	// M is out of work and is actively looking for work
 	bool	blocked;	// M is blocked on a Note
+	uint32	syscalltick;	// p->syscalltick at the last entersyscall
 	uint32	fastrand;
 	uint64	ncgocall;	// number of cgo calls in total
 	int32	ncgo;		// number of cgo calls currently in progress
@@ -357,7 +428,8 @@ struct	M
 	uint32	machport;	// Return address for Mach IPC (OS X)
 	MCache*	mcache;
 	G*	lockedg;
-	uintptr	createstack[32];// Stack that created this thread.
+	uintptr	createstack[64];// Stack that created this thread.
+	int32	createvcore;	// vcore the creating thread ran on (Akaros), or -1
 	uint32	freglo[16];	// D[i] lsb and F[i]
 	uint32	freghi[16];	// D[i] msb and F[i+16]
 	uint32	fflag;		// floating point compare flags
@@ -398,6 +470,15 @@ struct	M
 #ifdef GOOS_plan9
 	int8*	notesig;
 	byte*	errstr;
+#endif
+#ifdef GOOS_akaros
+	void*	uthread;	// the parlib uthread this M runs as
+	int64	offcoresince;	// when sysmon first saw it off its vcore, or 0
+	bool	yieldvcore;	// give up the vcore at the next schedule
+	AsyncPreempt	asyncpreempt;	// last asynchronous preemption request
+	AsyncProf	asyncprof;	// profiling ticks interrupt the M's goroutine with this
+	AlarmArg	waitalarm;	// wakes the M from semasleep; waitsema points here
+	bool	vcorepinned;	// its uthread keeps to one vcore (runtime·vcorepin)
 #endif
 	uintptr	end[];
 };
@@ -428,6 +509,8 @@ struct P
 	G*	gfree;
 	int32	gfreecnt;
 
+	void*	profbuf;	// profile events not yet in their buckets (see mprof.go)
+
 	byte	pad[64];
 };
 
@@ -619,8 +702,36 @@ struct DebugVars
 	int32	scheddetail;
 	int32	schedtrace;
 	int32	scavenge;
+#ifdef GOOS_akaros
+	int32	starttrace;
+	int32	tracekernel;
+	int32	akarostrace;
+	int32	asyncpreemptoff;
+	int32	hugepages;
+	int32	pinpcore;
+	int32	akarossync;	// read by package syscall, through syscall·godebug
+	int32	akarosleaks;
+#endif
 };
 
+#ifdef GOOS_akaros
+// Start-up phases, timed in runtime·startstamps (see startup_akaros.go).
+enum
+{
+	StartOsinit,	// runtime·osinit
+	StartMalloc,	// heap initialized
+	StartArgs,	// arguments parsed
+	StartEnv,	// environment parsed
+	StartMCP,	// became an MCP, or settled for one vcore
+	StartTopology,	// CPU topology found, pcores provisioned if asked
+	StartSched,	// scheduler initialized
+	StartPoller,	// network poller initialized, on first use
+	StartInit,	// runtime initialized, package init starting
+	StartMain,	// main.main starting
+	StartMax,
+};
+#endif
+
 // Indicates to write barrier and sychronization task to preform.
 enum
 {                   // Synchronization            Write barrier
@@ -758,6 +869,21 @@ extern	uint32	runtime·panicking;
 extern	int8*	runtime·goos;
 extern	int32	runtime·ncpu;
 extern	bool	runtime·iscgo;
+#ifdef GOOS_akaros
+extern	uint32	runtime·schedticks;	// bumped at every scheduling point; watched by the akaros watchdog
+extern	bool	runtime·singlecore;	// GOSINGLECORE or no MCP: one vcore, one P, no time-slice preemption
+extern	int64	runtime·startstamps[StartMax];	// nanotime at the end of each start-up phase
+void	runtime·vcoreadjust(bool);
+bool	runtime·moncore(M*);
+int32	runtime·vcoreid(void);
+int32	runtime·threadid(void);
+void	runtime·preemptasync(M*, G*);
+void	runtime·asyncprofstack(G*);
+bool	runtime·hugepagesok(void);
+uintptr	runtime·SysReleasable(void*, uintptr);
+G*	runtime·vcorechanged(void);
+void	runtime·vcorepin(bool);
+#endif
 extern 	void	(*runtime·sysargs)(int32, uint8**);
 extern	uintptr	runtime·maxstring;
 extern	uint32	runtime·cpuid_ecx;
@@ -766,6 +892,8 @@ extern	DebugVars	runtime·debug;
 extern	uintptr	runtime·maxstacksize;
 extern	Note	runtime·signote;
 extern	ForceGCState	runtime·forcegc;
+extern	bool	runtime·traceEnabled;
+extern	bool	runtime·traceShutdown;
 extern	SchedT	runtime·sched;
 extern	int32		runtime·newprocs;
 
@@ -909,6 +1037,7 @@ void	runtime·newextram(void);
 void	runtime·exit(int32);
 void	runtime·breakpoint(void);
 void	runtime·gosched_m(G*);
+void	runtime·gopreempt_m(G*);
 void	runtime·schedtrace(bool);
 void	runtime·park(bool(*)(G*, void*), void*, String);
 void	runtime·parkunlock(Mutex*, String);
@@ -972,6 +1101,26 @@ void	runtime·stoptheworld(void);
 void	runtime·starttheworld(void);
 extern uint32 runtime·worldsema;
 
+/*
+ * execution tracer hooks, in trace.go
+ */
+G*	runtime·traceReader(void);
+void	runtime·traceGomaxprocs(int32);
+void	runtime·traceProcStart(void);
+void	runtime·traceProcStop(P*);
+void	runtime·traceGCStart(void);
+void	runtime·traceGCDone(void);
+void	runtime·traceGoCreate(G*, uintptr);
+void	runtime·traceGoStart(void);
+void	runtime·traceGoEnd(void);
+void	runtime·traceGoSched(void);
+void	runtime·traceGoPreempt(void);
+void	runtime·traceGoPark(G*);
+void	runtime·traceGoUnblock(G*);
+void	runtime·traceGoSysCall(void);
+void	runtime·traceGoSysExit(G*);
+void	runtime·traceGoSysBlock(P*);
+
 /*
  * mutual exclusion locks.  in the uncontended case,
  * as fast as spin locks (just a few user-level instructions),
@@ -40,15 +40,36 @@ var semtable [semTabSize]struct {
 
 // Called from sync/net packages.
 func asyncsemacquire(addr *uint32) {
-	semacquire(addr, true)
+	semacquire1(addr, semaBlockProfile)
+}
+
+// Called from sync.Mutex and sync.RWMutex, whose waits also go in the
+// mutex profile.
+func asyncsemacquiremutex(addr *uint32) {
+	semacquire1(addr, semaBlockProfile|semaMutexProfile)
 }
 
 func asyncsemrelease(addr *uint32) {
 	semrelease(addr)
 }
 
+type semaProfileFlags int
+
+const (
+	semaBlockProfile semaProfileFlags = 1 << iota
+	semaMutexProfile
+)
+
 // Called from runtime.
 func semacquire(addr *uint32, profile bool) {
+	var flags semaProfileFlags
+	if profile {
+		flags = semaBlockProfile
+	}
+	semacquire1(addr, flags)
+}
+
+func semacquire1(addr *uint32, flags semaProfileFlags) {
 	gp := getg()
 	if gp != gp.m.curg {
 		gothrow("semacquire not on the G stack")
@@ -69,10 +90,17 @@ func semacquire(addr *uint32, profile bool) {
 	root := semroot(addr)
 	t0 := int64(0)
 	s.releasetime = 0
-	if profile && blockprofilerate > 0 {
+	s.acquiretime = 0
+	if flags&semaBlockProfile != 0 && blockprofilerate > 0 {
 		t0 = cputicks()
 		s.releasetime = -1
 	}
+	if flags&semaMutexProfile != 0 && mutexprofilerate > 0 {
+		if t0 == 0 {
+			t0 = cputicks()
+		}
+		s.acquiretime = t0
+	}
 	for {
 		lock(&root.lock)
 		// Add ourselves to nwait to disable "easy case" in semrelease.
@@ -126,6 +154,9 @@ func semrelease(addr *uint32) {
 	}
 	unlock(&root.lock)
 	if s != nil {
+		if s.acquiretime != 0 {
+			mutexevent(cputicks()-s.acquiretime, 3)
+		}
 		if s.releasetime != 0 {
 			s.releasetime = cputicks()
 		}
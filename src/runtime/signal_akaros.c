@@ -6,6 +6,8 @@
 #include "defs_GOOS_GOARCH.h"
 #include "os_GOOS.h"
 #include "signal_unix.h"
+#include "signal_GOOS_GOARCH.h"
+#include "malloc.h"
 
 extern SigTab runtime·sigtab[];
 
@@ -47,6 +49,8 @@ runtime·sigenable(uint32 sig)
 		return;
 
 	t = &runtime·sigtab[sig];
+	if(t->flags & SigNotify)
+		runtime·netpollsignals();
 	if((t->flags & SigNotify) && !(t->flags & SigHandling)) {
 		t->flags |= SigHandling;
 		if(runtime·getsig(sig) == SIG_IGN)
@@ -73,6 +77,46 @@ runtime·sigdisable(uint32 sig)
 	}
 }
 
+// A signal sent to the process, whether by kill, by the console on an
+// interrupt or by the kernel itself, arrives as an EV_POSIX_SIGNAL event.
+// Parlib would run the handler in vcore context, with no M or G to run
+// Go code on, so once os/signal asks for a signal the runtime takes these
+// events on the poller's queue instead, and netpoll hands each one here
+// on an M of its own.  There is no interrupted context: a signal meant
+// for os/signal is queued for it, and any other gets the action
+// runtime·sighandler would give it, less the register dump.
+void
+runtime·sigevent(int32 sig)
+{
+	SigTab *t;
+	bool crash;
+
+	if(sig <= 0 || sig >= NSIG)
+		return;
+	t = &runtime·sigtab[sig];
+	if((t->flags & SigNotify) && runtime·sigsend(sig))
+		return;
+	if(t->flags & SigKill)
+		runtime·exit(2);
+	if(!(t->flags & SigThrow))
+		return;
+
+	g->m->throwing = 1;
+	runtime·startpanic();
+	runtime·printf("%s\n\n", t->name);
+	if(runtime·gotraceback(&crash)) {
+		runtime·tracebackothers(g);
+		runtime·printf("\n");
+		runtime·akarosdump();
+	}
+	if(crash)
+		runtime·crash();
+	runtime·exit(2);
+}
+
+// There is no SIGPROF to ask for: a parlib alarm, shared by every M,
+// interrupts the goroutine on each vcore hz times a second and has it
+// call runtime·sigprof itself (see runtime·asyncprof2 in os_akaros.c).
 void
 runtime·resetcpuprofiler(int32 hz)
 {
@@ -85,10 +129,138 @@ runtime·resetcpuprofiler(int32 hz)
 	return;
 }
 
+// GOTRACEBACK=crash.  Akaros does not dump core, and has no ptrace for a
+// debugger to attach with, so a crashing program writes a core of its
+// own: to the file named by $GOCORE, or core.PID in the current
+// directory, or failing that the console, #cons/cons.  It is text, for
+// want of tools to read anything else: the registers of the faulting
+// context, every goroutine's stack with runtime frames, the state that
+// runtime·akarosdump prints, and a table of the heap's spans.  The
+// process then exits with status 2.
+enum
+{
+	O_WRONLY = 1,
+	O_CREAT = 0100,
+	O_TRUNC = 01000,
+	CoreBufSize = 64<<20,	// address space; only what is written gets pages
+};
+
+void	runtime·dumpregs(Siginfo*, void*);
+
+static Siginfo *crashinfo;
+static void *crashctxt;
+static G *crashgp;
+
+// Called by runtime·sighandler before runtime·crash, with the context
+// of the signal that brought the program down, which ran on gp.
+void
+runtime·crashcontext(Siginfo *info, void *ctxt, G *gp)
+{
+	crashinfo = info;
+	crashctxt = ctxt;
+	crashgp = gp;
+}
+
+static int32
+corefile(void)
+{
+	byte *p, path[32];
+	int32 i, n, pid, fd;
+
+	p = runtime·getenv("GOCORE");
+	if(p != nil && *p != 0) {
+		fd = runtime·open((int8*)p, O_WRONLY|O_CREAT|O_TRUNC, 0644);
+		if(fd >= 0)
+			return fd;
+	}
+	runtime·memmove(path, "core.", 5);
+	pid = runtime·getpid();
+	n = 1;
+	for(i = pid; i >= 10; i /= 10)
+		n++;
+	for(i = 5+n-1; i >= 5; i--) {
+		path[i] = '0' + pid%10;
+		pid /= 10;
+	}
+	path[5+n] = 0;
+	fd = runtime·open((int8*)path, O_WRONLY|O_CREAT|O_TRUNC, 0644);
+	if(fd >= 0)
+		return fd;
+	return runtime·open("#cons/cons", O_WRONLY, 0);
+}
+
+// Indexed by MSpan.state.
+static int8 *spanstates[] = {
+	"inuse",
+	"stack",
+	"free",
+	"listhead",
+	"dead",
+};
+
+static void
+dumpspans(void)
+{
+	uintptr i;
+	MSpan *s;
+
+	runtime·printf("heap: arena %p-%p, %D spans\n",
+	               runtime·mheap.arena_start, runtime·mheap.arena_used,
+	               (uint64)runtime·mheap.nspan);
+	for(i = 0; i < runtime·mheap.nspan; i++) {
+		s = runtime·mheap.allspans[i];
+		if(s->state == MSpanDead)
+			continue;
+		runtime·printf("span %p npages=%D %s class=%d elemsize=%D ref=%d\n",
+		               (uintptr)(s->start << PageShift), (uint64)s->npages,
+		               s->state < nelem(spanstates) ? spanstates[s->state] : "?",
+		               s->sizeclass, (uint64)s->elemsize, s->ref);
+	}
+}
+
 void
 runtime·crash(void)
 {
-	runtime·unblocksignals();
-	runtime·setsig(SIGABRT, SIG_DFL, false);
-	runtime·raise(SIGABRT);
+	int32 fd, n;
+	byte *buf;
+	G *gp;
+
+	fd = corefile();
+	buf = runtime·SysAlloc(CoreBufSize, &mstats.other_sys);
+	if(fd < 0 || buf == nil)
+		return;
+
+	// Capture everything printed below in buf.
+	g->writebuf.array = buf;
+	g->writebuf.len = 0;
+	g->writebuf.cap = CoreBufSize;
+	g->m->traceback = 2;
+
+	runtime·printf("Go core of process %d\n\n", runtime·getpid());
+	gp = crashgp != nil ? crashgp : g->m->curg;
+	if(crashctxt != nil) {
+		runtime·printf("registers:\n");
+		runtime·dumpregs(crashinfo, crashctxt);
+	}
+	if(gp != nil) {
+		runtime·printf("\n");
+		runtime·goroutineheader(gp);
+		if(crashctxt != nil)
+			runtime·tracebacktrap(SIG_RIP(crashinfo, crashctxt), SIG_RSP(crashinfo, crashctxt), 0, gp);
+		else
+			runtime·traceback(~(uintptr)0, ~(uintptr)0, 0, gp);
+	}
+	runtime·tracebackothers(gp);
+	runtime·printf("\n");
+	runtime·akarosdump();
+	runtime·printf("\n");
+	dumpspans();
+
+	n = g->writebuf.len;
+	g->writebuf.array = nil;
+	g->writebuf.len = 0;
+	g->writebuf.cap = 0;
+	runtime·write(fd, buf, n);
+	runtime·close(fd);
+	runtime·printf("runtime: wrote %d-byte core\n", n);
 }
@@ -147,10 +147,17 @@ runtime·sighandler(int32 sig, Siginfo *info, void *ctxt, G *gp)
 		runtime·tracebackothers(gp);
 		runtime·printf("\n");
 		runtime·dumpregs(info, ctxt);
+#ifdef GOOS_akaros
+		runtime·akarosdump();
+#endif
 	}
 	
-	if(crash)
+	if(crash) {
+#ifdef GOOS_akaros
+		runtime·crashcontext(info, ctxt, gp);
+#endif
 		runtime·crash();
+	}
 
 	runtime·exit(2);
 }
@@ -773,7 +773,7 @@ runtime·newstack(void)
 		}
 		// Act like goroutine called runtime.Gosched.
 		runtime·casgstatus(gp, Gwaiting, Grunning);
-		runtime·gosched_m(gp);	// never return
+		runtime·gopreempt_m(gp);	// never return
 	}
 
 	// Allocate a bigger segment and move the stack.
@@ -787,6 +787,9 @@ runtime·newstack(void)
 	// Note that the concurrent GC might be scanning the stack as we try to replace it.
 	// copystack takes care of the appropriate coordination with the stack scanner.
 	copystack(gp, newsize);
+#ifdef GOOS_akaros
+	runtime·asyncprofstack(gp);
+#endif
 	if(StackDebug >= 1)
 		runtime·printf("stack grow done\n");
 	runtime·casgstatus(gp, Gwaiting, Grunning);
@@ -846,6 +849,16 @@ runtime·shrinkstack(G *gp)
 	// The syscall might have pointers into the stack.
 	if(gp->syscallsp != 0)
 		return;
+#ifdef GOOS_akaros
+	// Nor while it waits for one issued asynchronously (see
+	// netpoll_akaros.c), which may point into it too.
+	if(gp->usysc != nil)
+		return;
+	// Nor while it is stopped by an asynchronous preemption, whose
+	// frame the stack maps do not describe (see os_akaros.c).
+	if(gp->asyncbusy)
+		return;
+#endif
 
 #ifdef GOOS_windows
 	if(gp->m != nil && gp->m->libcallsp != 0)
@@ -6,6 +6,7 @@ package runtime_test
 
 import (
 	. "runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -381,6 +382,50 @@ func TestStackAllOutput(t *testing.T) {
 	}
 }
 
+// goid returns the ID of the calling goroutine, from its stack trace.
+func goid() int64 {
+	b := make([]byte, 64)
+	s := strings.TrimPrefix(string(b[:Stack(b, false)]), "goroutine ")
+	id, _ := strconv.ParseInt(s[:strings.Index(s, " ")], 10, 64)
+	return id
+}
+
+func stackOfWaiter(id chan<- int64, done <-chan bool) {
+	id <- goid()
+	<-done
+}
+
+func TestStackOf(t *testing.T) {
+	id := make(chan int64)
+	done := make(chan bool)
+	go stackOfWaiter(id, done)
+	other := <-id
+	defer close(done)
+
+	b := make([]byte, 1024)
+	n, ok := StackOf(other, b)
+	stk := string(b[:n])
+	if !ok || !strings.HasPrefix(stk, "goroutine "+strconv.FormatInt(other, 10)+" [") {
+		t.Fatalf("StackOf(%d) = %q, %v", other, stk, ok)
+	}
+	if !strings.Contains(stk, "runtime_test.stackOfWaiter") {
+		t.Errorf("StackOf(%d) does not show stackOfWaiter:\n%s", other, stk)
+	}
+	// "created by runtime_test.TestStackOf" is expected; a frame is not.
+	if strings.Contains(stk, "runtime_test.TestStackOf(") {
+		t.Errorf("StackOf(%d) shows the calling goroutine:\n%s", other, stk)
+	}
+
+	n, ok = StackOf(goid(), b)
+	if stk := string(b[:n]); !ok || !strings.Contains(stk, "TestStackOf") {
+		t.Errorf("StackOf of the calling goroutine = %q, %v", stk, ok)
+	}
+
+	if n, ok := StackOf(-1, b); ok || n != 0 {
+		t.Errorf("StackOf(-1) = %d, %v; want 0, false", n, ok)
+	}
+}
+
 func TestStackPanic(t *testing.T) {
 	// Test that stack copying copies panics correctly.  This is difficult
 	// to test because it is very unlikely that the stack will be copied
@@ -0,0 +1,75 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// startstamps holds the nanotime at which each start-up phase ended,
+// indexed by the Start enum in runtime.h, or 0 for a phase not reached
+// yet.  The C phases fill it in as they go; GODEBUG=starttrace=1 prints
+// it when main.main starts.
+var startstamps [_StartMax]int64
+
+var startnames = [_StartMax]string{
+	_StartOsinit:   "osinit",
+	_StartMalloc:   "malloc",
+	_StartArgs:     "args",
+	_StartEnv:      "env",
+	_StartMCP:      "mcp",
+	_StartTopology: "topology",
+	_StartSched:    "sched",
+	_StartPoller:   "poller",
+	_StartInit:     "init",
+	_StartMain:     "main",
+}
+
+const (
+	startInit = _StartInit
+	startMain = _StartMain
+)
+
+// beforemain, if set, runs once package initialization has finished,
+// just before main.main.  Package syscall sets it to run the latency
+// benchmarks GOAKAROSBENCH=1 asks for.
+var beforemain func()
+
+// setbeforemain is syscall.runtime_setBeforeMain.
+func setbeforemain(f func()) {
+	beforemain = f
+}
+
+// startphase records that phase, one of the phases timed in Go, is
+// starting.
+func startphase(phase int) {
+	startstamps[phase] = nanotime()
+	if phase == startMain && debug.starttrace > 0 {
+		printstartup()
+	}
+	if phase == startMain && beforemain != nil {
+		beforemain()
+	}
+}
+
+// printstartup prints the phases reached, in microseconds since
+// runtime·osinit.
+func printstartup() {
+	t0 := startstamps[_StartOsinit]
+	print("startup:")
+	for i, t := range startstamps {
+		if t != 0 {
+			print(" ", startnames[i], " ", (t-t0)/1000, "us")
+		}
+	}
+	print("\n")
+}
+
+// startuptimes is syscall.startupTimes.
+func startuptimes() (names []string, stamps []int64) {
+	for i, t := range startstamps {
+		if t != 0 {
+			names = append(names, startnames[i])
+			stamps = append(stamps, t-startstamps[_StartOsinit])
+		}
+	}
+	return
+}
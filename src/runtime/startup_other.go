@@ -0,0 +1,15 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !akaros
+
+package runtime
+
+const (
+	startInit = 0
+	startMain = 0
+)
+
+func startphase(phase int) {
+}
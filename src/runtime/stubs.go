@@ -28,7 +28,9 @@ func getg() *g
 func acquirem() *m
 func releasem(mp *m)
 func gomcache() *mcache
-func readgstatus(*g) uint32 // proc.c
+func readgstatus(*g) uint32                              // proc.c
+func castogscanstatus(gp *g, oldval, newval uint32) bool // proc.c
+func casfromgscanstatus(gp *g, oldval, newval uint32)    // proc.c
 
 // mcall switches from the g to the g0 stack and invokes fn(g),
 // where g is the goroutine that made the call.
@@ -113,6 +115,7 @@ func markallocated_m()
 func unrollgcprog_m()
 func unrollgcproginplace_m()
 func setgcpercent_m()
+func setmemorylimit_m()
 func setmaxthreads_m()
 func ready_m()
 func deferproc_m()
@@ -0,0 +1,54 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// Decoding a PC's file and line means walking two varint tables from
+// the start of its function, which profile scrapes and tracebacks do for
+// the same few thousand PCs over and over.  funcline1 therefore keeps the
+// results in a small direct-mapped cache.
+//
+// The cache is used from tracebacks, which can run anywhere, including
+// in a signal handler or while crashing with the cache half updated, so
+// it never blocks: a caller that finds it busy does the lookup itself.
+
+const pcCacheSize = 4096 // entries; a power of two
+
+type pcCacheEntry struct {
+	pc     uintptr // 0 for an empty entry
+	entry  uintptr // the function pc was looked up in
+	fileno int32
+	line   int32
+}
+
+var pcCache struct {
+	busy uint32
+	ents [pcCacheSize]pcCacheEntry
+}
+
+func pcCacheIndex(pc uintptr) uintptr {
+	return (pc ^ pc>>12) & (pcCacheSize - 1)
+}
+
+// pcCacheGet returns the file number and line of pc in f, if cached.
+func pcCacheGet(f *_func, pc uintptr) (fileno, line int32, ok bool) {
+	if !cas(&pcCache.busy, 0, 1) {
+		return 0, 0, false
+	}
+	e := &pcCache.ents[pcCacheIndex(pc)]
+	if e.pc == pc && e.entry == f.entry {
+		fileno, line, ok = e.fileno, e.line, true
+	}
+	atomicstore(&pcCache.busy, 0)
+	return
+}
+
+// pcCachePut records the file number and line of pc in f.
+func pcCachePut(f *_func, pc uintptr, fileno, line int32) {
+	if !cas(&pcCache.busy, 0, 1) {
+		return
+	}
+	pcCache.ents[pcCacheIndex(pc)] = pcCacheEntry{pc, f.entry, fileno, line}
+	atomicstore(&pcCache.busy, 0)
+}
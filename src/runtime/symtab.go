@@ -209,6 +209,10 @@ func gofuncname(f *_func) string {
 }
 
 func funcline1(f *_func, targetpc uintptr, file *string, strict bool) int32 {
+	if fileno, line, ok := pcCacheGet(f, targetpc); ok {
+		*file = gostringnocopy(&pclntable[filetab[fileno]])
+		return line
+	}
 	*file = "?"
 	fileno := int(pcvalue(f, f.pcfile, targetpc, strict))
 	line := pcvalue(f, f.pcln, targetpc, strict)
@@ -216,6 +220,7 @@ func funcline1(f *_func, targetpc uintptr, file *string, strict bool) int32 {
 		// print("looking for ", hex(targetpc), " in ", gofuncname(f), " got file=", fileno, " line=", lineno, "\n")
 		return 0
 	}
+	pcCachePut(f, targetpc, int32(fileno), line)
 	*file = gostringnocopy(&pclntable[filetab[fileno]])
 	return line
 }
@@ -45,3 +45,24 @@ func testCallerBar(t *testing.T) {
 		}
 	}
 }
+
+func TestFileLineCached(t *testing.T) {
+	pc, file, line, _ := runtime.Caller(0)
+	f := runtime.FuncForPC(pc)
+	for i := 0; i < 3; i++ {
+		// Caller reports the return address but the line of the call.
+		file1, line1 := f.FileLine(pc - 1)
+		if file1 != file || line1 != line {
+			t.Fatalf("FileLine #%d = %s:%d, want %s:%d", i, file1, line1, file, line)
+		}
+	}
+	// The lookups above left pc's file and line in the cache, which the
+	// later ones were answered from.
+	file1, line1, ok := runtime.PCCached(pc - 1)
+	if !ok {
+		t.Fatalf("PC %#x not in the cache after FileLine", pc-1)
+	}
+	if file1 != file || line1 != line {
+		t.Fatalf("cache holds %s:%d for PC %#x, want %s:%d", file1, line1, pc-1, file, line)
+	}
+}
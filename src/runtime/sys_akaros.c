@@ -17,6 +17,17 @@
 // they entails just for compilation in the kenc world.
 // We use asmcgocall() to call them.
 #pragma cgo_import_static gcc_syscall
+#pragma cgo_import_static gcc_syscall_batch
+#pragma cgo_import_static gcc_syscall_submit
+#pragma cgo_import_static gcc_syscall_reap
+#pragma cgo_import_static gcc_evq_new
+#pragma cgo_import_static gcc_evq_wait
+#pragma cgo_import_static gcc_evq_poll
+#pragma cgo_import_static gcc_evq_free
+#pragma cgo_import_static gcc_evq_signals
+#pragma cgo_import_static gcc_alarm_new
+#pragma cgo_import_static gcc_alarm_set
+#pragma cgo_import_static gcc_thread_ids
 #pragma cgo_import_static gcc_futex
 #pragma cgo_import_static gcc_myield
 #pragma cgo_import_static gcc_sigprocmask
@@ -24,6 +35,17 @@
 #pragma cgo_import_static gcc_disable_profalarm
 typedef void (*gcc_call_t)(void *arg);
 extern gcc_call_t gcc_syscall;
+extern gcc_call_t gcc_syscall_batch;
+extern gcc_call_t gcc_syscall_submit;
+extern gcc_call_t gcc_syscall_reap;
+extern gcc_call_t gcc_evq_new;
+extern gcc_call_t gcc_evq_wait;
+extern gcc_call_t gcc_evq_poll;
+extern gcc_call_t gcc_evq_free;
+extern gcc_call_t gcc_evq_signals;
+extern gcc_call_t gcc_alarm_new;
+extern gcc_call_t gcc_alarm_set;
+extern gcc_call_t gcc_thread_ids;
 extern gcc_call_t gcc_futex;
 extern gcc_call_t gcc_myield;
 extern gcc_call_t gcc_sigprocmask;
@@ -39,110 +61,334 @@ static intgo strlen(int8 *string)
 	return temp-string;
 }
 
+// Convert TSC ticks to nanoseconds at the frequency the kernel calibrated
+// the TSC to.  Splitting off whole seconds keeps the product in range for
+// any tick count, rather than trading resolution for range as the uptime
+// grows: the remainder is under one second's worth of ticks, and times
+// 1e9 that fits in 63 bits at any frequency below 9GHz.
 #pragma textflag NOSPLIT
-static inline bool mult_will_overflow_int64(int64 a, int64 b)
+static int64
+tsc2nsec(int64 tsc)
 {
-    if (!a)
-        return false;
-    return ((uint64)(-1) >> 1) / a < b;
+	int64 freq, sec;
+
+	freq = __procinfo.tsc_freq;
+	sec = tsc / freq;
+	return sec*1000000000LL + (tsc - sec*freq)*1000000000LL/freq;
 }
 
+// Wrapper for making an akaros syscall through gcc
+#define __akaros_syscall(sysc, n, a0, a1, a2, a3, a4, a5, perrno) \
+do { \
+	sysc->num = n;       \
+	sysc->err = 0;       \
+	sysc->retval = 0;    \
+	sysc->flags = 0;     \
+	sysc->ev_q = 0;      \
+	sysc->u_data = 0;    \
+	sysc->arg0 = a0;     \
+	sysc->arg1 = a1;     \
+	sysc->arg2 = a2;     \
+	sysc->arg3 = a3;     \
+	sysc->arg4 = a4;     \
+	sysc->arg5 = a5;     \
+	sysc->errstr[0] = 0; \
+	runtime·asmcgocall(gcc_syscall, sysc); \
+	if(perrno != nil) \
+    	*perrno = sysc->err; \
+} while(0);
+
+#define akaros_syscall(sysc, n, a0, a1, a2, a3, a4, a5, perrno) \
+	__akaros_syscall(((sysc)), ((uint32)(n)),                   \
+	                 ((intgo)(a0)), ((intgo)(a1)),              \
+	                 ((intgo)(a2)), ((intgo)(a3)),              \
+	                 ((intgo)(a4)), ((intgo)(a5)),              \
+	                 ((int32*)(perrno)))
+
+// Submit a batch of system calls for the syscall package (see
+// syscall/batch_akaros.go).  The calls may point into the caller's stack,
+// which stays put while we are in the syscall state.
 #pragma textflag NOSPLIT
-static inline int64 tsc2sec(int64 tsc_time)
+void
+syscall·runtime_batch(void *arg)
 {
-    return tsc_time / __procinfo.tsc_freq;
+	runtime·entersyscall();
+	runtime·asmcgocall(gcc_syscall_batch, arg);
+	runtime·exitsyscall();
 }
 
+// Issue a system call for syscall.RawSyscall: synchronously, on this M,
+// and without entering the scheduler, so the P stays with the caller.
 #pragma textflag NOSPLIT
-static inline int64 tsc2msec(int64 tsc_time)
+void
+syscall·runtime_rawSyscall(void *sysc)
 {
-    if (mult_will_overflow_int64(tsc_time, 1000LL))
-        return tsc2sec(tsc_time) * 1000LL;
-    else
-        return (tsc_time * 1000LL) / __procinfo.tsc_freq;
+	runtime·asmcgocall(gcc_syscall, sysc);
 }
 
+// Issue a system call for syscall.Submit without waiting for it, and
+// report whether it is already done.  The call must live in the heap.
 #pragma textflag NOSPLIT
-static inline int64 tsc2usec(int64 tsc_time)
+void
+syscall·runtime_asyncSubmit(void *sysc, bool done)
 {
-    if (mult_will_overflow_int64(tsc_time, 1000000LL))
-        return tsc2msec(tsc_time) * 1000LL;
-    else
-        return (tsc_time * 1000000LL) / __procinfo.tsc_freq;
+	struct { void *sysc; void *evq; int32 done; } a;
+
+	a.sysc = sysc;
+	a.evq = nil;
+	runtime·asmcgocall(gcc_syscall_submit, &a);
+	done = a.done != 0;
+	FLUSH(&done);
 }
 
+// Event queues for syscall.EventQueue (see syscall/evq_akaros.go).  arg
+// is laid out as gcc_evq_arg_t.  syscall·runtime_evqSubmit is
+// syscall·runtime_asyncSubmit with the completion posted to evq.
 #pragma textflag NOSPLIT
-static inline int64 tsc2nsec(int64 tsc_time)
+void
+syscall·runtime_evqNew(void *arg)
 {
-    if (mult_will_overflow_int64(tsc_time, 1000000000LL))
-        return tsc2usec(tsc_time) * 1000LL;
-    else
-        return (tsc_time * 1000000000LL) / __procinfo.tsc_freq;
+	runtime·asmcgocall(gcc_evq_new, arg);
 }
 
 #pragma textflag NOSPLIT
-static inline int64 sec2tsc(int64 sec)
+void
+syscall·runtime_evqWait(void *arg)
 {
-    if (mult_will_overflow_int64(sec, __procinfo.tsc_freq))
-        return (int64)(-1);
-    else
-        return sec * __procinfo.tsc_freq;
+	runtime·entersyscall();
+	runtime·asmcgocall(gcc_evq_wait, arg);
+	runtime·exitsyscall();
 }
 
 #pragma textflag NOSPLIT
-static inline int64 msec2tsc(int64 msec)
+void
+syscall·runtime_evqFree(void *arg)
 {
-    if (mult_will_overflow_int64(msec, __procinfo.tsc_freq))
-        return sec2tsc(msec / 1000LL);
-    else
-        return (msec * __procinfo.tsc_freq) / 1000LL;
+	runtime·asmcgocall(gcc_evq_free, arg);
 }
 
 #pragma textflag NOSPLIT
-static inline int64 usec2tsc(int64 usec)
+void
+syscall·runtime_evqSubmit(void *evq, void *sysc, bool done)
 {
-    if (mult_will_overflow_int64(usec, __procinfo.tsc_freq))
-        return msec2tsc(usec / 1000LL);
-    else
-        return (usec * __procinfo.tsc_freq) / 1000000LL;
+	struct { void *sysc; void *evq; int32 done; } a;
+
+	a.sysc = sysc;
+	a.evq = evq;
+	runtime·asmcgocall(gcc_syscall_submit, &a);
+	done = a.done != 0;
+	FLUSH(&done);
 }
 
+// Event queues and FD taps for the network poller (see netpoll_akaros.c).
 #pragma textflag NOSPLIT
-static inline int64 nsec2tsc(int64 nsec)
+EventQueue*
+runtime·evqnew(void)
 {
-    if (mult_will_overflow_int64(nsec, __procinfo.tsc_freq))
-        return usec2tsc(nsec / 1000LL);
-    else
-        return (nsec * __procinfo.tsc_freq) / 1000000000LL;
+	EvqPollArg a;
+
+	runtime·asmcgocall(gcc_evq_new, &a);
+	return a.evq;
 }
 
-// Wrapper for making an akaros syscall through gcc
-#define __akaros_syscall(sysc, n, a0, a1, a2, a3, a4, a5, perrno) \
-do { \
-	sysc->num = n;       \
-	sysc->err = 0;       \
-	sysc->retval = 0;    \
-	sysc->flags = 0;     \
-	sysc->ev_q = 0;      \
-	sysc->u_data = 0;    \
-	sysc->arg0 = a0;     \
-	sysc->arg1 = a1;     \
-	sysc->arg2 = a2;     \
-	sysc->arg3 = a3;     \
-	sysc->arg4 = a4;     \
-	sysc->arg5 = a5;     \
-	sysc->errstr[0] = 0; \
-	runtime·asmcgocall(gcc_syscall, sysc); \
-	if(perrno != nil) \
-    	*perrno = sysc->err; \
-} while(0);
+// Take the next event on evq into *msg.  If block is set, wait for one;
+// otherwise report whether there was one.  The wait blocks the M, not
+// just the goroutine, and so is only for the scheduler.
+#pragma textflag NOSPLIT
+bool
+runtime·evqnext(EventQueue *evq, EventMsg *msg, bool block)
+{
+	EvqPollArg a;
+
+	a.evq = evq;
+	a.ok = 1;
+	if(block)
+		runtime·asmcgocall(gcc_evq_wait, &a);
+	else
+		runtime·asmcgocall(gcc_evq_poll, &a);
+	if(a.ok)
+		*msg = a.msg;
+	return a.ok != 0;
+}
 
-#define akaros_syscall(sysc, n, a0, a1, a2, a3, a4, a5, perrno) \
-	__akaros_syscall(((sysc)), ((uint32)(n)),                   \
-	                 ((intgo)(a0)), ((intgo)(a1)),              \
-	                 ((intgo)(a2)), ((intgo)(a3)),              \
-	                 ((intgo)(a4)), ((intgo)(a5)),              \
-	                 ((int32*)(perrno)))
+// Redirect the process's POSIX signal events to evq.
+#pragma textflag NOSPLIT
+void
+runtime·evqsignals(EventQueue *evq)
+{
+	EvqPollArg a;
+
+	a.evq = evq;
+	runtime·asmcgocall(gcc_evq_signals, &a);
+}
+
+// Kernel alarms from the #alarm device, each posting to an event queue
+// of its own.  Report whether the device gave us one.
+#pragma textflag NOSPLIT
+bool
+runtime·alarminit(AlarmArg *a)
+{
+	runtime·asmcgocall(gcc_alarm_new, a);
+	return a->have != 0;
+}
+
+// Convert nanoseconds to TSC ticks; the inverse of tsc2nsec.  Timers
+// far enough out to overflow (when is often close to 1<<63) get the
+// largest tick count instead.
+#pragma textflag NOSPLIT
+static int64
+nsec2tsc(int64 ns)
+{
+	int64 freq, sec;
+
+	freq = __procinfo.tsc_freq;
+	sec = ns / 1000000000LL;
+	if(sec >= 0x7fffffffffffffffLL/freq - 1)
+		return 0x7fffffffffffffffLL;
+	return sec*freq + (ns - sec*1000000000LL)*freq/1000000000LL;
+}
+
+// The TSC reading ns nanoseconds from now, for runtime·alarmat, or the
+// largest one if that is too far out to represent.
+#pragma textflag NOSPLIT
+int64
+runtime·tscafter(int64 ns)
+{
+	int64 now, d;
+
+	now = runtime·cputicks();
+	d = nsec2tsc(ns);
+	if(d > 0x7fffffffffffffffLL - now)
+		return 0x7fffffffffffffffLL;
+	return now + d;
+}
+
+// Set a to go off when the TSC reaches tsc, replacing any earlier
+// setting; at once if tsc is past.  The setting goes through a copy of
+// a, since the M waiting on an alarm and the one waking it early may be
+// setting it at the same time.  Once we have the alarm, the sleeper and
+// the waker both count on it, and neither can go over to a futex without
+// the other; so an alarm that cannot be set is fatal.
+#pragma textflag NOSPLIT
+void
+runtime·alarmat(AlarmArg *a, int64 tsc)
+{
+	AlarmArg b;
+
+	b = *a;
+	b.tsc = tsc;
+	runtime·asmcgocall(gcc_alarm_set, &b);
+	if(!b.ok)
+		runtime·throw("runtime: cannot set kernel alarm");
+}
+
+// Block the M until a goes off, or went off since it was last waited
+// for.  Only the uthread blocks: its vcore runs other Ms meanwhile, or
+// goes back to the kernel, and the event wakes the process again.
+#pragma textflag NOSPLIT
+void
+runtime·alarmblock(AlarmArg *a)
+{
+	EvqPollArg e;
+
+	e.evq = a->evq;
+	runtime·asmcgocall(gcc_evq_wait, &e);
+}
+
+// The kernel alarm runtime timers wait for (see timer_akaros.go), waited
+// for only by the timer goroutine.
+static AlarmArg timeralarm;
+
+bool
+runtime·alarmnew(void)
+{
+	return runtime·alarminit(&timeralarm);
+}
+
+// Set the alarm to go off ns nanoseconds from now, or at once if ns is 0.
+void
+runtime·alarmset(int64 ns)
+{
+	runtime·alarmat(&timeralarm, runtime·tscafter(ns));
+}
+
+// Block until the alarm goes off.  The wait is long, so the P goes to
+// another M at once.
+#pragma textflag NOSPLIT
+void
+runtime·alarmwait(void)
+{
+	runtime·entersyscallblock();
+	runtime·alarmblock(&timeralarm);
+	runtime·exitsyscall();
+}
+
+// Issue FD tap command cmd for fd, reporting the conditions in filter to
+// evq with evid as the event type.  Returns 0 or an errno.
+#pragma textflag NOSPLIT
+int32
+runtime·tapfd(int32 fd, int32 cmd, int32 filter, int32 evid, EventQueue *evq)
+{
+	int32 errno;
+	FdTapReq r;
+	SyscallArg *sysc = (SyscallArg *)(g->sysc);
+
+	if(fd < 0)
+		return EBADF;
+	r.fd = fd;
+	r.cmd = cmd;
+	r.filter = filter;
+	r.ev_id = evid;
+	r.ev_q = evq;
+	r.data = nil;
+	akaros_syscall(sysc, SYS_tap_fds, &r, 1, 0, 0, 0, 0, &errno);
+	if(sysc->retval == 1)
+		return 0;
+	return errno != 0 ? errno : EBADF;
+}
+
+// Issue sysc without waiting for it, with its completion posted to evq,
+// and report whether it is already done.
+bool
+runtime·syscallsubmit(void *sysc, EventQueue *evq)
+{
+	struct { void *sysc; void *evq; int32 done; } a;
+
+	a.sysc = sysc;
+	a.evq = evq;
+	runtime·asmcgocall(gcc_syscall_submit, &a);
+	return a.done != 0;
+}
+
+// Wait for the next call issued with syscall·runtime_asyncSubmit that did
+// not complete at once, and return it.
+#pragma textflag NOSPLIT
+void
+syscall·runtime_asyncReap(void *sysc)
+{
+	struct { void *sysc; } a;
+
+	runtime·entersyscall();
+	runtime·asmcgocall(gcc_syscall_reap, &a);
+	runtime·exitsyscall();
+	sysc = a.sysc;
+	FLUSH(&sysc);
+}
+
+// The pthread the calling goroutine is running on, and that pthread's
+// vcore, for syscall.Gettid and syscall.Getvcoreid.
+#pragma textflag NOSPLIT
+void
+syscall·runtime_threadids(int32 vcoreid, int32 tid)
+{
+	struct { int32 vcoreid; int32 tid; } a;
+
+	runtime·asmcgocall(gcc_thread_ids, &a);
+	vcoreid = a.vcoreid;
+	tid = a.tid;
+	FLUSH(&vcoreid);
+	FLUSH(&tid);
+}
 
 #pragma textflag NOSPLIT
 int32 runtime·getpid(void)
@@ -217,18 +463,35 @@ void runtime·usleep(uint32 usec)
 	akaros_syscall(sysc, SYS_block, usec, 0, 0, 0, 0, 0, nil);
 }
 
+// The kernel's calibrated TSC frequency.  cputicks, nanotime and
+// tickspersecond are all derived from it, so that block profile cycles,
+// CPU profile ticks and trace timestamps convert into each other exactly.
+#pragma textflag NOSPLIT
+int64 runtime·tscfreq(void)
+{
+	return __procinfo.tsc_freq;
+}
+
+// The monotonic clock: nanoseconds since boot, never stepped.  The TSC is
+// invariant and synchronized across cores on every machine Akaros runs
+// on, so readings taken on different vcores compare directly.
 #pragma textflag NOSPLIT
 int64 runtime·nanotime(void)
 {
 	return tsc2nsec(runtime·cputicks());
 }
 
+// The wall clock: the kernel publishes the wall time at its last TSC
+// reading, and we advance it by the ticks since.  The kernel may step it
+// when the time is set; nothing that measures intervals should use it
+// (see package time, which pairs every reading with runtime·nanotime).
 #pragma textflag NOSPLIT
 void time·now(int64 sec, int32 nsec)
 {
-	// NOTE: we should add real time base to the nsec since start,
-	// but gettimeofday syscall is missing on akaros.
-	int64 time = tsc2nsec(runtime·cputicks() - __proc_global_info.tsc_cycles_last) + __proc_global_info.walltime_ns_last;
+	int64 time;
+
+	time = tsc2nsec(runtime·cputicks() - __proc_global_info.tsc_cycles_last) +
+	       __proc_global_info.walltime_ns_last;
 	sec = time / 1000000000LL;
 	nsec = time - sec * 1000000000LL;
 	FLUSH(&sec);
@@ -8,6 +8,7 @@
 
 #include "zasm_GOOS_GOARCH.h"
 #include "../cmd/ld/textflag.h"
+#include "funcdata.h"
 
 // Do nothing for now
 TEXT runtime·settls(SB), NOSPLIT, $0
@@ -72,3 +73,104 @@ TEXT runtime·sigtramp(SB),NOSPLIT,$0
 	POPQ	BX
     RET
 
+// Asynchronous preemption and profiling (see runtime·preemptasync in
+// os_akaros.c).  The notification handler in parlib/gcc_akaros.c makes
+// the goroutine look as if the instruction it interrupted had called one
+// of the functions below: that instruction is the return address, its
+// registers are saved in a block laid out as g->asyncregs, except for the
+// X registers, which are still live, and R12 points to the block.  Each
+// function saves the X registers, calls its Go side with the block, puts
+// everything back as it was and returns.  The handler never interrupts
+// the code between runtime·asyncpreempt and runtime·asyncpreemptend.
+#define ASYNCCALL(FN)	\
+	NO_LOCAL_POINTERS;	\
+	MOVOU	X0, (const_AsyncX0*8+0)(R12);	\
+	MOVOU	X1, (const_AsyncX0*8+16)(R12);	\
+	MOVOU	X2, (const_AsyncX0*8+32)(R12);	\
+	MOVOU	X3, (const_AsyncX0*8+48)(R12);	\
+	MOVOU	X4, (const_AsyncX0*8+64)(R12);	\
+	MOVOU	X5, (const_AsyncX0*8+80)(R12);	\
+	MOVOU	X6, (const_AsyncX0*8+96)(R12);	\
+	MOVOU	X7, (const_AsyncX0*8+112)(R12);	\
+	MOVOU	X8, (const_AsyncX0*8+128)(R12);	\
+	MOVOU	X9, (const_AsyncX0*8+144)(R12);	\
+	MOVOU	X10, (const_AsyncX0*8+160)(R12);	\
+	MOVOU	X11, (const_AsyncX0*8+176)(R12);	\
+	MOVOU	X12, (const_AsyncX0*8+192)(R12);	\
+	MOVOU	X13, (const_AsyncX0*8+208)(R12);	\
+	MOVOU	X14, (const_AsyncX0*8+224)(R12);	\
+	MOVOU	X15, (const_AsyncX0*8+240)(R12);	\
+	PUSHQ	R12;	\
+	CALL	FN(SB);	\
+	POPQ	R12;	\
+	MOVOU	(const_AsyncX0*8+0)(R12), X0;	\
+	MOVOU	(const_AsyncX0*8+16)(R12), X1;	\
+	MOVOU	(const_AsyncX0*8+32)(R12), X2;	\
+	MOVOU	(const_AsyncX0*8+48)(R12), X3;	\
+	MOVOU	(const_AsyncX0*8+64)(R12), X4;	\
+	MOVOU	(const_AsyncX0*8+80)(R12), X5;	\
+	MOVOU	(const_AsyncX0*8+96)(R12), X6;	\
+	MOVOU	(const_AsyncX0*8+112)(R12), X7;	\
+	MOVOU	(const_AsyncX0*8+128)(R12), X8;	\
+	MOVOU	(const_AsyncX0*8+144)(R12), X9;	\
+	MOVOU	(const_AsyncX0*8+160)(R12), X10;	\
+	MOVOU	(const_AsyncX0*8+176)(R12), X11;	\
+	MOVOU	(const_AsyncX0*8+192)(R12), X12;	\
+	MOVOU	(const_AsyncX0*8+208)(R12), X13;	\
+	MOVOU	(const_AsyncX0*8+224)(R12), X14;	\
+	MOVOU	(const_AsyncX0*8+240)(R12), X15;	\
+	MOVQ	(const_AsyncFlags*8)(R12), AX;	\
+	PUSHQ	AX;	\
+	POPFQ;	\
+	MOVQ	(const_AsyncAX*8)(R12), AX;	\
+	MOVQ	(const_AsyncBX*8)(R12), BX;	\
+	MOVQ	(const_AsyncCX*8)(R12), CX;	\
+	MOVQ	(const_AsyncDX*8)(R12), DX;	\
+	MOVQ	(const_AsyncSI*8)(R12), SI;	\
+	MOVQ	(const_AsyncDI*8)(R12), DI;	\
+	MOVQ	(const_AsyncBP*8)(R12), BP;	\
+	MOVQ	(const_AsyncR8*8)(R12), R8;	\
+	MOVQ	(const_AsyncR9*8)(R12), R9;	\
+	MOVQ	(const_AsyncR10*8)(R12), R10;	\
+	MOVQ	(const_AsyncR11*8)(R12), R11;	\
+	MOVQ	(const_AsyncR13*8)(R12), R13;	\
+	MOVQ	(const_AsyncR14*8)(R12), R14;	\
+	MOVQ	(const_AsyncR15*8)(R12), R15;	\
+	MOVL	$0, (g_asyncbusy-g_asyncregs)(R12);	\
+	MOVQ	(const_AsyncR12*8)(R12), R12;	\
+	RET
+
+// runtime·asyncpreempt2 decides whether the goroutine can be preempted.
+TEXT runtime·asyncpreempt(SB),NOSPLIT,$0-0
+	ASYNCCALL(runtime·asyncpreempt2)
+
+// runtime·asyncprof2 takes a profiling sample.
+TEXT runtime·asyncprof(SB),NOSPLIT,$0-0
+	ASYNCCALL(runtime·asyncprof2)
+
+TEXT runtime·asyncpreemptend(SB),NOSPLIT,$0-0
+	RET
+
+// Hardware faults (see faultinit in os_akaros.c).  parlib's fault hook
+// makes the faulting uthread look as if the faulting instruction had
+// called runtime·faulttramp, with the signal the fault amounts to in R12,
+// its code in R13 and the fault address in R14.  Record them in g, as
+// runtime·sighandler would, and jump to runtime·sigpanic, which then
+// sees the faulting instruction as its caller.  It never returns.
+TEXT runtime·faulttramp(SB),NOSPLIT,$0-0
+	get_tls(BX)
+	MOVQ	g(BX), AX
+	CMPQ	AX, $0
+	JEQ	nog
+	MOVL	R12, g_sig(AX)
+	MOVQ	R13, g_sigcode0(AX)
+	MOVQ	R14, g_sigcode1(AX)
+	MOVQ	0(SP), R15
+	MOVQ	R15, g_sigpc(AX)
+	JMP	runtime·sigpanic(SB)
+nog:
+	// Nothing to return to; the arguments overwrite the return address.
+	MOVL	R12, 0(SP)
+	MOVQ	R14, 8(SP)
+	CALL	runtime·badfault(SB)
+	RET
@@ -0,0 +1,36 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// A PendingSyscall describes a system call that has been handed to the
+// kernel and has not completed yet.
+type PendingSyscall struct {
+	Goid    int64      // goroutine that issued the call
+	Num     uint32     // system call number
+	Args    [6]uintptr // raw arguments
+	Elapsed int64      // nanoseconds since the call was issued, or -1 if unknown
+}
+
+// Name returns the kernel's name for the call, such as "read", or "" if
+// the kernel the runtime was built against has no call numbered Num.
+func (s *PendingSyscall) Name() string {
+	return syscallname(s.Num)
+}
+
+// PendingSyscalls returns n, the number of system calls currently in
+// flight.  If len(p) >= n, PendingSyscalls copies them into p and returns
+// n, true.  If len(p) < n, it does not change p and returns n, false.
+//
+// Only Akaros, where every system call is asynchronous, keeps track of
+// them; elsewhere n is always 0.  The table is read without stopping the
+// world, so a call may complete while it is being listed.
+func PendingSyscalls(p []PendingSyscall) (n int, ok bool) {
+	n = pendingsyscalls(nil)
+	if n <= len(p) {
+		n = pendingsyscalls(p[:n])
+		ok = true
+	}
+	return
+}
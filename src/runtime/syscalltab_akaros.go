@@ -0,0 +1,183 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "unsafe"
+
+// akarosSyscall is the head of struct syscall, as laid out in g.sysc and
+// in the structs package syscall points g.usysc at.
+type akarosSyscall struct {
+	num    uint32
+	err    int32
+	retval int64
+	flags  uint64
+	ev_q   uintptr
+	u_data uintptr
+	args   [6]uintptr
+	errstr [128]byte // MAX_ERRSTR_LEN
+}
+
+// syscallname returns the kernel's name for system call num, or "" if
+// it has none.  The table is generated from the kernel headers the
+// runtime was built against.
+func syscallname(num uint32) string {
+	if uintptr(num) < uintptr(len(syscallnames)) {
+		return syscallnames[num]
+	}
+	return ""
+}
+
+// printsyscall prints the name of system call num, or "syscall N".
+func printsyscall(num uint32) {
+	if name := syscallname(num); name != "" {
+		print(name)
+	} else {
+		print("syscall ", num)
+	}
+}
+
+func syscallpending(s *akarosSyscall) bool {
+	return s.num != 0 && atomicload64(&s.flags)&_SC_DONE == 0
+}
+
+// pendingsyscalls fills p with the calls in flight, as far as it goes,
+// and returns how many there are.  A goroutine can have two: one made by
+// the runtime on its behalf in g.sysc, and one made by package syscall.
+func pendingsyscalls(p []PendingSyscall) int {
+	n := 0
+	add := func(gp *g, s *akarosSyscall, elapsed int64) {
+		if n < len(p) {
+			p[n] = PendingSyscall{Goid: gp.goid, Num: s.num, Args: s.args, Elapsed: elapsed}
+		}
+		n++
+	}
+	now := nanotime()
+	lock(&allglock)
+	for _, gp := range allgs {
+		if s := (*akarosSyscall)(unsafe.Pointer(&gp.sysc[0])); syscallpending(s) {
+			add(gp, s, -1)
+		}
+		if s := (*akarosSyscall)(atomicloadp(unsafe.Pointer(&gp.usysc))); s != nil && syscallpending(s) {
+			add(gp, s, now-gp.usysctime)
+		}
+	}
+	unlock(&allglock)
+	return n
+}
+
+// syscallbegin and syscallend bracket every call made by package syscall,
+// so that it shows up in PendingSyscalls and the crash-time dump.
+//go:nosplit
+func syscallbegin(s unsafe.Pointer) {
+	gp := getg()
+	gp.usysctime = nanotime()
+	atomicstorep(unsafe.Pointer(&gp.usysc), s)
+}
+
+//go:nosplit
+func syscallend() {
+	gp := getg()
+	if debug.akarostrace != 0 && gp.usysc != nil {
+		// Tracing needs more stack than a nosplit path has, and the
+		// call may live in the caller's frame, so the stack must not
+		// move while it is read: log it from the g0 stack.
+		onM(tracesyscall_m)
+	}
+	atomicstorep(unsafe.Pointer(&gp.usysc), nil)
+}
+
+// tracesyscall_m logs the call m.curg has in usysc.  Run on g0.
+func tracesyscall_m() {
+	gp := getg().m.curg
+	tracesyscall(gp, (*akarosSyscall)(gp.usysc), gp.usysctime)
+}
+
+// syscalltrace logs s, a call package syscall issued at start without
+// recording it in gp.usysc, such as the later calls of a SyscallRing.
+func syscalltrace(s unsafe.Pointer, start int64) {
+	if debug.akarostrace != 0 {
+		tracesyscall(getg(), (*akarosSyscall)(s), start)
+	}
+}
+
+// tracesyscall logs the completed call s, issued at start, for
+// GODEBUG=akarostrace.  The line is formatted into a buffer and written
+// whole, so that lines from different goroutines do not interleave.  The
+// write goes through the runtime's own system call path, which is not
+// traced.  gp is the goroutine that made the call, which need not be the
+// one running.
+func tracesyscall(gp *g, s *akarosSyscall, start int64) {
+	var buf [512]byte
+	me := getg()
+	me.writebuf = buf[0:0:len(buf)]
+	print("[", gp.goid, "] ")
+	printsyscall(s.num)
+	print("(")
+	for i, a := range s.args {
+		if i != 0 {
+			print(", ")
+		}
+		print(hex(a))
+	}
+	print(") = ", s.retval)
+	if s.err != 0 {
+		print(" errno ", s.err)
+		// The kernel always terminates errstr; check, since the
+		// struct belongs to user code.
+		n := 0
+		for n < len(s.errstr) && s.errstr[n] != 0 {
+			n++
+		}
+		if n > 0 && n < len(s.errstr) {
+			print(" (", gostringnocopy(&s.errstr[0]), ")")
+		}
+	}
+	print(" <", (nanotime()-start)/1000, "us>\n")
+	n := len(me.writebuf)
+	me.writebuf = nil
+	fd := uintptr(debug.akarostrace)
+	if fd <= 2 {
+		fd = 2
+	}
+	write(fd, unsafe.Pointer(&buf[0]), int32(n))
+}
+
+// printkernelcall follows a traceback frame that entered the kernel with
+// the call it made, if GODEBUG=tracekernel=1 asks for it.  Package
+// syscall enters through usys.Call and records the call in gp.usysc; the
+// runtime's own calls go through asmcgocall and live in gp.sysc.  The
+// call is only shown while it is in flight, when the struct is known to
+// still describe it.
+func printkernelcall(gp *g, f *_func) {
+	if debug.tracekernel == 0 {
+		return
+	}
+	var s *akarosSyscall
+	var elapsed int64 = -1
+	switch name := gofuncname(f); {
+	case hasprefix(name, "usys.Call"):
+		s = (*akarosSyscall)(atomicloadp(unsafe.Pointer(&gp.usysc)))
+		elapsed = nanotime() - gp.usysctime
+	case name == "runtime.asmcgocall":
+		s = (*akarosSyscall)(unsafe.Pointer(&gp.sysc[0]))
+	}
+	if s == nil || !syscallpending(s) {
+		return
+	}
+	print("\t    kernel call: ")
+	printsyscall(s.num)
+	print("(")
+	for i, a := range s.args {
+		if i != 0 {
+			print(", ")
+		}
+		print(hex(a))
+	}
+	print(")")
+	if elapsed >= 0 {
+		print(", waiting ", elapsed/1000, "us")
+	}
+	print("\n")
+}
@@ -0,0 +1,18 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !akaros
+
+package runtime
+
+func pendingsyscalls(p []PendingSyscall) int {
+	return 0
+}
+
+func syscallname(num uint32) string {
+	return ""
+}
+
+func printkernelcall(gp *g, f *_func) {
+}
@@ -17,6 +17,53 @@ TEXT net·runtimeNano(SB),NOSPLIT,$0-0
 TEXT time·runtimeNano(SB),NOSPLIT,$0-0
 	JMP     runtime·nanotime(SB)
 
+TEXT syscall·runtimeNano(SB),NOSPLIT,$0-0
+	JMP     runtime·nanotime(SB)
+
+#ifdef GOOS_akaros
+TEXT syscall·mcpStatus(SB),NOSPLIT,$0-0
+	JMP	runtime·mcpstatus(SB)
+
+TEXT syscall·cpuTopology(SB),NOSPLIT,$0-0
+	JMP	runtime·cputopology(SB)
+
+TEXT syscall·vcoreWait(SB),NOSPLIT,$0-0
+	JMP	runtime·vcorewait(SB)
+
+TEXT syscall·setMemoryLimit(SB),NOSPLIT,$0-0
+	JMP	runtime·setMemoryLimit(SB)
+
+TEXT syscall·startupTimes(SB),NOSPLIT,$0-0
+	JMP	runtime·startuptimes(SB)
+
+TEXT syscall·runtime_procPin(SB),NOSPLIT,$0-0
+	JMP	sync·runtime_procPin(SB)
+
+TEXT syscall·runtime_procUnpin(SB),NOSPLIT,$0-0
+	JMP	sync·runtime_procUnpin(SB)
+
+TEXT syscall·runtime_syscallBegin(SB),NOSPLIT,$0-0
+	JMP	runtime·syscallbegin(SB)
+
+TEXT syscall·runtime_syscallEnd(SB),NOSPLIT,$0-0
+	JMP	runtime·syscallend(SB)
+
+TEXT syscall·syscallName(SB),NOSPLIT,$0-0
+	JMP	runtime·syscallname(SB)
+
+TEXT syscall·runtime_syscallTrace(SB),NOSPLIT,$0-0
+	JMP	runtime·syscalltrace(SB)
+
+TEXT syscall·runtime_args(SB),NOSPLIT,$0-0
+	JMP	runtime·runtime_args(SB)
+
+TEXT syscall·runtime_setBeforeMain(SB),NOSPLIT,$0-0
+	JMP	runtime·setbeforemain(SB)
+
+TEXT syscall·runtime_pollServerInit(SB),NOSPLIT,$0-0
+	JMP	runtime·netpollServerInit(SB)
+#endif
+
 TEXT time·Sleep(SB),NOSPLIT,$0-0
 	JMP     runtime·timeSleep(SB)
 
@@ -41,6 +88,9 @@ TEXT sync·runtime_Semacquire(SB),NOSPLIT,$0-0
 TEXT sync·runtime_Semrelease(SB),NOSPLIT,$0-0
 	JMP	runtime·asyncsemrelease(SB)
 
+TEXT sync·runtime_SemacquireMutex(SB),NOSPLIT,$0-0
+	JMP	runtime·asyncsemacquiremutex(SB)
+
 TEXT sync·runtime_registerPoolCleanup(SB),NOSPLIT,$0-0
 	JMP	runtime·registerPoolCleanup(SB)
 
@@ -53,6 +103,18 @@ TEXT net·runtime_Semrelease(SB),NOSPLIT,$0-0
 TEXT runtime∕pprof·runtime_cyclesPerSecond(SB),NOSPLIT,$0-0
 	JMP	runtime·tickspersecond(SB)
 
+TEXT runtime∕pprof·runtime_setProfLabel(SB),NOSPLIT,$0-0
+	JMP	runtime·setproflabel(SB)
+
+TEXT runtime∕pprof·runtime_getProfLabel(SB),NOSPLIT,$0-0
+	JMP	runtime·getproflabel(SB)
+
+TEXT runtime∕pprof·runtime_setCPUProfileLabels(SB),NOSPLIT,$0-0
+	JMP	runtime·setcpuproflabels(SB)
+
+TEXT runtime∕pprof·runtime_heapTypes(SB),NOSPLIT,$0-0
+	JMP	runtime·heaptypes(SB)
+
 TEXT bytes·Compare(SB),NOSPLIT,$0-0
 	JMP	runtime·cmpbytes(SB)
 
@@ -101,7 +101,7 @@ func addtimerLocked(t *timer) {
 		// siftup moved to top: new earliest deadline.
 		if timers.sleeping {
 			timers.sleeping = false
-			notewakeup(&timers.waitnote)
+			timerwakeup()
 		}
 		if timers.rescheduling {
 			timers.rescheduling = false
@@ -202,9 +202,7 @@ func timerproc() {
 		}
 		// At least one timer pending.  Sleep until then.
 		timers.sleeping = true
-		noteclear(&timers.waitnote)
-		unlock(&timers.lock)
-		notetsleepg(&timers.waitnote, delta)
+		timersleep(delta)
 	}
 }
 
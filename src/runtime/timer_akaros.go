@@ -0,0 +1,62 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// On Akaros the timer goroutine waits for a kernel alarm from the #alarm
+// device, set to the TSC deadline of the earliest timer, rather than in a
+// futex with a timeout, which parlib implements with an alarm of its own
+// and rounds up.  The alarm posts to an event queue that only the timer
+// goroutine's M waits on, so nothing else wakes up for it, and it goes
+// off within the TSC's resolution.  addtimer wakes the goroutine early by
+// setting the alarm to go off at once.  Without the device, timers fall
+// back to notes as elsewhere.
+
+func alarmnew() bool
+func alarmset(ns int64)
+func alarmwait()
+
+var alarmstate struct {
+	tried   bool
+	have    bool
+	wakeups uint32 // timerwakeup calls, so timersleep can spot one it overrode
+}
+
+// timersleep unlocks timers.lock and sleeps for up to ns nanoseconds,
+// or until timerwakeup is called.
+func timersleep(ns int64) {
+	if !alarmstate.tried {
+		alarmstate.tried = true
+		alarmstate.have = alarmnew()
+	}
+	if !alarmstate.have {
+		noteclear(&timers.waitnote)
+		unlock(&timers.lock)
+		notetsleepg(&timers.waitnote, ns)
+		return
+	}
+	// Setting the alarm is a system call, so it happens after unlocking.
+	// A timerwakeup that comes in between is overridden by the setting,
+	// so if there was one, set the alarm to go off at once again.  An
+	// alarm that went off after the last wait but before this setting
+	// leaves an event behind, and the wait returns at once; timerproc
+	// just goes round again.
+	wakeups := alarmstate.wakeups
+	unlock(&timers.lock)
+	alarmset(ns)
+	if atomicload(&alarmstate.wakeups) != wakeups {
+		alarmset(0)
+	}
+	alarmwait()
+}
+
+// timerwakeup wakes timersleep early.  Timers are locked.
+func timerwakeup() {
+	if alarmstate.have {
+		xadd(&alarmstate.wakeups, 1)
+		alarmset(0)
+		return
+	}
+	notewakeup(&timers.waitnote)
+}
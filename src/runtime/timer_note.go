@@ -0,0 +1,20 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !akaros
+
+package runtime
+
+// timersleep unlocks timers.lock and sleeps for up to ns nanoseconds,
+// or until timerwakeup is called.
+func timersleep(ns int64) {
+	noteclear(&timers.waitnote)
+	unlock(&timers.lock)
+	notetsleepg(&timers.waitnote, ns)
+}
+
+// timerwakeup wakes timersleep early.  Timers are locked.
+func timerwakeup() {
+	notewakeup(&timers.waitnote)
+}
@@ -0,0 +1,817 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Go execution tracer.
+//
+// The tracer records what the scheduler does with every goroutine:
+// creation, start and end, blocking and unblocking, system calls and the
+// Ps taking them, garbage collections, and goroutines made runnable by the
+// network poller.  Events go into a buffer of the P the event happened on,
+// or of the global buffer when the M has no P; full buffers queue up for
+// ReadTrace.  The output is in the format of the tracer that appears in
+// later Go releases, version 1.5, which `go tool trace` reads.
+//
+// Events are timestamped with cputicks, the time-stamp counter on x86,
+// and the trace gives its rate as tickspersecond.  On Akaros that is the
+// kernel's calibrated TSC frequency (see os_akaros.go), the same one
+// nanotime is derived from, so trace timestamps agree exactly with the
+// runtime's clock.
+//
+// The hooks in proc.c and mgc0.c test traceEnabled before calling in here.
+// On Akaros, a goroutine parked for a system call issued asynchronously by
+// package syscall (see netpoll_akaros.c) is traced as blocking in the
+// system call, and the poller delivering its completion as the system
+// call's exit.
+
+package runtime
+
+import "unsafe"
+
+// Event types in the trace, args are given in square brackets.
+const (
+	traceEvNone           = 0  // unused
+	traceEvBatch          = 1  // start of per-P batch of events [pid, timestamp]
+	traceEvFrequency      = 2  // contains tracer timer frequency [frequency (ticks per second)]
+	traceEvStack          = 3  // stack [stack id, number of PCs, array of PCs]
+	traceEvGomaxprocs     = 4  // current value of GOMAXPROCS [timestamp, GOMAXPROCS, stack id]
+	traceEvProcStart      = 5  // start of P [timestamp, thread id]
+	traceEvProcStop       = 6  // stop of P [timestamp]
+	traceEvGCStart        = 7  // GC start [timestamp, stack id]
+	traceEvGCDone         = 8  // GC done [timestamp]
+	traceEvGCScanStart    = 9  // GC scan start [timestamp]
+	traceEvGCScanDone     = 10 // GC scan done [timestamp]
+	traceEvGCSweepStart   = 11 // GC sweep start [timestamp, stack id]
+	traceEvGCSweepDone    = 12 // GC sweep done [timestamp]
+	traceEvGoCreate       = 13 // goroutine creation [timestamp, new goroutine id, start PC, stack id]
+	traceEvGoStart        = 14 // goroutine starts running [timestamp, goroutine id]
+	traceEvGoEnd          = 15 // goroutine ends [timestamp]
+	traceEvGoStop         = 16 // goroutine stops (like in select{}) [timestamp, stack]
+	traceEvGoSched        = 17 // goroutine calls Gosched [timestamp, stack]
+	traceEvGoPreempt      = 18 // goroutine is preempted [timestamp, stack]
+	traceEvGoSleep        = 19 // goroutine calls Sleep [timestamp, stack]
+	traceEvGoBlock        = 20 // goroutine blocks [timestamp, stack]
+	traceEvGoUnblock      = 21 // goroutine is unblocked [timestamp, goroutine id, stack]
+	traceEvGoBlockSend    = 22 // goroutine blocks on chan send [timestamp, stack]
+	traceEvGoBlockRecv    = 23 // goroutine blocks on chan recv [timestamp, stack]
+	traceEvGoBlockSelect  = 24 // goroutine blocks on select [timestamp, stack]
+	traceEvGoBlockSync    = 25 // goroutine blocks on Mutex/RWMutex [timestamp, stack]
+	traceEvGoBlockCond    = 26 // goroutine blocks on Cond [timestamp, stack]
+	traceEvGoBlockNet     = 27 // goroutine blocks on network [timestamp, stack]
+	traceEvGoSysCall      = 28 // syscall enter [timestamp, stack]
+	traceEvGoSysExit      = 29 // syscall exit [timestamp, goroutine id, real timestamp]
+	traceEvGoSysBlock     = 30 // syscall blocks [timestamp]
+	traceEvGoWaiting      = 31 // denotes that goroutine is blocked when tracing starts [goroutine id]
+	traceEvGoInSyscall    = 32 // denotes that goroutine is in syscall when tracing starts [goroutine id]
+	traceEvHeapAlloc      = 33 // memstats.heap_alloc change [timestamp, heap_alloc]
+	traceEvNextGC         = 34 // memstats.next_gc change [timestamp, next_gc]
+	traceEvTimerGoroutine = 35 // denotes timer goroutine [timer goroutine id]
+	traceEvFutileWakeup   = 36 // denotes that the previous wakeup of this goroutine was futile [timestamp]
+	traceEvCount          = 37
+)
+
+const (
+	// Timestamps in trace are cputicks/traceTickDiv.
+	// This makes absolute values of timestamp diffs smaller,
+	// and so they are encoded in less number of bytes.
+	// 64 is somewhat arbitrary (one tick is ~20ns on a 3GHz machine).
+	traceTickDiv = 64
+	// Maximum number of PCs in a single stack trace.
+	traceStackSize = 128
+	// Identifier of a fake P that is used when we trace without a real P.
+	traceGlobProc = -1
+	// Maximum number of bytes to encode uint64 in base-128.
+	traceBytesPerNumber = 10
+	// Shift of the number of arguments in the first event byte.
+	traceArgCountShift = 6
+)
+
+// traceEnabled is set while events are being recorded, traceShutdown
+// while StopTrace waits for ReadTrace to return the last of them.  Both
+// are read by the hooks in C.
+var traceEnabled, traceShutdown bool
+
+// trace is global tracing context.
+var trace struct {
+	lock          mutex     // protects the following members
+	lockOwner     *g        // to avoid deadlocks during recursive lock locks
+	reading       *traceBuf // buffer currently handed off to user
+	empty         *traceBuf // stack of empty buffers
+	fullHead      *traceBuf // queue of full buffers
+	fullTail      *traceBuf
+	reader        *g              // goroutine that called ReadTrace, or nil
+	stackTab      traceStackTable // maps stack traces to unique ids
+	headerWritten bool            // whether ReadTrace has emitted trace header
+	footerWritten bool            // whether ReadTrace has emitted trace footer
+	shutdownSema  uint32          // used to wait for ReadTrace completion
+
+	bufs [_MaxGomaxprocs]*traceBuf // per-P buffers, indexed by P id
+
+	bufLock mutex     // protects buf
+	buf     *traceBuf // global trace buffer, used when running without a p
+}
+
+// traceBuf is per-P tracing buffer.
+type traceBuf struct {
+	link      *traceBuf               // in trace.empty/full
+	lastTicks uint64                  // when we wrote the last event
+	pos       uintptr                 // next write offset in arr
+	stk       [traceStackSize]uintptr // scratch buffer for traceback
+	arr       [64<<10 - 3*ptrSize - 8 - traceStackSize*ptrSize]byte
+}
+
+// StartTrace enables tracing for the current process.
+// While tracing, the data will be buffered and available via ReadTrace.
+// StartTrace returns an error if tracing is already enabled.
+// Most clients should use the runtime/trace package instead of calling
+// StartTrace directly.
+func StartTrace() error {
+	// Stop the world, so that we can take a consistent snapshot
+	// of all goroutines at the beginning of the trace.
+	semacquire(&worldsema, false)
+	_g_ := getg()
+	_g_.m.gcing = 1
+	onM(stoptheworld)
+
+	// We are in stop-the-world, but syscalls can finish and write to trace concurrently.
+	// Exitsyscall could check traceEnabled long before and then suddenly wake up
+	// and decide to write to trace at a random point in time.
+	// However, such syscall will use the global trace.buf buffer, because we've
+	// acquired all p's by doing stop-the-world. So this protects us from such races.
+	lock(&trace.bufLock)
+
+	if traceEnabled || traceShutdown {
+		unlock(&trace.bufLock)
+		_g_.m.gcing = 0
+		semrelease(&worldsema)
+		onM(starttheworld)
+		return errorString("tracing is already enabled")
+	}
+
+	trace.headerWritten = false
+	trace.footerWritten = false
+
+	traceEnabled = true
+	unlock(&trace.bufLock)
+
+	for _, gp := range allgs {
+		status := readgstatus(gp) &^ _Gscan
+		if status != _Gdead {
+			traceEvent(traceEvGoCreate, 0, uint64(gp.goid), uint64(gp.startpc))
+		}
+		if status == _Gwaiting {
+			traceEvent(traceEvGoWaiting, -1, uint64(gp.goid))
+		}
+		if status == _Gsyscall {
+			gp.sysblocktraced = true
+			traceEvent(traceEvGoInSyscall, -1, uint64(gp.goid))
+		}
+	}
+	traceProcStart()
+	traceGoStart()
+	traceGomaxprocs(gomaxprocs)
+
+	_g_.m.gcing = 0
+	semrelease(&worldsema)
+	onM(starttheworld)
+	return nil
+}
+
+// StopTrace stops tracing, if it was previously enabled.
+// StopTrace only returns after all the reads for the trace have completed.
+func StopTrace() {
+	// Stop the world so that we can collect the trace buffers from all p's below,
+	// and also to avoid races with traceEvent.
+	semacquire(&worldsema, false)
+	_g_ := getg()
+	_g_.m.gcing = 1
+	onM(stoptheworld)
+
+	// See the comment in StartTrace.
+	lock(&trace.bufLock)
+
+	if !traceEnabled {
+		unlock(&trace.bufLock)
+		_g_.m.gcing = 0
+		semrelease(&worldsema)
+		onM(starttheworld)
+		return
+	}
+
+	traceGoSched()
+
+	lock(&trace.lock)
+	for i := range trace.bufs {
+		if buf := trace.bufs[i]; buf != nil {
+			traceFullQueue(buf)
+			trace.bufs[i] = nil
+		}
+	}
+	if trace.buf != nil && trace.buf.pos != 0 {
+		buf := trace.buf
+		trace.buf = nil
+		traceFullQueue(buf)
+	}
+	unlock(&trace.lock)
+
+	traceEnabled = false
+	traceShutdown = true
+	trace.stackTab.dump()
+
+	unlock(&trace.bufLock)
+
+	_g_.m.gcing = 0
+	semrelease(&worldsema)
+	onM(starttheworld)
+
+	// The world is started but we've set traceShutdown, so new tracing can't start.
+	// Wait for the trace reader to flush pending buffers and stop.
+	semacquire(&trace.shutdownSema, false)
+
+	// The lock protects us from races with StartTrace/StopTrace because they do stop-the-world.
+	lock(&trace.lock)
+	for _, buf := range trace.bufs {
+		if buf != nil {
+			gothrow("trace: non-empty trace buffer in proc")
+		}
+	}
+	if trace.buf != nil {
+		gothrow("trace: non-empty global trace buffer")
+	}
+	if trace.fullHead != nil || trace.fullTail != nil {
+		gothrow("trace: non-empty full trace buffer")
+	}
+	if trace.reading != nil || trace.reader != nil {
+		gothrow("trace: reading after shutdown")
+	}
+	// The empty buffers stay for the next trace.
+	traceShutdown = false
+	unlock(&trace.lock)
+}
+
+// ReadTrace returns the next chunk of binary tracing data, blocking until data
+// is available. If tracing is turned off and all the data accumulated while it
+// was on has been returned, ReadTrace returns nil. The caller must copy the
+// returned data before calling ReadTrace again.
+// ReadTrace must be called from one goroutine at a time.
+func ReadTrace() []byte {
+	// This function may need to lock trace.lock recursively
+	// (goparkunlock -> park_m -> traceGoPark -> traceEvent -> traceFlush).
+	// To allow this we use trace.lockOwner.
+	lock(&trace.lock)
+	trace.lockOwner = getg()
+
+	if trace.reader != nil {
+		// More than one goroutine reads trace. This is bad.
+		// But we rather do not crash the program because of tracing,
+		// because tracing can be enabled at runtime on prod servers.
+		trace.lockOwner = nil
+		unlock(&trace.lock)
+		println("runtime: ReadTrace called from multiple goroutines simultaneously")
+		return nil
+	}
+	// Recycle the old buffer.
+	if buf := trace.reading; buf != nil {
+		buf.link = trace.empty
+		trace.empty = buf
+		trace.reading = nil
+	}
+	// Write trace header.
+	if !trace.headerWritten {
+		trace.headerWritten = true
+		trace.lockOwner = nil
+		unlock(&trace.lock)
+		return []byte("go 1.5 trace\x00\x00\x00\x00")
+	}
+	// Wait for new data.
+	if trace.fullHead == nil && !traceShutdown {
+		trace.reader = getg()
+		goparkunlock(&trace.lock, "trace reader (blocked)")
+		lock(&trace.lock)
+	}
+	// Write a buffer.
+	if trace.fullHead != nil {
+		buf := traceFullDequeue()
+		trace.reading = buf
+		trace.lockOwner = nil
+		unlock(&trace.lock)
+		return buf.arr[:buf.pos]
+	}
+	// Write footer with timer frequency.
+	if !trace.footerWritten {
+		trace.footerWritten = true
+		trace.lockOwner = nil
+		unlock(&trace.lock)
+		var data []byte
+		data = append(data, traceEvFrequency|0<<traceArgCountShift)
+		data = traceAppend(data, uint64(tickspersecond()/traceTickDiv))
+		if timers.gp != nil {
+			data = append(data, traceEvTimerGoroutine|0<<traceArgCountShift)
+			data = traceAppend(data, uint64(timers.gp.goid))
+		}
+		return data
+	}
+	// Done.
+	if traceShutdown {
+		trace.lockOwner = nil
+		unlock(&trace.lock)
+		// traceEnabled is already reset, so can call traceable functions.
+		semrelease(&trace.shutdownSema)
+		return nil
+	}
+	// Also bad, but see the comment above.
+	trace.lockOwner = nil
+	unlock(&trace.lock)
+	println("runtime: spurious wakeup of trace reader")
+	return nil
+}
+
+// traceReader returns the trace reader that should be woken up, if any.
+// Called by schedule in proc.c.
+func traceReader() *g {
+	if trace.reader == nil || (trace.fullHead == nil && !traceShutdown) {
+		return nil
+	}
+	lock(&trace.lock)
+	if trace.reader == nil || (trace.fullHead == nil && !traceShutdown) {
+		unlock(&trace.lock)
+		return nil
+	}
+	gp := trace.reader
+	trace.reader = nil
+	unlock(&trace.lock)
+	return gp
+}
+
+// traceFullQueue queues buf into queue of full buffers.
+// trace.lock must be held.
+func traceFullQueue(buf *traceBuf) {
+	buf.link = nil
+	if trace.fullHead == nil {
+		trace.fullHead = buf
+	} else {
+		trace.fullTail.link = buf
+	}
+	trace.fullTail = buf
+}
+
+// traceFullDequeue dequeues from queue of full buffers.
+// trace.lock must be held.
+func traceFullDequeue() *traceBuf {
+	buf := trace.fullHead
+	if buf == nil {
+		return nil
+	}
+	trace.fullHead = buf.link
+	if trace.fullHead == nil {
+		trace.fullTail = nil
+	}
+	buf.link = nil
+	return buf
+}
+
+// traceEvent writes a single event to trace buffer, flushing the buffer if necessary.
+// ev is event type.
+// If skip > 0, write current stack id as the last argument (skipping skip top frames).
+// If skip = 0, this event type should contain a stack, but we don't want
+// to collect and remember it for this particular call.
+func traceEvent(ev byte, skip int, args ...uint64) {
+	mp, pid, bufp := traceAcquireBuffer()
+	// Double-check traceEnabled now that we've done m.locks++ and acquired bufLock.
+	// This protects from races between traceEvent and StartTrace/StopTrace.
+
+	// The caller checked that traceEnabled == true, but traceEnabled might have been
+	// turned off between the check and now. Check again. traceLockBuffer did mp.locks++,
+	// StopTrace does stoptheworld, and stoptheworld waits for mp.locks to go back to zero,
+	// so if we see traceEnabled == true now, we know it's true for the rest of the function.
+	// Exitsyscall can run even during stoptheworld. The race with StartTrace/StopTrace
+	// during tracing in exitsyscall is resolved by locking trace.bufLock in traceLockBuffer.
+	if !traceEnabled {
+		traceReleaseBuffer(pid)
+		return
+	}
+	buf := *bufp
+	const maxSize = 2 + 4*traceBytesPerNumber // event type, length, timestamp, stack id and two add params
+	if buf == nil || uintptr(len(buf.arr))-buf.pos < maxSize {
+		buf = traceFlush(buf)
+		*bufp = buf
+	}
+
+	ticks := uint64(cputicks()) / traceTickDiv
+	if ticks < buf.lastTicks {
+		// The P moved to a core whose counter is a little behind;
+		// events within a batch must not go back in time.
+		ticks = buf.lastTicks
+	}
+	tickDiff := ticks - buf.lastTicks
+	if buf.pos == 0 {
+		buf.byte(traceEvBatch | 1<<traceArgCountShift)
+		buf.varint(uint64(pid))
+		buf.varint(ticks)
+		tickDiff = 0
+	}
+	buf.lastTicks = ticks
+	narg := byte(len(args))
+	if skip >= 0 {
+		narg++
+	}
+	// We have only 2 bits for number of arguments.
+	// If number is >= 3, then the event type is followed by event length in bytes.
+	if narg > 3 {
+		narg = 3
+	}
+	startPos := buf.pos
+	buf.byte(ev | narg<<traceArgCountShift)
+	var lenp *byte
+	if narg == 3 {
+		// Reserve the byte for length assuming that length < 128.
+		buf.varint(0)
+		lenp = &buf.arr[buf.pos-1]
+	}
+	buf.varint(tickDiff)
+	for _, a := range args {
+		buf.varint(a)
+	}
+	if skip == 0 {
+		buf.varint(0)
+	} else if skip > 0 {
+		_g_ := getg()
+		gp := mp.curg
+		nstk := 0
+		if gp == _g_ {
+			nstk = callers(skip, &buf.stk[0], len(buf.stk))
+		} else if gp != nil {
+			nstk = gcallers(gp, skip-1, &buf.stk[0], len(buf.stk))
+		}
+		if nstk > 0 {
+			nstk-- // skip runtime.goexit
+		}
+		if nstk > 0 && gp.goid == 1 {
+			nstk-- // skip runtime.main
+		}
+		id := trace.stackTab.put(buf.stk[:nstk])
+		buf.varint(uint64(id))
+	}
+	evSize := buf.pos - startPos
+	if evSize > maxSize {
+		gothrow("invalid length of trace event")
+	}
+	if lenp != nil {
+		// Fill in actual length.
+		*lenp = byte(evSize - 2)
+	}
+	traceReleaseBuffer(pid)
+}
+
+// traceAcquireBuffer returns trace buffer to use and, if necessary, locks it.
+func traceAcquireBuffer() (mp *m, pid int32, bufp **traceBuf) {
+	mp = acquirem()
+	if p := mp.p; p != nil {
+		return mp, p.id, &trace.bufs[p.id]
+	}
+	lock(&trace.bufLock)
+	return mp, traceGlobProc, &trace.buf
+}
+
+// traceReleaseBuffer releases a buffer previously acquired with traceAcquireBuffer.
+func traceReleaseBuffer(pid int32) {
+	if pid == traceGlobProc {
+		unlock(&trace.bufLock)
+	}
+	releasem(getg().m)
+}
+
+// traceFlush puts buf onto stack of full buffers and returns an empty buffer.
+func traceFlush(buf *traceBuf) *traceBuf {
+	owner := trace.lockOwner
+	dolock := owner == nil || owner != getg().m.curg
+	if dolock {
+		lock(&trace.lock)
+	}
+	if buf != nil {
+		traceFullQueue(buf)
+	}
+	if trace.empty != nil {
+		buf = trace.empty
+		trace.empty = buf.link
+	} else {
+		buf = (*traceBuf)(sysAlloc(unsafe.Sizeof(traceBuf{}), &memstats.other_sys))
+		if buf == nil {
+			gothrow("trace: out of memory")
+		}
+	}
+	buf.link = nil
+	buf.pos = 0
+	buf.lastTicks = 0
+	if dolock {
+		unlock(&trace.lock)
+	}
+	return buf
+}
+
+// traceAppend appends v to buf in little-endian-base-128 encoding.
+func traceAppend(buf []byte, v uint64) []byte {
+	for ; v >= 0x80; v >>= 7 {
+		buf = append(buf, 0x80|byte(v))
+	}
+	buf = append(buf, byte(v))
+	return buf
+}
+
+// varint appends v to buf in little-endian-base-128 encoding.
+func (buf *traceBuf) varint(v uint64) {
+	pos := buf.pos
+	for ; v >= 0x80; v >>= 7 {
+		buf.arr[pos] = 0x80 | byte(v)
+		pos++
+	}
+	buf.arr[pos] = byte(v)
+	pos++
+	buf.pos = pos
+}
+
+// byte appends v to buf.
+func (buf *traceBuf) byte(v byte) {
+	buf.arr[buf.pos] = v
+	buf.pos++
+}
+
+// traceStackTable maps stack traces (arrays of PC's) to unique uint32 ids.
+type traceStackTable struct {
+	lock mutex
+	seq  uint32
+	mem  traceAlloc
+	tab  [1 << 13]*traceStack
+}
+
+// traceStack is a single stack in traceStackTable.
+type traceStack struct {
+	link *traceStack
+	hash uintptr
+	id   uint32
+	n    int
+	stk  [0]uintptr // real type [n]uintptr
+}
+
+// stack returns slice of PCs.
+func (ts *traceStack) stack() []uintptr {
+	return (*[traceStackSize]uintptr)(unsafe.Pointer(&ts.stk))[:ts.n]
+}
+
+// put returns a unique id for the stack trace pcs and caches it in the table,
+// if it sees the trace for the first time.
+func (tab *traceStackTable) put(pcs []uintptr) uint32 {
+	if len(pcs) == 0 {
+		return 0
+	}
+	hash := memhash(unsafe.Pointer(&pcs[0]), uintptr(len(pcs))*unsafe.Sizeof(pcs[0]), 0)
+	lock(&tab.lock)
+	if id := tab.find(pcs, hash); id != 0 {
+		unlock(&tab.lock)
+		return id
+	}
+	// Now, create a new stack.
+	tab.seq++
+	stk := tab.newStack(len(pcs))
+	stk.hash = hash
+	stk.id = tab.seq
+	stk.n = len(pcs)
+	stkpc := stk.stack()
+	for i, pc := range pcs {
+		stkpc[i] = pc
+	}
+	part := int(hash % uintptr(len(tab.tab)))
+	stk.link = tab.tab[part]
+	tab.tab[part] = stk
+	unlock(&tab.lock)
+	return stk.id
+}
+
+// find checks if the stack trace pcs is already present in the table.
+// tab.lock must be held.
+func (tab *traceStackTable) find(pcs []uintptr, hash uintptr) uint32 {
+	part := int(hash % uintptr(len(tab.tab)))
+Search:
+	for stk := tab.tab[part]; stk != nil; stk = stk.link {
+		if stk.hash == hash && stk.n == len(pcs) {
+			for i, stkpc := range stk.stack() {
+				if stkpc != pcs[i] {
+					continue Search
+				}
+			}
+			return stk.id
+		}
+	}
+	return 0
+}
+
+// newStack allocates a new stack of size n.
+func (tab *traceStackTable) newStack(n int) *traceStack {
+	return (*traceStack)(tab.mem.alloc(unsafe.Sizeof(traceStack{}) + uintptr(n)*ptrSize))
+}
+
+// dump writes all previously cached stacks to trace buffers,
+// releases their memory and resets state.
+func (tab *traceStackTable) dump() {
+	var tmp [(2 + traceStackSize) * traceBytesPerNumber]byte
+	buf := traceFlush(nil)
+	for _, stk := range tab.tab {
+		for ; stk != nil; stk = stk.link {
+			maxSize := 1 + (3+stk.n)*traceBytesPerNumber
+			if uintptr(len(buf.arr))-buf.pos < uintptr(maxSize) {
+				buf = traceFlush(buf)
+			}
+			// Form the event in the temp buffer, we need to know the actual length.
+			tmpbuf := tmp[:0]
+			tmpbuf = traceAppend(tmpbuf, uint64(stk.id))
+			tmpbuf = traceAppend(tmpbuf, uint64(stk.n))
+			for _, pc := range stk.stack() {
+				tmpbuf = traceAppend(tmpbuf, uint64(pc))
+			}
+			buf.byte(traceEvStack | 3<<traceArgCountShift)
+			buf.varint(uint64(len(tmpbuf)))
+			copy(buf.arr[buf.pos:], tmpbuf)
+			buf.pos += uintptr(len(tmpbuf))
+		}
+	}
+
+	lock(&trace.lock)
+	traceFullQueue(buf)
+	unlock(&trace.lock)
+
+	tab.mem.drop()
+	for i := range tab.tab {
+		tab.tab[i] = nil
+	}
+	tab.seq = 0
+}
+
+// traceAlloc is a non-thread-safe region allocator.
+// It holds a linked list of traceAllocBlock, and keeps those it has
+// dropped for reuse.
+type traceAlloc struct {
+	head *traceAllocBlock
+	off  uintptr
+	free *traceAllocBlock
+}
+
+// traceAllocBlock is a block in traceAlloc.
+type traceAllocBlock struct {
+	next *traceAllocBlock
+	data [64<<10 - ptrSize]byte
+}
+
+// alloc allocates n-byte block.
+func (a *traceAlloc) alloc(n uintptr) unsafe.Pointer {
+	n = round(n, ptrSize)
+	if a.head == nil || a.off+n > uintptr(len(a.head.data)) {
+		if n > uintptr(len(a.head.data)) {
+			gothrow("trace: alloc too large")
+		}
+		block := a.free
+		if block != nil {
+			a.free = block.next
+		} else {
+			block = (*traceAllocBlock)(sysAlloc(unsafe.Sizeof(traceAllocBlock{}), &memstats.other_sys))
+			if block == nil {
+				gothrow("trace: out of memory")
+			}
+		}
+		block.next = a.head
+		a.head = block
+		a.off = 0
+	}
+	p := &a.head.data[a.off]
+	a.off += n
+	return unsafe.Pointer(p)
+}
+
+// drop releases all previously allocated memory, for reuse, and resets
+// the allocator.
+func (a *traceAlloc) drop() {
+	for a.head != nil {
+		block := a.head
+		a.head = block.next
+		block.next = a.free
+		a.free = block
+	}
+	a.off = 0
+}
+
+// The following functions write specific events to trace.
+// Those called from C run on g0, where the goroutine concerned is m.curg.
+
+func traceGomaxprocs(procs int32) {
+	traceEvent(traceEvGomaxprocs, 1, uint64(procs))
+}
+
+func traceProcStart() {
+	traceEvent(traceEvProcStart, -1, uint64(getg().m.id))
+}
+
+// traceProcStop records that pp stopped.  Sysmon and stoptheworld stop
+// Ps held by Ms in system calls, so pp need not be the M's own P; it is
+// borrowed for the event.
+func traceProcStop(pp *p) {
+	mp := acquirem()
+	oldp := mp.p
+	mp.p = pp
+	traceEvent(traceEvProcStop, -1)
+	mp.p = oldp
+	releasem(mp)
+}
+
+func traceGCStart() {
+	traceEvent(traceEvGCStart, 2)
+}
+
+func traceGCDone() {
+	traceEvent(traceEvGCDone, -1)
+}
+
+func traceGoCreate(newg *g, pc uintptr) {
+	traceEvent(traceEvGoCreate, 2, uint64(newg.goid), uint64(pc))
+}
+
+func traceGoStart() {
+	if gp := getg().m.curg; gp != nil {
+		traceEvent(traceEvGoStart, -1, uint64(gp.goid))
+	}
+}
+
+func traceGoEnd() {
+	traceEvent(traceEvGoEnd, -1)
+}
+
+func traceGoSched() {
+	traceEvent(traceEvGoSched, 2)
+}
+
+func traceGoPreempt() {
+	traceEvent(traceEvGoPreempt, 2)
+}
+
+// traceGoPark records that the current goroutine, gp, is parking, with
+// the event chosen by why it waits.
+func traceGoPark(gp *g) {
+	var ev byte
+	switch gp.waitreason {
+	case "chan send", "chan send (nil chan)":
+		ev = traceEvGoBlockSend
+	case "chan receive", "chan receive (nil chan)":
+		ev = traceEvGoBlockRecv
+	case "select":
+		ev = traceEvGoBlockSelect
+	case "select (no cases)":
+		ev = traceEvGoStop
+	case "sleep":
+		ev = traceEvGoSleep
+	case "semacquire":
+		ev = traceEvGoBlockSync
+	case "IO wait":
+		ev = traceEvGoBlockNet
+	case "syscall":
+		// Waiting for a system call issued asynchronously:
+		// the goroutine blocks in the call, not on the poller.
+		gp.sysblocktraced = true
+		traceEvent(traceEvGoSysCall, 2)
+		traceEvent(traceEvGoSysBlock, -1)
+		return
+	default:
+		ev = traceEvGoBlock
+	}
+	traceEvent(ev, 2)
+}
+
+// traceGoUnblock records that gp, which parked, is runnable again.
+func traceGoUnblock(gp *g) {
+	if gp.sysblocktraced {
+		gp.sysblocktraced = false
+		traceEvent(traceEvGoSysExit, -1, uint64(gp.goid), 0)
+		return
+	}
+	traceEvent(traceEvGoUnblock, 2, uint64(gp.goid))
+}
+
+func traceGoSysCall() {
+	getg().m.curg.sysblocktraced = true
+	traceEvent(traceEvGoSysCall, 2)
+}
+
+// traceGoSysExit records that gp, which lost its P in a system call,
+// has returned from it.
+func traceGoSysExit(gp *g) {
+	gp.sysblocktraced = false
+	traceEvent(traceEvGoSysExit, -1, uint64(gp.goid), 0)
+}
+
+// traceGoSysBlock records that the goroutine in a system call on pp
+// lost pp to another M, or to stoptheworld.
+func traceGoSysBlock(pp *p) {
+	mp := acquirem()
+	oldp := mp.p
+	mp.p = pp
+	traceEvent(traceEvGoSysBlock, -1)
+	mp.p = oldp
+	releasem(mp)
+}
@@ -0,0 +1,251 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// The tests decode the traces they take the way `go tool trace` does and
+// check that they hang together: every event has the arguments its type
+// calls for, every stack an event refers to is in the trace, and every
+// goroutine an event names was created.
+
+// Event types, as in runtime/trace.go.
+const (
+	evNone           = 0
+	evBatch          = 1
+	evFrequency      = 2
+	evStack          = 3
+	evGomaxprocs     = 4
+	evProcStart      = 5
+	evProcStop       = 6
+	evGCStart        = 7
+	evGCDone         = 8
+	evGCScanStart    = 9
+	evGCScanDone     = 10
+	evGCSweepStart   = 11
+	evGCSweepDone    = 12
+	evGoCreate       = 13
+	evGoStart        = 14
+	evGoEnd          = 15
+	evGoStop         = 16
+	evGoSched        = 17
+	evGoPreempt      = 18
+	evGoSleep        = 19
+	evGoBlock        = 20
+	evGoUnblock      = 21
+	evGoBlockSend    = 22
+	evGoBlockRecv    = 23
+	evGoBlockSelect  = 24
+	evGoBlockSync    = 25
+	evGoBlockCond    = 26
+	evGoBlockNet     = 27
+	evGoSysCall      = 28
+	evGoSysExit      = 29
+	evGoSysBlock     = 30
+	evGoWaiting      = 31
+	evGoInSyscall    = 32
+	evHeapAlloc      = 33
+	evNextGC         = 34
+	evTimerGoroutine = 35
+	evFutileWakeup   = 36
+	evCount          = 37
+)
+
+var evNames = [evCount]string{
+	"None", "Batch", "Frequency", "Stack", "Gomaxprocs", "ProcStart",
+	"ProcStop", "GCStart", "GCDone", "GCScanStart", "GCScanDone",
+	"GCSweepStart", "GCSweepDone", "GoCreate", "GoStart", "GoEnd",
+	"GoStop", "GoSched", "GoPreempt", "GoSleep", "GoBlock", "GoUnblock",
+	"GoBlockSend", "GoBlockRecv", "GoBlockSelect", "GoBlockSync",
+	"GoBlockCond", "GoBlockNet", "GoSysCall", "GoSysExit", "GoSysBlock",
+	"GoWaiting", "GoInSyscall", "HeapAlloc", "NextGC", "TimerGoroutine",
+	"FutileWakeup",
+}
+
+// evArgs is the number of arguments each type of timed event has after
+// its timestamp, counting the stack id, which comes last.
+var evArgs = [evCount]int{
+	evGomaxprocs: 2, evProcStart: 1, evGCStart: 1, evGCSweepStart: 1,
+	evGoCreate: 3, evGoStart: 1, evGoStop: 1, evGoSched: 1,
+	evGoPreempt: 1, evGoSleep: 1, evGoBlock: 1, evGoUnblock: 2,
+	evGoBlockSend: 1, evGoBlockRecv: 1, evGoBlockSelect: 1,
+	evGoBlockSync: 1, evGoBlockCond: 1, evGoBlockNet: 1, evGoSysCall: 1,
+	evGoSysExit: 2, evGoWaiting: 1, evGoInSyscall: 1, evHeapAlloc: 1,
+	evNextGC: 1,
+}
+
+// evHasStack reports whether each type of timed event ends with a stack id.
+var evHasStack = [evCount]bool{
+	evGomaxprocs: true, evGCStart: true, evGCSweepStart: true,
+	evGoCreate: true, evGoStop: true, evGoSched: true, evGoPreempt: true,
+	evGoSleep: true, evGoBlock: true, evGoUnblock: true,
+	evGoBlockSend: true, evGoBlockRecv: true, evGoBlockSelect: true,
+	evGoBlockSync: true, evGoBlockCond: true, evGoBlockNet: true,
+	evGoSysCall: true,
+}
+
+// An event is a timed event of a trace.
+type event struct {
+	typ  byte
+	p    int      // P the event happened on, or -1
+	ts   uint64   // in units of 1/freq seconds
+	args []uint64 // after the timestamp
+}
+
+// A parsedTrace is a decoded trace.
+type parsedTrace struct {
+	events []event
+	count  [evCount]int        // events of each type, including untimed ones
+	stacks map[uint64][]uint64 // PCs by stack id
+	freq   uint64              // timestamp units per second
+}
+
+// duration returns the time the trace spans, in seconds.
+func (t *parsedTrace) duration() float64 {
+	var min, max uint64
+	for i, ev := range t.events {
+		if i == 0 || ev.ts < min {
+			min = ev.ts
+		}
+		if ev.ts > max {
+			max = ev.ts
+		}
+	}
+	return float64(max-min) / float64(t.freq)
+}
+
+func parseTrace(data []byte) (*parsedTrace, error) {
+	if !bytes.HasPrefix(data, []byte(header)) {
+		return nil, fmt.Errorf("trace does not start with the header")
+	}
+	t := &parsedTrace{stacks: make(map[uint64][]uint64)}
+	data = data[len(header):]
+	size := len(header) + len(data)
+	readVal := func() (uint64, error) {
+		var v uint64
+		for i := uint(0); i < 10; i++ {
+			if len(data) == 0 {
+				return 0, fmt.Errorf("trace ends in the middle of a value")
+			}
+			b := data[0]
+			data = data[1:]
+			v |= uint64(b&0x7f) << (7 * i)
+			if b&0x80 == 0 {
+				return v, nil
+			}
+		}
+		return 0, fmt.Errorf("value longer than 10 bytes")
+	}
+
+	p, inBatch := 0, false
+	var ticks uint64
+	for len(data) > 0 {
+		off := size - len(data)
+		typ, narg := data[0]&0x3f, int(data[0]>>6)
+		data = data[1:]
+		if typ == evNone || typ >= evCount {
+			return nil, fmt.Errorf("bad event type %d", typ)
+		}
+		var vals []uint64
+		if narg == 3 {
+			n, err := readVal()
+			if err != nil {
+				return nil, err
+			}
+			if n > uint64(len(data)) {
+				return nil, fmt.Errorf("%s event of %d bytes runs past the end", evNames[typ], n)
+			}
+			end := len(data) - int(n)
+			for len(data) > end {
+				v, err := readVal()
+				if err != nil {
+					return nil, err
+				}
+				vals = append(vals, v)
+			}
+			if len(data) != end {
+				return nil, fmt.Errorf("%s event overruns its length", evNames[typ])
+			}
+		} else {
+			// The timestamp, or the one value of an untimed event,
+			// is not counted in narg.
+			for i := 0; i <= narg; i++ {
+				v, err := readVal()
+				if err != nil {
+					return nil, err
+				}
+				vals = append(vals, v)
+			}
+		}
+		t.count[typ]++
+
+		switch typ {
+		case evBatch:
+			if len(vals) != 2 {
+				return nil, fmt.Errorf("Batch event has %d values, want 2", len(vals))
+			}
+			p, ticks, inBatch = int(int64(vals[0])), vals[1], true
+			if p < -1 || p >= 256 {
+				return nil, fmt.Errorf("Batch for P %d", p)
+			}
+			continue
+		case evFrequency:
+			if len(vals) != 1 || vals[0] == 0 {
+				return nil, fmt.Errorf("bad Frequency event %v", vals)
+			}
+			t.freq = vals[0]
+			continue
+		case evTimerGoroutine:
+			if len(vals) != 1 {
+				return nil, fmt.Errorf("bad TimerGoroutine event %v", vals)
+			}
+			continue
+		case evStack:
+			if len(vals) < 2 || uint64(len(vals)) != 2+vals[1] || vals[0] == 0 {
+				return nil, fmt.Errorf("bad Stack event %v", vals)
+			}
+			if _, dup := t.stacks[vals[0]]; dup {
+				return nil, fmt.Errorf("stack %d appears twice", vals[0])
+			}
+			t.stacks[vals[0]] = vals[2:]
+			continue
+		}
+		if !inBatch {
+			return nil, fmt.Errorf("%s event at offset %d outside a batch", evNames[typ], off)
+		}
+		if len(vals)-1 != evArgs[typ] {
+			return nil, fmt.Errorf("%s event has %d arguments, want %d", evNames[typ], len(vals)-1, evArgs[typ])
+		}
+		ticks += vals[0]
+		t.events = append(t.events, event{typ: typ, p: p, ts: ticks, args: vals[1:]})
+	}
+	if t.freq == 0 {
+		return nil, fmt.Errorf("trace has no Frequency event")
+	}
+
+	created := make(map[uint64]bool)
+	for _, ev := range t.events {
+		if ev.typ == evGoCreate {
+			created[ev.args[0]] = true
+		}
+	}
+	for _, ev := range t.events {
+		if evHasStack[ev.typ] {
+			if id := ev.args[len(ev.args)-1]; id != 0 && t.stacks[id] == nil {
+				return nil, fmt.Errorf("%s event refers to missing stack %d", evNames[ev.typ], id)
+			}
+		}
+		switch ev.typ {
+		case evGoStart, evGoUnblock, evGoSysExit, evGoWaiting, evGoInSyscall:
+			if !created[ev.args[0]] {
+				return nil, fmt.Errorf("%s event for goroutine %d, which was never created", evNames[ev.typ], ev.args[0])
+			}
+		}
+	}
+	return t, nil
+}
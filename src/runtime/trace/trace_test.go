@@ -0,0 +1,143 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace_test
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	. "runtime/trace"
+	"sync"
+	"testing"
+	"time"
+)
+
+const header = "go 1.5 trace\x00\x00\x00\x00"
+
+func TestTraceStartStop(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	Stop()
+	size := buf.Len()
+	if size <= len(header) {
+		t.Fatalf("trace is empty")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if size != buf.Len() {
+		t.Fatalf("trace writes after stop: %v -> %v", size, buf.Len())
+	}
+	tr, err := parseTrace(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to parse trace: %v", err)
+	}
+	for _, ev := range []byte{evProcStart, evGomaxprocs, evGoStart, evGoSched} {
+		if tr.count[ev] == 0 {
+			t.Errorf("trace has no %s events", evNames[ev])
+		}
+	}
+}
+
+func TestTraceDoubleStart(t *testing.T) {
+	Stop()
+	buf := new(bytes.Buffer)
+	if err := Start(buf); err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+	if err := Start(buf); err == nil {
+		t.Fatalf("succeeded in starting tracing second time")
+	}
+	Stop()
+	Stop()
+}
+
+// TestTraceStress runs goroutines that block in every way the tracer
+// distinguishes, and restarts the trace while they do.
+func TestTraceStress(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	done := make(chan bool)
+	ping := make(chan bool)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	mu.Lock()
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		mu.Lock()
+		mu.Unlock()
+	}()
+	go func() {
+		defer wg.Done()
+		<-done
+	}()
+	go func() {
+		defer wg.Done()
+		for _ = range ping {
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		var b [1]byte
+		for {
+			if _, err := r.Read(b[:]); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer w.Close()
+		defer close(ping)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			time.Sleep(time.Millisecond)
+			runtime.Gosched()
+			runtime.GC()
+			ping <- true
+			w.Write([]byte{0})
+		}
+	}()
+
+	var count [evCount]int
+	for i := 0; i < 3; i++ {
+		buf := new(bytes.Buffer)
+		if err := Start(buf); err != nil {
+			t.Fatalf("failed to start tracing: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		Stop()
+		tr, err := parseTrace(buf.Bytes())
+		if err != nil {
+			t.Fatalf("failed to parse trace %d: %v", i, err)
+		}
+		if d := tr.duration(); d < 0.01 || d > 10 {
+			t.Errorf("trace %d spans %vs, want about 0.02s", i, d)
+		}
+		for ev, n := range tr.count {
+			count[ev] += n
+		}
+	}
+	mu.Unlock()
+	close(done)
+	wg.Wait()
+
+	for _, ev := range []byte{evGoCreate, evGoStart, evGoWaiting, evGoSched,
+		evGoSleep, evGoBlockRecv, evGoUnblock, evGoSysCall, evGCStart,
+		evGCDone, evProcStart, evStack} {
+		if count[ev] == 0 {
+			t.Errorf("traces have no %s events", evNames[ev])
+		}
+	}
+}
@@ -345,6 +345,7 @@ func gentraceback(pc0 uintptr, sp0 uintptr, lr0 uintptr, gp *g, skip int, pcbuf
 					print(" fp=", hex(frame.fp), " sp=", hex(frame.sp))
 				}
 				print("\n")
+				printkernelcall(gp, f)
 				nprint++
 			}
 		}
@@ -616,6 +617,9 @@ func goroutineheader(gp *g) {
 		print(", locked to thread")
 	}
 	print("]:\n")
+	if gotraceback(nil) >= 2 {
+		tracebackthread(gp)
+	}
 }
 
 func tracebackothers(me *g) {
@@ -647,6 +651,76 @@ func tracebackothers(me *g) {
 	unlock(&allglock)
 }
 
+// tracebackothersconc is tracebackothers for a world that is still
+// running.  Each goroutine is held still only while its own stack is
+// printed: setting the scan bit in its status, as the garbage collector
+// does to scan a stack, keeps it from running, leaving a system call or
+// moving its stack until the bit is cleared.  A goroutine running on
+// another M is asked to stop at its next preemption check and shown once
+// it has, unless that takes too long.  Goroutines created meanwhile are
+// left out.  Runs on g0.
+func tracebackothersconc(me *g) {
+	level := gotraceback(nil)
+	g := getg()
+
+	lock(&allglock)
+	gs := allgs
+	unlock(&allglock)
+
+	for _, gp := range gs {
+		if gp == me || gp == g.m.curg || gp.issystem && level < 2 {
+			continue
+		}
+		tracebackg(gp, true)
+	}
+}
+
+// tracebackg prints the header and stack of gp, a goroutine other than
+// the caller's, holding it still as tracebackothersconc describes, after
+// a blank line if blank.  It reports false, printing nothing, if gp is
+// dead.  Runs on g0.
+func tracebackg(gp *g, blank bool) bool {
+	for try := 0; ; try++ {
+		s := readgstatus(gp)
+		if s == _Gdead {
+			return false
+		}
+		if s == _Grunnable || s == _Gwaiting || s == _Gsyscall {
+			if castogscanstatus(gp, s, s|_Gscan) {
+				if blank {
+					print("\n")
+				}
+				goroutineheader(gp)
+				traceback(^uintptr(0), ^uintptr(0), 0, gp)
+				casfromgscanstatus(gp, s|_Gscan, s)
+				return true
+			}
+			continue
+		}
+		if try >= tracebackTries {
+			if blank {
+				print("\n")
+			}
+			goroutineheader(gp)
+			print("\tgoroutine running on other thread; stack unavailable\n")
+			printcreatedby(gp)
+			return true
+		}
+		// Claim gp, as stopg does, so that it is not leaving
+		// _Grunning as we ask it to stop.
+		if s == _Grunning && castogscanstatus(gp, _Grunning, _Gscanrunning) {
+			gp.preempt = true
+			gp.stackguard0 = stackPreempt
+			casfromgscanstatus(gp, _Gscanrunning, _Grunning)
+		}
+		// Running, or held by the garbage collector or a stack copy.
+		usleep(10)
+	}
+}
+
+// Number of times tracebackg waits for a goroutine to stop.
+const tracebackTries = 100
+
 // Does f mark the top of a goroutine stack?
 func topofstack(f *_func) bool {
 	pc := f.entry
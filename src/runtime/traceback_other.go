@@ -0,0 +1,12 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !akaros
+
+package runtime
+
+// tracebackthread prints the state of the thread under gp, where the
+// system has any worth showing.
+func tracebackthread(gp *g) {
+}
@@ -6,6 +6,7 @@ package syscall
 
 import (
 	"runtime"
+	"sync/atomic"
 	"usys"
 )
 
@@ -14,9 +15,11 @@ func RunWithDeadline(f func(), deadline int64) {
 		f()
 	} else {
 		runtime.LockOSThread()
+		atomic.AddInt32(&deadlineRegions, 1)
 		handle := usys.Call1(usys.USYS_ABORT_SYSCALL_AT_ABS_UNIX, uintptr(deadline))
 		f()
 		usys.Call1(usys.USYS_UNSET_ALARM, uintptr(handle))
+		atomic.AddInt32(&deadlineRegions, -1)
 		runtime.UnlockOSThread()
 	}
 }
@@ -0,0 +1,141 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Append-mode writes.
+//
+// Akaros moves an O_APPEND channel's offset to the end of the file before
+// each write, but the length lookup and the write are not one step, so two
+// writers appending to the same regular file can overwrite each other.
+// Writes to devices without offsets, such as pipes and consoles, do not
+// have that problem.  For regular files opened with O_APPEND through Open
+// or Openat, Write therefore serializes the process's own appends: each
+// descriptor has a mutex, shared with its duplicates, and Write seeks to
+// the end of the file and writes while holding it.  Goroutines appending
+// through this package so keep their records whole.  Appends from other
+// processes to the same file are not guarded at all: Akaros has no file
+// locks, and a process's appends can still overwrite another's.
+
+package syscall
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// An AppendGuarantee says how appends to a descriptor are kept whole.
+type AppendGuarantee int
+
+const (
+	// AppendNone: the descriptor was not opened with O_APPEND through
+	// this package, and nothing is done for it.
+	AppendNone AppendGuarantee = iota
+
+	// AppendKernel: the descriptor is a device without offsets, and
+	// the kernel keeps each write whole.
+	AppendKernel
+
+	// AppendInProcess: writes are serialized within the process, each
+	// after a seek to the end of the file.  Appends by other processes
+	// to the same file are unguarded and can overwrite these.
+	AppendInProcess
+)
+
+func (g AppendGuarantee) String() string {
+	switch g {
+	case AppendNone:
+		return "none"
+	case AppendKernel:
+		return "kernel"
+	case AppendInProcess:
+		return "in-process"
+	}
+	return "append" + itoa(int(g))
+}
+
+type appendFile struct {
+	sync.Mutex
+	guarantee AppendGuarantee
+}
+
+var appendFds struct {
+	sync.RWMutex
+	n int32 // len(m), read atomically on the Write fast path
+	m map[int]*appendFile
+}
+
+// AppendMode reports how appends to fd are kept whole.  No mode covers
+// appends from several processes to one regular file: those are never
+// guarded.
+func AppendMode(fd int) AppendGuarantee {
+	if f := lookupAppend(fd); f != nil {
+		return f.guarantee
+	}
+	return AppendNone
+}
+
+// noteAppend records fd, just opened with O_APPEND.
+func noteAppend(fd int) {
+	f := &appendFile{guarantee: AppendKernel}
+	var st Stat_t
+	if Fstat(fd, &st) == nil && st.Mode&S_IFMT == S_IFREG {
+		f.guarantee = AppendInProcess
+	}
+	setAppend(fd, f)
+}
+
+// noteDup records that newfd now refers to the same open file as oldfd,
+// sharing its mutex if it has one and dropping whatever newfd was before.
+func noteDup(oldfd, newfd int) {
+	if atomic.LoadInt32(&appendFds.n) == 0 {
+		return
+	}
+	setAppend(newfd, lookupAppend(oldfd))
+}
+
+// forgetAppend drops fd, which is being closed or reused.
+func forgetAppend(fd int) {
+	if atomic.LoadInt32(&appendFds.n) == 0 {
+		return
+	}
+	setAppend(fd, nil)
+}
+
+func setAppend(fd int, f *appendFile) {
+	appendFds.Lock()
+	if f == nil {
+		delete(appendFds.m, fd)
+	} else {
+		if appendFds.m == nil {
+			appendFds.m = make(map[int]*appendFile)
+		}
+		appendFds.m[fd] = f
+	}
+	atomic.StoreInt32(&appendFds.n, int32(len(appendFds.m)))
+	appendFds.Unlock()
+}
+
+func lookupAppend(fd int) *appendFile {
+	if atomic.LoadInt32(&appendFds.n) == 0 {
+		return nil
+	}
+	appendFds.RLock()
+	f := appendFds.m[fd]
+	appendFds.RUnlock()
+	return f
+}
+
+// appendWrite is write with the append guarantee for fd applied.
+func appendWrite(fd int, p []byte) (n int, err error) {
+	f := lookupAppend(fd)
+	if f == nil || f.guarantee != AppendInProcess {
+		return write(fd, p)
+	}
+	f.Lock()
+	defer f.Unlock()
+	var off int64
+	if err = llseek(fd, 0, 0, &off, SEEK_END); err != nil {
+		return 0, err
+	}
+	return write(fd, p)
+}
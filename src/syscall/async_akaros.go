@@ -0,0 +1,157 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Asynchronous system calls.
+//
+// Every Akaros system call is asynchronous underneath: the kernel returns
+// to the caller as soon as a call blocks and later marks it done.  Submit
+// exposes that directly.  It issues a call and returns without waiting;
+// the kernel posts the completion to an event queue that a single reaper
+// goroutine drains, and the reaper closes the call's Done channel.  A
+// handful of goroutines can so keep many I/Os in flight while the reaper
+// is the only one holding a thread in the kernel.
+//
+// The wrappers use the same mechanism for every call they make.  When a
+// call blocks in the kernel, the goroutine making it parks and its M goes
+// on to run other goroutines; the runtime's network poller collects the
+// completion and makes the goroutine runnable again.  Tens of thousands of
+// goroutines blocked in system calls so cost no more threads than the
+// same number blocked on channels.  GODEBUG=akarossync=1 turns this off,
+// and each blocking call then holds its M as it does elsewhere.
+
+package syscall
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// An AsyncSyscall is a system call issued with Submit.
+type AsyncSyscall struct {
+	s    Syscall_struct
+	done chan struct{}
+}
+
+var async struct {
+	sync.Mutex
+	reaping bool
+	pending map[unsafe.Pointer]*AsyncSyscall // keeps calls in flight reachable
+}
+
+// Implemented in the runtime.
+func runtime_asyncSubmit(s *Syscall_struct) (done bool)
+func runtime_asyncReap() (s unsafe.Pointer)
+func runtime_pollServerInit()
+
+// runtime_syscallAsync issues s and parks the calling goroutine until it
+// completes.  It reports false, without issuing s, if the goroutine
+// cannot park.
+//go:noescape
+func runtime_syscallAsync(s unsafe.Pointer) (ok bool)
+
+// asyncBlocking is set when goSyscall issues calls with
+// runtime_syscallAsync.
+var asyncBlocking bool
+
+func init() {
+	if godebug("akarossync") == 0 {
+		runtime_pollServerInit()
+		asyncBlocking = true
+	}
+}
+
+// Submit issues system call trap with the given arguments and returns
+// without waiting for it to complete.  Any memory the arguments point to
+// must be heap allocated and must stay reachable and untouched until the
+// call is done; pointers into a goroutine's stack are never safe here.
+func Submit(trap uintptr, args ...uintptr) (*AsyncSyscall, error) {
+	if len(args) > 6 {
+		return nil, E2BIG
+	}
+	var a [6]uintptr
+	copy(a[:], args)
+	c := &AsyncSyscall{done: make(chan struct{})}
+	c.s.num = uint32(trap)
+	c.s.arg0, c.s.arg1, c.s.arg2 = a[0], a[1], a[2]
+	c.s.arg3, c.s.arg4, c.s.arg5 = a[3], a[4], a[5]
+
+	key := unsafe.Pointer(&c.s)
+	async.Lock()
+	if async.pending == nil {
+		async.pending = make(map[unsafe.Pointer]*AsyncSyscall)
+	}
+	async.pending[key] = c
+	if !async.reaping {
+		async.reaping = true
+		go reapAsync()
+	}
+	async.Unlock()
+
+	if runtime_asyncSubmit(&c.s) {
+		async.Lock()
+		delete(async.pending, key)
+		async.Unlock()
+		close(c.done)
+	}
+	return c, nil
+}
+
+// reapAsync closes the Done channel of each call the kernel completes.
+func reapAsync() {
+	for {
+		key := runtime_asyncReap()
+		async.Lock()
+		c := async.pending[key]
+		delete(async.pending, key)
+		async.Unlock()
+		if c != nil {
+			close(c.done)
+		}
+	}
+}
+
+// Done returns a channel that is closed when the call completes.
+func (c *AsyncSyscall) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait blocks until the call completes and returns its result.
+func (c *AsyncSyscall) Wait() (r uintptr, err error) {
+	<-c.done
+	return c.Result()
+}
+
+// Result returns the result of a completed call.  Before the call
+// completes it returns EINPROGRESS.
+func (c *AsyncSyscall) Result() (r uintptr, err error) {
+	select {
+	case <-c.done:
+	default:
+		return 0, EINPROGRESS
+	}
+	if c.s.err != 0 {
+		return uintptr(c.s.retval), Errno(c.s.err)
+	}
+	return uintptr(c.s.retval), nil
+}
+
+// Cancel asks the kernel to abort the call.  A cancelled call still
+// completes, normally with EINTR, and closes its Done channel; Cancel
+// returns ESRCH if the call had already completed or could not be
+// aborted.
+func (c *AsyncSyscall) Cancel() error {
+	select {
+	case <-c.done:
+		return ESRCH
+	default:
+	}
+	r, _, e := Syscall(SYS_ABORT_SYSC, uintptr(unsafe.Pointer(&c.s)), 0, 0)
+	if e != 0 {
+		return e
+	}
+	if r == 0 {
+		return ESRCH
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// System call batching.
+//
+// An Akaros kernel entry can carry any number of system calls, laid out
+// contiguously in memory.  With a batching window set, the calls declared
+// with //sysbatch that are issued on the same P within the window are
+// copied into one such array and submitted together by whichever of them
+// arrived first.  Each caller waits for up to the window, plus the time the
+// whole batch takes, in exchange for far fewer kernel entries under
+// syscall-heavy load.  Batching is off until SetSyscallBatchWindow is
+// called.
+//
+// A queued call may point into its caller's stack, so from the moment a
+// call is copied into a batch until the batch is done, its caller must not
+// reach a point where the stack can move.  Callers therefore enqueue with
+// the P pinned, and wait in the kernel rather than in the scheduler.
+
+package syscall
+
+import (
+	"sync/atomic"
+	"unsafe"
+	"usys"
+)
+
+// MaxSyscallBatch is the most calls submitted with one kernel entry.
+const MaxSyscallBatch = 16
+
+// maxBatchPs is the runtime's limit on GOMAXPROCS.
+const maxBatchPs = 256
+
+const (
+	batchOpen   = iota // accepting calls
+	batchSealed        // full, or the window is over
+	batchDone          // the kernel has completed every call
+)
+
+const (
+	_FUTEX_WAIT = 0
+	_FUTEX_WAKE = 1
+)
+
+type syscallBatch struct {
+	calls    [MaxSyscallBatch]Syscall_struct
+	reserved int32 // slots handed out; >= MaxSyscallBatch once closed
+	ready    int32 // slots filled in
+	state    uint32
+}
+
+var (
+	batchWindow int64                      // nanoseconds; <= 0 disables batching
+	batchSlot   [maxBatchPs]unsafe.Pointer // *syscallBatch being filled on each P
+)
+
+// SetSyscallBatchWindow sets how long, in nanoseconds, a batchable system
+// call may wait for others to join it, and returns the previous window.
+// A window <= 0 turns batching off.
+func SetSyscallBatchWindow(ns int64) (old int64) {
+	return atomic.SwapInt64(&batchWindow, ns)
+}
+
+func runtime_procPin() int
+
+// runtime_syscallTrace logs a call issued at start that was not recorded
+// with runtime_syscallBegin, for GODEBUG=akarostrace.
+//go:noescape
+func runtime_syscallTrace(s unsafe.Pointer, start int64)
+func runtime_procUnpin()
+
+// runtime_batch submits a.n calls starting at a.sysc with a single kernel
+// entry and returns once all of them have completed.
+func runtime_batch(a *batchArg)
+
+type batchArg struct {
+	sysc *Syscall_struct
+	n    int32
+	_    int32
+}
+
+// goSyscallBatched is goSyscall for the wrappers generated from //sysbatch.
+// Calls made under RunWithDeadline are never batched: the abort has to
+// find them on the caller's own thread.
+func goSyscallBatched(s *Syscall_struct) {
+	window := atomic.LoadInt64(&batchWindow)
+	if window <= 0 || atomic.LoadInt32(&deadlineRegions) != 0 {
+		goSyscall(s)
+		return
+	}
+	ts := NsecToTimespec(window)
+
+	p := runtime_procPin()
+	slot := &batchSlot[p]
+	b, i, leader := joinBatch(slot)
+	b.calls[i] = *s
+	atomic.AddInt32(&b.ready, 1)
+	sealer := i == MaxSyscallBatch-1
+	if sealer {
+		atomic.CompareAndSwapPointer(slot, unsafe.Pointer(b), nil)
+		atomic.StoreUint32(&b.state, batchSealed)
+	}
+	runtime_procUnpin()
+	runtime_syscallBegin(unsafe.Pointer(&b.calls[i]))
+
+	if leader {
+		futexWait(&b.state, batchOpen, &ts)
+		submitBatch(slot, b)
+	} else {
+		if sealer {
+			futexWake(&b.state)
+		}
+		for {
+			st := atomic.LoadUint32(&b.state)
+			if st == batchDone {
+				break
+			}
+			futexWait(&b.state, st, nil)
+		}
+	}
+
+	runtime_syscallEnd()
+	*s = b.calls[i]
+	if s.err == int32(EINTR) && retryInterrupted(atomic.LoadUint32(&abortGen), 0) {
+		s.err = 0
+		s.retval = 0
+		s.flags = 0
+		s.errstr[0] = 0
+		goSyscall(s)
+	}
+}
+
+// joinBatch reserves a slot in the batch being filled on this P, starting
+// a new batch if there is none or it is full.  Called with the P pinned.
+func joinBatch(slot *unsafe.Pointer) (b *syscallBatch, i int, leader bool) {
+	for {
+		b = (*syscallBatch)(atomic.LoadPointer(slot))
+		if b != nil {
+			if n := atomic.AddInt32(&b.reserved, 1) - 1; n < MaxSyscallBatch {
+				return b, int(n), false
+			}
+		}
+		nb := new(syscallBatch)
+		nb.reserved = 1
+		if atomic.CompareAndSwapPointer(slot, unsafe.Pointer(b), unsafe.Pointer(nb)) {
+			return nb, 0, true
+		}
+	}
+}
+
+// submitBatch closes b to new calls, waits for the ones already reserved
+// to be filled in and hands them all to the kernel.
+//go:nosplit
+func submitBatch(slot *unsafe.Pointer, b *syscallBatch) {
+	atomic.CompareAndSwapPointer(slot, unsafe.Pointer(b), nil)
+	n := atomic.AddInt32(&b.reserved, MaxSyscallBatch) - MaxSyscallBatch
+	if n > MaxSyscallBatch {
+		n = MaxSyscallBatch
+	}
+	for atomic.LoadInt32(&b.ready) < n {
+	}
+	runtime_batch(&batchArg{sysc: &b.calls[0], n: n})
+	atomic.StoreUint32(&b.state, batchDone)
+	futexWake(&b.state)
+}
+
+// A SyscallRing collects system calls to be issued together, with one
+// kernel entry, by Submit.  Unlike the batching window, which gathers
+// calls from many goroutines, a ring is filled and submitted by one
+// caller, for bursts it knows about up front: a directory of stats, an fd
+// duplicated many times.  Memory the arguments point to must stay
+// reachable until Submit returns.
+type SyscallRing struct {
+	calls []Syscall_struct
+}
+
+// Add appends system call trap with the given arguments to the ring and
+// returns its index.
+func (r *SyscallRing) Add(trap uintptr, args ...uintptr) int {
+	var s Syscall_struct
+	var a [6]uintptr
+	copy(a[:], args)
+	s.num = uint32(trap)
+	s.arg0, s.arg1, s.arg2 = a[0], a[1], a[2]
+	s.arg3, s.arg4, s.arg5 = a[3], a[4], a[5]
+	r.calls = append(r.calls, s)
+	return len(r.calls) - 1
+}
+
+// Len returns the number of calls in the ring.
+func (r *SyscallRing) Len() int { return len(r.calls) }
+
+// Reset empties the ring for reuse.
+func (r *SyscallRing) Reset() { r.calls = r.calls[:0] }
+
+// Submit issues every call in the ring and returns when all of them have
+// completed.  The calls may run concurrently in the kernel, in any order.
+// Calls interrupted by an event are reissued one at a time under the
+// interrupt policy.
+func (r *SyscallRing) Submit() {
+	if len(r.calls) == 0 {
+		return
+	}
+	gen := atomic.LoadUint32(&abortGen)
+	for i := range r.calls {
+		s := &r.calls[i]
+		s.err, s.retval, s.flags, s.errstr[0] = 0, 0, 0, 0
+	}
+	start := runtimeNano()
+	runtime_syscallBegin(unsafe.Pointer(&r.calls[0]))
+	runtime_batch(&batchArg{sysc: &r.calls[0], n: int32(len(r.calls))})
+	runtime_syscallEnd()
+	for i := 1; i < len(r.calls); i++ {
+		runtime_syscallTrace(unsafe.Pointer(&r.calls[i]), start)
+	}
+	for i := range r.calls {
+		s := &r.calls[i]
+		if s.err == int32(EINTR) && retryInterrupted(gen, 0) {
+			s.err, s.retval, s.flags, s.errstr[0] = 0, 0, 0, 0
+			goSyscall(s)
+		}
+	}
+}
+
+// Result returns the result of call i, which is only meaningful after
+// Submit.
+func (r *SyscallRing) Result(i int) (r1 uintptr, err error) {
+	s := &r.calls[i]
+	if s.err != 0 {
+		return uintptr(s.retval), Errno(s.err)
+	}
+	return uintptr(s.retval), nil
+}
+
+//go:nosplit
+func futexWait(addr *uint32, val uint32, ts *Timespec) {
+	usys.Call(usys.USYS_FUTEX, uintptr(unsafe.Pointer(addr)), _FUTEX_WAIT,
+		uintptr(val), uintptr(unsafe.Pointer(ts)), 0, 0)
+}
+
+//go:nosplit
+func futexWake(addr *uint32) {
+	usys.Call(usys.USYS_FUTEX, uintptr(unsafe.Pointer(addr)), _FUTEX_WAKE,
+		1<<31-1, 0, 0, 0)
+}
@@ -0,0 +1,103 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Close-on-exec.
+//
+// A new Akaros process starts with only the descriptors StartProcess maps
+// into it with SYS_DUP_FDS_TO, but Exec replaces the program and keeps
+// every descriptor not marked close-on-exec.  Open sets the mark as it
+// opens when asked with O_CLOEXEC, as package os always does.  On a kernel
+// that ignores O_CLOEXEC (see FeatureOpenCloexec) the mark is set just
+// after the open, and ForkLock keeps the two steps together as it does on
+// Unix: they hold it for reading, and StartProcess and Exec hold it for
+// writing while descriptors pass to another program.
+//
+// The descriptors in ProcAttr.Files are handed to the child on purpose and
+// must survive the child's own exec, as they do after dup2 on Unix.
+// SYS_DUP_FDS_TO copies a descriptor's flags along with it, so
+// StartProcess clears close-on-exec on each of them for the duration of
+// the call and then puts it back.
+
+package syscall
+
+import "sync"
+
+// ForkLock is held for writing by StartProcess, PrepareProcess and Exec,
+// and for reading around any creation of a descriptor that cannot set
+// close-on-exec in the same step.
+var ForkLock sync.RWMutex
+
+// CloseOnExec marks fd close-on-exec.  It takes no lock: as on Unix, a
+// caller that just created fd holds ForkLock for reading around both
+// steps, and ForkLock is not reentrant.
+func CloseOnExec(fd int) { setCloseOnExec(fd, true) }
+
+func setCloseOnExec(fd int, on bool) error {
+	fl, err := fcntl(fd, F_GETFD, 0)
+	if err != nil {
+		return err
+	}
+	if on {
+		fl |= FD_CLOEXEC
+	} else {
+		fl &^= FD_CLOEXEC
+	}
+	_, err = fcntl(fd, F_SETFD, fl)
+	return err
+}
+
+// DupCloseOnExec returns a new descriptor for the file open on fd, marked
+// close-on-exec.
+func DupCloseOnExec(fd int) (nfd int, err error) {
+	ForkLock.RLock()
+	defer ForkLock.RUnlock()
+	if nfd, err = Dup(fd); err != nil {
+		return -1, err
+	}
+	if err = setCloseOnExec(nfd, true); err != nil {
+		forgetAppend(nfd)
+		closeBatch(nfd)
+		return -1, err
+	}
+	return nfd, nil
+}
+
+// openatCloseOnExec is openat for a kernel that ignores O_CLOEXEC.
+func openatCloseOnExec(fromfd int, path string, flags int, mode uint32) (fd int, err error) {
+	ForkLock.RLock()
+	defer ForkLock.RUnlock()
+	if fd, err = openat(fromfd, path, flags, mode); err != nil {
+		return -1, err
+	}
+	if err = setCloseOnExec(fd, true); err != nil {
+		closeBatch(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// inheritFds clears close-on-exec on the descriptors in files, which are
+// about to be handed to a child, and returns a function that restores
+// it.  ForkLock must be held for writing.
+func inheritFds(files []uintptr) (restore func()) {
+	var marked []int
+	for _, f := range files {
+		fd := int(f)
+		if fd < 0 {
+			continue
+		}
+		fl, err := fcntl(fd, F_GETFD, 0)
+		if err != nil || fl&FD_CLOEXEC == 0 {
+			continue
+		}
+		if _, err = fcntl(fd, F_SETFD, fl&^FD_CLOEXEC); err == nil {
+			marked = append(marked, fd)
+		}
+	}
+	return func() {
+		for _, fd := range marked {
+			setCloseOnExec(fd, true)
+		}
+	}
+}
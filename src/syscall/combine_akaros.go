@@ -0,0 +1,244 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Write combining.
+//
+// Services that log a line at a time spend much of their time in
+// one-line writes.  With combining turned on for a descriptor, Write
+// appends to a per-descriptor buffer and returns at once; the buffer goes
+// to the kernel in one write when it fills up, when the combining window
+// has passed since the first write into it, or when the descriptor is
+// flushed, seeked, truncated, synced, closed or written at an offset, and
+// before the process exits through Exit.  Data still buffered when the
+// process crashes is lost.  An error from a deferred write is returned by
+// the next of those calls, or the next Write, on the descriptor.
+//
+// A single goroutine, running only while some descriptor has data
+// buffered, writes out the buffers whose window has passed.
+
+package syscall
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// combineMax is the buffer size at which combined writes are flushed
+// without waiting for the window.
+const combineMax = 32 << 10
+
+type combiner struct {
+	sync.Mutex
+	fd        int
+	window    int64 // nanoseconds
+	buf       []byte
+	err       error // from a deferred write
+	scheduled bool  // a flush is pending
+	due       int64 // runtimeNano time the pending flush is due
+}
+
+var combiners struct {
+	sync.RWMutex
+	n int32 // len(m), read atomically on the Write fast path
+	m map[int]*combiner
+}
+
+// SetWriteCombining turns write combining on fd on, with the given window
+// in nanoseconds, or off if window <= 0.  Turning it off flushes what is
+// buffered.
+func SetWriteCombining(fd int, window int64) (err error) {
+	if fd < 0 {
+		return EBADF
+	}
+	combiners.Lock()
+	c := combiners.m[fd]
+	if window > 0 {
+		if c == nil {
+			c = &combiner{fd: fd}
+			if combiners.m == nil {
+				combiners.m = make(map[int]*combiner)
+			}
+			combiners.m[fd] = c
+		}
+		c.Lock()
+		c.window = window
+		c.Unlock()
+	} else if c != nil {
+		delete(combiners.m, fd)
+	}
+	atomic.StoreInt32(&combiners.n, int32(len(combiners.m)))
+	combiners.Unlock()
+	if window <= 0 && c != nil {
+		return c.flush()
+	}
+	return nil
+}
+
+func lookupCombiner(fd int) *combiner {
+	if atomic.LoadInt32(&combiners.n) == 0 {
+		return nil
+	}
+	combiners.RLock()
+	c := combiners.m[fd]
+	combiners.RUnlock()
+	return c
+}
+
+// FlushWrites writes out anything buffered for fd by write combining.
+func FlushWrites(fd int) (err error) {
+	if c := lookupCombiner(fd); c != nil {
+		return c.flush()
+	}
+	return nil
+}
+
+// flushAllWrites flushes every combining descriptor, ignoring errors.
+func flushAllWrites() {
+	if atomic.LoadInt32(&combiners.n) == 0 {
+		return
+	}
+	combiners.RLock()
+	for _, c := range combiners.m {
+		c.flush()
+	}
+	combiners.RUnlock()
+}
+
+// Close closes fd, first writing out anything combined for it.
+func Close(fd int) (err error) {
+	if lookupCombiner(fd) != nil {
+		err = SetWriteCombining(fd, 0)
+	}
+	forgetAppend(fd)
+	if e := closeBatch(fd); e != nil {
+		err = e
+	}
+	return
+}
+
+func Write(fd int, p []byte) (n int, err error) {
+	c := lookupCombiner(fd)
+	if c == nil {
+		return appendWrite(fd, p)
+	}
+	c.Lock()
+	defer c.Unlock()
+	if err = c.err; err != nil {
+		c.err = nil
+		return 0, err
+	}
+	if len(c.buf)+len(p) > combineMax {
+		if err = c.flushLocked(); err != nil {
+			return 0, err
+		}
+		if len(p) >= combineMax {
+			return appendWrite(fd, p)
+		}
+	}
+	c.buf = append(c.buf, p...)
+	if !c.scheduled {
+		c.scheduled = true
+		c.due = runtimeNano() + c.window
+		kickFlusher()
+	}
+	return len(p), nil
+}
+
+var flusher struct {
+	sync.Mutex
+	running bool
+	kicked  bool // a flush was scheduled since the flusher last looked
+}
+
+// kickFlusher makes sure flushDue runs to see a newly scheduled flush.
+func kickFlusher() {
+	flusher.Lock()
+	flusher.kicked = true
+	if !flusher.running {
+		flusher.running = true
+		go flushDue()
+	}
+	flusher.Unlock()
+}
+
+// flushDue writes out each buffer once its window has passed.  It sleeps
+// until the earliest flush is due, but never longer than the shortest
+// window, so a flush scheduled while it sleeps is at most one window
+// late.  It exits once nothing is left to flush.
+func flushDue() {
+	for {
+		flusher.Lock()
+		flusher.kicked = false
+		flusher.Unlock()
+
+		now := runtimeNano()
+		sleep := int64(-1)
+		pending := false
+		combiners.RLock()
+		for _, c := range combiners.m {
+			c.Lock()
+			if c.scheduled && now >= c.due {
+				c.scheduled = false
+				if err := c.flushLocked(); err != nil {
+					c.err = err
+				}
+			}
+			if c.scheduled {
+				pending = true
+				if sleep < 0 || c.due-now < sleep {
+					sleep = c.due - now
+				}
+			}
+			if sleep < 0 || c.window < sleep {
+				sleep = c.window
+			}
+			c.Unlock()
+		}
+		combiners.RUnlock()
+
+		if !pending {
+			flusher.Lock()
+			if !flusher.kicked {
+				flusher.running = false
+				flusher.Unlock()
+				return
+			}
+			flusher.Unlock()
+			continue
+		}
+		usec := int(sleep / 1e3)
+		if usec < 1 {
+			usec = 1
+		}
+		Block(usec)
+	}
+}
+
+func (c *combiner) flush() error {
+	c.Lock()
+	defer c.Unlock()
+	err := c.flushLocked()
+	if err == nil {
+		err, c.err = c.err, nil
+	}
+	return err
+}
+
+func (c *combiner) flushLocked() error {
+	for len(c.buf) > 0 {
+		n, err := appendWrite(c.fd, c.buf)
+		if n > 0 {
+			c.buf = c.buf[:copy(c.buf, c.buf[n:])]
+		}
+		if err != nil {
+			c.buf = c.buf[:0]
+			return err
+		}
+		if n == 0 {
+			c.buf = c.buf[:0]
+			return EIO
+		}
+	}
+	return nil
+}
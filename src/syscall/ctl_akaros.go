@@ -0,0 +1,127 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Device control.
+//
+// Akaros has no ioctl.  As in Plan 9, a device is controlled by writing
+// textual messages to the ctl file next to the file being controlled, and
+// some devices answer on a read of the same ctl file.  Ctl and CtlQuery
+// find that file for an open descriptor and talk to it; Ioctl carries out
+// the few Unix requests that have an equivalent.
+
+package syscall
+
+import "unsafe"
+
+// CtlPath returns the name of the control file for the file open on fd:
+// fd's own file if that is a ctl file, and otherwise the ctl file in the
+// same directory.
+func CtlPath(fd int) (string, error) {
+	path, err := Fd2path(fd)
+	if err != nil {
+		return "", err
+	}
+	i := len(path)
+	for i > 0 && path[i-1] != '/' {
+		i--
+	}
+	if path[i:] == "ctl" {
+		return path, nil
+	}
+	return path[:i] + "ctl", nil
+}
+
+// Ctl writes the control message msg to the control file for fd.
+func Ctl(fd int, msg string) error {
+	_, err := CtlQuery(fd, msg, nil)
+	return err
+}
+
+// CtlQuery writes the control message msg, if any, to the control file
+// for fd and then reads the device's reply into reply.  With a nil reply
+// nothing is read.
+func CtlQuery(fd int, msg string, reply []byte) (n int, err error) {
+	path, err := CtlPath(fd)
+	if err != nil {
+		return 0, err
+	}
+	cfd, err := Open(path, O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer Close(cfd)
+	if msg != "" {
+		if _, err = Write(cfd, []byte(msg)); err != nil {
+			return 0, err
+		}
+	}
+	if reply == nil {
+		return 0, nil
+	}
+	return Pread(cfd, reply, 0)
+}
+
+// SetNonblock sets or clears O_NONBLOCK on fd.
+func SetNonblock(fd int, nonblocking bool) (err error) {
+	fl, err := fcntl(fd, F_GETFL, 0)
+	if err != nil {
+		return err
+	}
+	if nonblocking {
+		fl |= O_NONBLOCK
+	} else {
+		fl &^= O_NONBLOCK
+	}
+	_, err = fcntl(fd, F_SETFL, fl)
+	return err
+}
+
+// Ioctl carries out the Unix ioctl request req on fd, for the requests
+// Akaros can honour:
+//
+//	FIONBIO   set (*arg != 0) or clear O_NONBLOCK, arg pointing to an int32
+//	FIOCLEX   set close-on-exec
+//	FIONCLEX  clear close-on-exec
+//	TCGETS    Tcgetattr, arg pointing to a Termios
+//	TCSETS    Tcsetattr with TCSANOW (TCSETSW: TCSADRAIN, TCSETSF: TCSAFLUSH)
+//	TIOCGWINSZ, TIOCSWINSZ  GetWinsize and SetWinsize, arg pointing to a Winsize
+//
+// Any other request fails with ENOTTY; use Ctl for device controls.
+func Ioctl(fd int, req uint, arg uintptr) (err error) {
+	switch req {
+	case FIONBIO:
+		if arg == 0 {
+			return EFAULT
+		}
+		return SetNonblock(fd, *(*int32)(unsafe.Pointer(arg)) != 0)
+	case FIOCLEX:
+		err = setCloseOnExec(fd, true)
+	case FIONCLEX:
+		err = setCloseOnExec(fd, false)
+	case TCGETS, TCSETS, TCSETSW, TCSETSF, TIOCGWINSZ, TIOCSWINSZ:
+		if arg == 0 {
+			return EFAULT
+		}
+		switch req {
+		case TCGETS:
+			err = Tcgetattr(fd, (*Termios)(unsafe.Pointer(arg)))
+		case TCSETS:
+			err = Tcsetattr(fd, TCSANOW, (*Termios)(unsafe.Pointer(arg)))
+		case TCSETSW:
+			err = Tcsetattr(fd, TCSADRAIN, (*Termios)(unsafe.Pointer(arg)))
+		case TCSETSF:
+			err = Tcsetattr(fd, TCSAFLUSH, (*Termios)(unsafe.Pointer(arg)))
+		case TIOCGWINSZ:
+			var ws *Winsize
+			if ws, err = GetWinsize(fd); err == nil {
+				*(*Winsize)(unsafe.Pointer(arg)) = *ws
+			}
+		case TIOCSWINSZ:
+			err = SetWinsize(fd, (*Winsize)(unsafe.Pointer(arg)))
+		}
+	default:
+		err = ENOTTY
+	}
+	return
+}
@@ -0,0 +1,246 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Event queues.
+//
+// The Akaros kernel reports what happens to a process by posting event
+// messages to event queues in the process's memory.  An EventQueue is
+// such a queue, paired with a pipe whose read end, Fd, is readable
+// whenever messages are waiting, so that a program can wait for kernel
+// events alongside its other descriptors.  A goroutine moves messages
+// from the kernel queue to the EventQueue as they arrive; Next takes
+// them off without blocking and Wait blocks for one.
+//
+// The kernel is told to post to the queue by passing it the queue's
+// address, Ptr, in the requests that take one, such as FD taps.
+
+package syscall
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// evqArg is laid out as gcc_evq_arg_t in runtime/parlib/gcc_akaros.h.
+type evqArg struct {
+	evq uintptr // struct event_queue *
+	msg EventMsg
+}
+
+// Implemented in the runtime.
+func runtime_evqNew(a *evqArg)
+func runtime_evqWait(a *evqArg)
+func runtime_evqFree(a *evqArg)
+func runtime_evqSubmit(evq uintptr, s *Syscall_struct) (done bool)
+
+// An EventQueue is an Akaros event queue that can be polled as a file
+// descriptor.
+type EventQueue struct {
+	evq uintptr
+	r   int // read end of the pipe; readable while msgs is not empty
+	w   int
+
+	mu     sync.Mutex
+	cond   sync.Cond
+	msgs   []EventMsg
+	closed bool
+	wake   *Syscall_struct       // completion posted by Close to stop the pump
+	woken  bool                  // the pump has seen wake's completion
+	timers map[uintptr]*evqTimer // waitUntil deadlines the kernel still has
+	freed  chan struct{}         // closed once the kernel queue is freed
+}
+
+// An evqTimer is a kernel sleep posting its completion to the queue, to
+// end a waitUntil at its deadline.  The pump takes the completion out of
+// the stream and drops the timer from EventQueue.timers, keyed by the
+// address of s, which keeps it reachable while the kernel has it.
+type evqTimer struct {
+	s     Syscall_struct
+	fired bool
+}
+
+// NewEventQueue returns a new, empty event queue.
+func NewEventQueue() (*EventQueue, error) {
+	var p [2]int
+	if err := Pipe(p[:], O_CLOEXEC|O_NONBLOCK); err != nil {
+		return nil, err
+	}
+	var a evqArg
+	runtime_evqNew(&a)
+	q := &EventQueue{evq: a.evq, r: p[0], w: p[1], freed: make(chan struct{})}
+	q.cond.L = &q.mu
+	registerEventQueue(q, true)
+	go q.pump()
+	return q, nil
+}
+
+// pump moves messages from the kernel queue to q.msgs until q is closed.
+// Completions of waitUntil's timers are not messages; the pump notes them
+// and drops them.
+func (q *EventQueue) pump() {
+	a := evqArg{evq: q.evq}
+	for {
+		runtime_evqWait(&a)
+		q.mu.Lock()
+		key := uintptr(unsafe.Pointer(a.msg.Arg3))
+		timer := false
+		if t := q.timers[key]; t != nil {
+			delete(q.timers, key)
+			t.fired = true
+			timer = true
+			q.cond.Broadcast()
+		}
+		if q.closed {
+			// Only free the queue once the kernel is done with it:
+			// it has completed the wake-up and every timer.
+			if key == uintptr(unsafe.Pointer(q.wake)) {
+				q.woken = true
+			}
+			done := q.woken && len(q.timers) == 0
+			q.mu.Unlock()
+			if done {
+				break
+			}
+			continue
+		}
+		if !timer {
+			if len(q.msgs) == 0 {
+				write(q.w, []byte{0})
+			}
+			q.msgs = append(q.msgs, a.msg)
+			q.cond.Broadcast()
+		}
+		q.mu.Unlock()
+	}
+	runtime_evqFree(&a)
+	closeBatch(q.r)
+	closeBatch(q.w)
+	close(q.freed)
+}
+
+// Fd returns a descriptor that is readable while messages are waiting in
+// q.  The descriptor belongs to q: read it only through Next and Wait.
+func (q *EventQueue) Fd() int {
+	return q.r
+}
+
+// Ptr returns the address of the kernel event queue, to hand to the
+// kernel in requests that post events.
+func (q *EventQueue) Ptr() uintptr {
+	return q.evq
+}
+
+// Next removes the first message from q into m.  If there is none it
+// returns EAGAIN without waiting.
+func (q *EventQueue) Next(m *EventMsg) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return EBADF
+	}
+	if len(q.msgs) == 0 {
+		return EAGAIN
+	}
+	q.take(m)
+	return nil
+}
+
+// Wait removes the first message from q into m, waiting for one to
+// arrive if need be.
+func (q *EventQueue) Wait(m *EventMsg) error {
+	return q.waitUntil(m, 0)
+}
+
+// waitUntil is Wait giving up with EAGAIN at runtimeNano time deadline,
+// unless deadline is 0.  The deadline is a kernel sleep posting to q
+// itself, so nothing outlives the wait: a wait that ends early aborts the
+// sleep, and the pump drops its completion.
+func (q *EventQueue) waitUntil(m *EventMsg, deadline int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	expired := false
+	var t *evqTimer
+	if deadline != 0 && !q.closed {
+		if d := deadline - runtimeNano(); d <= 0 {
+			expired = true
+		} else {
+			t = q.startTimer((d + 999) / 1000)
+		}
+	}
+	for len(q.msgs) == 0 && !q.closed && !expired && (t == nil || !t.fired) {
+		q.cond.Wait()
+	}
+	if t != nil && !t.fired {
+		t.abort()
+	}
+	if q.closed {
+		return EBADF
+	}
+	if len(q.msgs) == 0 {
+		return EAGAIN
+	}
+	q.take(m)
+	return nil
+}
+
+// startTimer starts a kernel sleep of usec microseconds that posts its
+// completion to q.  q.mu is held.
+func (q *EventQueue) startTimer(usec int64) *evqTimer {
+	t := &evqTimer{s: Syscall_struct{num: SYS_BLOCK, arg0: uintptr(usec)}}
+	key := uintptr(unsafe.Pointer(&t.s))
+	if q.timers == nil {
+		q.timers = make(map[uintptr]*evqTimer)
+	}
+	q.timers[key] = t
+	if runtime_evqSubmit(q.evq, &t.s) {
+		// Done already; nothing will be posted.
+		delete(q.timers, key)
+		t.fired = true
+	}
+	return t
+}
+
+// abort cuts t's sleep short.  Its completion still goes to the pump.
+func (t *evqTimer) abort() {
+	RawSyscall(SYS_ABORT_SYSC, uintptr(unsafe.Pointer(&t.s)), 0, 0)
+}
+
+// take moves q.msgs[0] to m, draining the pipe when q.msgs empties.
+// q.mu is held.
+func (q *EventQueue) take(m *EventMsg) {
+	*m = q.msgs[0]
+	copy(q.msgs, q.msgs[1:])
+	q.msgs = q.msgs[:len(q.msgs)-1]
+	if len(q.msgs) == 0 {
+		var b [1]byte
+		Read(q.r, b[:])
+	}
+}
+
+// Close stops q and closes its descriptor.  Wait calls blocked on q
+// return EBADF.  The caller must first withdraw every request that has
+// the kernel posting to q.
+func (q *EventQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return EBADF
+	}
+	q.closed = true
+	q.cond.Broadcast()
+	registerEventQueue(q, false)
+	for _, t := range q.timers {
+		t.abort()
+	}
+
+	// Wake the pump with the completion of a short sleep.
+	for {
+		q.wake = &Syscall_struct{num: SYS_BLOCK, arg0: 1000}
+		if !runtime_evqSubmit(q.evq, q.wake) {
+			break
+		}
+	}
+	q.mu.Unlock()
+	return nil
+}
@@ -6,10 +6,7 @@
 
 package syscall
 
-import (
-	"unsafe"
-	"usys"
-)
+import "unsafe"
 
 // ProcAttr holds attributes that will be applied to a new process started
 // by StartProcess.
@@ -22,8 +19,11 @@ type ProcAttr struct {
 
 var zeroProcAttr ProcAttr
 
-// Undefined on Akaros
-type SysProcAttr struct{}
+type SysProcAttr struct {
+	// Fds describes descriptors in ProcAttr.Files for the child's
+	// benefit; see FdManifestEnv.
+	Fds []InheritedFd
+}
 
 var zeroSysProcAttr SysProcAttr
 
@@ -43,35 +43,207 @@ func SlicePtrFromStrings(ss []string) ([]*byte, error) {
 	return bb, nil
 }
 
-// This is allocated in C, and must stay in sync with parlib/serialize.h.  Buf
-// is an open-ended C array.
+// PackedPtrsFromStrings is like SlicePtrFromStrings, but copies all the
+// strings, NUL-terminated, into one shared buffer, so that converting a
+// large environment costs two allocations instead of one per string.
+func PackedPtrsFromStrings(ss []string) ([]*byte, error) {
+	n := 0
+	for _, s := range ss {
+		if hasNUL(s) {
+			return nil, EINVAL
+		}
+		n += len(s) + 1
+	}
+	buf := make([]byte, n)
+	bb := make([]*byte, len(ss)+1)
+	off := 0
+	for i, s := range ss {
+		copy(buf[off:], s)
+		bb[i] = &buf[off]
+		off += len(s) + 1
+	}
+	return bb, nil
+}
+
+// SerializedData is argv and envp packed as parlib's serialize_argv_envp
+// packs them (see parlib/serialize.h), ready to hand to the kernel.  Buf
+// holds argc and envc, then one offset into Buf per argument and per
+// variable, then the NUL-terminated strings themselves.
 type SerializedData struct {
 	Len uintptr
-	Buf [1]byte
+	Buf []byte
 }
 
+// SerializeArgvEnvp packs argv and envp, which must each end with a nil
+// pointer, as SlicePtrFromStrings returns them, into the form the kernel
+// takes for a new program.
 func SerializeArgvEnvp(argv []*byte, envp []*byte) (sd *SerializedData, err error) {
-	p_argv := (unsafe.Pointer(&argv[0]))
-	p_envp := (unsafe.Pointer(&envp[0]))
+	if len(argv) == 0 || argv[len(argv)-1] != nil || len(envp) == 0 || envp[len(envp)-1] != nil {
+		return nil, EINVAL
+	}
+	argv, envp = argv[:len(argv)-1], envp[:len(envp)-1]
+	const word = int(unsafe.Sizeof(uintptr(0)))
+
+	n := (2 + len(argv) + len(envp)) * word
+	for _, p := range argv {
+		n += clenPtr(p) + 1
+	}
+	for _, p := range envp {
+		n += clenPtr(p) + 1
+	}
+	buf := make([]byte, n)
 
-	__sd := usys.Call(usys.USYS_SERIALIZE_ARGV_ENVP, uintptr(p_argv), uintptr(p_envp))
-	if __sd == 0 {
-		err = NewAkaError(1, "SerializeArgvEnvp: error packing argv and envp")
-	} else {
-		sd = (*SerializedData)(unsafe.Pointer(uintptr(__sd)))
+	putWord := func(off int, v uintptr) {
+		*(*uintptr)(unsafe.Pointer(&buf[off])) = v
 	}
-	return sd, err
+	putWord(0, uintptr(len(argv)))
+	putWord(word, uintptr(len(envp)))
+	ptr := 2 * word
+	str := (2 + len(argv) + len(envp)) * word
+	for _, list := range [][]*byte{argv, envp} {
+		for _, p := range list {
+			putWord(ptr, uintptr(str))
+			ptr += word
+			l := clenPtr(p)
+			copy(buf[str:str+l], (*[1 << 30]byte)(unsafe.Pointer(p))[:l])
+			str += l + 1
+		}
+	}
+	return &SerializedData{Len: uintptr(n), Buf: buf}, nil
 }
 
-func getSDBuffer(sd *SerializedData) uintptr {
-	return uintptr(unsafe.Pointer(&sd.Buf[0]))
+// clenPtr returns the length of the NUL-terminated string at p.
+func clenPtr(p *byte) int {
+	n := 0
+	for *(*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + uintptr(n))) != 0 {
+		n++
+	}
+	return n
 }
 
+// programArgv returns the argument vector for running the program at
+// path argv0.  The program is found by argv0 alone, so argv[0] is free to
+// be anything the caller wants the program to see as its name.  An empty
+// argv gets argv0 as its only element, since most programs assume that
+// argv[0] is there.
+func programArgv(argv0 string, argv []string) ([]string, error) {
+	if argv0 == "" {
+		return nil, ENOENT
+	}
+	if len(argv) == 0 {
+		return []string{argv0}, nil
+	}
+	return argv, nil
+}
+
+// ArgMax is the largest argv and environment, as packed by
+// SerializeArgvEnvp, that the kernel will take from a new process.
+const ArgMax = 128 << 10
+
+// argEnvSize is the space s takes up in the packed form: the string, its
+// NUL, and a pointer to it.
+func argEnvSize(s string) int {
+	return len(s) + 1 + int(unsafe.Sizeof(uintptr(0)))
+}
+
+func hasNUL(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupEnv returns env with only the last entry for each variable kept,
+// as a Linux exec would present it to the child.  Names are compared
+// exactly, so their case is preserved and matters.  Entries are kept in
+// the order of the ones that survive.
+func dedupEnv(env []string) []string {
+	seen := make(map[string]bool, len(env))
+	out := make([]string, len(env))
+	n := len(out)
+	for i := len(env) - 1; i >= 0; i-- {
+		k := envName(env[i])
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		n--
+		out[n] = env[i]
+	}
+	return out[n:]
+}
+
+// envName returns the variable name of an environment entry.
+func envName(kv string) string {
+	for i := 0; i < len(kv); i++ {
+		if kv[i] == '=' {
+			return kv[:i]
+		}
+	}
+	return kv
+}
+
+// checkArgvEnvp reports, before anything is packed or sent to the kernel,
+// why argv and env cannot be passed to a new process.  The error names
+// the argument or variable at fault.
+func checkArgvEnvp(argv, env []string) error {
+	total := 2 * int(unsafe.Sizeof(uintptr(0))) // argc and envc
+	big, bigSize := "", -1
+	for i, s := range argv {
+		what := "argument " + itoa(i)
+		if hasNUL(s) {
+			return NewAkaError(EINVAL, what+" contains a NUL byte")
+		}
+		total += argEnvSize(s)
+		if argEnvSize(s) > bigSize {
+			big, bigSize = what, argEnvSize(s)
+		}
+	}
+	for _, kv := range env {
+		what := "environment variable " + envName(kv)
+		if hasNUL(kv) {
+			return NewAkaError(EINVAL, what+" contains a NUL byte")
+		}
+		total += argEnvSize(kv)
+		if argEnvSize(kv) > bigSize {
+			big, bigSize = what, argEnvSize(kv)
+		}
+	}
+	if total > ArgMax {
+		return NewAkaError(E2BIG, "argument list too long: argv and environment take "+
+			itoa(total)+" bytes, limit is "+itoa(ArgMax)+"; largest is "+
+			big+" at "+itoa(bigSize)+" bytes")
+	}
+	return nil
+}
+
+// FreeSerializedData does nothing.  SerializedData is garbage collected
+// like any other Go value; the function is kept for existing callers.
 func FreeSerializedData(sd *SerializedData) {
-	usys.Call1(usys.USYS_FREE, uintptr(unsafe.Pointer(sd)))
 }
 
 func StartProcess(argv0 string, argv []string, attr *ProcAttr) (pid int, handle uintptr, err error) {
+	pid, err = PrepareProcess(argv0, argv, attr)
+	if err != nil {
+		return 0, 0, err
+	}
+	t := spawnBegin()
+	err = ProcRun(pid)
+	spawnEnd(pid, SpawnRun, t, err)
+	if err != nil {
+		proc_destroy(pid, 0)
+		return 0, 0, err
+	}
+	return pid, 0, nil
+}
+
+// PrepareProcess does everything StartProcess does except let the child
+// run: the process is created, its descriptors are duplicated and its
+// working directory is set, and it then waits until ProcRun(pid) starts
+// it or Kill(pid, SIGKILL) discards it.
+func PrepareProcess(argv0 string, argv []string, attr *ProcAttr) (pid int, err error) {
 	if attr == nil {
 		attr = &zeroProcAttr
 	}
@@ -80,44 +252,56 @@ func StartProcess(argv0 string, argv []string, attr *ProcAttr) (pid int, handle
 		sys = &zeroSysProcAttr
 	}
 
+	argv, err = programArgv(argv0, argv)
+	if err != nil {
+		return 0, err
+	}
+
 	// Convert args to C form.
 	argv0p, err := ByteSliceFromString(argv0)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-	argvp, err := SlicePtrFromStrings(argv)
+	argvp, err := PackedPtrsFromStrings(argv)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-	envvp, err := SlicePtrFromStrings(attr.Env)
+	env, err := withFdManifest(withRlimits(dedupEnv(attr.Env)), sys.Fds, attr.Files)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
+	}
+	if err := checkArgvEnvp(argv, env); err != nil {
+		return 0, err
+	}
+	envvp, err := PackedPtrsFromStrings(env)
+	if err != nil {
+		return 0, err
 	}
 
-	// Kick off child.
-	pid, err = startProcess(argv0p, argvp, envvp, attr.Dir, attr.Files)
-
-	// Return the pid and the error if there was one
-	return pid, 0, err
+	return prepareProcess(argv0p, argvp, envvp, attr.Dir, attr.Files)
 }
 
-func startProcess(argv0 []byte, argv, envv []*byte, dir string, files []uintptr) (pid int, err error) {
+func prepareProcess(argv0 []byte, argv, envv []*byte, dir string, files []uintptr) (pid int, err error) {
 	// Adjust argv0 to prepend 'dir' if argv0 is a relative path
-	if argv0[0] != '/' {
-		if len(dir) > 0 {
-			argv0 = append([]byte(dir[:len(dir)-1]),
-			               append([]byte{'/'}, argv0...)...)
+	if argv0[0] != '/' && len(dir) > 0 {
+		if dir[len(dir)-1] != '/' {
+			dir += "/"
 		}
+		argv0 = append([]byte(dir), argv0...)
 	}
 
+	t := spawnBegin()
 	sd, err := SerializeArgvEnvp(argv, envv)
+	spawnEnd(0, SpawnSerialize, t, err)
 	if err != nil {
 		return 0, err
 	}
-	// sd was allocated in C, so it's not a Go object/pointer.  We don't
-	// need to worry about stack splits or garbage collection.
-	child, err := ProcCreate(argv0, getSDBuffer(sd), sd.Len, 0)
-	FreeSerializedData(sd)
+	// The kernel copies sd.Buf during the call.
+	var pin Pinner
+	t = spawnBegin()
+	child, err := ProcCreate(argv0, pin.Pin(unsafe.Pointer(&sd.Buf[0])), sd.Len, 0)
+	pin.Unpin()
+	spawnEnd(child, SpawnCreate, t, err)
 	if err != nil {
 		return 0, err
 	}
@@ -134,38 +318,76 @@ func startProcess(argv0 []byte, argv, envv []*byte, dir string, files []uintptr)
 
 	// We're relying on the slice internals; that the contents are an array
 	// of objects.
+	t = spawnBegin()
+	ForkLock.Lock()
+	restore := inheritFds(files)
 	_, err = DupFdsTo(child, &__cfdm[0], len(__cfdm))
+	restore()
+	ForkLock.Unlock()
+	spawnEnd(child, SpawnDup, t, err)
 	if err != nil {
+		proc_destroy(child, 0)
 		return 0, err
 	}
 
 	if len(dir) > 0 {
+		t = spawnBegin()
 		err = chdir(child, dir)
+		spawnEnd(child, SpawnChdir, t, err)
 		if err != nil {
+			proc_destroy(child, 0)
 			return 0, err
 		}
 	}
 
-	err = ProcRun(child)
+	return child, nil
+}
+
+// execCheck makes the checks the kernel's exec makes before it starts
+// replacing the process image: that argv0 opens and is an ELF file.
+// Past them, exec does not return.
+func execCheck(argv0 string) error {
+	fd, err := Open(argv0, O_RDONLY|O_CLOEXEC, 0)
 	if err != nil {
-		return 0, err
+		return err
 	}
-
-	return child, nil
+	defer Close(fd)
+	var hdr [4]byte
+	n, err := Pread(fd, hdr[:], 0)
+	if err != nil {
+		return err
+	}
+	if n < len(hdr) || string(hdr[:]) != "\x7fELF" {
+		return NewAkaError(ENOEXEC, argv0+" is not an ELF executable")
+	}
+	return nil
 }
 
 // Ordinary exec.
 func Exec(argv0 string, argv []string, envv []string) (err error) {
+	argv, err = programArgv(argv0, argv)
+	if err != nil {
+		return err
+	}
+	// The exec'd image gets no manifest: nothing describes its
+	// descriptors to it.
+	envv, err = withFdManifest(withRlimits(dedupEnv(envv)), nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkArgvEnvp(argv, envv); err != nil {
+		return err
+	}
 	// Convert args to C form.
 	argv0p, err := ByteSliceFromString(argv0)
 	if err != nil {
 		return err
 	}
-	argvp, err := SlicePtrFromStrings(argv)
+	argvp, err := PackedPtrsFromStrings(argv)
 	if err != nil {
 		return err
 	}
-	envvp, err := SlicePtrFromStrings(envv)
+	envvp, err := PackedPtrsFromStrings(envv)
 	if err != nil {
 		return err
 	}
@@ -173,9 +395,17 @@ func Exec(argv0 string, argv []string, envv []string) (err error) {
 	if err != nil {
 		return err
 	}
-	err = exec(argv0p, getSDBuffer(sd), sd.Len)
-	FreeSerializedData(sd)
+	// The new image must not inherit the kernel's registrations on
+	// this one's memory, but the old one keeps them for as long as exec
+	// can still fail and return to it.
+	if err := execCheck(argv0); err != nil {
+		return err
+	}
+	teardown("exec")
+	var pin Pinner
+	ForkLock.Lock()
+	err = exec(argv0p, pin.Pin(unsafe.Pointer(&sd.Buf[0])), sd.Len)
+	ForkLock.Unlock()
+	pin.Unpin()
 	return err
 }
-
-func CloseOnExec(fd int) { fcntl(fd, F_SETFD, FD_CLOEXEC) }
@@ -0,0 +1,59 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Allocation-free system calls.
+//
+// A tight loop of Read, Write or Stat calls should not allocate.  Three
+// things used to make every call reach the heap:
+//
+//   - The Syscall_struct a wrapper hands to goSyscall, about 200 bytes.
+//     goSyscall registers it with the runtime for PendingSyscalls, which
+//     made it escape.  The runtime forgets it before goSyscall returns,
+//     and usys keeps the goroutine in the syscall state, where its stack
+//     cannot move, for the whole call, so it now lives in the wrapper's
+//     frame.
+//
+//   - The copy of every string argument made to add a NUL.  Akaros takes
+//     each string as a pointer and a length and copies it itself, so the
+//     wrappers now pass the string's own bytes.
+//
+//   - The error.  A failed call whose errno the kernel did not explain
+//     with a string returns one of a fixed set of errors, one per errno,
+//     instead of a new one.  Loops that poll a non-blocking descriptor
+//     see EAGAIN this way.
+
+package syscall
+
+import "unsafe"
+
+// errnoErrors holds the error returned for each errno with no errstr.
+var errnoErrors = func() (e [len(errors)]AkaError) {
+	for i := range e {
+		e[i].errno = Errno(i)
+	}
+	return
+}()
+
+// errnoError returns the error for errno with no errstr.
+func errnoError(errno Errno) error {
+	if uintptr(errno) < uintptr(len(errnoErrors)) {
+		return &errnoErrors[errno]
+	}
+	return NewAkaError(errno, "")
+}
+
+// stringArg returns a pointer to the bytes of s, to be passed to the
+// kernel along with len(s).  Like BytePtrFromString, it rejects a string
+// with a NUL byte in it, which the kernel would cut short.
+func stringArg(s string) (*byte, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 {
+			return nil, EINVAL
+		}
+	}
+	if len(s) == 0 {
+		return (*byte)(unsafe.Pointer(&_zero)), nil
+	}
+	return *(**byte)(unsafe.Pointer(&s)), nil
+}
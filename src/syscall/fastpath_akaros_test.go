@@ -0,0 +1,38 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall_test
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestHotSyscallsDoNotAllocate(t *testing.T) {
+	var p [2]int
+	if err := syscall.Pipe(p[:], 0); err != nil {
+		t.Fatalf("Pipe: %v", err)
+	}
+	defer syscall.Close(p[0])
+	defer syscall.Close(p[1])
+
+	buf := make([]byte, 64)
+	var st syscall.Stat_t
+	tests := []struct {
+		name string
+		f    func()
+	}{
+		{"Write", func() { syscall.Write(p[1], buf) }},
+		{"Read", func() { syscall.Read(p[0], buf) }},
+		{"Stat", func() { syscall.Stat("/", &st) }},
+		{"Fstat", func() { syscall.Fstat(p[0], &st) }},
+	}
+	for _, tt := range tests {
+		// Every Write runs before the first Read and the pipe holds
+		// them all, so Read never blocks.
+		if n := testing.AllocsPerRun(100, tt.f); n != 0 {
+			t.Errorf("%s: %v allocations per call, want 0", tt.name, n)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Kernel version and feature detection.
+//
+// Akaros kernels differ in which system calls they implement.  Rather than
+// assuming the newest kernel and failing at the first missing call, the
+// wrappers here probe for optional facilities once, with arguments that can
+// only fail, and cache the answer.  The same answers are exported so that
+// applications can pick a strategy up front.
+
+package syscall
+
+import "sync/atomic"
+
+// A Feature is an optional kernel facility that HasFeature can probe for.
+type Feature int
+
+const (
+	// FeatureFdTaps reports support for SYS_TAP_FDS, which the epoll
+	// shim and any poller built on event queues depend on.
+	FeatureFdTaps Feature = iota
+
+	// FeatureOpenCloexec reports that open honours O_CLOEXEC.  Without
+	// it Open sets close-on-exec itself, holding ForkLock.
+	FeatureOpenCloexec
+
+	numFeatures
+)
+
+var featureNames = [...]string{
+	FeatureFdTaps:      "fd-taps",
+	FeatureOpenCloexec: "open-cloexec",
+}
+
+func (f Feature) String() string {
+	if f >= 0 && f < numFeatures {
+		return featureNames[f]
+	}
+	return "feature" + itoa(int(f))
+}
+
+const (
+	featureUnknown = iota
+	featurePresent
+	featureAbsent
+)
+
+var features [numFeatures]int32
+
+// featureProbes issue the cheapest call that tells a kernel with the
+// feature from one without it.
+var featureProbes = [...]func() bool{
+	FeatureFdTaps: func() bool { return probeSyscall(SYS_TAP_FDS, 0, 0) },
+	FeatureOpenCloexec: func() bool {
+		fd, err := openat(_AT_FDCWD, "/", O_RDONLY|O_CLOEXEC, 0)
+		if err != nil {
+			return false
+		}
+		fl, err := fcntl(fd, F_GETFD, 0)
+		closeBatch(fd)
+		return err == nil && fl&FD_CLOEXEC != 0
+	},
+}
+
+// HasFeature reports whether the running kernel supports f.  The first
+// call for each feature may issue a probing system call; the answer is
+// cached for the life of the process.
+func HasFeature(f Feature) bool {
+	if f < 0 || f >= numFeatures {
+		return false
+	}
+	switch atomic.LoadInt32(&features[f]) {
+	case featurePresent:
+		return true
+	case featureAbsent:
+		return false
+	}
+	ok := featureProbes[f]()
+	setFeature(f, ok)
+	return ok
+}
+
+func setFeature(f Feature, ok bool) {
+	if ok {
+		atomic.CompareAndSwapInt32(&features[f], featureUnknown, featurePresent)
+	} else {
+		atomic.StoreInt32(&features[f], featureAbsent)
+	}
+}
+
+// probeSyscall issues system call num with args and reports whether the
+// kernel implements it, whatever else the result.
+func probeSyscall(num uintptr, args ...uintptr) bool {
+	var a [6]uintptr
+	copy(a[:], args)
+	_, _, e := Syscall6(num, a[0], a[1], a[2], a[3], a[4], a[5])
+	return e != ENOSYS
+}
+
+// AkarosVersion returns the version string of the running kernel, as
+// reported by the #version device.
+func AkarosVersion() (string, error) {
+	fd, err := Open("#version/version", O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer Close(fd)
+	var buf [128]byte
+	n, err := Read(fd, buf[:])
+	if err != nil {
+		return "", err
+	}
+	for n > 0 && (buf[n-1] == '\n' || buf[n-1] == ' ' || buf[n-1] == 0) {
+		n--
+	}
+	return string(buf[:n]), nil
+}
+
+func mcpStatus() (mcp bool, errno int32) // in runtime
+
+// MCPStatus reports whether the process became a multicore process (MCP)
+// at startup.  If it did not, err is the reason the kernel gave, or nil
+// if GOSINGLECORE asked the runtime to stay on one vcore; either way the
+// runtime is then running every goroutine on a single vcore.
+func MCPStatus() (mcp bool, err error) {
+	mcp, e := mcpStatus()
+	if e != 0 {
+		err = Errno(e)
+	}
+	return
+}
@@ -0,0 +1,96 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+import (
+	"sync/atomic"
+	"unsafe"
+	"usys"
+)
+
+// An InterruptPolicy determines what the system call wrappers do with a
+// call that the kernel completed with EINTR because an event was delivered
+// to the process while the call was blocked.
+type InterruptPolicy int32
+
+const (
+	// InterruptPropagate returns EINTR to the caller.
+	InterruptPropagate InterruptPolicy = iota
+
+	// InterruptRetry transparently reissues the call, up to the retry
+	// limit set with SetInterruptPolicy.
+	InterruptRetry
+)
+
+// DefaultInterruptRetries is the retry limit used until SetInterruptPolicy
+// is called.
+const DefaultInterruptRetries = 16
+
+var (
+	interruptPolicy  = int32(InterruptRetry)
+	interruptRetries = int32(DefaultInterruptRetries)
+
+	// abortGen is bumped every time this process asks the kernel to abort
+	// an outstanding system call, and deadlineRegions counts the callers
+	// currently inside RunWithDeadline.  An interruption that may have
+	// been caused by either is always propagated: the abort is the point.
+	abortGen        uint32
+	deadlineRegions int32
+)
+
+// SetInterruptPolicy sets the policy applied to interrupted system calls
+// and returns the previous one.  With InterruptRetry, a call is reissued
+// at most retries times before EINTR is returned; retries <= 0 means no
+// limit.
+func SetInterruptPolicy(policy InterruptPolicy, retries int) (oldPolicy InterruptPolicy, oldRetries int) {
+	oldPolicy = InterruptPolicy(atomic.SwapInt32(&interruptPolicy, int32(policy)))
+	oldRetries = int(atomic.SwapInt32(&interruptRetries, int32(retries)))
+	return
+}
+
+// goSyscall issues the system call described by s, asynchronously if it
+// can (see async_akaros.go) and otherwise through usys, and applies the
+// interrupt policy to the result.  It is the single entry point used by
+// the generated wrappers in zsyscall_akaros_*.go.
+//
+// The arguments in s may be raw pointers into the caller's stack, so
+// nothing on this path may split the stack.
+//go:nosplit
+func goSyscall(s *Syscall_struct) {
+	gen := atomic.LoadUint32(&abortGen)
+	runtime_syscallBegin(unsafe.Pointer(s))
+	for tries := 0; ; tries++ {
+		if !asyncBlocking || !runtime_syscallAsync(unsafe.Pointer(s)) {
+			usys.Call1(usys.USYS_GO_SYSCALL, uintptr(unsafe.Pointer(s)))
+		}
+		if s.err != int32(EINTR) || !retryInterrupted(gen, tries) {
+			runtime_syscallEnd()
+			return
+		}
+		s.err = 0
+		s.retval = 0
+		s.flags = 0
+		s.errstr[0] = 0
+	}
+}
+
+// Implemented in the runtime; they record the call for
+// runtime.PendingSyscalls.  The runtime drops s in runtime_syscallEnd,
+// so s does not escape and the wrappers can keep their Syscall_struct on
+// the stack (see fastpath_akaros.go).
+//go:noescape
+func runtime_syscallBegin(s unsafe.Pointer)
+func runtime_syscallEnd()
+
+//go:nosplit
+func retryInterrupted(gen uint32, tries int) bool {
+	if atomic.LoadInt32(&interruptPolicy) != int32(InterruptRetry) {
+		return false
+	}
+	if max := atomic.LoadInt32(&interruptRetries); max > 0 && tries >= int(max) {
+		return false
+	}
+	return atomic.LoadInt32(&deadlineRegions) == 0 && atomic.LoadUint32(&abortGen) == gen
+}
@@ -0,0 +1,182 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Latency microbenchmarks.
+//
+// How fast the port is depends as much on the kernel it runs on as on
+// the Go code, so the measurements that matter ship with every binary.
+// LatencyBenchmarks times the operations the runtime and this package
+// lean on hardest:
+//
+//	spawn         StartProcess of the program itself, until it has exited
+//	null-syscall  a round trip into the kernel with SYS_NULL
+//	wakeup        one goroutine blocked in the kernel waking another
+//	timer         how late Block(1000) returns
+//
+// Setting the environment variable BenchEnv to 1 runs them once every
+// package has been initialized, just before main.main, and prints the
+// results on standard error.  BenchEnv is then unset, so that processes
+// the program starts do not run them again, and the program carries on
+// as usual.
+
+package syscall
+
+import "sync/atomic"
+
+// BenchEnv is the environment variable that asks for the benchmarks at
+// start-up.  The copies of the program started by the spawn benchmark
+// find it set to "child" and exit at once.
+const BenchEnv = "GOAKAROSBENCH"
+
+// A LatencyBenchmark is the result of one latency microbenchmark.
+type LatencyBenchmark struct {
+	Name string
+	N    int   // operations timed
+	Mean int64 // nanoseconds
+	Max  int64 // nanoseconds
+	Err  error // why the benchmark stopped early, if it did
+}
+
+func runtime_args() []string
+func runtime_setBeforeMain(f func())
+
+func init() {
+	switch s, _ := Getenv(BenchEnv); s {
+	case "child":
+		Exit(0)
+	case "1":
+		runtime_setBeforeMain(printLatencyBenchmarks)
+	}
+}
+
+func printLatencyBenchmarks() {
+	for _, b := range LatencyBenchmarks() {
+		msg := "akarosbench: " + b.Name + " n=" + itoa(b.N) +
+			" mean=" + itoa(int(b.Mean)) + "ns max=" + itoa(int(b.Max)) + "ns"
+		if b.Err != nil {
+			msg += " error: " + b.Err.Error()
+		}
+		write(2, []byte(msg+"\n"))
+	}
+	Unsetenv(BenchEnv)
+}
+
+// LatencyBenchmarks runs the latency microbenchmarks and returns their
+// results.  It takes about a second.
+func LatencyBenchmarks() []LatencyBenchmark {
+	return []LatencyBenchmark{
+		benchSpawn(20),
+		benchNullSyscall(10000),
+		benchWakeup(1000),
+		benchTimer(100),
+	}
+}
+
+// timing accumulates the durations of one benchmark.
+type timing struct {
+	b     LatencyBenchmark
+	total int64
+}
+
+func (t *timing) add(d int64) {
+	t.b.N++
+	t.total += d
+	if d > t.b.Max {
+		t.b.Max = d
+	}
+}
+
+func (t *timing) result() LatencyBenchmark {
+	if t.b.N > 0 {
+		t.b.Mean = t.total / int64(t.b.N)
+	}
+	return t.b
+}
+
+func benchSpawn(n int) LatencyBenchmark {
+	t := timing{b: LatencyBenchmark{Name: "spawn"}}
+	args := runtime_args()
+	if len(args) == 0 {
+		t.b.Err = ENOENT
+		return t.result()
+	}
+	attr := &ProcAttr{
+		Env:   []string{BenchEnv + "=child"},
+		Files: []uintptr{0, 1, 2},
+	}
+	for i := 0; i < n; i++ {
+		start := runtimeNano()
+		pid, _, err := StartProcess(args[0], args[:1], attr)
+		if err == nil {
+			_, err = Waitpid(pid, nil, 0)
+		}
+		if err != nil {
+			t.b.Err = err
+			break
+		}
+		t.add(runtimeNano() - start)
+	}
+	return t.result()
+}
+
+func benchNullSyscall(n int) LatencyBenchmark {
+	t := timing{b: LatencyBenchmark{Name: "null-syscall"}}
+	for i := 0; i < n; i++ {
+		start := runtimeNano()
+		if _, _, e := Syscall(SYS_NULL, 0, 0, 0); e != 0 {
+			t.b.Err = e
+			break
+		}
+		t.add(runtimeNano() - start)
+	}
+	return t.result()
+}
+
+// benchWakeup times a ping-pong between two goroutines, each waiting for
+// the other in a futex, so that each wakeup crosses from one vcore to
+// another when there is more than one.  A round trip is two wakeups.
+func benchWakeup(n int) LatencyBenchmark {
+	t := timing{b: LatencyBenchmark{Name: "wakeup"}}
+	var ping, pong uint32
+	done := make(chan bool)
+	go func() {
+		for i := uint32(1); i <= uint32(n); i++ {
+			for atomic.LoadUint32(&ping) != i {
+				futexWait(&ping, i-1, nil)
+			}
+			atomic.StoreUint32(&pong, i)
+			futexWake(&pong)
+		}
+		done <- true
+	}()
+	for i := uint32(1); i <= uint32(n); i++ {
+		start := runtimeNano()
+		atomic.StoreUint32(&ping, i)
+		futexWake(&ping)
+		for atomic.LoadUint32(&pong) != i {
+			futexWait(&pong, i-1, nil)
+		}
+		t.add((runtimeNano() - start) / 2)
+	}
+	<-done
+	return t.result()
+}
+
+// benchTimer times how far past the requested millisecond Block sleeps.
+func benchTimer(n int) LatencyBenchmark {
+	t := timing{b: LatencyBenchmark{Name: "timer"}}
+	for i := 0; i < n; i++ {
+		start := runtimeNano()
+		if err := Block(1000); err != nil {
+			t.b.Err = err
+			break
+		}
+		late := runtimeNano() - start - 1e6
+		if late < 0 {
+			late = 0
+		}
+		t.add(late)
+	}
+	return t.result()
+}
@@ -0,0 +1,158 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Warm-start fd manifest.
+//
+// A parent that hands open descriptors to a child (a listener it wants the
+// child to keep serving on, a log file, a control channel back to itself)
+// can describe them in SysProcAttr.Fds.  StartProcess then passes the
+// description to the child in the FdManifestEnv environment variable, as a
+// comma-separated list of fd:kind:name entries, and the child can recover
+// it with InheritedFds (or os.InheritedFiles).
+
+package syscall
+
+import "sync"
+
+// FdManifestEnv is the environment variable carrying the fd manifest.
+const FdManifestEnv = "GOAKAROS_FDS"
+
+// Well-known kinds of inherited descriptors.  Any other kind is allowed.
+const (
+	FdListener = "listener"
+	FdLog      = "log"
+	FdControl  = "control"
+
+	// FdTestResults is where a test binary reports each test's
+	// outcome to the harness that started it (see package testing).
+	FdTestResults = "testresults"
+)
+
+// An InheritedFd describes one descriptor handed to a child process.
+type InheritedFd struct {
+	Fd   int    // descriptor number in the child
+	Kind string // FdListener, FdLog, FdControl, ...
+	Name string // free-form; for a listener, its address
+}
+
+func manifestFieldOK(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' || s[i] == ',' || s[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatFdManifest encodes fds as the value of FdManifestEnv.
+// Kinds and names may not contain ':', ',' or NUL.
+func FormatFdManifest(fds []InheritedFd) (string, error) {
+	var b []byte
+	for i, f := range fds {
+		if f.Fd < 0 || f.Kind == "" || !manifestFieldOK(f.Kind) || !manifestFieldOK(f.Name) {
+			return "", EINVAL
+		}
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, itoa(f.Fd)...)
+		b = append(b, ':')
+		b = append(b, f.Kind...)
+		b = append(b, ':')
+		b = append(b, f.Name...)
+	}
+	return string(b), nil
+}
+
+// ParseFdManifest decodes a value of FdManifestEnv.
+func ParseFdManifest(s string) ([]InheritedFd, error) {
+	var fds []InheritedFd
+	for len(s) > 0 {
+		var ent string
+		ent, s = splitOn(s, ',')
+		fd, rest := splitOn(ent, ':')
+		kind, name := splitOn(rest, ':')
+		n, ok := atoi(fd)
+		if !ok || kind == "" {
+			return nil, EINVAL
+		}
+		fds = append(fds, InheritedFd{Fd: n, Kind: kind, Name: name})
+	}
+	return fds, nil
+}
+
+var inheritedFds struct {
+	once sync.Once
+	fds  []InheritedFd
+	err  error
+}
+
+// InheritedFds returns the descriptors described by the parent's
+// manifest, or none if the process was started without one.  The
+// manifest is read on the first call and removed from the environment,
+// so that the processes this one starts are not told about descriptors
+// they do not have; later calls return the same result.
+func InheritedFds() ([]InheritedFd, error) {
+	inheritedFds.once.Do(func() {
+		m, ok := Getenv(FdManifestEnv)
+		if !ok {
+			return
+		}
+		Unsetenv(FdManifestEnv)
+		inheritedFds.fds, inheritedFds.err = ParseFdManifest(m)
+	})
+	return inheritedFds.fds, inheritedFds.err
+}
+
+// splitOn splits s around the first sep; rest is empty if there is none.
+func splitOn(s string, sep byte) (first, rest string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == sep {
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+func atoi(s string) (n int, ok bool) {
+	if s == "" {
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+// withFdManifest returns env with the manifest for fds set in it,
+// replacing any manifest env already carries, which describes the
+// parent's descriptors rather than the child's.  With no fds it only
+// removes that manifest.  files is the child's descriptor table as given
+// to StartProcess; every described fd must be present in it.
+func withFdManifest(env []string, fds []InheritedFd, files []uintptr) ([]string, error) {
+	for _, f := range fds {
+		if f.Fd >= len(files) || int(files[f.Fd]) < 0 {
+			return nil, EBADF
+		}
+	}
+	m, err := FormatFdManifest(fds)
+	if err != nil {
+		return nil, err
+	}
+	prefix := FdManifestEnv + "="
+	out := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if len(kv) >= len(prefix) && kv[:len(prefix)] == prefix {
+			continue
+		}
+		out = append(out, kv)
+	}
+	if len(fds) == 0 {
+		return out, nil
+	}
+	return append(out, prefix+m), nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall_test
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestFdManifest(t *testing.T) {
+	fds := []syscall.InheritedFd{
+		{Fd: 3, Kind: syscall.FdListener, Name: "tcp!*!8080"},
+		{Fd: 4, Kind: syscall.FdLog},
+		{Fd: 5, Kind: syscall.FdControl, Name: "parent"},
+	}
+	s, err := syscall.FormatFdManifest(fds)
+	if err != nil {
+		t.Fatalf("FormatFdManifest: %v", err)
+	}
+	if want := "3:listener:tcp!*!8080,4:log:,5:control:parent"; s != want {
+		t.Errorf("FormatFdManifest = %q, want %q", s, want)
+	}
+	got, err := syscall.ParseFdManifest(s)
+	if err != nil {
+		t.Fatalf("ParseFdManifest(%q): %v", s, err)
+	}
+	if !reflect.DeepEqual(got, fds) {
+		t.Errorf("ParseFdManifest(%q) = %v, want %v", s, got, fds)
+	}
+}
+
+func TestFdManifestBad(t *testing.T) {
+	if _, err := syscall.FormatFdManifest([]syscall.InheritedFd{{Fd: 3, Kind: "a:b"}}); err == nil {
+		t.Errorf("FormatFdManifest accepted a kind containing ':'")
+	}
+	for _, s := range []string{"x:log:", "3::name", "-1:log:"} {
+		if _, err := syscall.ParseFdManifest(s); err == nil {
+			t.Errorf("ParseFdManifest(%q) succeeded, want error", s)
+		}
+	}
+}
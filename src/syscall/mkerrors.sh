@@ -146,6 +146,7 @@ includes_Akaros='
 #include <bits/sockaddr.h>
 #include <ros/glibc-asm/ioctls.h>
 #include <ros/event.h>
+#include <ros/errno.h>
 '
 
 includes_NetBSD='
@@ -327,9 +328,16 @@ ccflags="$@"
 	echo ')'
 ) >_const.go
 
+# The kernel's own Akaros errors, such as EFAIL, are only in ros/errno.h.
+errno_h='#include <errno.h>'
+if [[ "includes_${uname}" == "includes_Akaros" ]]; then
+	errno_h='#include <errno.h>
+#include <ros/errno.h>'
+fi
+
 # Pull out the error names for later.
 errors=$(
-	echo '#include <errno.h>' | $CC -x c - -E -dM $ccflags |
+	echo "$errno_h" | $CC -x c - -E -dM $ccflags |
 	awk '$1=="#define" && $2 ~ /^E[A-Z0-9_]+$/ { print $2 }' |
 	sort
 )
@@ -343,7 +351,7 @@ signals=$(
 )
 
 # Again, writing regexps to a file.
-echo '#include <errno.h>' | $CC -x c - -E -dM $ccflags |
+echo "$errno_h" | $CC -x c - -E -dM $ccflags |
 	awk '$1=="#define" && $2 ~ /^E[A-Z0-9_]+$/ { print "^\t" $2 "[ \t]*=" }' |
 	sort >_error.grep
 echo '#include <signal.h>' | $CC -x c - -E -dM $ccflags |
@@ -388,7 +396,7 @@ fi
 	echo -E "
 #include <stdio.h>
 #include <stdlib.h>
-#include <errno.h>
+$errno_h
 #include <ctype.h>
 #include <string.h>
 #include <signal.h>
@@ -19,6 +19,11 @@
 # block, as otherwise the system call could cause all goroutines to
 # hang.
 
+# With -akaros, a line beginning with //sysbatch is like //sys, except
+# that the call may be held back for the syscall batching window and
+# submitted together with others (see batch_akaros.go).  Use it only for
+# calls whose latency does not matter.
+
 use strict;
 
 my $cmdline = "mksyscall.pl " . join(' ', @ARGV);
@@ -95,7 +100,6 @@ sub parseparam($) {
 
 my $text = "";
 if ($akaros) {
-	$text .= "import \"usys\"\n";
 	$text .= "import \"bytes\"\n";
 }
 while(<>) {
@@ -104,12 +108,13 @@ while(<>) {
 	s/^\s+//;
 	s/\s+$//;
 	my $nonblock = /^\/\/sysnb /;
-	next if !/^\/\/sys / && !$nonblock;
+	my $batch = $akaros && /^\/\/sysbatch /;
+	next if !/^\/\/sys / && !$nonblock && !$batch;
 
 	# Line must be of the form
 	#	func Open(path string, mode int, perm int) (fd int, errno error)
 	# Split into name, in params, out params.
-	if(!/^\/\/sys(nb)? (\w+)\(([^()]*)\)\s*(?:\(([^()]+)\))?\s*(?:=\s*((?i)SYS_[A-Z0-9_]+))?$/) {
+	if(!/^\/\/sys(nb|batch)? (\w+)\(([^()]*)\)\s*(?:\(([^()]+)\))?\s*(?:=\s*((?i)SYS_[A-Z0-9_]+))?$/) {
 		print STDERR "$ARGV:$.: malformed //sys declaration\n";
 		$errors = 1;
 		next;
@@ -147,9 +152,20 @@ while(<>) {
 		my ($name, $type) = parseparam($p);
 		if($type =~ /^\*/) {
 			push @args, "uintptr(unsafe.Pointer($name))";
+			if ($akaros) {
+				# The call only sees a uintptr; keep the
+				# pointee alive until it returns (see pin_akaros.go).
+				push @uses, "use(unsafe.Pointer($name))";
+			}
 		} elsif($type eq "string" && $errvar ne "") {
 			$text .= "\tvar _p$n *byte\n";
-			$text .= "\t_p$n, $errvar = BytePtrFromString($name)\n";
+			if ($akaros) {
+				# The kernel takes the length; pass the
+				# string's own bytes (see fastpath_akaros.go).
+				$text .= "\t_p$n, $errvar = stringArg($name)\n";
+			} else {
+				$text .= "\t_p$n, $errvar = BytePtrFromString($name)\n";
+			}
 			$text .= "\tif $errvar != nil {\n\t\treturn\n\t}\n";
 			push @args, "uintptr(unsafe.Pointer(_p$n))";
 			if ($akaros) {
@@ -177,6 +193,9 @@ while(<>) {
 			$text .= " else {\n\t\t_p$n = unsafe.Pointer(&_zero)\n\t}";
 			$text .= "\n";
 			push @args, "uintptr(_p$n)", "uintptr(len($name))";
+			if ($akaros) {
+				push @uses, "use(_p$n)";
+			}
 			$n++;
 		} elsif($type eq "int64" && ($openbsd || $netbsd)) {
 			push @args, "0";
@@ -217,7 +236,7 @@ while(<>) {
 	# Determine which form to use; pad args with zeros.
 	my $asm = "Syscall";
 	if ($akaros) {
-		$asm = "usys.Call1";
+		$asm = $batch ? "goSyscallBatched" : "goSyscall";
 		while(@args < 6) {
 			push @args, "0";
 		}
@@ -257,7 +276,7 @@ while(<>) {
 	# Actual call.
 	$text .= "\tsyscall_struct := Syscall_struct{\n\t\t$sysname,0,0,0,0,0,\n\t\t".+
 			join(',', @args).+",\n\t\t[ErrstrMax]byte{},\n\t}\n";
-	my $call = "$asm(usys.USYS_GO_SYSCALL, uintptr(unsafe.Pointer(&syscall_struct)))";
+	my $call = "$asm(&syscall_struct)";
 
 	# Assign return values.
 	my $body = "";
@@ -315,7 +334,7 @@ while(<>) {
 				$text .= "\tif __err_num != 0 {\n";
 				$text .= "\t\t__null := bytes.IndexByte(syscall_struct.errstr[:], 0)\n";
 				$text .= "\t\t__errstr := string(syscall_struct.errstr[:__null])\n";
-				$text .= "\t\terr = NewAkaError(Errno(__err_num), __errstr)\n";
+				$text .= "\t\terr = syscallError(syscall_struct.num, Errno(__err_num), __errstr)\n";
 				$text .= "\t}\n";
 			}
 		}
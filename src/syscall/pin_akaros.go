@@ -0,0 +1,52 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Passing Go memory to the kernel.
+//
+// A system call takes its arguments as uintptrs, and the garbage
+// collector does not treat a uintptr as a reference: once the last
+// pointer to a buffer is converted, the buffer can be collected while
+// the kernel is still using it.  Goroutine stacks also move when they
+// grow, leaving a uintptr into the old stack pointing at freed memory.
+// Every call that passes Go memory by address therefore follows one of
+// two rules.
+//
+// Memory in a goroutine's stack may be passed only if the conversion to
+// uintptr and the kernel entry happen with no stack growth in between:
+// the generated wrappers build their Syscall_struct and hand it straight
+// to goSyscall, which is nosplit.
+//
+// Anything else, in particular memory whose address is kept across a
+// function call that can grow the stack, such as the arguments to
+// Syscall and Syscall6, is passed through a Pinner.
+// Pinning makes the memory escape to the heap, where it does not move,
+// and keeps it reachable until Unpin.  The generated wrappers do the
+// equivalent for their pointer, slice and string arguments with use.
+
+package syscall
+
+import "unsafe"
+
+// A Pinner keeps the memory passed to Pin alive and in place until Unpin
+// is called.  The zero value is ready to use.
+type Pinner struct {
+	ptrs []unsafe.Pointer
+}
+
+// Pin pins the memory ptr points into and returns its address, for
+// passing to the kernel.
+func (p *Pinner) Pin(ptr unsafe.Pointer) uintptr {
+	p.ptrs = append(p.ptrs, ptr)
+	return uintptr(ptr)
+}
+
+// Unpin releases everything pinned by p.  It must be called after the
+// kernel is done with the memory, which for a synchronous call is when
+// the call returns.
+func (p *Pinner) Unpin() {
+	for _, ptr := range p.ptrs {
+		use(ptr)
+	}
+	p.ptrs = nil
+}
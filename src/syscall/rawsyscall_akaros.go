@@ -0,0 +1,58 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+// Generic system call entry points, for code that issues calls by number.
+// r1 is the kernel's return value and r2 is always 0; the kernel's error
+// string is not returned, only its errno.  Syscall and Syscall6 go through
+// goSyscall like the generated wrappers.  The Raw variants, as elsewhere,
+// never enter the scheduler: they issue the call synchronously and hold
+// the M until it is done, so the runtime neither parks the goroutine nor
+// starts another M to run its P meanwhile.
+//
+// They build a Syscall_struct on the stack, too large for a nosplit
+// chain down to the kernel entry, so their stack may grow before the call
+// is issued: Go memory passed by address must be pinned (see
+// pin_akaros.go).
+
+func Syscall(trap, a1, a2, a3 uintptr) (r1, r2 uintptr, err Errno) {
+	return Syscall6(trap, a1, a2, a3, 0, 0, 0)
+}
+
+func Syscall6(trap, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err Errno) {
+	s := Syscall_struct{
+		num:  uint32(trap),
+		arg0: a1,
+		arg1: a2,
+		arg2: a3,
+		arg3: a4,
+		arg4: a5,
+		arg5: a6,
+	}
+	goSyscall(&s)
+	return uintptr(s.retval), 0, Errno(s.err)
+}
+
+func RawSyscall(trap, a1, a2, a3 uintptr) (r1, r2 uintptr, err Errno) {
+	return RawSyscall6(trap, a1, a2, a3, 0, 0, 0)
+}
+
+func RawSyscall6(trap, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err Errno) {
+	s := Syscall_struct{
+		num:  uint32(trap),
+		arg0: a1,
+		arg1: a2,
+		arg2: a3,
+		arg3: a4,
+		arg4: a5,
+		arg5: a6,
+	}
+	runtime_rawSyscall(&s)
+	return uintptr(s.retval), 0, Errno(s.err)
+}
+
+// runtime_rawSyscall issues s synchronously, in the runtime.
+//go:noescape
+func runtime_rawSyscall(s *Syscall_struct)
@@ -0,0 +1,34 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall_test
+
+import (
+	"runtime/pprof"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestRawSyscallKeepsM(t *testing.T) {
+	// A goroutine blocked in RawSyscall keeps its M and P, so the
+	// runtime has no reason to start more Ms however many block.
+	threads := pprof.Lookup("threadcreate")
+	before := threads.Count()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, e := syscall.RawSyscall(syscall.SYS_BLOCK, 1000, 0, 0)
+			if e != 0 {
+				t.Errorf("RawSyscall(SYS_BLOCK): %v", e)
+			}
+		}()
+	}
+	wg.Wait()
+	if after := threads.Count(); after != before {
+		t.Errorf("%d Ms before 50 blocking RawSyscalls, %d after", before, after)
+	}
+}
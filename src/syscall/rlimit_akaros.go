@@ -0,0 +1,174 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Resource limits.
+//
+// The Akaros kernel keeps no resource limits, so the table lives here, in
+// the process.  Limits set with Setrlimit are enforced where this package
+// can see the resource (RLIMIT_NOFILE, for descriptors opened through
+// Open and Openat) and are handed on to children started with
+// StartProcess or Exec in the RlimitEnv environment variable, which the
+// child's syscall package loads at startup.  A child can lower what it
+// inherits but, as on Unix, not raise a hard limit.  The soft RLIMIT_AS is
+// the runtime's memory limit (see runtime/debug.SetMemoryLimit), so that a
+// program placed in a memory partition collects garbage to stay inside it.
+
+package syscall
+
+import "sync"
+
+// RlimitEnv is the environment variable carrying inherited limits.
+const RlimitEnv = "GOAKAROS_RLIMITS"
+
+var rlimits struct {
+	sync.RWMutex
+	set bool // some limit differs from the default
+	tab [RLIM_NLIMITS]Rlimit
+}
+
+// The limits are loaded while package variables are initialized, ahead
+// of every init function: those may already open files (see
+// latency_akaros.go).
+var _ = loadRlimits()
+
+func loadRlimits() bool {
+	for i := range rlimits.tab {
+		rlimits.tab[i] = Rlimit{Cur: RLIM_INFINITY, Max: RLIM_INFINITY}
+	}
+	if s, ok := Getenv(RlimitEnv); ok {
+		parseRlimits(s)
+		setMemoryLimitAS(rlimits.tab[RLIMIT_AS].Cur)
+	}
+	return true
+}
+
+func setMemoryLimit(limit int64) int64 // in runtime
+
+// setMemoryLimitAS hands a soft RLIMIT_AS to the runtime as its memory
+// limit.
+func setMemoryLimitAS(cur uint64) {
+	if cur >= 1<<63-1 {
+		cur = 1<<63 - 1
+	}
+	setMemoryLimit(int64(cur))
+}
+
+// Getrlimit returns the limits on resource.
+func Getrlimit(resource int, rlim *Rlimit) (err error) {
+	if resource < 0 || resource >= RLIM_NLIMITS {
+		return EINVAL
+	}
+	rlimits.RLock()
+	*rlim = rlimits.tab[resource]
+	rlimits.RUnlock()
+	return nil
+}
+
+// Setrlimit sets the limits on resource.  The soft limit may not exceed
+// the hard limit, and the hard limit may only be lowered.
+func Setrlimit(resource int, rlim *Rlimit) (err error) {
+	if resource < 0 || resource >= RLIM_NLIMITS || rlim.Cur > rlim.Max {
+		return EINVAL
+	}
+	rlimits.Lock()
+	defer rlimits.Unlock()
+	if rlim.Max > rlimits.tab[resource].Max {
+		return EPERM
+	}
+	rlimits.tab[resource] = *rlim
+	rlimits.set = true
+	if resource == RLIMIT_AS {
+		setMemoryLimitAS(rlim.Cur)
+	}
+	return nil
+}
+
+// checkNofile enforces RLIMIT_NOFILE on a newly opened fd, closing it if
+// it is over the limit.
+func checkNofile(fd int) error {
+	rlimits.RLock()
+	lim := rlimits.tab[RLIMIT_NOFILE].Cur
+	rlimits.RUnlock()
+	if uint64(fd) >= lim {
+		Close(fd)
+		return EMFILE
+	}
+	return nil
+}
+
+// withRlimits returns env with the current limits recorded in it, if any
+// have been set.
+func withRlimits(env []string) []string {
+	rlimits.RLock()
+	defer rlimits.RUnlock()
+	if !rlimits.set {
+		return env
+	}
+	var b []byte
+	for i, rl := range rlimits.tab {
+		if rl.Cur == RLIM_INFINITY && rl.Max == RLIM_INFINITY {
+			continue
+		}
+		if len(b) > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, itoa(i)...)
+		b = append(b, ':')
+		b = appendRlim(b, rl.Cur)
+		b = append(b, ':')
+		b = appendRlim(b, rl.Max)
+	}
+	prefix := RlimitEnv + "="
+	out := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if len(kv) >= len(prefix) && kv[:len(prefix)] == prefix {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return append(out, prefix+string(b))
+}
+
+func appendRlim(b []byte, v uint64) []byte {
+	if v == RLIM_INFINITY {
+		return append(b, "inf"...)
+	}
+	var buf [20]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = byte('0' + v%10)
+		v /= 10
+		if v == 0 {
+			break
+		}
+	}
+	return append(b, buf[i:]...)
+}
+
+func parseRlim(s string) (v uint64, ok bool) {
+	if s == "inf" {
+		return RLIM_INFINITY, true
+	}
+	return atou64(s)
+}
+
+// parseRlimits loads limits inherited from the parent, ignoring any entry
+// it does not understand.
+func parseRlimits(s string) {
+	for len(s) > 0 {
+		var ent string
+		ent, s = splitOn(s, ',')
+		res, rest := splitOn(ent, ':')
+		cur, max := splitOn(rest, ':')
+		r, ok1 := atoi(res)
+		c, ok2 := parseRlim(cur)
+		m, ok3 := parseRlim(max)
+		if !ok1 || !ok2 || !ok3 || r >= RLIM_NLIMITS || c > m {
+			continue
+		}
+		rlimits.tab[r] = Rlimit{Cur: c, Max: m}
+		rlimits.set = true
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+// A SpawnStage is one step of StartProcess.
+type SpawnStage int
+
+const (
+	SpawnSerialize SpawnStage = iota // pack argv and envp for the kernel
+	SpawnCreate                      // SYS_PROC_CREATE
+	SpawnDup                         // copy descriptors into the child
+	SpawnChdir                       // set the child's working directory
+	SpawnRun                         // SYS_PROC_RUN
+)
+
+var spawnStageNames = [...]string{
+	SpawnSerialize: "serialize",
+	SpawnCreate:    "create",
+	SpawnDup:       "dup",
+	SpawnChdir:     "chdir",
+	SpawnRun:       "run",
+}
+
+func (s SpawnStage) String() string {
+	if 0 <= s && int(s) < len(spawnStageNames) {
+		return spawnStageNames[s]
+	}
+	return "stage" + itoa(int(s))
+}
+
+// A SpawnEvent reports one completed stage of StartProcess.
+type SpawnEvent struct {
+	Pid   int // the child; 0 until SpawnCreate succeeds
+	Stage SpawnStage
+	Start int64 // runtime monotonic clock (see pprof.CyclesPerSecond), in nanoseconds
+	Dur   int64 // nanoseconds
+	Err   error // non-nil if the stage failed, ending the spawn
+}
+
+// SpawnTracer, if non-nil, is called synchronously as each stage of
+// StartProcess completes.  It must be set before any process is started
+// and must not start processes itself.
+var SpawnTracer func(ev SpawnEvent)
+
+func runtimeNano() int64
+
+// spawnBegin returns the start time of a stage, or 0 if nobody is
+// listening.
+func spawnBegin() int64 {
+	if SpawnTracer == nil {
+		return 0
+	}
+	return runtimeNano()
+}
+
+func spawnEnd(pid int, stage SpawnStage, start int64, err error) {
+	if start == 0 || SpawnTracer == nil {
+		return
+	}
+	if stage == SpawnCreate && err != nil {
+		pid = 0
+	}
+	SpawnTracer(SpawnEvent{pid, stage, start, runtimeNano() - start, err})
+}
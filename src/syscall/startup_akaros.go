@@ -0,0 +1,28 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+func startupTimes() (names []string, stamps []int64) // in runtime
+
+// A StartupPhase is one step of the runtime's start-up.
+type StartupPhase struct {
+	Name string // osinit, malloc, args, env, mcp, topology, sched, poller, init or main
+	Nsec int64  // nanoseconds from runtime entry to the end of the phase
+}
+
+// StartupPhases returns the start-up phases the runtime has reached, in
+// the order of the Akaros bring-up: entry into the runtime, heap and
+// argument set-up, the environment, the transition to an MCP, the CPU
+// topology, the scheduler, the network poller (which starts on first
+// use, so may come later or not at all), package initialization and
+// main.main.  GODEBUG=starttrace=1 prints the same when main.main starts.
+func StartupPhases() []StartupPhase {
+	names, stamps := startupTimes()
+	p := make([]StartupPhase, len(names))
+	for i := range p {
+		p[i] = StartupPhase{names[i], stamps[i]}
+	}
+	return p
+}
@@ -12,8 +12,10 @@
 package syscall
 
 import (
+	"internal/oserror"
 	"runtime/parlib"
 	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -42,7 +44,28 @@ func (e Errno) Timeout() bool {
 	return e == EAGAIN || e == EWOULDBLOCK || e == ETIMEDOUT
 }
 
-// An AkaError is a combination of a traditional errno and a custom string.
+// Is reports whether e is the kind of error that target, one of the
+// portable errors in package os, stands for.  It follows the convention
+// of later Go releases' errors.Is, and os.IsExist, os.IsNotExist and
+// os.IsPermission are built on it.
+func (e Errno) Is(target error) bool {
+	switch target {
+	case oserror.ErrPermission:
+		return e == EACCES || e == EPERM
+	case oserror.ErrExist:
+		return e == EEXIST || e == ENOTEMPTY
+	case oserror.ErrNotExist:
+		return e == ENOENT
+	case oserror.ErrInvalid:
+		return e == EINVAL
+	}
+	return false
+}
+
+// An AkaError is a combination of a traditional errno and the kernel's
+// errstr, which usually says more about the failure than the errno alone
+// and is what Error returns.  The errno is the wrapped error: Unwrap
+// returns it, and Is, Timeout and Temporary are decided by it.
 type AkaError struct {
 	errno  Errno
 	errstr string
@@ -60,11 +83,33 @@ func (e AkaError) Errno() Errno {
 func (e AkaError) Errstr() string {
 	return e.errstr
 }
+
+// Unwrap returns the errno.
+func (e AkaError) Unwrap() error {
+	return e.errno
+}
+
+// Temporary reports whether the call may succeed if retried.
 func (e AkaError) Temporary() bool {
 	return e.errno.Temporary()
 }
+
+// Timeout reports whether the call failed for lack of time: ETIMEDOUT,
+// or EINTR, since a call interrupted on Akaros was almost always aborted
+// by RunWithDeadline, which is how package net implements deadlines.
+// Unlike Errno.Timeout, it does not count EAGAIN, which on Akaros means
+// a non-blocking call had nothing to do rather than that time ran out.
 func (e AkaError) Timeout() bool {
-	return e.errno == EINTR
+	return e.errno == ETIMEDOUT || e.errno == EINTR
+}
+
+// Is reports whether e is target, which may be one of the portable errors
+// in package os or an Errno, judging by e's errno alone.
+func (e AkaError) Is(target error) bool {
+	if t, ok := target.(Errno); ok {
+		return e.errno == t
+	}
+	return e.errno.Is(target)
 }
 func NewAkaError(errno Errno, errstr string) error { return &AkaError{errno, errstr} }
 
@@ -159,7 +204,8 @@ func (w WaitStatus) TrapCause() int {
 // generated syscall makes an underlying call to Syscall() or RawSyscall().
 // Traditionally, the RawSyscall version has been used to generate NON-BLOCKING
 // versions of a syscall.  In Akaros, however, ALL syscalls are non-blocking,
-// so wedo not use //sysnb.
+// so wedo not use //sysnb.  We do have //sysbatch, for calls that may be
+// held back and submitted together with others (see batch_akaros.go).
 
 //this needs to have the same memory layout as a syscall on akaros
 type Syscall_struct struct {
@@ -185,19 +231,17 @@ type Syscall_struct struct {
 // is true for all OSes.  For Akaros, we do the same for any string arguments.
 // See syscall/mksyscall.pl for details.
 //
-//sys	Close(fd int) (err error)
+//sysbatch	closeBatch(fd int) (err error) = SYS_CLOSE
 //sys	Read(fd int, p []byte) (n int, err error)
-//sys	Write(fd int, p []byte) (n int, err error)
+//sys	write(fd int, p []byte) (n int, err error)
 //sys	Block(usec int) (err error)
 //sys	Fstat(fd int, stat *Stat_t) (err error)
 //sys	fcntl(fd int, cmd int, arg int) (val int, err error)
-//sys	AbortSyscFd(fd int) (val int, err error)
 //sys	Getcwd(buf []byte, length int) (n int, err error)
 //sys	Wstat(path string, stat_m []byte, flags int) (err error)
-//sys	Fwstat(fd int, stat_m []byte, flags int) (err error)
-//sys	Openat(fromfd int, path string, flags int, mode uint32) (fd int, err error)
-//sys	Mkdir(path string, mode uint32) (err error)
-//sys	Rename(oldpath string, newpath string) (err error)
+//sysbatch	Fwstat(fd int, stat_m []byte, flags int) (err error)
+//sys	openat(fromfd int, path string, flags int, mode uint32) (fd int, err error)
+//sys	mkdir(path string, mode uint32) (err error)
 //sys	Unlink(path string) (err error)
 //sys	Rmdir(path string) (err error)
 //sys	Stat(path string, stat *Stat_t) (err error)
@@ -216,12 +260,84 @@ func Open(path string, flags int, mode ...uint32) (fd int, err error) {
 	return Openat(_AT_FDCWD, path, flags, mode[0])
 }
 
+//sys	umask(mask int) (oldmask int)
+
+// The file mode creation mask.  Akaros keeps one too, but we apply ours
+// in the wrappers below as well so that it holds for every file server.
+// cmask is -1 until it has been read from the kernel.
+var (
+	cmaskOnce sync.Once
+	cmask     int32 = -1
+)
+
+func loadUmask() {
+	old := umask(0)
+	if old < 0 {
+		old = 022
+	}
+	umask(old)
+	atomic.CompareAndSwapInt32(&cmask, -1, int32(old&0777))
+}
+
+// Umask sets the file mode creation mask to mask and returns the
+// previous mask.
+func Umask(mask int) (oldmask int) {
+	cmaskOnce.Do(loadUmask)
+	mask &= 0777
+	umask(mask)
+	return int(atomic.SwapInt32(&cmask, int32(mask)))
+}
+
+// applyUmask clears the bits of mode that the creation mask forbids.
+func applyUmask(mode uint32) uint32 {
+	cmaskOnce.Do(loadUmask)
+	return mode &^ uint32(atomic.LoadInt32(&cmask))
+}
+
+func Openat(fromfd int, path string, flags int, mode uint32) (fd int, err error) {
+	if flags&O_CREAT != 0 {
+		mode = applyUmask(mode)
+	}
+	if flags&O_CLOEXEC != 0 && !HasFeature(FeatureOpenCloexec) {
+		fd, err = openatCloseOnExec(fromfd, path, flags, mode)
+	} else {
+		fd, err = openat(fromfd, path, flags, mode)
+	}
+	if err == nil {
+		err = checkNofile(fd)
+	}
+	if err == nil {
+		if flags&O_APPEND != 0 {
+			noteAppend(fd)
+		} else {
+			forgetAppend(fd)
+		}
+	}
+	return
+}
+
+func Creat(path string, mode uint32) (fd int, err error) {
+	return Open(path, O_CREAT|O_WRONLY|O_TRUNC, mode)
+}
+
+func Mkdir(path string, mode uint32) (err error) {
+	return mkdir(path, applyUmask(mode))
+}
+
 //sys	chdir(pid int, path string) (err error)
 func Chdir(path string) (err error) {
 	return chdir(int(parlib.Procinfo.Pid), path)
 }
 
+//sys	abortSyscFd(fd int) (val int, err error)
+func AbortSyscFd(fd int) (val int, err error) {
+	// Let interrupted calls know this abort was on purpose; see goSyscall.
+	atomic.AddUint32(&abortGen, 1)
+	return abortSyscFd(fd)
+}
+
 //sys	fchdir(pid int, fd int) (err error)
+// Fchdir changes the working directory to the directory open on fd.
 func Fchdir(fd int) (err error) {
 	return fchdir(int(parlib.Procinfo.Pid), fd)
 }
@@ -231,6 +347,9 @@ func Seek(fd int, offset int64, whence int) (newoffset int64, err error) {
 	if fd < 0 {
 		return -1, EBADF
 	}
+	if err = FlushWrites(fd); err != nil {
+		return -1, err
+	}
 	switch whence {
 	case SEEK_SET:
 	case SEEK_CUR:
@@ -247,6 +366,7 @@ func Seek(fd int, offset int64, whence int) (newoffset int64, err error) {
 
 //sys	proc_destroy(pid int, exitcode int) (err error)
 func Exit(exitcode int) {
+	flushAllWrites()
 	proc_destroy(int(parlib.Procinfo.Pid), exitcode)
 }
 
@@ -312,6 +432,11 @@ func Pwrite(fd int, p []byte, offset int64) (n int, err error) {
 	/* Saved offset */
 	var o_offset int64
 
+	/* Combined writes go out before anything is written at an offset */
+	if err = FlushWrites(fd); err != nil {
+		return
+	}
+
 	/* Save the current offset so we can restore it later */
 	o_offset, err = Seek(fd, 0, SEEK_CUR)
 	if err != nil {
@@ -325,7 +450,7 @@ func Pwrite(fd int, p []byte, offset int64) (n int, err error) {
 	}
 
 	/* Write out the data.  */
-	n, err = Write(fd, p)
+	n, err = write(fd, p)
 
 	/* Seek back to the original position. If this fails, we return its error,
 	 * only if the read before succedded. Otherwise we bypass this error and
@@ -341,6 +466,434 @@ func Pwrite(fd int, p []byte, offset int64) (n int, err error) {
 	return
 }
 
+// Akaros has no scatter/gather calls.  Readv and Preadv issue one read
+// per buffer, stopping at the first short transfer or error, so n counts
+// the bytes moved by the calls that succeeded.  Writev and Pwritev copy
+// up to gatherMax bytes in all into one buffer and write it with a
+// single call, so that such a write is as atomic as a plain Write; a
+// larger one is written a buffer at a time, and other writers to the
+// same file may land between the pieces.
+
+// gatherMax bounds the bytes Writev and Pwritev gather into one write.
+const gatherMax = 64 << 10
+
+// gather returns the contents of bufs as one slice and true, or false if
+// there are no buffers or more than gatherMax bytes in all.  A single
+// buffer is returned as is.
+func gather(bufs [][]byte) ([]byte, bool) {
+	total := 0
+	for _, b := range bufs {
+		total += len(b)
+		if total > gatherMax {
+			return nil, false
+		}
+	}
+	switch len(bufs) {
+	case 0:
+		return nil, false
+	case 1:
+		return bufs[0], true
+	}
+	p := make([]byte, 0, total)
+	for _, b := range bufs {
+		p = append(p, b...)
+	}
+	return p, true
+}
+
+// Readv reads from fd into the buffers in bufs, in order.
+func Readv(fd int, bufs [][]byte) (n int, err error) {
+	for _, b := range bufs {
+		m, e := Read(fd, b)
+		if m > 0 {
+			n += m
+		}
+		if e != nil || m < len(b) {
+			return n, e
+		}
+	}
+	return n, nil
+}
+
+// Writev writes the buffers in bufs to fd, in order.
+func Writev(fd int, bufs [][]byte) (n int, err error) {
+	if p, ok := gather(bufs); ok {
+		return Write(fd, p)
+	}
+	for _, b := range bufs {
+		m, e := Write(fd, b)
+		if m > 0 {
+			n += m
+		}
+		if e != nil || m < len(b) {
+			return n, e
+		}
+	}
+	return n, nil
+}
+
+// Preadv reads from fd at offset into the buffers in bufs, in order,
+// without changing the file offset.
+func Preadv(fd int, bufs [][]byte, offset int64) (n int, err error) {
+	for _, b := range bufs {
+		m, e := Pread(fd, b, offset+int64(n))
+		if m > 0 {
+			n += m
+		}
+		if e != nil || m < len(b) {
+			return n, e
+		}
+	}
+	return n, nil
+}
+
+// Pwritev writes the buffers in bufs to fd at offset, in order, without
+// changing the file offset.
+func Pwritev(fd int, bufs [][]byte, offset int64) (n int, err error) {
+	if p, ok := gather(bufs); ok {
+		return Pwrite(fd, p, offset)
+	}
+	for _, b := range bufs {
+		m, e := Pwrite(fd, b, offset+int64(n))
+		if m > 0 {
+			n += m
+		}
+		if e != nil || m < len(b) {
+			return n, e
+		}
+	}
+	return n, nil
+}
+
+// sendfileChunk bounds the buffer Sendfile copies through.
+const sendfileChunk = 64 << 10
+
+// Sendfile copies up to count bytes from infd to outfd.  If offset is
+// nil, it reads from infd's current file offset and advances it;
+// otherwise it reads from *offset, updates *offset past the bytes sent
+// and leaves infd's file offset alone.  It returns the number of bytes
+// written to outfd, which is less than count only at end of file or on
+// error.  A negative count is an error, EINVAL.  Akaros has no sendfile
+// call, so the bytes always pass through a buffer.
+func Sendfile(outfd int, infd int, offset *int64, count int) (written int, err error) {
+	if count < 0 {
+		return 0, EINVAL
+	}
+	size := count
+	if size > sendfileChunk {
+		size = sendfileChunk
+	}
+	buf := make([]byte, size)
+	for written < count {
+		p := buf
+		if len(p) > count-written {
+			p = p[:count-written]
+		}
+		var nr int
+		if offset != nil {
+			nr, err = Pread(infd, p, *offset)
+		} else {
+			nr, err = Read(infd, p)
+		}
+		if nr <= 0 {
+			return
+		}
+		for sent := 0; sent < nr; {
+			var nw int
+			nw, err = Write(outfd, p[sent:nr])
+			if nw > 0 {
+				sent += nw
+				written += nw
+				if offset != nil {
+					*offset += int64(nw)
+				}
+			}
+			if err != nil || nw <= 0 {
+				// Give back what was read but not sent, so that
+				// infd's offset matches what outfd got.
+				if offset == nil {
+					Seek(infd, int64(sent-nr), SEEK_CUR)
+				}
+				if err == nil {
+					err = EIO
+				}
+				return
+			}
+		}
+	}
+	return
+}
+
+// nullDirWith marshals a stat message in which every field but the ones
+// set by fill holds its "don't touch" value.
+func nullDirWith(fill func(d *Dir)) ([]byte, error) {
+	var d Dir
+	d.Null()
+	fill(&d)
+
+	buf := make([]byte, STATFIXLEN+len(d.Name)+len(d.Uid)+len(d.Gid)+len(d.Muid))
+	n, err := d.Marshal(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func lengthStat(length int64) ([]byte, error) {
+	if length < 0 {
+		return nil, EINVAL
+	}
+	return nullDirWith(func(d *Dir) { d.Length = length })
+}
+
+// Truncate changes the size of the named file to length.
+func Truncate(path string, length int64) (err error) {
+	stat, err := lengthStat(length)
+	if err != nil {
+		return err
+	}
+	return Wstat(path, stat, WSTAT_LENGTH)
+}
+
+// Ftruncate changes the size of the file open on fd to length.
+func Ftruncate(fd int, length int64) (err error) {
+	if err = FlushWrites(fd); err != nil {
+		return err
+	}
+	stat, err := lengthStat(length)
+	if err != nil {
+		return err
+	}
+	return Fwstat(fd, stat, WSTAT_LENGTH)
+}
+
+// chmodMask is the part of a mode that Chmod can change.  Akaros takes
+// these bits in their POSIX layout, the same one Stat reports in
+// Stat_t.Mode, so no translation is needed in either direction.
+const chmodMask = S_ISUID | S_ISGID | S_ISVTX | 0777
+
+func modeStat(mode uint32) ([]byte, error) {
+	return nullDirWith(func(d *Dir) { d.Mode = mode & chmodMask })
+}
+
+// Chmod changes the permission, setuid, setgid and sticky bits of the
+// named file.
+func Chmod(path string, mode uint32) (err error) {
+	stat, err := modeStat(mode)
+	if err != nil {
+		return err
+	}
+	return Wstat(path, stat, WSTAT_MODE)
+}
+
+// Fchmod changes the permission, setuid, setgid and sticky bits of the
+// file open on fd.
+func Fchmod(fd int, mode uint32) (err error) {
+	stat, err := modeStat(mode)
+	if err != nil {
+		return err
+	}
+	return Fwstat(fd, stat, WSTAT_MODE)
+}
+
+// ownerStat builds the stat message and wstat flags for a change of owner.
+// Owners are names on Akaros; numeric ids are passed as their decimal
+// string, and an id of -1 leaves that owner unchanged.
+func ownerStat(uid, gid int) (stat []byte, flags int, err error) {
+	if uid < -1 || gid < -1 {
+		return nil, 0, EINVAL
+	}
+	stat, err = nullDirWith(func(d *Dir) {
+		if uid != -1 {
+			d.Uid = itoa(uid)
+			flags |= WSTAT_UID
+		}
+		if gid != -1 {
+			d.Gid = itoa(gid)
+			flags |= WSTAT_GID
+		}
+	})
+	return
+}
+
+// Chown changes the owner and group of the named file.
+func Chown(path string, uid int, gid int) (err error) {
+	stat, flags, err := ownerStat(uid, gid)
+	if err != nil || flags == 0 {
+		return err
+	}
+	return Wstat(path, stat, flags)
+}
+
+// Fchown changes the owner and group of the file open on fd.
+func Fchown(fd int, uid int, gid int) (err error) {
+	stat, flags, err := ownerStat(uid, gid)
+	if err != nil || flags == 0 {
+		return err
+	}
+	return Fwstat(fd, stat, flags)
+}
+
+// A wstat that changes nothing is, by the Plan 9 convention Akaros
+// follows, a request to commit the file to stable storage.
+func syncStat() []byte {
+	stat, _ := nullDirWith(func(d *Dir) {})
+	return stat
+}
+
+// Fsync commits the contents and metadata of the file open on fd to
+// stable storage.
+func Fsync(fd int) (err error) {
+	if err = FlushWrites(fd); err != nil {
+		return
+	}
+	return Fwstat(fd, syncStat(), 0)
+}
+
+// Fdatasync commits the contents of the file open on fd to stable
+// storage.  Akaros file servers make no distinction between data and
+// metadata, so this is the same as Fsync.
+func Fdatasync(fd int) (err error) {
+	return Fsync(fd)
+}
+
+// Sync asks the file server mounted at the root of the namespace to
+// commit everything it holds to stable storage.  Akaros has no
+// system-wide sync; servers that only sync individual files will
+// treat this as a sync of the root directory.
+func Sync() {
+	Wstat("/", syncStat(), 0)
+}
+
+// atPath turns path, relative to the directory open on dirfd, into a
+// name the path-based system calls understand.  Akaros has no *at calls
+// apart from openat, so the *at wrappers are built on this.
+func atPath(dirfd int, path string) (string, error) {
+	if dirfd == _AT_FDCWD || (len(path) > 0 && path[0] == '/') {
+		return path, nil
+	}
+	dir, err := Fd2path(dirfd)
+	if err != nil {
+		return "", err
+	}
+	return dir + "/" + path, nil
+}
+
+// parentDir returns the directory containing the last element of path.
+func parentDir(path string) string {
+	i := len(path)
+	for i > 1 && path[i-1] == '/' {
+		i--
+	}
+	for i > 0 && path[i-1] != '/' {
+		i--
+	}
+	for i > 1 && path[i-1] == '/' {
+		i--
+	}
+	if i == 0 {
+		return "."
+	}
+	return path[:i]
+}
+
+//sys	rename(oldpath string, newpath string) (err error)
+
+// Rename atomically renames oldpath to newpath, replacing newpath if it
+// exists.  Renames between directories on different devices cannot be
+// atomic and fail with EXDEV; callers wanting to move a file there must
+// copy it.
+func Rename(oldpath string, newpath string) (err error) {
+	if olddir, newdir := parentDir(oldpath), parentDir(newpath); olddir != newdir {
+		var ost, nst Stat_t
+		if err := Stat(olddir, &ost); err != nil {
+			return err
+		}
+		if err := Stat(newdir, &nst); err != nil {
+			return err
+		}
+		if ost.Dev != nst.Dev {
+			return EXDEV
+		}
+	}
+	return rename(oldpath, newpath)
+}
+
+// Renameat is like Rename, with relative paths interpreted relative to
+// the directories open on olddirfd and newdirfd.
+func Renameat(olddirfd int, oldpath string, newdirfd int, newpath string) (err error) {
+	if oldpath, err = atPath(olddirfd, oldpath); err != nil {
+		return err
+	}
+	if newpath, err = atPath(newdirfd, newpath); err != nil {
+		return err
+	}
+	return Rename(oldpath, newpath)
+}
+
+// Access checks whether the calling process can access the named file
+// with the given combination of R_OK, W_OK and X_OK, or whether it exists
+// at all if mode is F_OK.
+func Access(path string, mode uint32) (err error) {
+	return Faccessat(_AT_FDCWD, path, mode, 0)
+}
+
+// Faccessat is like Access, with a relative path interpreted relative to
+// the directory open on dirfd.  AT_EACCESS is accepted but has no effect,
+// as Akaros processes have no separate real and effective identities.
+//
+// Like Plan 9's access, read and write access to a file is checked by
+// opening it, so that the file server makes the decision.  Execute
+// access, and any access to a directory, is judged from the permission
+// bits: a process has no numeric user id to match against the owner, so
+// a bit granted to anyone counts.
+func Faccessat(dirfd int, path string, mode uint32, flags int) (err error) {
+	if mode&^(R_OK|W_OK|X_OK) != 0 || flags&^(_AT_SYMLINK_NOFOLLOW|_AT_EACCESS) != 0 {
+		return EINVAL
+	}
+	path, err = atPath(dirfd, path)
+	if err != nil {
+		return err
+	}
+	var st Stat_t
+	if flags&_AT_SYMLINK_NOFOLLOW != 0 {
+		err = Lstat(path, &st)
+	} else {
+		err = Stat(path, &st)
+	}
+	if err != nil || mode == F_OK {
+		return err
+	}
+
+	const anyR, anyW, anyX = 0444, 0222, 0111
+	if mode&X_OK != 0 && st.Mode&anyX == 0 {
+		return EACCES
+	}
+	if st.Mode&S_IFMT == S_IFDIR {
+		if (mode&R_OK != 0 && st.Mode&anyR == 0) || (mode&W_OK != 0 && st.Mode&anyW == 0) {
+			return EACCES
+		}
+		return nil
+	}
+	var omode int
+	switch mode & (R_OK | W_OK) {
+	case 0:
+		return nil
+	case R_OK:
+		omode = O_RDONLY
+	case W_OK:
+		omode = O_WRONLY
+	default:
+		omode = O_RDWR
+	}
+	fd, err := Open(path, omode|O_NONBLOCK|O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	Close(fd)
+	return nil
+}
+
 func ReadDirent(fd int, buf []byte) (n int, err error) {
 	dsize := int(unsafe.Sizeof(Dirent{}))
 	n, err = Read(fd, buf[0:dsize])
@@ -364,12 +917,26 @@ func ParseDirent(buf []byte, max int, names []string) (consumed int, count int,
 }
 
 func Dup(oldfd int) (fd int, err error) {
-	return fcntl(oldfd, F_DUPFD, 0)
+	if fd, err = fcntl(oldfd, F_DUPFD, 0); err == nil {
+		noteDup(oldfd, fd)
+	}
+	return
+}
+
+func Dup2(oldfd int, newfd int) (err error) {
+	if err = dup2(oldfd, newfd); err == nil {
+		noteDup(oldfd, newfd)
+	}
+	return
 }
 
 //sys	fd2path(fd int, buf []byte) (err error)
+
+// Fd2path returns the path name the kernel has recorded for the file
+// open on fd, which is the name it was opened by, resolved against the
+// namespace at the time.
 func Fd2path(fd int) (path string, err error) {
-	var buf [512]byte
+	var buf [PathMax]byte
 
 	e := fd2path(fd, buf[:])
 	if e != nil {
@@ -378,6 +945,47 @@ func Fd2path(fd int) (path string, err error) {
 	return cstring(buf[:]), nil
 }
 
+// Flags for Nbind and Nmount, as in Plan 9.
+const (
+	MREPL   = 0x0000 // replace whatever is at the mount point
+	MBEFORE = 0x0001 // add the new directory before the old in the union
+	MAFTER  = 0x0002 // add the new directory after the old in the union
+	MORDER  = 0x0003 // mask for the order bits
+	MCREATE = 0x0004 // permit creation in the mounted directory
+	MCACHE  = 0x0010 // cache some data
+	MMASK   = 0x0017 // all bits on
+)
+
+//sys	nbind(src string, onto string, flag int) (err error)
+//sys	nmount(fd int, onto string, flag int) (err error)
+//sys	nunmount(src string, onto string) (err error)
+
+// Nbind binds the file or directory src onto the path onto in the
+// process's name space.  flag is MREPL, MBEFORE or MAFTER, optionally
+// or'ed with MCREATE.
+func Nbind(src, onto string, flag int) (err error) {
+	if flag&^MMASK != 0 {
+		return EINVAL
+	}
+	return nbind(src, onto, flag)
+}
+
+// Nmount attaches the file server speaking 9P on fd at the path onto,
+// with the same flags as Nbind.  The kernel keeps its own reference to
+// the channel, so fd may be closed afterwards.
+func Nmount(fd int, onto string, flag int) (err error) {
+	if flag&^MMASK != 0 {
+		return EINVAL
+	}
+	return nmount(fd, onto, flag)
+}
+
+// Nunmount undoes a bind or mount of src onto onto.  If src is empty,
+// everything bound or mounted on onto is removed.
+func Nunmount(src, onto string) (err error) {
+	return nunmount(src, onto)
+}
+
 // Mmap manager, for use by operating system-specific implementations.
 type mmapper struct {
 	sync.Mutex
@@ -442,6 +1050,9 @@ func (m *mmapper) Munmap(data []byte) (err error) {
 	return nil
 }
 func Mmap(fd int, offset int64, length int, prot int, flags int) (data []byte, err error) {
+	if atomic.LoadInt32(&mlockFuture) != 0 {
+		flags |= MAP_POPULATE
+	}
 	return mapper.Mmap(fd, offset, length, prot, flags)
 }
 
@@ -450,6 +1061,68 @@ func Munmap(b []byte) (err error) {
 	return mapper.Munmap(b)
 }
 
+// Madvise tells the kernel how b is going to be used.  Akaros has no
+// madvise call and advice is only a hint, so valid advice is accepted and
+// ignored.  MADV_DONTNEED in particular does not release or zero the
+// pages.
+func Madvise(b []byte, advice int) (err error) {
+	switch advice {
+	case MADV_NORMAL, MADV_RANDOM, MADV_SEQUENTIAL, MADV_WILLNEED, MADV_DONTNEED:
+		return nil
+	}
+	return EINVAL
+}
+
+// Akaros never pages memory out, so all that locking has to guarantee is
+// that the pages are present.  Mlock faults them in ahead of time and
+// Munlock has nothing to undo.
+//sys	populateVa(va uintptr, npages int) (err error) = SYS_POPULATE_VA
+
+// mlockFuture is set by Mlockall(MCL_FUTURE): later Mmap calls populate
+// their mappings up front.
+var mlockFuture int32
+
+func Mlock(b []byte) (err error) {
+	if len(b) == 0 {
+		return nil
+	}
+	pg := uintptr(Getpagesize())
+	start := uintptr(unsafe.Pointer(&b[0]))
+	end := (start + uintptr(len(b)) + pg - 1) &^ (pg - 1)
+	start &^= pg - 1
+	return populateVa(start, int((end-start)/pg))
+}
+
+func Munlock(b []byte) (err error) {
+	return nil
+}
+
+// Mlockall with MCL_CURRENT locks the mappings made with Mmap; memory
+// mapped by the runtime for the Go heap is always populated as it is used.
+func Mlockall(flags int) (err error) {
+	if flags == 0 || flags&^(MCL_CURRENT|MCL_FUTURE) != 0 {
+		return EINVAL
+	}
+	if flags&MCL_FUTURE != 0 {
+		atomic.StoreInt32(&mlockFuture, 1)
+	}
+	if flags&MCL_CURRENT != 0 {
+		mapper.Lock()
+		defer mapper.Unlock()
+		for _, b := range mapper.active {
+			if err = Mlock(b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func Munlockall() (err error) {
+	atomic.StoreInt32(&mlockFuture, 0)
+	return nil
+}
+
 //sys	waitpid(pid int, wstatus *_C_int, options int) (wpid int, err error)
 func Waitpid(pid int, wstatus *WaitStatus, options int) (wpid int, err error) {
 	var status _C_int
@@ -481,6 +1154,8 @@ func Kill(pid int, sig Signal) (err error) {
 
 const ImplementsGetwd = true
 
+// Getwd returns the kernel's view of the current working directory, as
+// set by Chdir and Fchdir.
 func Getwd() (wd string, err error) {
 	var buf [PathMax]byte
 	n, err := Getcwd(buf[0:], len(buf))
@@ -504,6 +1179,28 @@ func Getpid() (pid int) {
 	return int(parlib.Procinfo.Pid)
 }
 
+func Getppid() (ppid int) {
+	return int(parlib.Procinfo.Ppid)
+}
+
+func runtime_threadids() (vcoreid, tid int32)
+
+// Gettid returns the id of the pthread the calling goroutine is running
+// on.  Unless the goroutine has called runtime.LockOSThread, it may be
+// running on a different one by the time Gettid returns.
+func Gettid() (tid int) {
+	_, t := runtime_threadids()
+	return int(t)
+}
+
+// Getvcoreid returns the vcore the calling goroutine is running on, with
+// the same caveat as Gettid; vcores can also be revoked and regranted
+// underneath a locked thread.
+func Getvcoreid() (vcoreid int) {
+	v, _ := runtime_threadids()
+	return int(v)
+}
+
 /*****************************************************************************/
 /******* Stuff below is ported, but only exists as stubs thus far ************/
 /*****************************************************************************/
@@ -1142,10 +1839,21 @@ func clen(n []byte) int {
 	return len(n)
 }
 
+// Mount is the Linux interface and has no Akaros equivalent; use Nmount
+// or Nbind to change the namespace.
 func Mount(source string, target string, fstype string, flags uintptr, data string) (err error) {
 	return NewAkaError(Errno(EINVAL), "Mount not ported")
 }
 
+// Unmount removes everything mounted or bound on target.  Akaros has no
+// unmount flags; any are rejected.
+func Unmount(target string, flags int) (err error) {
+	if flags != 0 {
+		return EINVAL
+	}
+	return Nunmount("", target)
+}
+
 // Sendto
 // Recvfrom
 // Socketpair
@@ -1153,29 +1861,22 @@ func Mount(source string, target string, fstype string, flags uintptr, data stri
 /*
  * Direct access
  */
-//sys	Access(path string, mode uint32) (err error)
 //sys	Acct(path string) (err error)
 //sys	Adjtimex(buf *Timex) (state int, err error)
 //sys	Chroot(path string) (err error)
-//sys	Creat(path string, mode uint32) (fd int, err error)
-//sys	Dup2(oldfd int, newfd int) (err error)
+//sys	dup2(oldfd int, newfd int) (err error) = SYS_DUP2
 //sys	EpollCreate(size int) (fd int, err error)
 //sys	EpollCreate1(flag int) (fd int, err error)
 //sys	EpollCtl(epfd int, op int, fd int, event *EpollEvent) (err error)
 //sys	EpollWait(epfd int, events []EpollEvent, msec int) (n int, err error)
-//sys	Faccessat(dirfd int, path string, mode uint32, flags int) (err error)
 //sys	Fallocate(fd int, mode uint32, off int64, len int64) (err error)
 //sys	Fchmodat(dirfd int, path string, mode uint32, flags int) (err error)
 //sys	Fchownat(dirfd int, path string, uid int, gid int, flags int) (err error)
-//sys	Fdatasync(fd int) (err error)
 //sys	Flock(fd int, how int) (err error)
-//sys	Fsync(fd int) (err error)
 //sys	Getpgid(pid int) (pgid int, err error)
 //sys	Getpgrp() (pid int)
-//sys	Getppid() (ppid int)
 //sys	Getpriority(which int, who int) (prio int, err error)
 //sys	Getrusage(who int, rusage *Rusage) (err error)
-//sys	Gettid() (tid int)
 //sys	Getxattr(path string, attr string, dest []byte) (sz int, err error)
 //sys	InotifyAddWatch(fd int, pathname string, mask uint32) (watchdesc int, err error)
 //sys	InotifyInit() (fd int, err error)
@@ -1191,7 +1892,6 @@ func Mount(source string, target string, fstype string, flags uintptr, data stri
 //sys	PivotRoot(newroot string, putold string) (err error) = SYS_PIVOT_ROOT
 //sys prlimit(pid int, resource int, old *Rlimit, newlimit *Rlimit) (err error) = SYS_PRLIMIT64
 //sys	Removexattr(path string, attr string) (err error)
-//sys	Renameat(olddirfd int, oldpath string, newdirfd int, newpath string) (err error)
 //sys	Setdomainname(p []byte) (err error)
 //sys	Sethostname(p []byte) (err error)
 //sys	Setpgid(pid int, pgid int) (err error)
@@ -1202,27 +1902,18 @@ func Mount(source string, target string, fstype string, flags uintptr, data stri
 func Setxattr(path string, attr string, data []byte, flags int) (err error) {
 	return NewAkaError(Errno(EINVAL), "Setxattr not ported")
 }
-//sys	Sync()
-//sys	Sysinfo(info *Sysinfo_t) (err error)
 //sys	Tee(rfd int, wfd int, len int, flags int) (n int64, err error)
 //sys	Tgkill(tgid int, tid int, sig Signal) (err error)
 //sys	Times(tms *Tms) (ticks uintptr, err error)
-//sys	Umask(mask int) (oldmask int)
 //sys	Uname(buf *Utsname) (err error)
 //sys	Unlinkat(dirfd int, path string) (err error)
-//sys	Unmount(target string, flags int) (err error) = SYS_UMOUNT2
 //sys	Unshare(flags int) (err error)
 //sys	Ustat(dev int, ubuf *Ustat_t) (err error)
 //sys	Utime(path string, buf *Utimbuf) (err error)
 //sys	exitThread(code int) (err error) = SYS_EXIT
 //sys	readlen(fd int, p *byte, np int) (n int, err error) = SYS_READ
 //sys	writelen(fd int, p *byte, np int) (n int, err error) = SYS_WRITE
-//sys	Madvise(b []byte, advice int) (err error)
 //sys	Mprotect(b []byte, prot int) (err error)
-//sys	Mlock(b []byte) (err error)
-//sys	Munlock(b []byte) (err error)
-//sys	Mlockall(flags int) (err error)
-//sys	Munlockall() (err error)
 
 /*
  * Unimplemented
@@ -1264,7 +1955,6 @@ func Setxattr(path string, attr string, data []byte, flags int) (err error) {
 // IoGetevents
 // IoSetup
 // IoSubmit
-// Ioctl
 // IoprioGet
 // IoprioSet
 // KexecLoad
@@ -1305,7 +1995,6 @@ func Setxattr(path string, attr string, data []byte, flags int) (err error) {
 // QueryModule
 // Quotactl
 // Readahead
-// Readv
 // RemapFilePages
 // RequestKey
 // RestartSyscall
@@ -4,10 +4,7 @@
 
 package syscall
 
-//sys	Chown(path string, uid int, gid int) (err error)
-//sys	Fchown(fd int, uid int, gid int) (err error)
 //sys	Fstatfs(fd int, buf *Statfs_t) (err error)
-//sys	Getrlimit(resource int, rlim *Rlimit) (err error)
 //sys	Ioperm(from int, num int, on int) (err error)
 //sys	Iopl(level int) (err error)
 //sys	Lchown(path string, uid int, gid int) (err error)
@@ -18,7 +15,6 @@ package syscall
 //sys	Setregid(rgid int, egid int) (err error)
 //sys	Setresgid(rgid int, egid int, sgid int) (err error)
 //sys	Setresuid(ruid int, euid int, suid int) (err error)
-//sys	Setrlimit(resource int, rlim *Rlimit) (err error)
 //sys	Setreuid(ruid int, euid int) (err error)
 //sys	Shutdown(fd int, how int) (err error)
 //sys	Splice(rfd int, roff *int64, wfd int, woff *int64, len int, flags int) (n int64, err error)
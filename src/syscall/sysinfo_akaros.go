@@ -0,0 +1,115 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+import "runtime/parlib"
+
+// Sysinfo fills in the fields of info that Akaros can supply: Uptime,
+// from the TSC, which the kernel starts at boot; Totalram and Freeram,
+// from #mem/free, in units of Unit (always 1) bytes; and Procs, the
+// number of processes in #proc.  Akaros keeps no load averages and has no
+// swap, so those fields are zero.
+func Sysinfo(info *Sysinfo_t) (err error) {
+	*info = Sysinfo_t{}
+	info.Uptime = runtimeNano() / 1e9
+	info.Unit = 1
+	total, free, err := memStats()
+	if err != nil {
+		return err
+	}
+	info.Totalram = total
+	info.Freeram = free
+	if n, err := countDir("#proc"); err == nil {
+		info.Procs = uint16(n)
+	}
+	return nil
+}
+
+// Vcores returns the number of vcores currently granted to the process
+// and the most it could be granted, which is the number of cores
+// available to it.
+func Vcores() (granted, max int) {
+	return int(parlib.Procinfo.Num_vcores), int(parlib.Procinfo.Max_vcores)
+}
+
+// memStats parses #mem/free, which holds lines like
+//
+//	Total Memory :      8589934592
+//	Free Memory  :      8286441472
+func memStats() (total, free uint64, err error) {
+	fd, err := Open("#mem/free", O_RDONLY, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer Close(fd)
+	var buf [512]byte
+	n, err := Read(fd, buf[:])
+	if err != nil {
+		return 0, 0, err
+	}
+	s := string(buf[:n])
+	for len(s) > 0 {
+		var line string
+		line, s = splitOn(s, '\n')
+		key, val := splitOn(line, ':')
+		v, ok := atou64(trimSpace(val))
+		if !ok {
+			continue
+		}
+		switch trimSpace(key) {
+		case "Total Memory":
+			total = v
+		case "Free Memory":
+			free = v
+		}
+	}
+	if total == 0 {
+		return 0, 0, NewAkaError(Errno(EINVAL), "#mem/free: no total")
+	}
+	return total, free, nil
+}
+
+func countDir(name string) (n int, err error) {
+	fd, err := Open(name, O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer Close(fd)
+	buf := make([]byte, 4096)
+	for {
+		nb, err := ReadDirent(fd, buf)
+		if err != nil {
+			return 0, err
+		}
+		if nb <= 0 {
+			return n, nil
+		}
+		_, c, _ := ParseDirent(buf[:nb], -1, nil)
+		n += c
+	}
+}
+
+func trimSpace(s string) string {
+	for len(s) > 0 && (s[0] == ' ' || s[0] == '\t') {
+		s = s[1:]
+	}
+	for len(s) > 0 && (s[len(s)-1] == ' ' || s[len(s)-1] == '\t' || s[len(s)-1] == '\r') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func atou64(s string) (v uint64, ok bool) {
+	if s == "" {
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		v = v*10 + uint64(s[i]-'0')
+	}
+	return v, true
+}
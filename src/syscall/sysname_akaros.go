@@ -0,0 +1,35 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+// Implemented in the runtime, which keeps the one copy of the table of
+// names generated from the kernel headers by mksysnum_akaros.pl.
+func syscallName(num uint32) string
+
+// SyscallName returns the kernel's name for system call num, such as
+// "read" for SYS_READ, or "syscall N" if the kernel the program was built
+// against has no call numbered num.  The numbers in sysnumstubs, which
+// stand in for Linux calls Akaros lacks, have no names.
+func SyscallName(num uintptr) string {
+	if num == uintptr(uint32(num)) {
+		if name := syscallName(uint32(num)); name != "" {
+			return name
+		}
+	}
+	return "syscall " + uitoa(uint(num))
+}
+
+// syscallError returns the error for system call num failing with errno
+// and the kernel's errstr.  A kernel that does not implement a call
+// leaves errstr empty, so the error names the call instead.
+func syscallError(num uint32, errno Errno, errstr string) error {
+	if errstr == "" {
+		if errno != ENOSYS {
+			return errnoError(errno)
+		}
+		errstr = SyscallName(uintptr(num)) + ": " + errno.Error()
+	}
+	return NewAkaError(errno, errstr)
+}
@@ -3,6 +3,10 @@
 // system call numbers as originally required by the linux port we derive
 // outselves from. As we continue porting the contants in here will start to
 // disappear. The contants are copied out of zsysnum_linux_386.go
+//
+// Every call the kernel does implement comes from zsysnum_akaros_386.go,
+// generated from the kernel headers, and has a name for SyscallName;
+// the numbers here have none.
 
 package syscall
 
@@ -0,0 +1,223 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// FD taps.
+//
+// An FD tap asks the kernel to post an event to an event queue whenever
+// a descriptor becomes readable, writable, hung up and so on: Akaros's
+// counterpart of an epoll registration.  A TapSet is a group of taps
+// sharing one EventQueue, like an epoll instance: Add, Modify and Remove
+// manage the taps and Wait collects what they report, coalesced per tap
+// as each tap's TapCoalesce asks.
+
+package syscall
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// Filter bits for TapSet.Add and TapEvent.
+const (
+	TapReadable = FDTAP_FILT_READABLE
+	TapWritable = FDTAP_FILT_WRITABLE
+	TapHangup   = FDTAP_FILT_HANGUP
+	TapError    = FDTAP_FILT_ERROR
+)
+
+// A TapEvent reports the conditions that hold for a tapped descriptor.
+type TapEvent struct {
+	Fd     int
+	Filter int // TapReadable, TapWritable, ...
+}
+
+// A TapSet is a set of FD taps reporting to one event queue.
+type TapSet struct {
+	q *EventQueue
+
+	mu   sync.Mutex
+	taps map[int]*fdTap
+}
+
+type fdTap struct {
+	filt int
+	c    tapCoalescer
+}
+
+// NewTapSet returns an empty tap set.
+func NewTapSet() (*TapSet, error) {
+	if !HasFeature(FeatureFdTaps) {
+		return nil, ENOSYS
+	}
+	q, err := NewEventQueue()
+	if err != nil {
+		return nil, err
+	}
+	s := &TapSet{q: q, taps: make(map[int]*fdTap)}
+	registerTapSet(s, true)
+	return s, nil
+}
+
+// Fd returns a descriptor that is readable while the kernel has events
+// for s waiting to be collected by Wait.
+func (s *TapSet) Fd() int {
+	return s.q.Fd()
+}
+
+// tapFds issues one FD tap request.  The event type of each event is
+// the tapped descriptor, so fd must fit in 16 bits.
+func (s *TapSet) tapFds(cmd, fd, filt int) error {
+	if fd < 0 || fd > 0xFFFF {
+		return EBADF
+	}
+	var r FdTapReq
+	r.Fd = int32(fd)
+	r.Cmd = int32(cmd)
+	r.Filter = int32(filt)
+	r.Ev_id = int32(fd)
+	*(*uintptr)(unsafe.Pointer(&r.Ev_q)) = s.q.Ptr()
+	var pin Pinner
+	n, _, e := Syscall(SYS_TAP_FDS, pin.Pin(unsafe.Pointer(&r)), 1, 0)
+	pin.Unpin()
+	if e != 0 {
+		return e
+	}
+	if n != 1 {
+		return EIO
+	}
+	return nil
+}
+
+// Add taps fd for the conditions in filt, with events coalesced as co
+// says.
+func (s *TapSet) Add(fd, filt int, co TapCoalesce) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.taps[fd] != nil {
+		return EEXIST
+	}
+	if err := s.tapFds(FDTAP_CMD_ADD, fd, filt); err != nil {
+		return err
+	}
+	s.taps[fd] = &fdTap{filt: filt, c: tapCoalescer{cfg: co}}
+	return nil
+}
+
+// Modify changes the conditions fd is tapped for to filt.
+func (s *TapSet) Modify(fd, filt int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.taps[fd]
+	if t == nil {
+		return ENOENT
+	}
+	if err := s.tapFds(FDTAP_CMD_MOD, fd, filt); err != nil {
+		return err
+	}
+	t.filt = filt
+	t.c.clear(^filt)
+	return nil
+}
+
+// Remove removes the tap on fd.  It must be called before fd is closed.
+func (s *TapSet) Remove(fd int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.taps[fd] == nil {
+		return ENOENT
+	}
+	delete(s.taps, fd)
+	return s.tapFds(FDTAP_CMD_REM, fd, 0)
+}
+
+// Clear tells s that the conditions in filt no longer hold for fd, for
+// instance because a read returned EAGAIN.  Taps with TapCoalesce.Level
+// report a condition until it is cleared.
+func (s *TapSet) Clear(fd, filt int) {
+	s.mu.Lock()
+	if t := s.taps[fd]; t != nil {
+		t.c.clear(filt)
+	}
+	s.mu.Unlock()
+}
+
+// Wait fills events with the taps that have something to report and
+// returns how many it filled.  It waits up to timeout nanoseconds for
+// the first, or forever if timeout is negative.
+func (s *TapSet) Wait(events []TapEvent, timeout int64) (n int, err error) {
+	var deadline int64
+	if timeout > 0 {
+		deadline = runtimeNano() + timeout
+	}
+	var m EventMsg
+	for {
+		for s.q.Next(&m) == nil {
+			s.post(&m)
+		}
+		n, at := s.collect(events)
+		if n > 0 || timeout == 0 || len(events) == 0 {
+			return n, nil
+		}
+		if deadline != 0 && (at == 0 || deadline < at) {
+			at = deadline
+		}
+		switch err := s.q.waitUntil(&m, at); err {
+		case nil:
+			s.post(&m)
+		case EAGAIN:
+			if at == deadline && deadline != 0 && runtimeNano() >= deadline {
+				return 0, nil
+			}
+		default:
+			return 0, err
+		}
+	}
+}
+
+// post records an event from the kernel.
+func (s *TapSet) post(m *EventMsg) {
+	s.mu.Lock()
+	if t := s.taps[int(m.Type)]; t != nil {
+		t.c.post(int(m.Arg2) & t.filt)
+	}
+	s.mu.Unlock()
+}
+
+// collect fills events with the taps due to report and returns how many
+// it filled and, if none is due, the earliest time one will be.
+func (s *TapSet) collect(events []TapEvent) (n int, at int64) {
+	now := runtimeNano()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for fd, t := range s.taps {
+		ok, when := t.c.due(now)
+		if !ok {
+			if when != 0 && (at == 0 || when < at) {
+				at = when
+			}
+			continue
+		}
+		if n == len(events) {
+			break
+		}
+		events[n] = TapEvent{Fd: fd, Filter: t.c.take(now)}
+		n++
+	}
+	if n > 0 {
+		at = 0
+	}
+	return n, at
+}
+
+// Close removes every tap in s and releases its event queue.
+func (s *TapSet) Close() error {
+	s.mu.Lock()
+	for fd := range s.taps {
+		s.tapFds(FDTAP_CMD_REM, fd, 0)
+	}
+	s.taps = nil
+	s.mu.Unlock()
+	registerTapSet(s, false)
+	return s.q.Close()
+}
@@ -0,0 +1,70 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// FD tap event coalescing.
+//
+// The kernel sends an event each time a tapped fd's state changes, so a
+// busy socket can fill an event queue by itself and delay the events of
+// every other fd on it.  Each tap therefore goes through a coalescer:
+// events for the tap that have not been collected yet are merged into
+// one, and a tap with a rate limit is not reported more often than the
+// limit allows, whatever the kernel sends in between.
+
+package syscall
+
+// A TapCoalesce configures how the events of one FD tap are reported.
+type TapCoalesce struct {
+	// Level reports a condition on every collection until the consumer
+	// says it has cleared, as with level-triggered epoll.  Otherwise a
+	// condition is reported once per change the kernel signals.
+	Level bool
+
+	// MaxRate is the most events per second reported for the tap, or 0
+	// for no limit.
+	MaxRate int
+}
+
+type tapCoalescer struct {
+	cfg     TapCoalesce
+	pending int   // filter bits signalled and not yet reported
+	ready   int   // in level mode, bits reported and not yet cleared
+	next    int64 // runtimeNano time before which nothing is reported
+}
+
+// post records that the kernel signalled the filter bits filt.
+func (c *tapCoalescer) post(filt int) {
+	c.pending |= filt
+}
+
+// due reports whether c has something to report at time now, and if not
+// but it will once the rate limit allows, when.
+func (c *tapCoalescer) due(now int64) (ok bool, at int64) {
+	if c.pending|c.ready == 0 {
+		return false, 0
+	}
+	if now < c.next {
+		return false, c.next
+	}
+	return true, 0
+}
+
+// take returns the filter bits to report at time now, which must be due,
+// and starts the next rate-limit interval.
+func (c *tapCoalescer) take(now int64) (filt int) {
+	filt = c.pending | c.ready
+	if c.cfg.Level {
+		c.ready = filt
+	}
+	c.pending = 0
+	if c.cfg.MaxRate > 0 {
+		c.next = now + 1e9/int64(c.cfg.MaxRate)
+	}
+	return filt
+}
+
+// clear tells a level-mode c that the conditions in filt no longer hold,
+// typically because a read or write returned EAGAIN.
+func (c *tapCoalescer) clear(filt int) {
+	c.ready &^= filt
+}
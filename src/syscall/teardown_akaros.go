@@ -0,0 +1,126 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Teardown before Exec.
+//
+// FD taps, event queues and asynchronous system calls all leave the
+// kernel holding addresses in this process's memory, which it writes to
+// whenever there is something to report.  Exec replaces that memory with
+// a new program's, so anything still registered would have the kernel
+// writing into pages that now belong to someone else.  Exec therefore
+// takes everything down first, once it has checked that the exec will go
+// ahead, in order: taps are removed so that nothing new is posted, calls
+// in flight are aborted and waited for, and then the event queues are
+// drained and freed.  Exit needs none of this: the kernel drops the
+// registrations along with the process.
+//
+// A program should close its own tap sets and queues before it execs, and
+// anything left over is a leak.  With GODEBUG=akarosleaks=1, teardown
+// reports what it had to clean up on standard error.
+
+package syscall
+
+import "sync"
+
+// teardownWait is how long, in nanoseconds, teardown waits for a call or
+// queue the kernel has not let go of yet.
+const teardownWait = 100e6
+
+var live struct {
+	sync.Mutex
+	taps   map[*TapSet]bool
+	queues map[*EventQueue]bool
+}
+
+func registerTapSet(s *TapSet, add bool) {
+	live.Lock()
+	if add {
+		if live.taps == nil {
+			live.taps = make(map[*TapSet]bool)
+		}
+		live.taps[s] = true
+	} else {
+		delete(live.taps, s)
+	}
+	live.Unlock()
+}
+
+func registerEventQueue(q *EventQueue, add bool) {
+	live.Lock()
+	if add {
+		if live.queues == nil {
+			live.queues = make(map[*EventQueue]bool)
+		}
+		live.queues[q] = true
+	} else {
+		delete(live.queues, q)
+	}
+	live.Unlock()
+}
+
+// teardown removes every registration the kernel holds on this process's
+// memory, before the process execs; why names the occasion.
+func teardown(why string) {
+	live.Lock()
+	taps := make([]*TapSet, 0, len(live.taps))
+	for s := range live.taps {
+		taps = append(taps, s)
+	}
+	queues := make([]*EventQueue, 0, len(live.queues))
+	for q := range live.queues {
+		queues = append(queues, q)
+	}
+	live.Unlock()
+	async.Lock()
+	calls := make([]*AsyncSyscall, 0, len(async.pending))
+	for _, c := range async.pending {
+		calls = append(calls, c)
+	}
+	async.Unlock()
+
+	if len(taps)+len(queues)+len(calls) > 0 && godebug("akarosleaks") > 0 {
+		msg := "syscall: " + why + " with " + itoa(len(taps)) + " tap sets, " +
+			itoa(len(queues)) + " event queues and " + itoa(len(calls)) +
+			" asynchronous calls still open\n"
+		write(2, []byte(msg))
+	}
+
+	deadline := runtimeNano() + teardownWait
+	for _, s := range taps {
+		s.Close()
+	}
+	for _, c := range calls {
+		c.Cancel()
+	}
+	for _, c := range calls {
+		waitClosed(c.done, deadline)
+	}
+	for _, q := range queues {
+		q.Close()
+	}
+	for _, q := range queues {
+		waitClosed(q.freed, deadline)
+	}
+}
+
+// waitClosed waits for c to be closed, giving up at runtimeNano time
+// deadline.
+func waitClosed(c chan struct{}, deadline int64) {
+	for {
+		select {
+		case <-c:
+			return
+		default:
+		}
+		if runtimeNano() >= deadline {
+			return
+		}
+		Block(100)
+	}
+}
+
+// godebug returns the value of key in GODEBUG, or 0.  The runtime parses
+// GODEBUG at start-up and keeps the variables package syscall reads in
+// its table alongside its own.
+func godebug(key string) int
@@ -0,0 +1,178 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Terminals.
+//
+// The only terminal on Akaros is the console, #cons, and its line
+// discipline has two states, switched by writing "rawon" or "rawoff" to
+// #cons/consctl: cooked, where the kernel echoes and edits whole lines,
+// and raw, where every byte is passed through as typed.  Tcgetattr and
+// Tcsetattr present that as termios: clearing ICANON or ECHO selects raw
+// mode and the other settings are kept but have no effect.  The console
+// leaves raw mode when the last descriptor open on consctl is closed, so
+// Tcsetattr keeps one open for as long as raw mode is on.  The console
+// has no size of its own; GetWinsize reports the one given by the
+// LINES and COLUMNS environment variables, or 24x80.
+
+package syscall
+
+import "sync"
+
+var console struct {
+	sync.Mutex
+	init bool
+	t    Termios
+	ws   Winsize
+	ctl  int // #cons/consctl, open while in raw mode; -1 otherwise
+}
+
+func consoleInit() {
+	if console.init {
+		return
+	}
+	console.init = true
+	console.ctl = -1
+	t := &console.t
+	t.Iflag = ICRNL | IXON
+	t.Oflag = OPOST | ONLCR
+	t.Cflag = CS8 | CREAD | B38400
+	t.Lflag = ISIG | ICANON | ECHO | ECHOE | ECHOK | IEXTEN
+	t.Cc[VMIN] = 1
+	console.ws = Winsize{Row: 24, Col: 80}
+	if s, ok := Getenv("LINES"); ok {
+		if n, ok := atoi(s); ok && n > 0 {
+			console.ws.Row = uint16(n)
+		}
+	}
+	if s, ok := Getenv("COLUMNS"); ok {
+		if n, ok := atoi(s); ok && n > 0 {
+			console.ws.Col = uint16(n)
+		}
+	}
+}
+
+// consoleDir returns the directory of the console device fd is open on,
+// or "" if fd is not open on the console.
+func consoleDir(fd int) string {
+	path, err := Fd2path(fd)
+	if err != nil {
+		return ""
+	}
+	i := len(path)
+	for i > 0 && path[i-1] != '/' {
+		i--
+	}
+	dir, name := path[:i], path[i:]
+	if dir != "#cons/" && dir != "/dev/" {
+		return ""
+	}
+	switch name {
+	case "cons", "stdin", "stdout", "stderr":
+		return dir
+	}
+	return ""
+}
+
+// IsTerminal reports whether fd is open on the console.
+func IsTerminal(fd int) bool {
+	return consoleDir(fd) != ""
+}
+
+// Tcgetattr returns the terminal settings of fd.
+func Tcgetattr(fd int, t *Termios) (err error) {
+	if !IsTerminal(fd) {
+		return ENOTTY
+	}
+	console.Lock()
+	consoleInit()
+	*t = console.t
+	console.Unlock()
+	return nil
+}
+
+// Tcsetattr changes the terminal settings of fd.  Every action takes
+// effect at once: the console has no output queue to drain or input to
+// flush.
+func Tcsetattr(fd int, action int, t *Termios) (err error) {
+	dir := consoleDir(fd)
+	if dir == "" {
+		return ENOTTY
+	}
+	switch action {
+	case TCSANOW, TCSADRAIN, TCSAFLUSH:
+	default:
+		return EINVAL
+	}
+	console.Lock()
+	defer console.Unlock()
+	consoleInit()
+	raw := t.Lflag&(ICANON|ECHO) != ICANON|ECHO
+	wasRaw := console.t.Lflag&(ICANON|ECHO) != ICANON|ECHO
+	switch {
+	case raw && !wasRaw:
+		cfd, err := Open(dir+"consctl", O_WRONLY|O_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		if _, err := Write(cfd, []byte("rawon")); err != nil {
+			Close(cfd)
+			return err
+		}
+		console.ctl = cfd
+	case !raw && wasRaw:
+		if _, err := Write(console.ctl, []byte("rawoff")); err != nil {
+			return err
+		}
+		Close(console.ctl)
+		console.ctl = -1
+	}
+	console.t = *t
+	return nil
+}
+
+// MakeRaw puts the terminal open on fd into raw mode and returns the
+// previous settings, for restoring with Tcsetattr.
+func MakeRaw(fd int) (old *Termios, err error) {
+	old = new(Termios)
+	if err = Tcgetattr(fd, old); err != nil {
+		return nil, err
+	}
+	t := *old
+	t.Iflag &^= IGNBRK | BRKINT | PARMRK | ISTRIP | INLCR | IGNCR | ICRNL | IXON
+	t.Oflag &^= OPOST
+	t.Lflag &^= ECHO | ECHONL | ICANON | ISIG | IEXTEN
+	t.Cflag &^= CSIZE | PARENB
+	t.Cflag |= CS8
+	t.Cc[VMIN] = 1
+	t.Cc[VTIME] = 0
+	if err = Tcsetattr(fd, TCSANOW, &t); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// GetWinsize returns the size of the terminal open on fd.
+func GetWinsize(fd int) (ws *Winsize, err error) {
+	if !IsTerminal(fd) {
+		return nil, ENOTTY
+	}
+	console.Lock()
+	consoleInit()
+	w := console.ws
+	console.Unlock()
+	return &w, nil
+}
+
+// SetWinsize records the size of the terminal open on fd, for instance
+// after the program at the other end of a serial line reports it.
+func SetWinsize(fd int, ws *Winsize) (err error) {
+	if !IsTerminal(fd) {
+		return ENOTTY
+	}
+	console.Lock()
+	consoleInit()
+	console.ws = *ws
+	console.Unlock()
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall
+
+import "runtime/parlib"
+
+func cpuTopology() (pcores, threadsPerCore, coresPerSocket int) // in runtime
+
+// A CPUTopology describes the cores the process may be granted.  The
+// Akaros kernel numbers pcores with hardware threads varying fastest, then
+// physical cores, then sockets; the shape comes from CPUID at startup.
+type CPUTopology struct {
+	Pcores         int // pcores the process may be granted
+	ThreadsPerCore int // hardware threads (SMT siblings) per physical core
+	CoresPerSocket int // physical cores per socket
+}
+
+// Topology returns the CPU topology the runtime found at startup.  Unless
+// the process runs on a single vcore, the runtime has already asked the
+// kernel for pcores in SpreadOrder.
+func Topology() CPUTopology {
+	p, t, c := cpuTopology()
+	return CPUTopology{Pcores: p, ThreadsPerCore: t, CoresPerSocket: c}
+}
+
+// PhysicalCores returns the number of physical cores among t.Pcores,
+// which is the most workers that can run without sharing a core.
+func (t CPUTopology) PhysicalCores() int {
+	return (t.Pcores + t.ThreadsPerCore - 1) / t.ThreadsPerCore
+}
+
+// Sockets returns the number of sockets t.Pcores span.
+func (t CPUTopology) Sockets() int {
+	n := t.ThreadsPerCore * t.CoresPerSocket
+	return (t.Pcores + n - 1) / n
+}
+
+// Locate returns where pcore sits: its socket, its physical core within
+// the socket and its hardware thread within the core.
+func (t CPUTopology) Locate(pcore int) (socket, core, thread int) {
+	thread = pcore % t.ThreadsPerCore
+	core = pcore / t.ThreadsPerCore % t.CoresPerSocket
+	socket = pcore / (t.ThreadsPerCore * t.CoresPerSocket)
+	return
+}
+
+// SpreadOrder returns the pcores in the order that puts work on every
+// physical core before any core's second hardware thread.
+func (t CPUTopology) SpreadOrder() []int {
+	order := make([]int, 0, t.Pcores)
+	for th := 0; th < t.ThreadsPerCore; th++ {
+		for p := th; p < t.Pcores; p += t.ThreadsPerCore {
+			order = append(order, p)
+		}
+	}
+	return order
+}
+
+// VcorePcore returns the pcore that vcore is currently running on, if it
+// is granted to the process.
+func VcorePcore(vcore int) (pcore int, ok bool) {
+	vm := &parlib.Procinfo.Vcoremap
+	if vcore < 0 || vcore >= len(vm) || !vm[vcore].Valid {
+		return 0, false
+	}
+	return int(vm[vcore].Pcoreid), true
+}
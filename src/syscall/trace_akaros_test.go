@@ -0,0 +1,47 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall_test
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestAkarosTrace(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") == "1" {
+		// Make the call from deep in the stack too, where the
+		// nosplit call path has little room left.
+		var deep func(int)
+		deep = func(n int) {
+			if n > 0 {
+				deep(n - 1)
+			}
+			syscall.Chdir("/akarostrace-test-missing")
+		}
+		deep(1000)
+		os.Exit(0)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAkarosTrace$")
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "GODEBUG=akarostrace=1"}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("child process: %v\n%s", err, out)
+	}
+	n := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.Contains(line, "] chdir(") {
+			if !strings.Contains(line, " errno ") || !strings.HasSuffix(line, "us>") {
+				t.Errorf("bad trace line %q", line)
+			}
+			n++
+		}
+	}
+	if n != 1001 {
+		t.Errorf("got %d chdir trace lines, want 1001; output:\n%s", n, out)
+	}
+}
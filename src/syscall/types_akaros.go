@@ -27,6 +27,7 @@ package syscall
 #include <netinet/in.h>
 #include <netinet/icmp6.h>
 #include <sys/un.h>
+#include <sys/ioctl.h>
 #include <sys/mman.h>
 #include <sys/stat.h>
 #include <sys/types.h>
@@ -36,6 +37,7 @@ package syscall
 #include <bits/sockaddr.h>
 #include <ros/glibc-asm/ioctls.h>
 #include <ros/event.h>
+#include <ros/fdtap.h>
 #include <ros/syscall.h>
 
 #define BIT8SZ      1
@@ -109,6 +111,18 @@ type Rusage C.struct_rusage
 
 type Rlimit C.struct_rlimit
 
+const (
+	RLIMIT_CPU    = C.RLIMIT_CPU
+	RLIMIT_FSIZE  = C.RLIMIT_FSIZE
+	RLIMIT_DATA   = C.RLIMIT_DATA
+	RLIMIT_STACK  = C.RLIMIT_STACK
+	RLIMIT_CORE   = C.RLIMIT_CORE
+	RLIMIT_NOFILE = C.RLIMIT_NOFILE
+	RLIMIT_AS     = C.RLIMIT_AS
+	RLIM_NLIMITS  = C.RLIM_NLIMITS
+	RLIM_INFINITY = C.RLIM_INFINITY
+)
+
 type _Gid_t C.gid_t
 
 // Files
@@ -121,6 +135,24 @@ type Dirent C.struct_dirent
 
 type Fsid C.fsid_t
 
+// FD taps
+
+type FdTapReq C.struct_fd_tap_req
+
+const (
+	FDTAP_CMD_ADD = C.FDTAP_CMD_ADD
+	FDTAP_CMD_REM = C.FDTAP_CMD_REM
+	FDTAP_CMD_MOD = C.FDTAP_CMD_MOD
+
+	FDTAP_FILT_READABLE = C.FDTAP_FILT_READABLE
+	FDTAP_FILT_WRITABLE = C.FDTAP_FILT_WRITABLE
+	FDTAP_FILT_WRITTEN  = C.FDTAP_FILT_WRITTEN
+	FDTAP_FILT_DELETED  = C.FDTAP_FILT_DELETED
+	FDTAP_FILT_ERROR    = C.FDTAP_FILT_ERROR
+	FDTAP_FILT_PRIORITY = C.FDTAP_FILT_PRIORITY
+	FDTAP_FILT_HANGUP   = C.FDTAP_FILT_HANGUP
+)
+
 const (
 	SEEK_SET = C.SEEK_SET
 	SEEK_CUR = C.SEEK_CUR
@@ -214,7 +246,40 @@ type Utsname C.struct_utsname
 type Ustat_t C.struct_ustat
 
 const (
-	_AT_FDCWD = C.AT_FDCWD
+	_AT_FDCWD            = C.AT_FDCWD
+	_AT_SYMLINK_NOFOLLOW = C.AT_SYMLINK_NOFOLLOW
+	_AT_EACCESS          = C.AT_EACCESS
+)
+
+const (
+	R_OK = C.R_OK
+	W_OK = C.W_OK
+	X_OK = C.X_OK
+)
+
+// Memory mapping
+
+const (
+	PROT_NONE  = C.PROT_NONE
+	PROT_READ  = C.PROT_READ
+	PROT_WRITE = C.PROT_WRITE
+	PROT_EXEC  = C.PROT_EXEC
+
+	MAP_SHARED    = C.MAP_SHARED
+	MAP_PRIVATE   = C.MAP_PRIVATE
+	MAP_FIXED     = C.MAP_FIXED
+	MAP_ANONYMOUS = C.MAP_ANONYMOUS
+	MAP_ANON      = C.MAP_ANONYMOUS
+	MAP_POPULATE  = C.MAP_POPULATE
+
+	MADV_NORMAL     = C.MADV_NORMAL
+	MADV_RANDOM     = C.MADV_RANDOM
+	MADV_SEQUENTIAL = C.MADV_SEQUENTIAL
+	MADV_WILLNEED   = C.MADV_WILLNEED
+	MADV_DONTNEED   = C.MADV_DONTNEED
+
+	MCL_CURRENT = C.MCL_CURRENT
+	MCL_FUTURE  = C.MCL_FUTURE
 )
 
 // Terminal handling
@@ -322,3 +387,20 @@ const (
 	TCGETS   = C.TCGETS
 	TCSETS   = C.TCSETS
 )
+
+// Requests that Ioctl carries out on any descriptor.
+const (
+	FIONBIO  = C.FIONBIO
+	FIOCLEX  = C.FIOCLEX
+	FIONCLEX = C.FIONCLEX
+)
+
+type Winsize C.struct_winsize
+
+const (
+	TCSETSW   = C.TCSETSW
+	TCSETSF   = C.TCSETSF
+	TCSANOW   = C.TCSANOW
+	TCSADRAIN = C.TCSADRAIN
+	TCSAFLUSH = C.TCSAFLUSH
+)
@@ -0,0 +1,90 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Vcore grants.
+//
+// An MCP's share of the machine is whatever vcores the kernel grants it,
+// and that changes while the program runs: the runtime asks for a vcore
+// per busy P, the kernel may grant fewer or revoke some for other
+// processes, and vcores with nothing to run go back to the kernel.
+// runtime.NumCPU reports the grant at the moment; WatchVcores reports
+// each change, so that a program can size its worker pools to the cores
+// it actually holds.
+
+package syscall
+
+import "sync"
+
+func vcoreWait(n int) int // in runtime
+
+var vcoreWatch struct {
+	sync.Mutex
+	chans   []chan int
+	n       int // last count seen, 0 until the first
+	started bool
+}
+
+// WatchVcores arranges for the number of vcores granted to the process
+// to be sent on c, first as it stands and then each time it changes.  The
+// runtime notices a change within a few milliseconds while the program
+// is busy.  Sends do not block: if c's buffer is full, the oldest count
+// in it is dropped to make room for the new one, so that the last count
+// received is always the current one.  c should be buffered.
+func WatchVcores(c chan int) {
+	if c == nil {
+		panic("syscall: WatchVcores using nil channel")
+	}
+	vcoreWatch.Lock()
+	defer vcoreWatch.Unlock()
+	vcoreWatch.chans = append(vcoreWatch.chans, c)
+	if vcoreWatch.n != 0 {
+		sendVcores(c, vcoreWatch.n)
+	}
+	if !vcoreWatch.started {
+		vcoreWatch.started = true
+		go watchVcores()
+	}
+}
+
+// StopWatchVcores stops sending vcore counts on c.
+func StopWatchVcores(c chan int) {
+	vcoreWatch.Lock()
+	defer vcoreWatch.Unlock()
+	for i, w := range vcoreWatch.chans {
+		if w == c {
+			vcoreWatch.chans = append(vcoreWatch.chans[:i], vcoreWatch.chans[i+1:]...)
+			return
+		}
+	}
+}
+
+func watchVcores() {
+	n := 0
+	for {
+		n = vcoreWait(n)
+		vcoreWatch.Lock()
+		vcoreWatch.n = n
+		for _, c := range vcoreWatch.chans {
+			sendVcores(c, n)
+		}
+		vcoreWatch.Unlock()
+	}
+}
+
+// sendVcores sends n on c, dropping older counts from c's buffer until
+// there is room.  The receiver may empty the buffer in the meantime, so
+// the send is retried rather than assumed to succeed.
+func sendVcores(c chan int, n int) {
+	for {
+		select {
+		case c <- n:
+			return
+		default:
+		}
+		select {
+		case <-c:
+		default:
+		}
+	}
+}
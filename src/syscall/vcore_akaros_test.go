@@ -0,0 +1,29 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syscall_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchVcores(t *testing.T) {
+	// A channel registered after the watcher has started still gets the
+	// count as it stands, without waiting for the grant to change.
+	for i := 0; i < 2; i++ {
+		c := make(chan int, 1)
+		syscall.WatchVcores(c)
+		defer syscall.StopWatchVcores(c)
+		select {
+		case n := <-c:
+			if n < 1 {
+				t.Errorf("watcher %d: got %d vcores, want at least 1", i, n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("watcher %d: no vcore count after 5s", i)
+		}
+	}
+}
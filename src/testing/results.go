@@ -0,0 +1,78 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Result channel.
+//
+// Where the platform provides one (see openResults), the test binary also
+// reports its progress on a separate channel back to the harness that
+// started it, one line per event, so that the harness can follow the run
+// even when the console loses or mangles output:
+//
+//	run NAME
+//	pass NAME NANOSECONDS OUTPUT
+//	fail NAME NANOSECONDS OUTPUT
+//	skip NAME NANOSECONDS OUTPUT
+//	exit CODE
+//
+// OUTPUT is the test's log as a Go quoted string.  Each line is written
+// with a single write, so lines from parallel tests do not interleave.
+
+package testing
+
+import (
+	"io"
+	"strconv"
+	"sync"
+)
+
+var results struct {
+	sync.Mutex
+	once sync.Once
+	w    io.Writer
+}
+
+func resultLine(b []byte) {
+	results.once.Do(func() { results.w = openResults() })
+	if results.w == nil {
+		return
+	}
+	results.Lock()
+	if _, err := results.w.Write(b); err != nil {
+		// The harness has gone away; stop telling it things.
+		results.w = nil
+	}
+	results.Unlock()
+}
+
+// resultRun reports that the test name is starting.
+func resultRun(name string) {
+	resultLine([]byte("run " + name + "\n"))
+}
+
+// resultDone reports the outcome of t.
+func resultDone(t *T) {
+	status := "pass"
+	if t.Failed() {
+		status = "fail"
+	} else if t.Skipped() {
+		status = "skip"
+	}
+	t.mu.RLock()
+	b := make([]byte, 0, 64+len(t.output))
+	b = append(b, status...)
+	b = append(b, ' ')
+	b = append(b, t.name...)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(t.duration), 10)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, string(t.output))
+	b = append(b, '\n')
+	t.mu.RUnlock()
+	resultLine(b)
+}
+
+// resultExit reports the exit code of the test binary.
+func resultExit(code int) {
+	resultLine([]byte("exit " + strconv.Itoa(code) + "\n"))
+}
@@ -488,15 +488,18 @@ func (m *M) Run() int {
 	if !testOk || !exampleOk {
 		fmt.Println("FAIL")
 		after()
+		resultExit(1)
 		return 1
 	}
 	fmt.Println("PASS")
 	RunBenchmarks(m.matchString, m.benchmarks)
 	after()
+	resultExit(0)
 	return 0
 }
 
 func (t *T) report() {
+	resultDone(t)
 	dstr := fmtDuration(t.duration)
 	format := "--- %s: %s (%s)\n%s"
 	if t.Failed() {
@@ -552,6 +555,7 @@ func RunTests(matchString func(pat, str string) (bool, error), tests []InternalT
 			if *chatty {
 				fmt.Printf("=== RUN %s\n", t.name)
 			}
+			resultRun(t.name)
 			go tRunner(t, &tests[i])
 			out := (<-t.signal).(*T)
 			if out == nil { // Parallel run.
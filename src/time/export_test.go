@@ -22,3 +22,14 @@ var (
 	ForceZipFileForTesting = forceZipFileForTesting
 	ParseTimeZone          = parseTimeZone
 )
+
+// GetMono returns t's monotonic clock reading, or 0 if it has none.
+func GetMono(t *Time) int64 {
+	return t.mono
+}
+
+// StepWallClock moves t's wall clock reading by sec seconds, leaving its
+// monotonic reading alone, as if the clock had been set.
+func StepWallClock(t *Time, sec int64) {
+	t.sec += sec
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package time_test
+
+import (
+	"testing"
+	. "time"
+)
+
+func TestMonotonicSub(t *testing.T) {
+	t1 := Now()
+	if GetMono(&t1) == 0 {
+		t.Fatalf("Now() has no monotonic clock reading")
+	}
+	t2 := t1.Add(Second)
+	// Step t2's wall clock back an hour, as if the clock were set
+	// between the two readings.
+	StepWallClock(&t2, -3600)
+	if d := t2.Sub(t1); d != Second {
+		t.Errorf("t2.Sub(t1) = %v, want 1s", d)
+	}
+	if !t2.After(t1) || t2.Before(t1) || t2.Equal(t1) {
+		t.Errorf("t2 does not compare after t1")
+	}
+	// Without the monotonic readings, the wall clock decides.
+	if d := t2.Round(0).Sub(t1); d != Second-Hour {
+		t.Errorf("t2.Round(0).Sub(t1) = %v, want %v", d, Second-Hour)
+	}
+	if d := t2.Sub(t1.Truncate(0)); d != Second-Hour {
+		t.Errorf("t2.Sub(t1.Truncate(0)) = %v, want %v", d, Second-Hour)
+	}
+}
+
+func TestMonotonicDropped(t *testing.T) {
+	t1 := Now()
+	tests := []struct {
+		name string
+		t    Time
+	}{
+		{"Round(0)", t1.Round(0)},
+		{"Truncate(Second)", t1.Truncate(Second)},
+		{"AddDate(0, 0, 1)", t1.AddDate(0, 0, 1)},
+		{"Unix", Unix(t1.Unix(), 0)},
+		{"Date", Date(2014, 12, 1, 0, 0, 0, 0, UTC)},
+	}
+	b, err := t1.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var t2 Time
+	if err := t2.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests, struct {
+		name string
+		t    Time
+	}{"UnmarshalBinary", t2})
+	for _, tt := range tests {
+		if GetMono(&tt.t) != 0 {
+			t.Errorf("%s kept the monotonic clock reading", tt.name)
+		}
+	}
+	for _, u := range []Time{t1.UTC(), t1.Local(), t1.In(FixedZone("", 3600)), t1.Add(-Hour)} {
+		if GetMono(&u) == 0 {
+			t.Errorf("%v lost the monotonic clock reading", u)
+		}
+	}
+}
+
+func TestMonotonicAddOverflow(t *testing.T) {
+	t1 := Now()
+	t2 := t1.Add(1<<63 - 1)
+	if m := GetMono(&t2); m != 0 {
+		t.Errorf("Add(maxDuration) kept an overflowed monotonic clock reading %d", m)
+	}
+	if d := t2.Sub(t1); d != 1<<63-1 {
+		t.Errorf("t1.Add(maxDuration).Sub(t1) = %v", d)
+	}
+}
@@ -36,6 +36,17 @@ import "errors"
 // without first guaranteeing that the identical Location has been set for all
 // values, which can be achieved through use of the UTC or Local method.
 //
+// Besides the wall clock reading, a Time returned by Now carries a reading
+// of the monotonic clock, which the runtime's timers also use and which is
+// never stepped.  When both times carry one, Sub, Since, Until, Before,
+// After and Equal use the monotonic readings, so that the intervals they
+// measure are not thrown off if the wall clock is set in between.  Add
+// keeps the monotonic reading, adjusted by the same duration; AddDate,
+// Round and Truncate are wall clock computations and drop it, so t.Round(0)
+// is the way to strip it.  The monotonic reading only has meaning within
+// the current process, and is not marshaled.  Because == compares it too,
+// two readings of the same instant are best compared with Equal.
+//
 type Time struct {
 	// sec gives the number of seconds elapsed since
 	// January 1, year 1 00:00:00 UTC.
@@ -52,15 +63,29 @@ type Time struct {
 	// Only the zero Time has a nil Location.
 	// In that case it is interpreted to mean UTC.
 	loc *Location
+
+	// mono is the monotonic clock reading, in nanoseconds since
+	// startNano, or 0 if there is none.
+	mono int64
 }
 
+// startNano is just before the first monotonic reading a process takes,
+// so that every reading is positive.
+var startNano = runtimeNano() - 1
+
 // After reports whether the time instant t is after u.
 func (t Time) After(u Time) bool {
+	if t.mono != 0 && u.mono != 0 {
+		return t.mono > u.mono
+	}
 	return t.sec > u.sec || t.sec == u.sec && t.nsec > u.nsec
 }
 
 // Before reports whether the time instant t is before u.
 func (t Time) Before(u Time) bool {
+	if t.mono != 0 && u.mono != 0 {
+		return t.mono < u.mono
+	}
 	return t.sec < u.sec || t.sec == u.sec && t.nsec < u.nsec
 }
 
@@ -70,6 +95,9 @@ func (t Time) Before(u Time) bool {
 // This comparison is different from using t == u, which also compares
 // the locations.
 func (t Time) Equal(u Time) bool {
+	if t.mono != 0 && u.mono != 0 {
+		return t.mono == u.mono
+	}
 	return t.sec == u.sec && t.nsec == u.nsec
 }
 
@@ -618,6 +646,13 @@ func (t Time) Add(d Duration) Time {
 		nsec += 1e9
 	}
 	t.nsec = nsec
+	if t.mono != 0 {
+		mono := t.mono + int64(d)
+		if d < 0 && mono > t.mono || d > 0 && mono < t.mono || mono == 0 {
+			mono = 0 // out of range; fall back to the wall clock
+		}
+		t.mono = mono
+	}
 	return t
 }
 
@@ -626,6 +661,16 @@ func (t Time) Add(d Duration) Time {
 // will be returned.
 // To compute t-d for a duration d, use t.Add(-d).
 func (t Time) Sub(u Time) Duration {
+	if t.mono != 0 && u.mono != 0 {
+		d := Duration(t.mono - u.mono)
+		switch {
+		case d < 0 && t.mono > u.mono:
+			return maxDuration
+		case d > 0 && t.mono < u.mono:
+			return minDuration
+		}
+		return d
+	}
 	d := Duration(t.sec-u.sec)*Second + Duration(int32(t.nsec)-int32(u.nsec))
 	// Check for overflow or underflow.
 	switch {
@@ -786,7 +831,7 @@ func now() (sec int64, nsec int32)
 // Now returns the current local time.
 func Now() Time {
 	sec, nsec := now()
-	return Time{sec + unixToInternal, nsec, Local}
+	return Time{sec + unixToInternal, nsec, Local, runtimeNano() - startNano}
 }
 
 // UTC returns t with the location set to UTC.
@@ -982,7 +1027,7 @@ func Unix(sec int64, nsec int64) Time {
 			sec--
 		}
 	}
-	return Time{sec + unixToInternal, int32(nsec), Local}
+	return Time{sec + unixToInternal, int32(nsec), Local, 0}
 }
 
 func isLeap(year int) bool {
@@ -1091,12 +1136,13 @@ func Date(year int, month Month, day, hour, min, sec, nsec int, loc *Location) T
 		unix -= int64(offset)
 	}
 
-	return Time{unix + unixToInternal, int32(nsec), loc}
+	return Time{unix + unixToInternal, int32(nsec), loc, 0}
 }
 
 // Truncate returns the result of rounding t down to a multiple of d (since the zero time).
-// If d <= 0, Truncate returns t unchanged.
+// If d <= 0, Truncate returns t unchanged but for dropping its monotonic clock reading.
 func (t Time) Truncate(d Duration) Time {
+	t.mono = 0
 	if d <= 0 {
 		return t
 	}
@@ -1106,8 +1152,9 @@ func (t Time) Truncate(d Duration) Time {
 
 // Round returns the result of rounding t to the nearest multiple of d (since the zero time).
 // The rounding behavior for halfway values is to round up.
-// If d <= 0, Round returns t unchanged.
+// If d <= 0, Round returns t unchanged but for dropping its monotonic clock reading.
 func (t Time) Round(d Duration) Time {
+	t.mono = 0
 	if d <= 0 {
 		return t
 	}